@@ -18,11 +18,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/api"
@@ -33,7 +35,16 @@ import (
 var (
 	fileStats, mode, pageSelection string
 	upw, opw, key, perm            string
-	verbose                        bool
+	keyFile, keyPW, recipients     string
+	scope                          string
+	target                         string
+	trustDir, tsaURL               string
+	angle                          string
+	pagesPerSheet, paper, margin   string
+	orientation, order             string
+	binding, creep                 string
+	incremental, verbose, jsonOut  bool
+	border, fit, fill              bool
 
 	needStackTrace = true
 )
@@ -44,17 +55,52 @@ func init() {
 	flag.StringVar(&fileStats, "stats", "", statsUsage)
 	flag.StringVar(&fileStats, "s", "", statsUsage)
 
-	modeUsage := "validate: strict|relaxed; extract: image|font|content|page; encrypt: rc4|aes"
+	modeUsage := "validate: strict|relaxed; extract: image|font|content|page; encrypt: rc4|aes; sign: pkcs7|cades|rfc3161; pages insert: before|after"
 	flag.StringVar(&mode, "mode", "", modeUsage)
 	flag.StringVar(&mode, "m", "", modeUsage)
 
-	keyUsage := "encrypt: 40|128"
+	targetUsage := "validate: spec version for strict mode: 1.7|2.0"
+	flag.StringVar(&target, "target", "", targetUsage)
+
+	incrementalUsage := "attach add/remove, stamp, watermark, rotate: write an incremental update"
+	flag.BoolVar(&incremental, "incremental", false, incrementalUsage)
+
+	keyUsage := "encrypt: 40|128|256"
 	flag.StringVar(&key, "key", "128", keyUsage)
+	flag.StringVar(&key, "keylength", "128", keyUsage)
 	flag.StringVar(&key, "k", "128", keyUsage)
 
-	permUsage := "encrypt, perm set: none|all"
+	permUsage := "encrypt, perm add: none|all or a comma separated list of print, print-high, modify, extract, extract-accessibility, annotate, fill-forms, assemble"
 	flag.StringVar(&perm, "perm", "none", permUsage)
 
+	scopeUsage := "encrypt: all|nometadata|attachments"
+	flag.StringVar(&scope, "scope", "all", scopeUsage)
+
+	recipientsUsage := "encrypt: a comma separated list of recipient certificate files, each optionally followed by :none, :all or :perm+perm..."
+	flag.StringVar(&recipients, "recipients", "", recipientsUsage)
+
+	flag.StringVar(&keyFile, "keyfile", "", "PKCS#12 or PEM file holding certificate and private key")
+	flag.StringVar(&keyPW, "keypw", "", "password for keyfile")
+
+	flag.StringVar(&trustDir, "trust", "", "directory holding trusted certificates")
+	flag.StringVar(&tsaURL, "tsa", "", "URL of a RFC 3161 time stamping authority")
+	flag.BoolVar(&jsonOut, "json", false, "report as JSON")
+
+	flag.StringVar(&angle, "angle", "", "rotate: clockwise rotation in degrees: 90|180|270")
+
+	flag.StringVar(&pagesPerSheet, "n", "", "nup: pages per sheet: 2|4|6|9|16")
+	flag.StringVar(&paper, "paper", "A4", "nup, booklet, resize: paper size, eg. A4, Letter or WxH")
+	flag.StringVar(&orientation, "orientation", "portrait", "nup: sheet orientation: portrait|landscape")
+	flag.StringVar(&order, "order", "ltr", "nup: page order: ltr (left to right)|ttb (top to bottom)")
+	flag.StringVar(&margin, "margin", "0", "nup: space around each page in points")
+	flag.BoolVar(&border, "border", false, "nup: draw a border around each page")
+
+	flag.StringVar(&binding, "binding", "left", "booklet: binding edge: left|right")
+	flag.StringVar(&creep, "creep", "0", "booklet: shift towards the fold per sheet in points")
+
+	flag.BoolVar(&fit, "fit", false, "resize: scale content to fit the paper (default)")
+	flag.BoolVar(&fill, "fill", false, "resize: scale content to fill the paper cropping it")
+
 	pageSelectionUsage := "a comma separated list of pages or page ranges, see pdfcpu help split/extract"
 	flag.StringVar(&pageSelection, "pages", "", pageSelectionUsage)
 	flag.StringVar(&pageSelection, "p", "", pageSelectionUsage)
@@ -77,6 +123,19 @@ func main() {
 	config.UserPW = upw
 	config.OwnerPW = opw
 
+	if keyFile != "" {
+		kp, err := pdfcpu.LoadKeyPair(keyFile, keyPW)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		config.KeyPair = kp
+	}
+
+	if tsaURL != "" {
+		config.Timestamper = pdfcpu.TSAClient{URL: tsaURL}
+	}
+
 	var cmd *api.Command
 
 	handleVersion(command)
@@ -87,28 +146,40 @@ func main() {
 	}
 
 	for k, v := range map[string]func(config *pdfcpu.Configuration) *api.Command{
-		"validate":  prepareValidateCommand,
-		"optimize":  prepareOptimizeCommand,
-		"o":         prepareOptimizeCommand,
-		"split":     prepareSplitCommand,
-		"s":         prepareSplitCommand,
-		"merge":     prepareMergeCommand,
-		"m":         prepareMergeCommand,
-		"extract":   prepareExtractCommand,
-		"ext":       prepareExtractCommand,
-		"trim":      prepareTrimCommand,
-		"t":         prepareTrimCommand,
-		"attach":    prepareAttachmentCommand,
-		"decrypt":   prepareDecryptCommand,
-		"d":         prepareDecryptCommand,
-		"dec":       prepareDecryptCommand,
-		"encrypt":   prepareEncryptCommand,
-		"enc":       prepareEncryptCommand,
-		"changeupw": prepareChangeUserPasswordCommand,
-		"changeopw": prepareChangeOwnerPasswordCommand,
-		"perm":      preparePermissionsCommand,
-		"stamp":     prepareAddStampsCommand,
-		"watermark": prepareAddWatermarksCommand,
+		"validate":   prepareValidateCommand,
+		"optimize":   prepareOptimizeCommand,
+		"o":          prepareOptimizeCommand,
+		"split":      prepareSplitCommand,
+		"s":          prepareSplitCommand,
+		"merge":      prepareMergeCommand,
+		"m":          prepareMergeCommand,
+		"extract":    prepareExtractCommand,
+		"ext":        prepareExtractCommand,
+		"trim":       prepareTrimCommand,
+		"t":          prepareTrimCommand,
+		"attach":     prepareAttachmentCommand,
+		"decrypt":    prepareDecryptCommand,
+		"d":          prepareDecryptCommand,
+		"dec":        prepareDecryptCommand,
+		"encrypt":    prepareEncryptCommand,
+		"enc":        prepareEncryptCommand,
+		"changeupw":  prepareChangeUserPasswordCommand,
+		"changeopw":  prepareChangeOwnerPasswordCommand,
+		"perm":       preparePermissionsCommand,
+		"stamp":      prepareAddStampsCommand,
+		"watermark":  prepareAddWatermarksCommand,
+		"revisions":  prepareRevisionsCommand,
+		"linearize":  prepareLinearizeCommand,
+		"sign":       prepareSignCommand,
+		"signatures": prepareSignaturesCommand,
+		"rotate":     prepareRotateCommand,
+		"r":          prepareRotateCommand,
+		"pages":      preparePagesCommand,
+		"nup":        prepareNUpCommand,
+		"booklet":    prepareBookletCommand,
+		"boxes":      prepareBoxesCommand,
+		"crop":       prepareCropCommand,
+		"resize":     prepareResizeCommand,
 	} {
 		if command == k {
 			cmd = v(config)
@@ -149,21 +220,32 @@ func helpString(topic string) string {
 		usageShort, usageLong string
 		usagePageSelection    bool
 	}{
-		"validate":  {usageValidate, usageLongValidate, false},
-		"optimize":  {usageOptimize, usageLongOptimize, false},
-		"split":     {usageSplit, usageLongSplit, false},
-		"merge":     {usageMerge, usageLongMerge, false},
-		"extract":   {usageValidate, usageLongValidate, false},
-		"trim":      {usageTrim, usageLongTrim, true},
-		"attach":    {usageAttach, usageLongAttach, false},
-		"perm":      {usagePerm, usageLongPerm, false},
-		"encrypt":   {usageEncrypt, usageLongEncrypt, false},
-		"decrypt":   {usageDecrypt, usageLongDecrypt, false},
-		"changeupw": {usageChangeUserPW, usageLongChangeUserPW, false},
-		"changeopw": {usageChangeOwnerPW, usageLongChangeOwnerPW, false},
-		"stamp":     {usageStamp, usageLongStamp, true},
-		"watermark": {usageWatermark, usageLongWatermark, true},
-		"version":   {usageVersion, usageLongVersion, false},
+		"validate":   {usageValidate, usageLongValidate, false},
+		"optimize":   {usageOptimize, usageLongOptimize, false},
+		"split":      {usageSplit, usageLongSplit, false},
+		"merge":      {usageMerge, usageLongMerge, false},
+		"extract":    {usageValidate, usageLongValidate, false},
+		"trim":       {usageTrim, usageLongTrim, true},
+		"attach":     {usageAttach, usageLongAttach, false},
+		"perm":       {usagePerm, usageLongPerm, false},
+		"encrypt":    {usageEncrypt, usageLongEncrypt, false},
+		"decrypt":    {usageDecrypt, usageLongDecrypt, false},
+		"changeupw":  {usageChangeUserPW, usageLongChangeUserPW, false},
+		"changeopw":  {usageChangeOwnerPW, usageLongChangeOwnerPW, false},
+		"stamp":      {usageStamp, usageLongStamp, true},
+		"watermark":  {usageWatermark, usageLongWatermark, true},
+		"revisions":  {usageRevisions, usageLongRevisions, false},
+		"linearize":  {usageLinearize, usageLongLinearize, false},
+		"sign":       {usageSign, usageLongSign, false},
+		"signatures": {usageSignatures, usageLongSignatures, false},
+		"rotate":     {usageRotate, usageLongRotate, true},
+		"pages":      {usagePages, usageLongPages, true},
+		"nup":        {usageNUp, usageLongNUp, true},
+		"booklet":    {usageBooklet, usageLongBooklet, true},
+		"boxes":      {usageBoxes, usageLongBoxes, true},
+		"crop":       {usageCrop, usageLongCrop, true},
+		"resize":     {usageResize, usageLongResize, true},
+		"version":    {usageVersion, usageLongVersion, false},
 	} {
 		if topic == k {
 			if v.usagePageSelection {
@@ -237,6 +319,42 @@ func parseFlagsAndGetCommand() (command string) {
 		i = 3
 	}
 
+	// The revisions command uses a subcommand and is therefore a special case => start flag processing after 3rd argument.
+	if command == "revisions" {
+		if len(os.Args) == 2 {
+			fmt.Fprintln(os.Stderr, usageRevisions)
+			os.Exit(1)
+		}
+		i = 3
+	}
+
+	// The signatures command uses a subcommand and is therefore a special case => start flag processing after 3rd argument.
+	if command == "signatures" {
+		if len(os.Args) == 2 {
+			fmt.Fprintln(os.Stderr, usageSignatures)
+			os.Exit(1)
+		}
+		i = 3
+	}
+
+	// The pages command uses a subcommand and is therefore a special case => start flag processing after 3rd argument.
+	if command == "pages" {
+		if len(os.Args) == 2 {
+			fmt.Fprintln(os.Stderr, usagePages)
+			os.Exit(1)
+		}
+		i = 3
+	}
+
+	// The boxes command uses a subcommand and is therefore a special case => start flag processing after 3rd argument.
+	if command == "boxes" {
+		if len(os.Args) == 2 {
+			fmt.Fprintln(os.Stderr, usageBoxes)
+			os.Exit(1)
+		}
+		i = 3
+	}
+
 	// Parse commandline flags.
 	err := flag.CommandLine.Parse(os.Args[i:])
 	if err != nil {
@@ -248,7 +366,18 @@ func parseFlagsAndGetCommand() (command string) {
 
 func process(cmd *api.Command) {
 
-	out, err := api.Process(cmd)
+	// Stop processing on interrupt without leaving partial output behind.
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	out, err := api.ProcessContext(c, cmd)
 
 	if err != nil {
 		if needStackTrace {
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/api"
 	"github.com/iPaladinLLC/pdfcpu/pkg/pdfcpu"
@@ -48,6 +50,15 @@ func prepareValidateCommand(config *pdfcpu.Configuration) *api.Command {
 		config.ValidationMode = pdfcpu.ValidationRelaxed
 	}
 
+	if target != "" {
+		if target != "1.7" && target != "2.0" {
+			fmt.Fprintf(os.Stderr, "%s\n\n", usageValidate)
+			os.Exit(1)
+		}
+		v, _ := pdfcpu.Version(target)
+		config.ValidationTarget = &v
+	}
+
 	return api.ValidateCommand(filenameIn, config)
 }
 
@@ -207,6 +218,8 @@ func prepareAddAttachmentsCommand(config *pdfcpu.Configuration) *api.Command {
 		filenames = append(filenames, arg)
 	}
 
+	config.Incremental = incremental
+
 	return api.AddAttachmentsCommand(filenameIn, filenames, config)
 }
 
@@ -229,6 +242,8 @@ func prepareRemoveAttachmentsCommand(config *pdfcpu.Configuration) *api.Command
 		filenames = append(filenames, arg)
 	}
 
+	config.Incremental = incremental
+
 	return api.RemoveAttachmentsCommand(filenameIn, filenames, config)
 }
 
@@ -304,10 +319,19 @@ func prepareListPermissionsCommand(config *pdfcpu.Configuration) *api.Command {
 	return api.ListPermissionsCommand(filenameIn, config)
 }
 
+func validPermissions() bool {
+	_, err := pdfcpu.ParsePermissionFlags(perm)
+	return err == nil
+}
+
+func permissions() int16 {
+	f, _ := pdfcpu.ParsePermissionFlags(perm)
+	return f.UserAccessPermissions()
+}
+
 func prepareAddPermissionsCommand(config *pdfcpu.Configuration) *api.Command {
 
-	if len(flag.Args()) != 1 || pageSelection != "" ||
-		!(perm == "" || perm == "none" || perm == "all") {
+	if len(flag.Args()) != 1 || pageSelection != "" || !validPermissions() {
 		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usagePermAdd)
 		os.Exit(1)
 	}
@@ -315,9 +339,7 @@ func prepareAddPermissionsCommand(config *pdfcpu.Configuration) *api.Command {
 	filenameIn := flag.Arg(0)
 	ensurePdfExtension(filenameIn)
 
-	if perm == "all" {
-		config.UserAccessPermissions = pdfcpu.PermissionsAll
-	}
+	config.UserAccessPermissions = permissions()
 
 	return api.AddPermissionsCommand(filenameIn, config)
 }
@@ -372,8 +394,40 @@ func prepareDecryptCommand(config *pdfcpu.Configuration) *api.Command {
 func validEncryptOptions() bool {
 	return pageSelection == "" &&
 		(mode == "" || mode == "rc4" || mode == "aes") &&
-		(key == "" || key == "40" || key == "128") &&
-		(perm == "" || perm == "none" || perm == "all")
+		(key == "" || key == "40" || key == "128" || key == "256" && mode != "rc4") &&
+		validPermissions() &&
+		(scope == "" || scope == "all" || scope == "nometadata" || scope == "attachments")
+}
+
+// parseRecipients parses a comma separated list of certificate files,
+// each optionally followed by :none, :all or :permission+permission...
+func parseRecipients(s string, defaultPermissions int16) ([]pdfcpu.Recipient, error) {
+
+	var rr []pdfcpu.Recipient
+
+	for _, v := range strings.Split(s, ",") {
+
+		fileName := strings.TrimSpace(v)
+		p := defaultPermissions
+
+		if i := strings.LastIndex(fileName, ":"); i > 0 {
+			if f, err := pdfcpu.ParsePermissionFlags(strings.Replace(fileName[i+1:], "+", ",", -1)); err == nil {
+				p = f.UserAccessPermissions()
+				fileName = fileName[:i]
+			}
+		}
+
+		certs, err := pdfcpu.LoadCertificates(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cert := range certs {
+			rr = append(rr, pdfcpu.Recipient{Cert: cert, Permissions: p})
+		}
+	}
+
+	return rr, nil
 }
 
 func prepareEncryptCommand(config *pdfcpu.Configuration) *api.Command {
@@ -391,8 +445,26 @@ func prepareEncryptCommand(config *pdfcpu.Configuration) *api.Command {
 		config.EncryptUsing128BitKey = false
 	}
 
-	if perm == "all" {
-		config.UserAccessPermissions = pdfcpu.PermissionsAll
+	if key == "256" {
+		config.EncryptUsing256BitKey = true
+	}
+
+	config.UserAccessPermissions = permissions()
+
+	switch scope {
+	case "nometadata":
+		config.UnencryptedMetadata = true
+	case "attachments":
+		config.EncryptEmbeddedFilesOnly = true
+	}
+
+	if recipients != "" {
+		rr, err := parseRecipients(recipients, config.UserAccessPermissions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		config.Recipients = rr
 	}
 
 	filenameIn := flag.Arg(0)
@@ -486,6 +558,8 @@ func prepareWatermarksCommand(config *pdfcpu.Configuration, onTop bool) *api.Com
 		ensurePdfExtension(filenameOut)
 	}
 
+	config.Incremental = incremental
+
 	return api.AddWatermarksCommand(filenameIn, filenameOut, pages, wm, config)
 }
 
@@ -496,3 +570,576 @@ func prepareAddStampsCommand(config *pdfcpu.Configuration) *api.Command {
 func prepareAddWatermarksCommand(config *pdfcpu.Configuration) *api.Command {
 	return prepareWatermarksCommand(config, false)
 }
+
+func prepareLinearizeCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) == 0 || len(flag.Args()) > 2 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageLinearize)
+		os.Exit(1)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 2 {
+		filenameOut = flag.Arg(1)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.LinearizeCommand(filenameIn, filenameOut, config)
+}
+
+func prepareRotateCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) == 0 || len(flag.Args()) > 2 || angle == "" {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageRotate)
+		os.Exit(1)
+	}
+
+	rotation, err := strconv.Atoi(angle)
+	if err != nil || rotation == 0 || !pdfcpu.ValidRotation(rotation) {
+		log.Fatalf("rotate: angle must be one of 90, 180, 270: %s", angle)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("rotate: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 2 {
+		filenameOut = flag.Arg(1)
+		ensurePdfExtension(filenameOut)
+	}
+
+	config.Incremental = incremental
+
+	return api.RotateCommand(filenameIn, filenameOut, pages, rotation, config)
+}
+
+func prepareInsertPagesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	args := flag.Args()
+
+	// The description is optional.
+	desc := ""
+	if len(args) > 0 && !strings.HasSuffix(strings.ToLower(args[0]), ".pdf") {
+		desc, args = args[0], args[1:]
+	}
+
+	if len(args) == 0 || len(args) > 2 || mode != "" && mode != "before" && mode != "after" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usagePagesInsert)
+		os.Exit(1)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("pages insert: problem with flag pageSelection: %v", err)
+	}
+
+	mediaBox, err := pdfcpu.ParseMediaBox(desc)
+	if err != nil {
+		log.Fatalf("pages insert: %v", err)
+	}
+
+	filenameIn := args[0]
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(args) == 2 {
+		filenameOut = args[1]
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.InsertPagesCommand(filenameIn, filenameOut, pages, mode != "after", mediaBox, config)
+}
+
+func prepareRemovePagesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) == 0 || len(flag.Args()) > 2 || pageSelection == "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usagePagesRemove)
+		os.Exit(1)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("pages remove: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 2 {
+		filenameOut = flag.Arg(1)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.RemovePagesCommand(filenameIn, filenameOut, pages, config)
+}
+
+func prepareMovePagesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 2 || len(flag.Args()) > 3 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usagePagesMove)
+		os.Exit(1)
+	}
+
+	order, err := api.ParsePageOrder(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("pages move: %v", err)
+	}
+
+	filenameIn := flag.Arg(1)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 3 {
+		filenameOut = flag.Arg(2)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.MovePagesCommand(filenameIn, filenameOut, order, config)
+}
+
+func preparePagesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(os.Args) == 2 {
+		fmt.Fprintln(os.Stderr, usagePages)
+		os.Exit(1)
+	}
+
+	var cmd *api.Command
+
+	subCmd := os.Args[2]
+
+	switch subCmd {
+
+	case "insert":
+		cmd = prepareInsertPagesCommand(config)
+
+	case "remove":
+		cmd = prepareRemovePagesCommand(config)
+
+	case "move":
+		cmd = prepareMovePagesCommand(config)
+
+	default:
+		fmt.Fprintln(os.Stderr, usagePages)
+		os.Exit(1)
+	}
+
+	return cmd
+}
+
+func prepareNUpCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 2 || pagesPerSheet == "" {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageNUp)
+		os.Exit(1)
+	}
+
+	nup := pdfcpu.DefaultNUpConfig()
+
+	n, err := strconv.Atoi(pagesPerSheet)
+	if err != nil || !pdfcpu.ValidNUp(n) {
+		log.Fatalf("nup: n must be one of 2, 4, 6, 9, 16: %s", pagesPerSheet)
+	}
+	nup.N = n
+
+	d, err := pdfcpu.ParsePaperSize(paper)
+	if err != nil {
+		log.Fatalf("nup: %v", err)
+	}
+	nup.Paper = *d
+
+	switch orientation {
+	case "portrait":
+	case "landscape":
+		nup.Landscape = true
+	default:
+		log.Fatalf("nup: orientation must be portrait or landscape: %s", orientation)
+	}
+
+	nup.Order, err = pdfcpu.ParseNUpOrder(order)
+	if err != nil {
+		log.Fatalf("nup: %v", err)
+	}
+
+	nup.Margin, err = strconv.ParseFloat(margin, 64)
+	if err != nil || nup.Margin < 0 {
+		log.Fatalf("nup: margin must be a non negative number: %s", margin)
+	}
+
+	nup.Border = border
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("nup: problem with flag pageSelection: %v", err)
+	}
+
+	// The last argument is the output file.
+	args := flag.Args()
+	filenamesIn, filenameOut := args[:len(args)-1], args[len(args)-1]
+	ensurePdfExtension(filenameOut)
+
+	if strings.HasSuffix(strings.ToLower(filenamesIn[0]), ".pdf") && len(filenamesIn) > 1 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageNUp)
+		os.Exit(1)
+	}
+
+	return api.NUpCommand(filenamesIn, filenameOut, pages, nup, config)
+}
+
+func prepareBookletCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) == 0 || len(flag.Args()) > 2 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageBooklet)
+		os.Exit(1)
+	}
+
+	bl := pdfcpu.DefaultBookletConfig()
+
+	d, err := pdfcpu.ParsePaperSize(paper)
+	if err != nil {
+		log.Fatalf("booklet: %v", err)
+	}
+	bl.Paper = *d
+
+	bl.Binding, err = pdfcpu.ParseBindingEdge(binding)
+	if err != nil {
+		log.Fatalf("booklet: %v", err)
+	}
+
+	bl.Creep, err = strconv.ParseFloat(creep, 64)
+	if err != nil || bl.Creep < 0 {
+		log.Fatalf("booklet: creep must be a non negative number: %s", creep)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("booklet: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 2 {
+		filenameOut = flag.Arg(1)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.BookletCommand(filenameIn, filenameOut, pages, bl, config)
+}
+
+func prepareListBoxesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usageBoxesList)
+		os.Exit(1)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("boxes list: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	return api.ListBoxesCommand(filenameIn, pages, config)
+}
+
+func prepareSetBoxesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 2 || len(flag.Args()) > 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n\n", usageBoxesSet)
+		os.Exit(1)
+	}
+
+	boxes, err := pdfcpu.ParseBoxes(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("boxes set: %v", err)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("boxes set: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(1)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 3 {
+		filenameOut = flag.Arg(2)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.SetBoxesCommand(filenameIn, filenameOut, pages, boxes, config)
+}
+
+func prepareBoxesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(os.Args) == 2 {
+		fmt.Fprintln(os.Stderr, usageBoxes)
+		os.Exit(1)
+	}
+
+	var cmd *api.Command
+
+	subCmd := os.Args[2]
+
+	switch subCmd {
+
+	case "list":
+		cmd = prepareListBoxesCommand(config)
+
+	case "set":
+		cmd = prepareSetBoxesCommand(config)
+
+	default:
+		fmt.Fprintln(os.Stderr, usageBoxes)
+		os.Exit(1)
+	}
+
+	return cmd
+}
+
+func prepareCropCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 2 || len(flag.Args()) > 3 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageCrop)
+		os.Exit(1)
+	}
+
+	cropBox, err := pdfcpu.ParseBox("crop", flag.Arg(0))
+	if err != nil {
+		log.Fatalf("crop: %v", err)
+	}
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("crop: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(1)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 3 {
+		filenameOut = flag.Arg(2)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.CropCommand(filenameIn, filenameOut, pages, cropBox, config)
+}
+
+func prepareResizeCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) == 0 || len(flag.Args()) > 2 || (fit && fill) {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageResize)
+		os.Exit(1)
+	}
+
+	rs := pdfcpu.DefaultResizeConfig()
+
+	d, err := pdfcpu.ParsePaperSize(paper)
+	if err != nil {
+		log.Fatalf("resize: %v", err)
+	}
+	rs.Paper = *d
+	rs.Fill = fill
+
+	pages, err := api.ParsePageSelection(pageSelection)
+	if err != nil {
+		log.Fatalf("resize: problem with flag pageSelection: %v", err)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(flag.Args()) == 2 {
+		filenameOut = flag.Arg(1)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.ResizeCommand(filenameIn, filenameOut, pages, rs, config)
+}
+
+func prepareSignCommand(config *pdfcpu.Configuration) *api.Command {
+
+	args := flag.Args()
+
+	// The description is optional.
+	desc := ""
+	if len(args) > 0 && !strings.HasSuffix(strings.ToLower(args[0]), ".pdf") {
+		desc, args = args[0], args[1:]
+	}
+
+	if len(args) == 0 || len(args) > 2 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageSign)
+		os.Exit(1)
+	}
+
+	sig, err := pdfcpu.ParseSignatureDetails(desc)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	switch mode {
+	case "", "pkcs7":
+		sig.SubFilter = pdfcpu.SubFilterPKCS7Detached
+	case "cades":
+		sig.SubFilter = pdfcpu.SubFilterCAdESDetached
+	case "rfc3161":
+		sig.SubFilter = pdfcpu.SubFilterRFC3161
+	default:
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageSign)
+		os.Exit(1)
+	}
+
+	// Document timestamps come from a TSA, signatures need a key pair.
+	if sig.SubFilter == pdfcpu.SubFilterRFC3161 && config.Timestamper == nil ||
+		sig.SubFilter != pdfcpu.SubFilterRFC3161 && config.KeyPair == nil {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageSign)
+		os.Exit(1)
+	}
+
+	filenameIn := args[0]
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := defaultFilenameOut(filenameIn)
+	if len(args) == 2 {
+		filenameOut = args[1]
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.SignCommand(filenameIn, filenameOut, sig, config)
+}
+
+func prepareListRevisionsCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) != 1 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageRevisionsList)
+		os.Exit(1)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	return api.ListRevisionsCommand(filenameIn, config)
+}
+
+func prepareExtractRevisionCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 2 || len(flag.Args()) > 3 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageRevisionsExtract)
+		os.Exit(1)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	revision, err := strconv.Atoi(flag.Arg(1))
+	if err != nil || revision < 1 {
+		log.Fatalf("revision must be a positive number: %s", flag.Arg(1))
+	}
+
+	filenameOut := filenameIn[:len(filenameIn)-4] + "_rev" + flag.Arg(1) + ".pdf"
+	if len(flag.Args()) == 3 {
+		filenameOut = flag.Arg(2)
+		ensurePdfExtension(filenameOut)
+	}
+
+	return api.ExtractRevisionCommand(filenameIn, filenameOut, revision, config)
+}
+
+func prepareRevisionsCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(os.Args) == 2 {
+		fmt.Fprintln(os.Stderr, usageRevisions)
+		os.Exit(1)
+	}
+
+	var cmd *api.Command
+
+	subCmd := os.Args[2]
+
+	switch subCmd {
+
+	case "list":
+		cmd = prepareListRevisionsCommand(config)
+
+	case "extract":
+		cmd = prepareExtractRevisionCommand(config)
+
+	default:
+		fmt.Fprintln(os.Stderr, usageRevisions)
+		os.Exit(1)
+	}
+
+	return cmd
+}
+
+func prepareVerifySignaturesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) != 1 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageSignaturesVerify)
+		os.Exit(1)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	return api.VerifySignaturesCommand(filenameIn, trustDir, jsonOut, config)
+}
+
+func prepareAddDSSCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(flag.Args()) < 3 || pageSelection != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageSignaturesDSS)
+		os.Exit(1)
+	}
+
+	filenameIn := flag.Arg(0)
+	ensurePdfExtension(filenameIn)
+
+	filenameOut := flag.Arg(1)
+	ensurePdfExtension(filenameOut)
+
+	return api.AddDSSCommand(filenameIn, filenameOut, flag.Args()[2:], config)
+}
+
+func prepareSignaturesCommand(config *pdfcpu.Configuration) *api.Command {
+
+	if len(os.Args) == 2 {
+		fmt.Fprintln(os.Stderr, usageSignatures)
+		os.Exit(1)
+	}
+
+	var cmd *api.Command
+
+	subCmd := os.Args[2]
+
+	switch subCmd {
+
+	case "verify":
+		cmd = prepareVerifySignaturesCommand(config)
+
+	case "dss":
+		cmd = prepareAddDSSCommand(config)
+
+	default:
+		fmt.Fprintln(os.Stderr, usageSignatures)
+		os.Exit(1)
+	}
+
+	return cmd
+}
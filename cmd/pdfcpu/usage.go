@@ -25,7 +25,7 @@ Usage:
 		
 The commands are:
 	
-	validate	validate PDF against PDF 32000-1:2008 (PDF 1.7)
+	validate	validate PDF against PDF 32000-1:2008 (PDF 1.7) or PDF 32000-2:2017 (PDF 2.0)
 	optimize	optimize PDF by getting rid of redundant page resources
 	split		split multi-page PDF into several single-page PDFs
 	merge		concatenate 2 or more PDFs
@@ -33,31 +33,48 @@ The commands are:
 	trim		create trimmed version
 	attach		list, add, remove, extract embedded file attachments
 	perm		list, add user access permissions
-	encrypt		set password protection		
-	decrypt		remove password protection
+	encrypt		set password protection or encrypt for recipient certificates
+	decrypt		remove password protection or public-key security
 	changeupw	change user password
 	changeopw	change owner password
 	stamp		add stamps
 	watermark	add watermarks
+	revisions	list, extract revisions of incrementally updated PDFs
+	linearize	optimize PDF for fast web view
+	rotate		rotate pages
+	pages		insert, remove, move pages
+	nup		rearrange pages or images for reduced number of sheets
+	booklet		impose pages for saddle-stitch printing
+	boxes		list, set page boundaries
+	crop		set crop box
+	resize		scale pages to a paper size
+	sign		add a digital signature
+	signatures	verify digital signatures, add long-term validation data
 	version		print version
    
 	Single-letter Unix-style supported for commands and flags.
 
 Use "pdfcpu help [command]" for more information about a command.`
 
-	usageValidate     = "usage: pdfcpu validate [-verbose] [-mode strict|relaxed] [-upw userpw] [-opw ownerpw] inFile"
+	usageValidate     = "usage: pdfcpu validate [-verbose] [-mode strict|relaxed] [-target 1.7|2.0] [-upw userpw] [-opw ownerpw] inFile"
 	usageLongValidate = `Validate checks inFile for specification compliance.
 
 verbose ... extensive log output
    mode ... validation mode
+ target ... spec version to validate against in strict mode (default=version of inFile)
     upw ... user password
     opw ... owner password
  inFile ... input pdf file
 		
 The validation modes are:
 
- strict ... (default) validates against PDF 32000-1:2008 (PDF 1.7)
-relaxed ... like strict but doesn't complain about common seen spec violations.`
+ strict ... (default) validates against PDF 32000-1:2008 (PDF 1.7) or PDF 32000-2:2017 (PDF 2.0)
+relaxed ... like strict but doesn't complain about common seen spec violations.
+
+The targets are:
+
+    1.7 ... PDF 32000-1:2008, rejects PDF 2.0 features
+    2.0 ... PDF 32000-2:2017, rejects features deprecated by PDF 2.0`
 
 	usageOptimize     = "usage: pdfcpu optimize [-verbose] [-stats csvFile] [-upw userpw] [-opw ownerpw] inFile [outFile]"
 	usageLongOptimize = `Optimize reads inFile, removes redundant page resources like embedded fonts and images and writes the result to outFile.
@@ -132,8 +149,8 @@ outFile ... output pdf file (default: inFile-new.pdf)`
 e.g. -3,5,7- or 4-7,!6 or 1-,!5 or odd,n1`
 
 	usageAttachList    = "pdfcpu attach list [-verbose] [-upw userpw] [-opw ownerpw] inFile"
-	usageAttachAdd     = "pdfcpu attach add [-verbose] [-upw userpw] [-opw ownerpw] inFile file..."
-	usageAttachRemove  = "pdfcpu attach remove [-verbose] [-upw userpw] [-opw ownerpw] inFile [file...]"
+	usageAttachAdd     = "pdfcpu attach add [-verbose] [-incremental] [-upw userpw] [-opw ownerpw] inFile file..."
+	usageAttachRemove  = "pdfcpu attach remove [-verbose] [-incremental] [-upw userpw] [-opw ownerpw] inFile [file...]"
 	usageAttachExtract = "pdfcpu attach extract [-verbose] [-upw userpw] [-opw ownerpw] inFile outDir [file...]"
 
 	usageAttach = "usage: " + usageAttachList +
@@ -143,15 +160,16 @@ e.g. -3,5,7- or 4-7,!6 or 1-,!5 or odd,n1`
 
 	usageLongAttach = `Attach manages embedded file attachments.
 	
-verbose ... extensive log output
-   perm ... user access permissions
-    upw ... user password
-    opw ... owner password
- inFile ... input pdf file
- outDir ... output directory`
+    verbose ... extensive log output
+incremental ... append changes to inFile keeping existing signatures valid
+       perm ... user access permissions
+        upw ... user password
+        opw ... owner password
+     inFile ... input pdf file
+     outDir ... output directory`
 
 	usagePermList = "pdfcpu perm list [-verbose] [-upw userpw] [-opw ownerpw] inFile"
-	usagePermAdd  = "pdfcpu perm add [-verbose] [-perm none|all] [-upw userpw] -opw ownerpw inFile"
+	usagePermAdd  = "pdfcpu perm add [-verbose] [-perm none|all|perm,...] [-upw userpw] -opw ownerpw inFile"
 
 	usagePerm = "usage: " + usagePermList +
 		"\n       " + usagePermAdd
@@ -159,29 +177,54 @@ verbose ... extensive log output
 	usageLongPerm = `Perm manages user access permissions.
 	
 verbose ... extensive log output
-   perm ... user access permissions
+   perm ... user access permissions (default=none)
     upw ... user password
     opw ... owner password
- inFile ... input pdf file`
+ inFile ... input pdf file
 
-	usageEncrypt     = "usage: pdfcpu encrypt [-verbose] [-mode rc4|aes] [-key 40|128] [perm none|all] [-upw userpw] [-opw ownerpw] inFile [outFile]"
-	usageLongEncrypt = `Encrypt sets a password protection based on user and owner password.
+` + usagePermissions
 
-verbose ... extensive log output
-   mode ... algorithm (default=aes)
-    key ... key length in bits (default=128)
-   perm ... user access permissions
-    upw ... user password
-    opw ... owner password
- inFile ... input pdf file
-outFile ... output pdf file`
+	usagePermissions = `Permissions may be combined, eg. -perm print,fill-forms
+
+                print ... print, possibly not at the highest quality level
+           print-high ... print at the highest quality level
+               modify ... modify contents other than by annotate, fill-forms and assemble
+              extract ... copy or extract text and graphics
+extract-accessibility ... extract text and graphics in support of accessibility
+             annotate ... add or modify annotations, fill in form fields
+           fill-forms ... fill in existing form fields including signature fields
+             assemble ... insert, rotate or delete pages, create bookmarks or thumbnails
+
+40 bit keys (security handler revision 2) only know about print, modify, extract and annotate.
+There print-high maps to print, assemble to modify, extract-accessibility to extract
+and fill-forms to annotate.`
+
+	usageEncrypt     = "usage: pdfcpu encrypt [-verbose] [-mode rc4|aes] [-key 40|128|256] [-perm none|all|perm,...] [-scope all|nometadata|attachments] [-upw userpw] [-opw ownerpw] [-recipients cert[:none|all|perm+...],...] inFile [outFile]"
+	usageLongEncrypt = `Encrypt sets a password protection based on user and owner password
+or encrypts for a list of recipient certificates (public-key security, requires key 128|256).
+
+   verbose ... extensive log output
+      mode ... algorithm (default=aes)
+       key ... key length in bits (default=128), 256 requires aes, alias: keylength
+      perm ... user access permissions (default=none), the default for recipients
+     scope ... what to encrypt (default=all), nometadata leaves XMP metadata readable,
+               attachments encrypts embedded files only, both require key 128|256
+       upw ... user password
+       opw ... owner password
+recipients ... comma separated list of PEM or DER certificate files, each optionally followed by its permissions
+    inFile ... input pdf file
+   outFile ... output pdf file
+
+` + usagePermissions
 
-	usageDecrypt     = "usage: pdfcpu decrypt [-verbose] [-upw userpw] [-opw ownerpw] inFile [outFile]"
-	usageLongDecrypt = `Decrypt removes a password protection.
+	usageDecrypt     = "usage: pdfcpu decrypt [-verbose] [-upw userpw] [-opw ownerpw] [-keyfile file [-keypw password]] inFile [outFile]"
+	usageLongDecrypt = `Decrypt removes a password protection or a public-key security.
 
 verbose ... extensive log output
     upw ... user password
     opw ... owner password
+keyfile ... PKCS#12 or PEM file holding a recipient certificate along with its private key
+  keypw ... password protecting keyfile
  inFile ... input pdf file
 outFile ... output pdf file`
 
@@ -229,10 +272,11 @@ e.g. 'Draft'                                                  'logo.png'
      'Intentionally left blank, p:48'
      'Confidental, f:Courier, s:0.75, c: 0.5 0.0 0.0, r:20'`
 
-	usageStamp     = "usage: pdfcpu stamp [-verbose] -pages pageSelection description inFile [outFile]"
+	usageStamp     = "usage: pdfcpu stamp [-verbose] [-incremental] -pages pageSelection description inFile [outFile]"
 	usageLongStamp = `Stamp adds stamps for selected pages. 
 
     verbose ... extensive log output
+incremental ... append changes to inFile keeping existing signatures valid
       pages ... page selection
 description ... font, text, color, rotation
      inFile ... input pdf file
@@ -240,10 +284,11 @@ description ... font, text, color, rotation
 
 ` + usageWMDescription
 
-	usageWatermark     = "usage: pdfcpu watermark [-verbose] -pages pageSelection description inFile [outFile]"
+	usageWatermark     = "usage: pdfcpu watermark [-verbose] [-incremental] -pages pageSelection description inFile [outFile]"
 	usageLongWatermark = `Watermark adds watermarks for selected pages. 
 
     verbose ... extensive log output
+incremental ... append changes to inFile keeping existing signatures valid
       pages ... page selection
 description ... font, text, color, rotation
      inFile ... input pdf file
@@ -251,6 +296,243 @@ description ... font, text, color, rotation
 
 ` + usageWMDescription
 
+	usageRevisionsList    = "pdfcpu revisions list [-verbose] inFile"
+	usageRevisionsExtract = "pdfcpu revisions extract [-verbose] inFile revision [outFile]"
+
+	usageRevisions = "usage: " + usageRevisionsList +
+		"\n       " + usageRevisionsExtract
+
+	usageLongRevisions = `Revisions lists the original document and all incremental updates of inFile
+including the objects each update touched or extracts inFile as it was at a given revision.
+Encrypted files need no passwords since no objects get decrypted.
+
+ verbose ... extensive log output
+  inFile ... input pdf file
+revision ... revision number, 1 is the original document
+ outFile ... output pdf file (default: inFile_rev<revision>.pdf)`
+
+	usageLinearize     = "usage: pdfcpu linearize [-verbose] [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageLongLinearize = `Linearize reads inFile and writes a linearized version ("Fast Web View") to outFile
+enabling viewers to display the first page before the whole file has been loaded.
+
+verbose ... extensive log output
+    upw ... user password
+    opw ... owner password
+ inFile ... input pdf file
+outFile ... output pdf file (default: inFile-new.pdf)`
+
+	usageRotate     = "usage: pdfcpu rotate [-verbose] [-incremental] [-pages pageSelection] -angle 90|180|270 [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageLongRotate = `Rotate turns selected pages clockwise adding to any rotation in effect.
+
+    verbose ... extensive log output
+incremental ... append changes to inFile keeping existing signatures valid
+      pages ... page selection (default: all pages)
+      angle ... clockwise rotation in degrees
+        upw ... user password
+        opw ... owner password
+     inFile ... input pdf file
+    outFile ... output pdf file (default: inFile-new.pdf)`
+
+	usagePagesInsert = "pdfcpu pages insert [-verbose] [-pages pageSelection] [-mode before|after] [-upw userpw] [-opw ownerpw] [description] inFile [outFile]"
+	usagePagesRemove = "pdfcpu pages remove [-verbose] -pages pageSelection [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usagePagesMove   = "pdfcpu pages move [-verbose] [-upw userpw] [-opw ownerpw] order inFile [outFile]"
+
+	usagePages = "usage: " + usagePagesInsert +
+		"\n       " + usagePagesRemove +
+		"\n       " + usagePagesMove
+
+	usageLongPages = `Pages edits the page tree.
+
+insert: inserts a blank page before or after each selected page (default: all pages).
+remove: removes selected pages along with outline items, named destinations and links pointing to them.
+  move: rearranges the pages in the given order.
+
+    verbose ... extensive log output
+      pages ... page selection
+       mode ... insert before (default) or after selected pages
+description ... "mediabox:llx lly urx ury" of the blank pages (default: media box of the selected page)
+      order ... comma separated list of all pages and page ranges in their new order, e.g. 3,1,2,5-10,4
+        upw ... user password
+        opw ... owner password
+     inFile ... input pdf file
+    outFile ... output pdf file (default: inFile-new.pdf)`
+
+	usageNUp     = "usage: pdfcpu nup [-verbose] [-pages pageSelection] -n 2|4|6|9|16 [-paper size] [-orientation portrait|landscape] [-border] [-margin m] [-order ltr|ttb] [-upw userpw] [-opw ownerpw] inFile|imageFile... outFile"
+	usageLongNUp = `NUp lays out selected pages of inFile or a sequence of image files onto sheets holding n pages each.
+
+    verbose ... extensive log output
+      pages ... page selection (default: all pages)
+          n ... number of pages per sheet
+      paper ... paper size of the sheets (default: A4)
+orientation ... orientation of the sheets (default: portrait)
+     border ... draw a border around each page
+     margin ... space around each page in points (default: 0)
+      order ... ltr: left to right, then top to bottom (default)
+                ttb: top to bottom, then left to right
+        upw ... user password
+        opw ... owner password
+     inFile ... input pdf file
+  imageFile ... input image file: png, jpg, tif
+    outFile ... output pdf file
+
+The paper sizes are:
+
+   A0 ... A10, B0 ... B10, C4, C5, C6
+   Letter, Legal, Tabloid, Ledger, Executive
+
+or WxH with an optional unit: pt (default), mm, cm, in, e.g. 210x297mm
+
+Pages keep their aspect ratio.
+Outline items and destinations pointing to pages of inFile are removed.`
+
+	usageBooklet     = "usage: pdfcpu booklet [-verbose] [-pages pageSelection] [-paper size] [-binding left|right] [-creep c] [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageLongBooklet = `Booklet imposes selected pages of inFile two-up onto sheets in saddle-stitch order.
+The pages are padded with blank pages to a multiple of 4.
+Print outFile duplex flipping on the short edge, fold the stack of sheets in the middle and staple along the fold.
+
+verbose ... extensive log output
+  pages ... page selection (default: all pages)
+  paper ... paper size of the sheets used in landscape orientation (default: A4), see pdfcpu help nup
+binding ... left (default) for reading left to right, right for reading right to left
+  creep ... shift of the pages towards the fold per sheet in points compensating for the paper thickness (default: 0)
+    upw ... user password
+    opw ... owner password
+ inFile ... input pdf file
+outFile ... output pdf file (default: inFile-new.pdf)
+
+Outline items and destinations pointing to pages of inFile are removed.`
+
+	usageBoxesList = "pdfcpu boxes list [-verbose] [-pages pageSelection] [-upw userpw] [-opw ownerpw] inFile"
+	usageBoxesSet  = "pdfcpu boxes set [-verbose] [-pages pageSelection] [-upw userpw] [-opw ownerpw] description inFile [outFile]"
+
+	usageBoxes = "usage: " + usageBoxesList +
+		"\n       " + usageBoxesSet
+
+	usageLongBoxes = `Boxes lists and sets the page boundaries MediaBox, CropBox, TrimBox, BleedBox and ArtBox.
+
+list: lists the effective page boxes of selected pages (default: all pages).
+ set: sets page boxes of selected pages (default: all pages).
+
+    verbose ... extensive log output
+      pages ... page selection
+        upw ... user password
+        opw ... owner password
+description ... comma separated list of box:value in the order to be applied
+     inFile ... input pdf file
+    outFile ... output pdf file (default: inFile-new.pdf)
+
+The boxes are: media, crop, trim, bleed, art.
+
+A value is one of:
+
+    [llx lly urx ury] ... absolute rectangle
+    m                 ... margin on all sides relative to the MediaBox
+    v h               ... vertical and horizontal margins relative to the MediaBox
+    t r b l           ... top, right, bottom and left margins relative to the MediaBox
+    box m|v h|t r b l ... margins relative to another box, negative margins extend that box
+
+followed by an optional unit: pt (default), mm, cm, in
+
+The CropBox defaults to the MediaBox, all other boxes default to the CropBox.
+Boxes are clipped to the MediaBox.
+
+e.g. "trim:10 mm, bleed:trim -3 mm" or "media:[0 0 595 842], crop:media 36"`
+
+	usageCrop     = "usage: pdfcpu crop [-verbose] [-pages pageSelection] [-upw userpw] [-opw ownerpw] description inFile [outFile]"
+	usageLongCrop = `Crop sets the visible region of selected pages, the CropBox.
+
+    verbose ... extensive log output
+      pages ... page selection (default: all pages)
+        upw ... user password
+        opw ... owner password
+description ... the value of the CropBox, see pdfcpu help boxes
+     inFile ... input pdf file
+    outFile ... output pdf file (default: inFile-new.pdf)
+
+e.g. "[0 0 500 700]" or "15 mm" or "1 0.5 in" or "trim"`
+
+	usageResize     = "usage: pdfcpu resize [-verbose] [-pages pageSelection] [-paper size] [-fit|-fill] [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageLongResize = `Resize scales and centres the content of selected pages of inFile onto a new paper size.
+
+verbose ... extensive log output
+  pages ... page selection (default: all pages)
+  paper ... target paper size (default: A4), see pdfcpu help nup
+    fit ... scale the page to fit the paper keeping its aspect ratio (default)
+   fill ... scale the page to fill the paper keeping its aspect ratio, cropping the overflow
+    upw ... user password
+    opw ... owner password
+ inFile ... input pdf file
+outFile ... output pdf file (default: inFile-new.pdf)
+
+The paper follows the orientation of each page.
+Annotations and links are scaled along with the page content.`
+
+	usageSign = "usage: pdfcpu sign [-verbose] [-mode pkcs7|cades] -keyfile keyFile [-keypw keypw] [-upw userpw] [-opw ownerpw] [description] inFile [outFile]" +
+		"\n       pdfcpu sign [-verbose] -mode rfc3161 -tsa url [-upw userpw] [-opw ownerpw] [description] inFile [outFile]"
+
+	usageLongSign = `Sign adds a digital signature or a document timestamp to inFile as an incremental update keeping existing signatures valid.
+
+    verbose ... extensive log output
+       mode ... signature format
+    keyFile ... PKCS#12 (.p12, .pfx) or PEM file holding the signing certificate, its private key
+                and optionally the issuing certificates
+      keypw ... password for keyFile
+        url ... URL of a RFC 3161 time stamping authority
+        upw ... user password
+        opw ... owner password
+description ... signature field, signer, reason, location, contact, visible widget
+     inFile ... input pdf file
+    outFile ... output pdf file (default: inFile-new.pdf)
+
+The signature formats are:
+
+  pkcs7 ... (default) adbe.pkcs7.detached
+  cades ... ETSI.CAdES.detached (PAdES baseline)
+rfc3161 ... ETSI.RFC3161 document timestamp, only field and page apply
+
+A description is a comma separated list of these entries:
+
+   field ... name of the signature field, an existing unsigned signature field gets signed (default: Signature1)
+    name ... name of the signer (default: common name of the certificate)
+  reason ... reason for signing
+location ... location of signing
+ contact ... contact information of the signer
+    page ... page of the signature widget (default: 1)
+    rect ... llx lly urx ury of a visible signature, the signature is invisible otherwise
+ certify ... 1, 2 or 3 for a certification signature permitting
+             1: no changes, 2: filling in forms and signing, 3: also annotating
+
+e.g. "reason:Approved, location:Berlin, rect:50 50 250 100"`
+
+	usageSignaturesVerify = "pdfcpu signatures verify [-verbose] [-json] [-trust trustDir] [-upw userpw] [-opw ownerpw] inFile"
+	usageSignaturesDSS    = "pdfcpu signatures dss [-verbose] [-upw userpw] [-opw ownerpw] inFile outFile file..."
+
+	usageSignatures = "usage: " + usageSignaturesVerify +
+		"\n       " + usageSignaturesDSS
+
+	usageLongSignatures = `Signatures verifies digital signatures and adds long-term validation data.
+
+verify: verifies all digital signatures of inFile.
+
+For every signature it checks that the byte range covers a complete revision except the signature,
+verifies the digest and the signature, builds the certificate chain of the signer and
+detects changes made by incremental updates after signing exceeding the DocMDP permissions
+of a certification signature or the FieldMDP locks of the signature.
+Without a certification signature filling in forms, signing and annotating are permitted.
+
+dss: adds certificates, CRLs and OCSP responses to the Document Security Store of inFile
+as an incremental update along with a VRI entry per signature referencing its validation data.
+
+ verbose ... extensive log output
+    json ... report as JSON
+trustDir ... directory holding the trusted certificates (.pem, .crt, .cer, .der),
+             certificate chains are not checked otherwise
+     upw ... user password
+     opw ... owner password
+  inFile ... input pdf file
+ outFile ... output pdf file
+    file ... PEM or DER encoded certificate, CRL or OCSP response`
+
 	usageVersion     = "usage: pdfcpu version"
 	usageLongVersion = "Version prints the pdfcpu version"
 )
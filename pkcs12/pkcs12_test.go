@@ -0,0 +1,62 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The test files have been created by OpenSSL 3:
+//
+//	openssl pkcs12 -export [-legacy] -inkey bob.key -in bob.crt -out bob.p12 -passout pass:bobpw
+func TestDecodeChain(t *testing.T) {
+
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "bob.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+
+	for _, fileName := range []string{"bob.p12", "bob-legacy.p12"} {
+
+		pfx, err := ioutil.ReadFile(filepath.Join("testdata", fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key, cert, caCerts, err := DecodeChain(pfx, "bobpw")
+		if err != nil {
+			t.Fatalf("%s: %v", fileName, err)
+		}
+
+		if cert.Subject.CommonName != "Bob" || len(caCerts) != 0 || !bytes.Equal(cert.Raw, block.Bytes) {
+			t.Fatalf("%s: unexpected certificate %s", fileName, cert.Subject)
+		}
+
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok || !rsaKey.PublicKey.Equal(cert.PublicKey) {
+			t.Fatalf("%s: private key does not match certificate", fileName)
+		}
+
+		if _, _, _, err = DecodeChain(pfx, "wrong"); err != ErrIncorrectPassword {
+			t.Fatalf("%s: expected %v, got %v", fileName, ErrIncorrectPassword, err)
+		}
+	}
+}
+
+// Test vector from RFC 6070.
+func TestPBKDF2(t *testing.T) {
+	dk := pbkdf2Key([]byte("password"), []byte("salt"), 4096, 20, sha1.New)
+	if got, want := hex.EncodeToString(dk), "4b007901b765489abead49d926f721d065a429c1"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
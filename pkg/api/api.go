@@ -18,7 +18,10 @@ limitations under the License.
 package api
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -28,6 +31,7 @@ import (
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/log"
 	"github.com/iPaladinLLC/pdfcpu/pkg/pdfcpu"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
 
 	"github.com/pkg/errors"
 )
@@ -48,8 +52,23 @@ func stringSet(slice []string) pdfcpu.StringSet {
 }
 
 // Read reads in a PDF file and builds an internal structure holding its cross reference table aka the PDFContext.
+// For config.Incremental changes get tracked from here on, see PDFContext.TrackChanges.
 func Read(fileIn string, config *pdfcpu.Configuration) (*pdfcpu.PDFContext, error) {
 
+	ctx, err := read(fileIn, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Incremental {
+		ctx.TrackChanges()
+	}
+
+	return ctx, nil
+}
+
+func read(fileIn string, config *pdfcpu.Configuration) (*pdfcpu.PDFContext, error) {
+
 	//logInfoAPI.Printf("reading %s..\n", fileIn)
 
 	ctx, err := pdfcpu.ReadPDFFile(fileIn, config)
@@ -57,9 +76,40 @@ func Read(fileIn string, config *pdfcpu.Configuration) (*pdfcpu.PDFContext, erro
 		return nil, errors.Wrap(err, "Read failed.")
 	}
 
+	reportRecovery(ctx)
+
+	return ctx, nil
+}
+
+// ReadFrom reads in a PDF from rs and builds an internal structure holding its cross reference table aka the PDFContext.
+// For config.Incremental changes get tracked from here on, see PDFContext.TrackChanges.
+func ReadFrom(rs io.ReadSeeker, config *pdfcpu.Configuration) (*pdfcpu.PDFContext, error) {
+
+	ctx, err := pdfcpu.ReadPDF(rs, "", config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Read failed.")
+	}
+
+	reportRecovery(ctx)
+
+	if config.Incremental {
+		ctx.TrackChanges()
+	}
+
 	return ctx, nil
 }
 
+// reportRecovery lists the objects recovered for a damaged file.
+func reportRecovery(ctx *pdfcpu.PDFContext) {
+
+	if !ctx.Read.Recovered {
+		return
+	}
+
+	n, s := ctx.Read.RecoveredObjectsString()
+	fmt.Printf("damaged cross reference table, recovered %d objects: %s\n", n, s)
+}
+
 // Validate validates a PDF file against ISO-32000-1:2008.
 func Validate(cmd *Command) ([]string, error) {
 
@@ -76,6 +126,8 @@ func Validate(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	dur1 := time.Since(from1).Seconds()
 
 	from2 := time.Now()
@@ -123,6 +175,52 @@ func Write(ctx *pdfcpu.PDFContext) error {
 	return nil
 }
 
+// WriteTo generates a PDF for a given PDFContext and writes it to w.
+func WriteTo(ctx *pdfcpu.PDFContext, w io.Writer) error {
+
+	err := pdfcpu.WritePDF(ctx, w)
+	if err != nil {
+		return errors.Wrap(err, "Write failed.")
+	}
+
+	if ctx.StatsFileName != "" {
+		err = pdfcpu.AppendStatsFile(ctx)
+		if err != nil {
+			return errors.Wrap(err, "Write stats failed.")
+		}
+	}
+
+	return nil
+}
+
+// cancelled returns the error of the context governing the command configured by config once it is done.
+func cancelled(config *pdfcpu.Configuration) error {
+
+	if config.Context == nil {
+		return nil
+	}
+
+	return config.Context.Err()
+}
+
+// outputFiles records the files written so far by a command producing several files.
+type outputFiles []string
+
+// removeIfCancelled removes all recorded files if err reports a cancellation.
+// A cancelled command leaves no partial output behind.
+func (files outputFiles) removeIfCancelled(err error) error {
+
+	if c := errors.Cause(err); c != context.Canceled && c != context.DeadlineExceeded {
+		return err
+	}
+
+	for _, fileName := range files {
+		os.Remove(fileName)
+	}
+
+	return err
+}
+
 // singlePageFileName generates a filename for a PDFContext and a specific page number.
 func singlePageFileName(ctx *pdfcpu.PDFContext, pageNr int) string {
 
@@ -145,16 +243,23 @@ func writeSinglePagePDF(ctx *pdfcpu.PDFContext, pageNr int, dirOut string) error
 	return pdfcpu.WritePDFFile(ctx)
 }
 
-func writeSinglePagePDFs(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet, dirOut string) error {
+func writeSinglePagePDFs(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet, dirOut string) (err error) {
+
+	var files outputFiles
+	defer func() { err = files.removeIfCancelled(err) }()
 
 	ensureSelectedPages(ctx, &selectedPages)
 
 	for i, v := range selectedPages {
 		if v {
+			if err := cancelled(ctx.Configuration); err != nil {
+				return err
+			}
 			err := writeSinglePagePDF(ctx, i, dirOut)
 			if err != nil {
 				return err
 			}
+			files = append(files, ctx.Write.DirName+ctx.Write.FileName)
 		}
 	}
 
@@ -163,7 +268,24 @@ func writeSinglePagePDFs(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet, di
 
 func readAndValidate(fileIn string, config *pdfcpu.Configuration, from1 time.Time) (ctx *pdfcpu.PDFContext, dur1, dur2 float64, err error) {
 
-	ctx, err = Read(fileIn, config)
+	ctx, dur1, dur2, err = readAndValidateUntracked(fileIn, config, from1)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Repairs done by validation need not go into an incremental update.
+	if config.Incremental {
+		ctx.TrackChanges()
+	}
+
+	return ctx, dur1, dur2, nil
+}
+
+// readAndValidateUntracked leaves tracking changes to the caller
+// since recording the state of all objects is expensive.
+func readAndValidateUntracked(fileIn string, config *pdfcpu.Configuration, from1 time.Time) (ctx *pdfcpu.PDFContext, dur1, dur2 float64, err error) {
+
+	ctx, err = read(fileIn, config)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -174,6 +296,7 @@ func readAndValidate(fileIn string, config *pdfcpu.Configuration, from1 time.Tim
 	//logInfoAPI.Printf("validating %s..\n", fileIn)
 	err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
 	if err != nil {
+		ctx.Read.Close()
 		return nil, 0, 0, err
 	}
 	dur2 = time.Since(from2).Seconds()
@@ -183,7 +306,7 @@ func readAndValidate(fileIn string, config *pdfcpu.Configuration, from1 time.Tim
 
 func readValidateAndOptimize(fileIn string, config *pdfcpu.Configuration, from1 time.Time) (ctx *pdfcpu.PDFContext, dur1, dur2, dur3 float64, err error) {
 
-	ctx, dur1, dur2, err = readAndValidate(fileIn, config, from1)
+	ctx, dur1, dur2, err = readAndValidateUntracked(fileIn, config, from1)
 	if err != nil {
 		return nil, 0, 0, 0, err
 	}
@@ -192,10 +315,16 @@ func readValidateAndOptimize(fileIn string, config *pdfcpu.Configuration, from1
 	//fmt.Printf("optimizing %s ...\n", fileIn)
 	err = pdfcpu.OptimizeXRefTable(ctx)
 	if err != nil {
+		ctx.Read.Close()
 		return nil, 0, 0, 0, err
 	}
 	dur3 = time.Since(from3).Seconds()
 
+	// Neither need the repairs done by validation and the changes done by optimization.
+	if config.Incremental {
+		ctx.TrackChanges()
+	}
+
 	return ctx, dur1, dur2, dur3, nil
 }
 
@@ -213,6 +342,8 @@ func Optimize(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	log.Stats.Printf("XRefTable:\n%s\n", ctx)
 
 	fromWrite := time.Now()
@@ -258,6 +389,8 @@ func Split(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	err = writeSinglePagePDFs(ctx, nil, dirOut)
@@ -292,6 +425,8 @@ func appendTo(fileIn string, ctxDest *pdfcpu.PDFContext) error {
 		return err
 	}
 
+	defer ctxSource.Read.Close()
+
 	// Merge the source context into the dest context.
 	fmt.Printf("merging in %s ...\n", fileIn)
 	return pdfcpu.MergeXRefTables(ctxSource, ctxDest)
@@ -314,6 +449,8 @@ func Merge(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctxDest.Read.Close()
+
 	if ctxDest.XRefTable.Version() < pdfcpu.V15 {
 		v, _ := pdfcpu.Version("1.5")
 		ctxDest.XRefTable.RootVersion = &v
@@ -373,7 +510,10 @@ func imageFilenameWithoutExtension(dir, resID string, pageNr, objNr int) string
 	return filepath.Join(dir, fmt.Sprintf("%s_%d_%d", resID, pageNr, objNr))
 }
 
-func doExtractImages(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error {
+func doExtractImages(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) (err error) {
+
+	var files outputFiles
+	defer func() { err = files.removeIfCancelled(err) }()
 
 	visited := pdfcpu.IntSet{}
 
@@ -381,6 +521,10 @@ func doExtractImages(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error
 
 		if v {
 
+			if err := cancelled(ctx.Configuration); err != nil {
+				return err
+			}
+
 			log.Info.Printf("writing images for page %d\n", pageNr)
 
 			for _, objNr := range imageObjNrs(ctx, pageNr) {
@@ -402,10 +546,13 @@ func doExtractImages(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error
 
 				filename := imageFilenameWithoutExtension(ctx.Write.DirName, io.ResourceNames[0], pageNr, objNr)
 
-				_, err = pdfcpu.WriteImage(ctx.XRefTable, filename, io.ImageDict, objNr)
+				fn, err := pdfcpu.WriteImage(ctx.XRefTable, filename, io.ImageDict, objNr)
 				if err != nil {
 					return err
 				}
+				if fn != "" {
+					files = append(files, fn)
+				}
 
 			}
 
@@ -433,6 +580,8 @@ func ExtractImages(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
@@ -475,7 +624,10 @@ func fontObjNrs(ctx *pdfcpu.PDFContext, page int) []int {
 	return o
 }
 
-func doExtractFonts(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error {
+func doExtractFonts(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) (err error) {
+
+	var files outputFiles
+	defer func() { err = files.removeIfCancelled(err) }()
 
 	visited := pdfcpu.IntSet{}
 
@@ -483,6 +635,10 @@ func doExtractFonts(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error {
 
 		if v {
 
+			if err := cancelled(ctx.Configuration); err != nil {
+				return err
+			}
+
 			log.Info.Printf("writing fonts for page %d\n", p)
 
 			for _, objNr := range fontObjNrs(ctx, p) {
@@ -508,6 +664,7 @@ func doExtractFonts(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error {
 				if err != nil {
 					return err
 				}
+				files = append(files, fileName)
 
 			}
 
@@ -535,6 +692,8 @@ func ExtractFonts(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
@@ -581,6 +740,8 @@ func ExtractPages(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
@@ -672,7 +833,10 @@ func contentObjNrs(ctx *pdfcpu.PDFContext, page int) ([]int, error) {
 	return objNrs, nil
 }
 
-func doExtractContent(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error {
+func doExtractContent(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) (err error) {
+
+	var files outputFiles
+	defer func() { err = files.removeIfCancelled(err) }()
 
 	visited := pdfcpu.IntSet{}
 
@@ -680,6 +844,10 @@ func doExtractContent(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error
 
 		if v {
 
+			if err := cancelled(ctx.Configuration); err != nil {
+				return err
+			}
+
 			log.Info.Printf("writing content for page %d\n", p)
 
 			objNrs, err := contentObjNrs(ctx, p)
@@ -714,6 +882,7 @@ func doExtractContent(ctx *pdfcpu.PDFContext, selectedPages pdfcpu.IntSet) error
 				if err != nil {
 					return err
 				}
+				files = append(files, fileName)
 
 			}
 
@@ -741,6 +910,8 @@ func ExtractContent(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
@@ -789,6 +960,8 @@ func Trim(cmd *Command) ([]string, error) {
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
@@ -824,6 +997,12 @@ func Trim(cmd *Command) ([]string, error) {
 	return nil, nil
 }
 
+// Linearize fileIn and write result to fileOut.
+func Linearize(cmd *Command) ([]string, error) {
+	cmd.Config.Linearize = true
+	return Optimize(cmd)
+}
+
 // Encrypt fileIn and write result to fileOut.
 func Encrypt(cmd *Command) ([]string, error) {
 	return Optimize(cmd)
@@ -860,6 +1039,8 @@ func ListAttachments(fileIn string, config *pdfcpu.Configuration) ([]string, err
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	list, err := pdfcpu.AttachList(ctx.XRefTable)
@@ -891,6 +1072,8 @@ func AddAttachments(fileIn string, files []string, config *pdfcpu.Configuration)
 		return err
 	}
 
+	defer ctx.Read.Close()
+
 	fmt.Printf("adding %d attachments to %s ...\n", len(files), fileIn)
 
 	from := time.Now()
@@ -946,6 +1129,8 @@ func RemoveAttachments(fileIn string, files []string, config *pdfcpu.Configurati
 		return err
 	}
 
+	defer ctx.Read.Close()
+
 	if len(files) > 0 {
 		fmt.Printf("removing %d attachments from %s ...\n", len(files), fileIn)
 	} else {
@@ -1007,6 +1192,8 @@ func ExtractAttachments(fileIn, dirOut string, files []string, config *pdfcpu.Co
 		return err
 	}
 
+	defer ctx.Read.Close()
+
 	fromWrite := time.Now()
 
 	ctx.Write.DirName = dirOut
@@ -1041,6 +1228,8 @@ func ListPermissions(fileIn string, config *pdfcpu.Configuration) ([]string, err
 		return nil, err
 	}
 
+	defer ctx.Read.Close()
+
 	fromList := time.Now()
 	list := pdfcpu.Permissions(ctx)
 	durList := time.Since(fromList).Seconds()
@@ -1058,6 +1247,21 @@ func ListPermissions(fileIn string, config *pdfcpu.Configuration) ([]string, err
 	return list, nil
 }
 
+// GetPermissions returns the user access permissions of fileIn.
+func GetPermissions(fileIn string, config *pdfcpu.Configuration) (pdfcpu.PermissionFlags, error) {
+
+	config.Mode = pdfcpu.LISTPERMISSIONS
+
+	ctx, err := Read(fileIn, config)
+	if err != nil {
+		return pdfcpu.PermNone, err
+	}
+
+	defer ctx.Read.Close()
+
+	return pdfcpu.UserPermissionFlags(ctx), nil
+}
+
 // AddPermissions sets the user access permissions.
 func AddPermissions(fileIn string, config *pdfcpu.Configuration) error {
 
@@ -1068,6 +1272,8 @@ func AddPermissions(fileIn string, config *pdfcpu.Configuration) error {
 		return err
 	}
 
+	defer ctx.Read.Close()
+
 	fmt.Printf("adding permissions to %s ...\n", fileIn)
 
 	fromWrite := time.Now()
@@ -1126,6 +1332,8 @@ func AddWatermarks(cmd *Command) ([]string, error) {
 		}
 	}
 
+	defer ctx.Read.Close()
+
 	fmt.Printf("%sing %s ...\n", wm.OnTopString(), fileIn)
 
 	from := time.Now()
@@ -1171,3 +1379,588 @@ func AddWatermarks(cmd *Command) ([]string, error) {
 
 	return nil, nil
 }
+
+// Rotate turns selected pages of fileIn clockwise by a multiple of 90 degrees and writes the result to fileOut.
+func Rotate(cmd *Command) ([]string, error) {
+
+	fileIn := *cmd.InFile
+	fileOut := *cmd.OutFile
+	pageSelection := cmd.PageSelection
+	rotation := cmd.Rotation
+	config := cmd.Config
+
+	if !pdfcpu.ValidRotation(rotation) {
+		return nil, errors.Errorf("rotate: rotation must be a multiple of 90, got %d", rotation)
+	}
+
+	fromStart := time.Now()
+
+	fmt.Printf("rotating %s ...\n", fileIn)
+
+	ctx, durRead, durVal, err := readAndValidate(fileIn, config, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ctx.Read.Close()
+
+	from := time.Now()
+
+	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	ensureSelectedPages(ctx, &pages)
+
+	err = pdfcpu.RotatePages(ctx.XRefTable, pages, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	durRotate := time.Since(from).Seconds()
+
+	fromWrite := time.Now()
+
+	dirName, fileName := filepath.Split(fileOut)
+	ctx.Write.DirName = dirName
+	ctx.Write.FileName = fileName
+
+	err = Write(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Stats.Printf("rotate               : %6.3fs  %4.1f%%\n", durRotate, durRotate/durTotal*100)
+	log.Stats.Printf("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+	ctx.Read.LogStats(ctx.Optimized)
+	ctx.Write.LogStats()
+
+	return nil, nil
+}
+
+// editPages applies edit to the page tree of fileIn and writes the result to fileOut.
+func editPages(fileIn, fileOut, msg string, config *pdfcpu.Configuration, edit func(ctx *pdfcpu.PDFContext) error) error {
+
+	fromStart := time.Now()
+
+	fmt.Printf("%s %s ...\n", msg, fileIn)
+
+	ctx, durRead, durVal, durOpt, err := readValidateAndOptimize(fileIn, config, fromStart)
+	if err != nil {
+		return err
+	}
+
+	defer ctx.Read.Close()
+
+	from := time.Now()
+
+	if err = edit(ctx); err != nil {
+		return err
+	}
+
+	durEdit := time.Since(from).Seconds()
+
+	fromWrite := time.Now()
+
+	dirName, fileName := filepath.Split(fileOut)
+	ctx.Write.DirName = dirName
+	ctx.Write.FileName = fileName
+
+	err = Write(ctx)
+	if err != nil {
+		return err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Stats.Printf("optimize             : %6.3fs  %4.1f%%\n", durOpt, durOpt/durTotal*100)
+	log.Stats.Printf("edit pages           : %6.3fs  %4.1f%%\n", durEdit, durEdit/durTotal*100)
+	log.Stats.Printf("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+	ctx.Read.LogStats(ctx.Optimized)
+	ctx.Write.LogStats()
+
+	return nil
+}
+
+// InsertPages inserts a blank page before or after each selected page of fileIn and writes the result to fileOut.
+// No page selection means all pages. A nil mediaBox means the media box of the selected page.
+func InsertPages(fileIn, fileOut string, pageSelection []string, before bool, mediaBox *types.Rectangle, config *pdfcpu.Configuration) error {
+
+	return editPages(fileIn, fileOut, "inserting pages into", config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
+		if err != nil {
+			return err
+		}
+
+		ensureSelectedPages(ctx, &pages)
+
+		return pdfcpu.InsertPages(ctx.XRefTable, pages, before, mediaBox)
+	})
+}
+
+// RemovePages removes selected pages of fileIn along with outline items and destinations pointing to them
+// and writes the result to fileOut.
+func RemovePages(fileIn, fileOut string, pageSelection []string, config *pdfcpu.Configuration) error {
+
+	return editPages(fileIn, fileOut, "removing pages from", config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
+		if err != nil {
+			return err
+		}
+
+		if len(pages) == 0 {
+			return errors.New("remove pages: no pages selected")
+		}
+
+		return pdfcpu.RemovePages(ctx.XRefTable, pages)
+	})
+}
+
+// MovePages rearranges the pages of fileIn in the order given by a page order expression
+// listing every page exactly once and writes the result to fileOut.
+func MovePages(fileIn, fileOut string, pageOrder []string, config *pdfcpu.Configuration) error {
+
+	return editPages(fileIn, fileOut, "moving pages of", config, func(ctx *pdfcpu.PDFContext) error {
+
+		order, err := pagesForPageOrder(ctx.PageCount, pageOrder)
+		if err != nil {
+			return err
+		}
+
+		return pdfcpu.MovePages(ctx.XRefTable, order)
+	})
+}
+
+// nupImages creates fileOut laying out image files onto n-up sheets.
+func nupImages(filesIn []string, fileOut string, nup *pdfcpu.NUp, config *pdfcpu.Configuration) error {
+
+	fromStart := time.Now()
+
+	fmt.Printf("laying out %d images ...\n", len(filesIn))
+
+	ctx, err := pdfcpu.NUpFromImages(filesIn, nup, config)
+	if err != nil {
+		return err
+	}
+
+	durNUp := time.Since(fromStart).Seconds()
+
+	fromWrite := time.Now()
+
+	dirName, fileName := filepath.Split(fileOut)
+	ctx.Write.DirName = dirName
+	ctx.Write.FileName = fileName
+
+	err = Write(ctx)
+	if err != nil {
+		return err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("n-up                 : %6.3fs  %4.1f%%\n", durNUp, durNUp/durTotal*100)
+	log.Stats.Printf("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+	ctx.Write.LogStats()
+
+	return nil
+}
+
+// NUp lays out selected pages of a PDF file or a sequence of image files onto sheets holding cmd.NUp.N pages each.
+// No page selection means all pages.
+func NUp(cmd *Command) ([]string, error) {
+
+	filesIn := cmd.InFiles
+	fileOut := *cmd.OutFile
+	config := cmd.Config
+
+	nup := cmd.NUp
+	if nup == nil {
+		nup = pdfcpu.DefaultNUpConfig()
+	}
+
+	if len(filesIn) == 0 {
+		return nil, errors.New("nup: missing input file")
+	}
+
+	if !strings.EqualFold(filepath.Ext(filesIn[0]), ".pdf") {
+		return nil, nupImages(filesIn, fileOut, nup, config)
+	}
+
+	if len(filesIn) > 1 {
+		return nil, errors.New("nup: only one PDF input file allowed")
+	}
+
+	return nil, editPages(filesIn[0], fileOut, "laying out pages of", config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, cmd.PageSelection)
+		if err != nil {
+			return err
+		}
+
+		return pdfcpu.NUpFromPDF(ctx.XRefTable, pages, nup)
+	})
+}
+
+// Booklet imposes selected pages of a file as a saddle-stitched booklet, two pages per sheet side.
+// No page selection means all pages.
+func Booklet(cmd *Command) ([]string, error) {
+
+	bl := cmd.Booklet
+	if bl == nil {
+		bl = pdfcpu.DefaultBookletConfig()
+	}
+
+	return nil, editPages(*cmd.InFile, *cmd.OutFile, "imposing booklet of", cmd.Config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, cmd.PageSelection)
+		if err != nil {
+			return err
+		}
+
+		return pdfcpu.BookletFromPDF(ctx.XRefTable, pages, bl)
+	})
+}
+
+// ListBoxes returns a list of the effective page boxes of selected pages of fileIn.
+// No page selection means all pages.
+func ListBoxes(fileIn string, pageSelection []string, config *pdfcpu.Configuration) ([]string, error) {
+
+	fromStart := time.Now()
+
+	ctx, durRead, durVal, err := readAndValidate(fileIn, config, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ctx.Read.Close()
+
+	fromList := time.Now()
+
+	pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := pdfcpu.ListPageBoxes(ctx.XRefTable, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	durList := time.Since(fromList).Seconds()
+
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Stats.Printf("list boxes           : %6.3fs  %4.1f%%\n", durList, durList/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return list, nil
+}
+
+// SetBoxes sets page boxes of selected pages of fileIn in the given order and writes the result to fileOut.
+// No page selection means all pages.
+func SetBoxes(fileIn, fileOut string, pageSelection []string, boxes []*pdfcpu.BoxSpec, config *pdfcpu.Configuration) error {
+
+	if len(boxes) == 0 {
+		return errors.New("set boxes: missing page boxes")
+	}
+
+	return editPages(fileIn, fileOut, "setting page boxes of", config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, pageSelection)
+		if err != nil {
+			return err
+		}
+
+		return pdfcpu.SetPageBoxes(ctx.XRefTable, pages, boxes)
+	})
+}
+
+// Resize scales and centres the content of selected pages of a PDF file onto a new paper size.
+// No page selection means all pages.
+func Resize(cmd *Command) ([]string, error) {
+
+	rs := cmd.Resize
+	if rs == nil {
+		rs = pdfcpu.DefaultResizeConfig()
+	}
+
+	return nil, editPages(*cmd.InFile, *cmd.OutFile, "resizing pages of", cmd.Config, func(ctx *pdfcpu.PDFContext) error {
+
+		pages, err := pagesForPageSelection(ctx.PageCount, cmd.PageSelection)
+		if err != nil {
+			return err
+		}
+
+		return pdfcpu.ResizePages(ctx.XRefTable, pages, rs)
+	})
+}
+
+// ListRevisions returns a list of all revisions of a PDF file: the original document followed by any incremental updates.
+func ListRevisions(fileIn string, config *pdfcpu.Configuration) ([]string, error) {
+
+	fromStart := time.Now()
+
+	file, err := os.Open(fileIn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open %q", fileIn)
+	}
+
+	defer file.Close()
+
+	ctx, err := pdfcpu.ReadRevisions(file, fileIn, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Read failed.")
+	}
+
+	durRead := time.Since(fromStart).Seconds()
+
+	fromList := time.Now()
+	list := pdfcpu.RevisionList(ctx)
+	durList := time.Since(fromList).Seconds()
+
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("list revisions       : %6.3fs  %4.1f%%\n", durList, durList/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return list, nil
+}
+
+// ExtractRevision writes a PDF file as it was at a specific revision to fileOut.
+// Revision 1 is the original document, each incremental update adds a revision.
+func ExtractRevision(fileIn, fileOut string, revision int, config *pdfcpu.Configuration) error {
+
+	fromStart := time.Now()
+
+	file, err := os.Open(fileIn)
+	if err != nil {
+		return errors.Wrapf(err, "can't open %q", fileIn)
+	}
+
+	defer file.Close()
+
+	// Keep the file open for copying.
+	// Revisions are byte ranges of the file, so neither objects nor passwords are needed.
+	ctx, err := pdfcpu.ReadRevisions(file, fileIn, config)
+	if err != nil {
+		return errors.Wrap(err, "Read failed.")
+	}
+
+	durRead := time.Since(fromStart).Seconds()
+
+	fmt.Printf("writing revision %d of %d to %s ...\n", revision, len(ctx.Read.Revisions), fileOut)
+
+	fromWrite := time.Now()
+
+	err = pdfcpu.WriteRevisionFile(ctx, revision, fileOut)
+	if err != nil {
+		return err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return nil
+}
+
+// Sign adds a digital signature to inFile using the key pair of config and writes the result to fileOut.
+// The signature gets appended as an incremental update keeping existing signatures valid.
+func Sign(cmd *Command) ([]string, error) {
+
+	fileIn := *cmd.InFile
+	fileOut := *cmd.OutFile
+	sig := cmd.Signature
+	// Work on a copy since the result is always written as an incremental update.
+	config := *cmd.Config
+
+	if sig.SubFilter == pdfcpu.SubFilterRFC3161 {
+		if config.Timestamper == nil {
+			return nil, errors.New("sign: missing timestamp authority")
+		}
+	} else if config.KeyPair == nil {
+		return nil, errors.New("sign: missing certificate and private key")
+	}
+
+	config.Incremental = true
+
+	fromStart := time.Now()
+
+	ctx, durRead, durVal, err := readAndValidate(fileIn, &config, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ctx.Read.Close()
+
+	fmt.Printf("signing %s ...\n", fileIn)
+
+	from := time.Now()
+
+	err = pdfcpu.AddSignatureField(ctx, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("writing %s ...\n", fileOut)
+
+	err = pdfcpu.WriteSignedPDFFile(ctx, sig, fileOut)
+	if err != nil {
+		return nil, errors.Wrap(err, "Write failed.")
+	}
+
+	durSign := time.Since(from).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Stats.Printf("sign and write       : %6.3fs  %4.1f%%\n", durSign, durSign/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return nil, nil
+}
+
+// AddDSS adds the certificates, CRLs and OCSP responses read from files to the Document Security Store of fileIn
+// and writes the result as an incremental update to fileOut.
+func AddDSS(cmd *Command) ([]string, error) {
+
+	fileIn := *cmd.InFile
+	fileOut := *cmd.OutFile
+	// Work on a copy since the result is always written as an incremental update.
+	config := *cmd.Config
+
+	vd, err := pdfcpu.LoadValidationData(cmd.InFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Incremental = true
+
+	fromStart := time.Now()
+
+	ctx, durRead, durVal, err := readAndValidate(fileIn, &config, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ctx.Read.Close()
+
+	fmt.Printf("adding validation data to %s ...\n", fileIn)
+
+	from := time.Now()
+
+	err = pdfcpu.AddDSS(ctx, vd)
+	if err != nil {
+		return nil, err
+	}
+
+	durAdd := time.Since(from).Seconds()
+
+	fromWrite := time.Now()
+
+	dirName, fileName := filepath.Split(fileOut)
+	ctx.Write.DirName = dirName
+	ctx.Write.FileName = fileName
+
+	err = Write(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("validate             : %6.3fs  %4.1f%%\n", durVal, durVal/durTotal*100)
+	log.Stats.Printf("add DSS              : %6.3fs  %4.1f%%\n", durAdd, durAdd/durTotal*100)
+	log.Stats.Printf("write                : %6.3fs  %4.1f%%\n", durWrite, durWrite/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return nil, nil
+}
+
+// VerifySignatures verifies all digital signatures of fileIn.
+// Signing certificates get verified against the certificates found in trustDir unless trustDir is empty.
+func VerifySignatures(fileIn, trustDir string, config *pdfcpu.Configuration) ([]pdfcpu.SignatureVerification, error) {
+
+	fromStart := time.Now()
+
+	var trusted []*x509.Certificate
+
+	if trustDir != "" {
+		var err error
+		trusted, err = pdfcpu.LoadTrustStore(trustDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(fileIn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open %q", fileIn)
+	}
+
+	defer file.Close()
+
+	// Keep the file open for reading signed revisions.
+	ctx, err := pdfcpu.ReadPDF(file, fileIn, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Read failed.")
+	}
+
+	reportRecovery(ctx)
+
+	durRead := time.Since(fromStart).Seconds()
+
+	fromVerify := time.Now()
+
+	svs, err := pdfcpu.VerifySignatures(ctx, trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	durVerify := time.Since(fromVerify).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	log.Stats.Println("Timing:")
+	log.Stats.Printf("read                 : %6.3fs  %4.1f%%\n", durRead, durRead/durTotal*100)
+	log.Stats.Printf("verify signatures    : %6.3fs  %4.1f%%\n", durVerify, durVerify/durTotal*100)
+	log.Stats.Printf("total processing time: %6.3fs\n\n", durTotal)
+
+	return svs, nil
+}
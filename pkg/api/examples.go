@@ -304,7 +304,8 @@ func exampleProcessAddPermissions() {
 	config.UserPW = "upw"
 	config.OwnerPW = "opw"
 
-	config.UserAccessPermissions = pdfcpu.PermissionsAll
+	// Allow printing and filling in forms only.
+	config.UserAccessPermissions = (pdfcpu.PermPrint | pdfcpu.PermFillForms).UserAccessPermissions()
 
 	_, err := Process(AddPermissionsCommand("in.pdf", config))
 	if err != nil {
@@ -17,26 +17,65 @@ limitations under the License.
 package api
 
 import (
+	"context"
+	"encoding/json"
+
 	"github.com/iPaladinLLC/pdfcpu/pkg/pdfcpu"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
 	"github.com/pkg/errors"
 )
 
 // Command represents an execution context.
 type Command struct {
-	Mode          pdfcpu.CommandMode    // VALIDATE  OPTIMIZE  SPLIT  MERGE  EXTRACT  TRIM  LISTATT ADDATT REMATT EXTATT  ENCRYPT  DECRYPT  CHANGEUPW  CHANGEOPW LISTP ADDP  WATERMARK
-	InFile        *string               //    *         *        *      -       *      *      *       *       *      *       *        *         *          *       *     *       *
-	InFiles       []string              //    -         -        -      *       -      -      -       *       *      *       -        -         -          -       -     -       -
-	InDir         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -
-	OutFile       *string               //    -         *        -      *       -      *      -       -       -      -       *        *         *          *       -     -       *
-	OutDir        *string               //    -         -        *      -       *      -      -       -       -      *       -        -         -          -       -     -       -
-	PageSelection []string              //    -         -        -      -       *      *      -       -       -      -       -        -         -          -       -     -       *
-	Config        *pdfcpu.Configuration //    *         *        *      *       *      *      *       *       *      *       *        *         *          *       *     *       *
-	PWOld         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -
-	PWNew         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -
-	Watermark     *pdfcpu.Watermark     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -
+	Mode          pdfcpu.CommandMode    // VALIDATE  OPTIMIZE  SPLIT  MERGE  EXTRACT  TRIM  LISTATT ADDATT REMATT EXTATT  ENCRYPT  DECRYPT  CHANGEUPW  CHANGEOPW LISTP ADDP  WATERMARK  LISTREV  EXTREV  LIN  SIGN  VERSIG  DSS  ROT  INSPG  RMPG  MVPG  NUP   BOOK  LBOX  SBOX  CROP  RSZ
+	InFile        *string               //    *         *        *      -       *      *      *       *       *      *       *        *         *          *       *     *       *         *        *    *     *       *     *     *      *     *     *     -     *     *     *     *     *
+	InFiles       []string              //    -         -        -      *       -      -      -       *       *      *       -        -         -          -       -     -       -         -        -    -     -       -     *     -      -     -     -     *     -     -     -     -     -
+	InDir         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       *     -     -      -     -     -     -     -     -     -     -     -
+	OutFile       *string               //    -         *        -      *       -      *      -       -       -      -       *        *         *          *       -     -       *         -        *    *     *       -     *     *      *     *     *     *     *     -     *     *     *
+	OutDir        *string               //    -         -        *      -       *      -      -       -       -      *       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     -     -     -
+	PageSelection []string              //    -         -        -      -       *      *      -       -       -      -       -        -         -          -       -     -       *         -        -    -     -       -     -     *      *     *     *     *     *     *     *     *     *
+	Config        *pdfcpu.Configuration //    *         *        *      *       *      *      *       *       *      *       *        *         *          *       *     *       *         *        *    *     *       *     *     *      *     *     *     *     *     *     *     *     *
+	PWOld         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     -     -     -
+	PWNew         *string               //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     -     -     -
+	Watermark     *pdfcpu.Watermark     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     -     -     -
+	Signature     *pdfcpu.Signature     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     *       -     -     -      -     -     -     -     -     -     -     -     -
+	Revision      int                   //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        *    -     -       -     -     -      -     -     -     -     -     -     -     -     -
+	JSON          bool                  //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       *     -     -      -     -     -     -     -     -     -     -     -
+	Rotation      int                   //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     *      -     -     -     -     -     -     -     -     -
+	Before        bool                  //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      *     -     -     -     -     -     -     -     -
+	MediaBox      *types.Rectangle      //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      *     -     -     -     -     -     -     -     -
+	NUp           *pdfcpu.NUp           //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     *     -     -     -     -     -
+	Booklet       *pdfcpu.Booklet       //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     -     *     -     -     -     -
+	Boxes         []*pdfcpu.BoxSpec     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     *     *     -
+	Resize        *pdfcpu.Resize        //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -        -    -     -       -     -     -      -     -     -     -     -     -     -     -     *
+}
+
+// ProcessContext executes a pdfcpu command governed by c.
+//
+// Processing stops as soon as c gets cancelled or its deadline expires,
+// in which case the returned error is c.Err(), see errors.Is.
+// No partially written output files are left behind.
+func ProcessContext(c context.Context, cmd *Command) ([]string, error) {
+
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	// The configuration may be shared by concurrent commands governed by other contexts.
+	config := pdfcpu.NewDefaultConfiguration()
+	if cmd.Config != nil {
+		*config = *cmd.Config
+	}
+	config.Context = c
+
+	cmdCopy := *cmd
+	cmdCopy.Config = config
+
+	return Process(&cmdCopy)
 }
 
 // Process executes a pdfcpu command.
+// See ProcessContext for cancellation and deadlines.
 func Process(cmd *Command) (out []string, err error) {
 
 	defer func() {
@@ -69,6 +108,22 @@ func Process(cmd *Command) (out []string, err error) {
 		pdfcpu.CHANGEOPW:          processEncryption,
 		pdfcpu.LISTPERMISSIONS:    processPermissions,
 		pdfcpu.ADDPERMISSIONS:     processPermissions,
+		pdfcpu.LISTREVISIONS:      processRevisions,
+		pdfcpu.EXTRACTREVISION:    processRevisions,
+		pdfcpu.LINEARIZE:          Linearize,
+		pdfcpu.SIGN:               Sign,
+		pdfcpu.VERIFYSIGNATURES:   processSignatures,
+		pdfcpu.ADDDSS:             AddDSS,
+		pdfcpu.ROTATE:             Rotate,
+		pdfcpu.INSERTPAGES:        processPages,
+		pdfcpu.REMOVEPAGES:        processPages,
+		pdfcpu.MOVEPAGES:          processPages,
+		pdfcpu.NUP:                NUp,
+		pdfcpu.BOOKLET:            Booklet,
+		pdfcpu.LISTBOXES:          processBoxes,
+		pdfcpu.SETBOXES:           processBoxes,
+		pdfcpu.CROP:               processBoxes,
+		pdfcpu.RESIZE:             Resize,
 	} {
 		if cmd.Mode == k {
 			return v(cmd)
@@ -259,6 +314,33 @@ func AddPermissionsCommand(pdfFileNameIn string, config *pdfcpu.Configuration) *
 		Config: config}
 }
 
+// ListRevisionsCommand creates a new command to list the revisions of a file.
+func ListRevisionsCommand(pdfFileNameIn string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:   pdfcpu.LISTREVISIONS,
+		InFile: &pdfFileNameIn,
+		Config: config}
+}
+
+// LinearizeCommand creates a new command to linearize a file.
+func LinearizeCommand(pdfFileNameIn, pdfFileNameOut string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:    pdfcpu.LINEARIZE,
+		InFile:  &pdfFileNameIn,
+		OutFile: &pdfFileNameOut,
+		Config:  config}
+}
+
+// ExtractRevisionCommand creates a new command to extract a file as it was at a specific revision.
+func ExtractRevisionCommand(pdfFileNameIn, pdfFileNameOut string, revision int, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:     pdfcpu.EXTRACTREVISION,
+		InFile:   &pdfFileNameIn,
+		OutFile:  &pdfFileNameOut,
+		Revision: revision,
+		Config:   config}
+}
+
 func processAttachments(cmd *Command) (out []string, err error) {
 
 	switch cmd.Mode {
@@ -299,6 +381,20 @@ func processEncryption(cmd *Command) (out []string, err error) {
 	return nil, nil
 }
 
+func processRevisions(cmd *Command) (out []string, err error) {
+
+	switch cmd.Mode {
+
+	case pdfcpu.LISTREVISIONS:
+		out, err = ListRevisions(*cmd.InFile, cmd.Config)
+
+	case pdfcpu.EXTRACTREVISION:
+		err = ExtractRevision(*cmd.InFile, *cmd.OutFile, cmd.Revision, cmd.Config)
+	}
+
+	return out, err
+}
+
 func processPermissions(cmd *Command) (out []string, err error) {
 
 	switch cmd.Mode {
@@ -324,3 +420,201 @@ func AddWatermarksCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []
 		Watermark:     wm,
 		Config:        config}
 }
+
+// RotateCommand creates a new command to rotate selected pages of a file clockwise by rotation degrees.
+func RotateCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, rotation int, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.ROTATE,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Rotation:      rotation,
+		Config:        config}
+}
+
+// InsertPagesCommand creates a new command to insert a blank page before or after each selected page.
+// A nil mediaBox means the media box of the selected page.
+func InsertPagesCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, before bool, mediaBox *types.Rectangle, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.INSERTPAGES,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Before:        before,
+		MediaBox:      mediaBox,
+		Config:        config}
+}
+
+// RemovePagesCommand creates a new command to remove selected pages.
+func RemovePagesCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.REMOVEPAGES,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Config:        config}
+}
+
+// MovePagesCommand creates a new command to rearrange pages in the order given by a page order expression.
+func MovePagesCommand(pdfFileNameIn, pdfFileNameOut string, pageOrder []string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.MOVEPAGES,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageOrder,
+		Config:        config}
+}
+
+// NUpCommand creates a new command to lay out selected pages of a PDF file or a sequence of image files onto n-up sheets.
+func NUpCommand(fileNamesIn []string, pdfFileNameOut string, pageSelection []string, nup *pdfcpu.NUp, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.NUP,
+		InFiles:       fileNamesIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		NUp:           nup,
+		Config:        config}
+}
+
+// BookletCommand creates a new command to impose selected pages of a file as a saddle-stitched booklet.
+func BookletCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, booklet *pdfcpu.Booklet, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.BOOKLET,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Booklet:       booklet,
+		Config:        config}
+}
+
+// ListBoxesCommand creates a new command to list the page boxes of selected pages.
+func ListBoxesCommand(pdfFileNameIn string, pageSelection []string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.LISTBOXES,
+		InFile:        &pdfFileNameIn,
+		PageSelection: pageSelection,
+		Config:        config}
+}
+
+// SetBoxesCommand creates a new command to set page boxes of selected pages.
+func SetBoxesCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, boxes []*pdfcpu.BoxSpec, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.SETBOXES,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Boxes:         boxes,
+		Config:        config}
+}
+
+// CropCommand creates a new command to set the crop box of selected pages.
+func CropCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, cropBox *pdfcpu.BoxSpec, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.CROP,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Boxes:         []*pdfcpu.BoxSpec{cropBox},
+		Config:        config}
+}
+
+// ResizeCommand creates a new command to resize selected pages to a paper size.
+func ResizeCommand(pdfFileNameIn, pdfFileNameOut string, pageSelection []string, resize *pdfcpu.Resize, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:          pdfcpu.RESIZE,
+		InFile:        &pdfFileNameIn,
+		OutFile:       &pdfFileNameOut,
+		PageSelection: pageSelection,
+		Resize:        resize,
+		Config:        config}
+}
+
+func processBoxes(cmd *Command) (out []string, err error) {
+
+	switch cmd.Mode {
+
+	case pdfcpu.LISTBOXES:
+		out, err = ListBoxes(*cmd.InFile, cmd.PageSelection, cmd.Config)
+
+	case pdfcpu.SETBOXES, pdfcpu.CROP:
+		err = SetBoxes(*cmd.InFile, *cmd.OutFile, cmd.PageSelection, cmd.Boxes, cmd.Config)
+	}
+
+	return out, err
+}
+
+func processPages(cmd *Command) (out []string, err error) {
+
+	switch cmd.Mode {
+
+	case pdfcpu.INSERTPAGES:
+		err = InsertPages(*cmd.InFile, *cmd.OutFile, cmd.PageSelection, cmd.Before, cmd.MediaBox, cmd.Config)
+
+	case pdfcpu.REMOVEPAGES:
+		err = RemovePages(*cmd.InFile, *cmd.OutFile, cmd.PageSelection, cmd.Config)
+
+	case pdfcpu.MOVEPAGES:
+		err = MovePages(*cmd.InFile, *cmd.OutFile, cmd.PageSelection, cmd.Config)
+	}
+
+	return out, err
+}
+
+// SignCommand creates a new command to digitally sign a file.
+func SignCommand(pdfFileNameIn, pdfFileNameOut string, sig *pdfcpu.Signature, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:      pdfcpu.SIGN,
+		InFile:    &pdfFileNameIn,
+		OutFile:   &pdfFileNameOut,
+		Signature: sig,
+		Config:    config}
+}
+
+// VerifySignaturesCommand creates a new command to verify all digital signatures of a file.
+// trustDir holds the trusted certificates, certificate chains do not get verified if trustDir is empty.
+// The result gets reported as JSON if asJSON is true.
+func VerifySignaturesCommand(pdfFileNameIn, trustDir string, asJSON bool, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:   pdfcpu.VERIFYSIGNATURES,
+		InFile: &pdfFileNameIn,
+		InDir:  &trustDir,
+		JSON:   asJSON,
+		Config: config}
+}
+
+// AddDSSCommand creates a new command to add the validation data of certificate, CRL and OCSP response files
+// to the Document Security Store of a signed file.
+func AddDSSCommand(pdfFileNameIn, pdfFileNameOut string, fileNames []string, config *pdfcpu.Configuration) *Command {
+	return &Command{
+		Mode:    pdfcpu.ADDDSS,
+		InFile:  &pdfFileNameIn,
+		InFiles: fileNames,
+		OutFile: &pdfFileNameOut,
+		Config:  config}
+}
+
+func processSignatures(cmd *Command) (out []string, err error) {
+
+	svs, err := VerifySignatures(*cmd.InFile, *cmd.InDir, cmd.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.JSON {
+		b, err := json.MarshalIndent(svs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(b)}, nil
+	}
+
+	if len(svs) == 0 {
+		return []string{"no signatures found"}, nil
+	}
+
+	for _, sv := range svs {
+		out = append(out, sv.Lines()...)
+	}
+
+	return out, nil
+}
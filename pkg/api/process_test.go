@@ -17,15 +17,38 @@ limitations under the License.
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/pdfcpu"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
 )
 
 var inDir, outDir string
@@ -75,6 +98,407 @@ func TestGetPageCount(t *testing.T) {
 
 }
 
+func TestReadFrom(t *testing.T) {
+
+	config := pdfcpu.NewDefaultConfiguration()
+	inFile := filepath.Join(inDir, "CenterOfWhy.pdf")
+
+	buf, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		t.Fatalf("TestReadFrom: %v\n", err)
+	}
+
+	ctx, err := ReadFrom(bytes.NewReader(buf), config)
+	if err != nil {
+		t.Fatalf("TestReadFrom: %v\n", err)
+	}
+
+	err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
+	if err != nil {
+		t.Fatalf("TestReadFrom: %v\n", err)
+	}
+
+	if ctx.PageCount != 25 {
+		t.Fatalf("TestReadFrom: pageCount should be %d but is %d\n", 25, ctx.PageCount)
+	}
+
+}
+
+func testWriteTo(t *testing.T, inFile string, xRefStream bool) {
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.WriteXRefStream = xRefStream
+	config.WriteObjectStream = xRefStream
+
+	ctx, _, _, _, err := readValidateAndOptimize(filepath.Join(inDir, inFile), config, time.Now())
+	if err != nil {
+		t.Fatalf("TestWriteTo %s: %v\n", inFile, err)
+	}
+
+	var buf bytes.Buffer
+
+	err = WriteTo(ctx, &buf)
+	if err != nil {
+		t.Fatalf("TestWriteTo %s: %v\n", inFile, err)
+	}
+
+	if ctx.Write.FileSize != int64(buf.Len()) {
+		t.Fatalf("TestWriteTo %s: FileSize should be %d but is %d\n", inFile, buf.Len(), ctx.Write.FileSize)
+	}
+
+	ctx, err = ReadFrom(bytes.NewReader(buf.Bytes()), pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("TestWriteTo %s: %v\n", inFile, err)
+	}
+
+	err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
+	if err != nil {
+		t.Fatalf("TestWriteTo %s: %v\n", inFile, err)
+	}
+
+}
+
+func TestWriteTo(t *testing.T) {
+
+	for _, inFile := range []string{"CenterOfWhy.pdf", "Acroforms2.pdf"} {
+		testWriteTo(t, inFile, true)
+		testWriteTo(t, inFile, false)
+	}
+
+}
+
+func writeToBuffer(t *testing.T, inFile string, xRefStream bool) []byte {
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.WriteXRefStream = xRefStream
+	config.WriteObjectStream = xRefStream
+
+	ctx, err := Read(filepath.Join(inDir, inFile), config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", inFile, err)
+	}
+
+	var buf bytes.Buffer
+
+	err = WriteTo(ctx, &buf)
+	if err != nil {
+		t.Fatalf("%s: %v\n", inFile, err)
+	}
+
+	return buf.Bytes()
+}
+
+func testRecover(t *testing.T, msg string, buf []byte, pageCount int) {
+
+	ctx, err := ReadFrom(bytes.NewReader(buf), pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if !ctx.Read.Recovered {
+		t.Fatalf("%s: xref table should have been recovered\n", msg)
+	}
+
+	if n, _ := ctx.Read.RecoveredObjectsString(); n == 0 {
+		t.Fatalf("%s: no objects recovered\n", msg)
+	}
+
+	err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if ctx.PageCount != pageCount {
+		t.Fatalf("%s: pageCount should be %d but is %d\n", msg, pageCount, ctx.PageCount)
+	}
+
+	err = WriteTo(ctx, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+}
+
+func TestRecoverDamagedFile(t *testing.T) {
+
+	// Corrupt startxref pointing into nowhere.
+	buf := writeToBuffer(t, "CenterOfWhy.pdf", false)
+	i := bytes.LastIndex(buf, []byte("startxref"))
+	buf = append(buf[:i:i], []byte("startxref\n99999999\n%%EOF\n")...)
+	testRecover(t, "TestRecoverDamagedFile bad startxref", buf, 25)
+
+	// Corrupt xref section entries.
+	buf = writeToBuffer(t, "CenterOfWhy.pdf", false)
+	i = bytes.LastIndex(buf, []byte("\nxref"))
+	j := bytes.LastIndex(buf, []byte("trailer"))
+	for k := i + 20; k < j; k++ {
+		if buf[k] >= '0' && buf[k] <= '9' {
+			buf[k] = 'x'
+		}
+	}
+	testRecover(t, "TestRecoverDamagedFile bad xref entries", buf, 25)
+
+	// Well formed xref section entries pointing to shifted offsets.
+	buf = writeToBuffer(t, "CenterOfWhy.pdf", false)
+	i = bytes.LastIndex(buf, []byte("\nxref"))
+	j = bytes.LastIndex(buf, []byte("trailer"))
+	re := regexp.MustCompile(`(\d{10}) (\d{5}) n`)
+	xref := re.ReplaceAllFunc(buf[i:j], func(b []byte) []byte {
+		off, _ := strconv.Atoi(string(b[:10]))
+		return []byte(fmt.Sprintf("%010d%s", off+3, b[10:]))
+	})
+	buf = append(append(append([]byte{}, buf[:i]...), xref...), buf[j:]...)
+	testRecover(t, "TestRecoverDamagedFile shifted xref offsets", buf, 25)
+
+	// Truncated file missing its xref stream, objects contained in object streams.
+	buf = writeToBuffer(t, "CenterOfWhy.pdf", true)
+	i = bytes.LastIndex(buf, []byte("endobj"))
+	i = bytes.LastIndex(buf[:i], []byte("endobj")) + len("endobj")
+	testRecover(t, "TestRecoverDamagedFile truncated", buf[:i], 25)
+
+}
+
+// countdownContext gets cancelled after its Err method has been called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func checkNoOutput(t *testing.T, dir string) {
+
+	t.Helper()
+
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fi := range fileInfos {
+		if strings.HasSuffix(fi.Name(), ".tmp") {
+			t.Fatalf("partial output file left behind: %s", fi.Name())
+		}
+	}
+}
+
+func TestProcessContextCancelled(t *testing.T) {
+
+	dir, err := ioutil.TempDir(outDir, "cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inFile := filepath.Join(inDir, "CenterOfWhy.pdf")
+	outFile := filepath.Join(dir, "out.pdf")
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = ProcessContext(c, OptimizeCommand(inFile, outFile, pdfcpu.NewDefaultConfiguration()))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+
+	c, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-c.Done()
+
+	_, err = ProcessContext(c, ValidateCommand(inFile, pdfcpu.NewDefaultConfiguration()))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+
+	// Cancel at increasingly later stages of reading, validation, optimization and writing.
+	var cancelled, completed bool
+	for n := 1; !completed; n *= 2 {
+
+		config := pdfcpu.NewDefaultConfiguration()
+		c := &countdownContext{Context: context.Background(), n: n}
+
+		_, err = ProcessContext(c, OptimizeCommand(inFile, outFile, config))
+		if err == nil {
+			completed = true
+			break
+		}
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("n=%d: expected cancellation, got: %v", n, err)
+		}
+		cancelled = true
+
+		if _, err = os.Stat(outFile); !os.IsNotExist(err) {
+			t.Fatalf("n=%d: cancelled command wrote %s", n, outFile)
+		}
+		checkNoOutput(t, dir)
+
+		if config.Context != nil {
+			t.Fatalf("n=%d: context still configured", n)
+		}
+	}
+
+	if !cancelled {
+		t.Fatal("command did not get cancelled")
+	}
+
+	// Commands sharing a configuration are governed by their own context only.
+	config := pdfcpu.NewDefaultConfiguration()
+	done := make(chan error)
+	go func() {
+		_, err := ProcessContext(&countdownContext{Context: context.Background()}, ValidateCommand(inFile, config))
+		done <- err
+	}()
+	if _, err = ProcessContext(context.Background(), ValidateCommand(inFile, config)); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+
+	// A cancelled command must not touch an existing output file.
+	before, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trimFile := filepath.Join(dir, "trim.pdf")
+	cmd := TrimCommand(inFile, trimFile, []string{"1"}, pdfcpu.NewDefaultConfiguration())
+
+	// Count the cancellation checks of a complete run.
+	cc := &countdownContext{Context: context.Background(), n: 1 << 30}
+	if _, err = ProcessContext(cc, cmd); err != nil {
+		t.Fatal(err)
+	}
+	checks := 1<<30 - cc.n
+
+	// Cancel at the last check which happens while writing.
+	cmd.OutFile = &outFile
+	_, err = ProcessContext(&countdownContext{Context: context.Background(), n: checks - 1}, cmd)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+
+	after, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(before, after) {
+		t.Fatalf("cancelled command modified %s", outFile)
+	}
+	checkNoOutput(t, dir)
+
+	// Cancelled commands writing several files remove the files written so far.
+	for _, newCmd := range []func(dirOut string) *Command{
+		func(dirOut string) *Command { return SplitCommand(inFile, dirOut, pdfcpu.NewDefaultConfiguration()) },
+		func(dirOut string) *Command {
+			return ExtractPagesCommand(inFile, dirOut, []string{"1-3"}, pdfcpu.NewDefaultConfiguration())
+		},
+	} {
+		dirOut, err := ioutil.TempDir(dir, "multi")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := newCmd(dirOut)
+		cc := &countdownContext{Context: context.Background(), n: 1 << 30}
+		if _, err = ProcessContext(cc, cmd); err != nil {
+			t.Fatal(err)
+		}
+		checks := 1<<30 - cc.n
+
+		dirOut, err = ioutil.TempDir(dir, "multi")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cmd = newCmd(dirOut)
+		_, err = ProcessContext(&countdownContext{Context: context.Background(), n: checks - 1}, cmd)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("mode %d: expected cancellation, got: %v", cmd.Mode, err)
+		}
+
+		fileInfos, err := ioutil.ReadDir(dirOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fileInfos) > 0 {
+			t.Fatalf("mode %d: cancelled command left %d files behind", cmd.Mode, len(fileInfos))
+		}
+	}
+
+	// A command without configuration can still be cancelled.
+	_, err = ProcessContext(&countdownContext{Context: context.Background(), n: 1}, ValidateCommand(inFile, nil))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got: %v", err)
+	}
+}
+
+func readWithWorkers(inFile string, workers int, decodeAll bool) (*pdfcpu.PDFContext, error) {
+	config := pdfcpu.NewDefaultConfiguration()
+	config.Workers = workers
+	config.DecodeAllStreams = decodeAll
+	return Read(inFile, config)
+}
+
+// Reading with concurrent stream decoding has to produce the same xRefTable as sequential reading.
+func TestConcurrentDecoding(t *testing.T) {
+
+	files, err := ioutil.ReadDir(inDir)
+	if err != nil {
+		t.Fatalf("TestConcurrentDecoding: %v\n", err)
+	}
+
+	for _, decodeAll := range []bool{false, true} {
+
+		for _, file := range files {
+
+			if !strings.HasSuffix(file.Name(), "pdf") {
+				continue
+			}
+
+			inFile := filepath.Join(inDir, file.Name())
+
+			want, wantErr := readWithWorkers(inFile, 1, decodeAll)
+			got, err := readWithWorkers(inFile, 8, decodeAll)
+
+			if (wantErr == nil) != (err == nil) {
+				t.Fatalf("TestConcurrentDecoding: %s: sequential: %v, concurrent: %v\n", inFile, wantErr, err)
+			}
+
+			if err != nil {
+				if wantErr.Error() != err.Error() {
+					t.Fatalf("TestConcurrentDecoding: %s: sequential: %v, concurrent: %v\n", inFile, wantErr, err)
+				}
+				continue
+			}
+
+			if len(want.Table) != len(got.Table) {
+				t.Fatalf("TestConcurrentDecoding: %s: xRefTable size mismatch: %d vs %d\n", inFile, len(want.Table), len(got.Table))
+			}
+
+			for objNr, entry := range want.Table {
+				if !reflect.DeepEqual(entry, got.Table[objNr]) {
+					t.Fatalf("TestConcurrentDecoding: %s: obj#%d differs (decodeAll=%t)\n", inFile, objNr, decodeAll)
+				}
+			}
+
+			if want.Read.UsingObjectStreams != got.Read.UsingObjectStreams || want.Read.BinaryTotalSize != got.Read.BinaryTotalSize {
+				t.Fatalf("TestConcurrentDecoding: %s: read stats differ\n", inFile)
+			}
+
+			want.Read.Close()
+			got.Read.Close()
+		}
+	}
+
+}
+
 // Validate all PDFs in testdata.
 func TestValidateCommand(t *testing.T) {
 
@@ -427,6 +851,107 @@ func TestExtractPagesCommand(t *testing.T) {
 
 }
 
+func lazyConfiguration() *pdfcpu.Configuration {
+	config := pdfcpu.NewDefaultConfiguration()
+	config.Lazy = true
+	config.LazyMemoryBudget = 64 * 1024
+	return config
+}
+
+// Validate and optimize all PDFs in testdata reading lazily under a tight memory budget.
+func TestLazyReading(t *testing.T) {
+
+	files, err := ioutil.ReadDir(inDir)
+	if err != nil {
+		t.Fatalf("TestLazyReading: %v\n", err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), "pdf") {
+			inFile := filepath.Join(inDir, file.Name())
+
+			_, err = Process(ValidateCommand(inFile, lazyConfiguration()))
+			if err != nil {
+				t.Fatalf("TestLazyReading: %v\n", err)
+			}
+
+			outFile := filepath.Join(outDir, "lazy.pdf")
+			_, err = Process(OptimizeCommand(inFile, outFile, lazyConfiguration()))
+			if err != nil {
+				t.Fatalf("TestLazyReading: %v\n", err)
+			}
+
+			_, err = Process(ValidateCommand(outFile, pdfcpu.NewDefaultConfiguration()))
+			if err != nil {
+				t.Fatalf("TestLazyReading: %s: %v\n", inFile, err)
+			}
+		}
+	}
+
+}
+
+func TestLazyExtractPagesCommand(t *testing.T) {
+
+	inFile := filepath.Join(inDir, "TheGoProgrammingLanguageCh1.pdf")
+
+	_, err := Process(ExtractPagesCommand(inFile, outDir, []string{"1"}, lazyConfiguration()))
+	if err != nil {
+		t.Fatalf("TestLazyExtractPagesCommand: %v\n", err)
+	}
+
+}
+
+func TestLazyMergeCommand(t *testing.T) {
+
+	inFiles := []string{
+		filepath.Join(inDir, "Acroforms2.pdf"),
+		filepath.Join(inDir, "adobe_errata.pdf"),
+		filepath.Join(inDir, "CenterOfWhy.pdf"),
+	}
+
+	outFile := filepath.Join(outDir, "lazyMerge.pdf")
+	_, err := Process(MergeCommand(inFiles, outFile, lazyConfiguration()))
+	if err != nil {
+		t.Fatalf("TestLazyMergeCommand: %v\n", err)
+	}
+
+	_, err = Process(ValidateCommand(outFile, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("TestLazyMergeCommand: %v\n", err)
+	}
+
+}
+
+// Encrypt and decrypt reading lazily.
+func TestLazyEncryption(t *testing.T) {
+
+	inFile := filepath.Join(inDir, "CenterOfWhy.pdf")
+	encFile := filepath.Join(outDir, "lazyEnc.pdf")
+	decFile := filepath.Join(outDir, "lazyDec.pdf")
+
+	config := lazyConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	_, err := Process(EncryptCommand(inFile, encFile, config))
+	if err != nil {
+		t.Fatalf("TestLazyEncryption: %v\n", err)
+	}
+
+	config = lazyConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	_, err = Process(DecryptCommand(encFile, decFile, config))
+	if err != nil {
+		t.Fatalf("TestLazyEncryption: %v\n", err)
+	}
+
+	_, err = Process(ValidateCommand(decFile, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("TestLazyEncryption: %v\n", err)
+	}
+
+}
+
 func TestEncryptUPWOnly(t *testing.T) {
 
 	// Test for setting only the user password.
@@ -983,13 +1508,512 @@ func TestEncryptDecrypt(t *testing.T) {
 	config.EncryptUsingAES = false
 	config.EncryptUsing128BitKey = false
 	encryptDecrypt("networkProgr.pdf", config, t)
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.EncryptUsing256BitKey = true
+	encryptDecrypt("5116.DCT_Filter.pdf", config, t)
 }
 
-func copyFile(srcFileName, destFileName string) (err error) {
+func TestEncryptAES256(t *testing.T) {
 
-	from, err := os.Open(srcFileName)
-	if err != nil {
-		return
+	msg := "TestEncryptAES256"
+
+	inFile := filepath.Join(inDir, "testImage.pdf")
+	outFile := filepath.Join(outDir, "testAES256.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.EncryptUsing256BitKey = true
+	_, err := Process(EncryptCommand(inFile, outFile, config))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	ctx, err := Read(outFile, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if ctx.E == nil || ctx.E.R != 6 || ctx.E.V != 5 || len(ctx.EncKey) != 32 || !ctx.AES4Strings || !ctx.AES4Streams {
+		t.Fatalf("%s: want AES-256 encryption, got %+v\n", msg, ctx.E)
+	}
+	if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// The AES-256 extension raises older files to PDF 1.7.
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.EncryptUsing256BitKey = true
+	config.Mode = pdfcpu.ENCRYPT
+	if ctx, err = Read(inFile, config); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if ctx.Version() >= pdfcpu.V17 {
+		t.Fatalf("%s: %s: unexpected version %s\n", msg, inFile, pdfcpu.VersionString(ctx.Version()))
+	}
+	if err = WriteTo(ctx, ioutil.Discard); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if ctx.Version() != pdfcpu.V17 {
+		t.Fatalf("%s: want version 1.7, got %s\n", msg, pdfcpu.VersionString(ctx.Version()))
+	}
+
+	// AES-256 requires AES.
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.EncryptUsingAES = false
+	config.EncryptUsing256BitKey = true
+	if _, err = Process(EncryptCommand(inFile, outFile, config)); err == nil {
+		t.Fatalf("%s: RC4 using 256 bit keys should fail\n", msg)
+	}
+}
+
+func newTestKeyPair(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	return cert, key
+}
+
+func writePEM(t *testing.T, fileName string, blocks ...*pem.Block) {
+
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		if err := pem.Encode(&buf, b); err != nil {
+			t.Fatalf("%s: %v\n", fileName, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+}
+
+func TestEncryptPubSec(t *testing.T) {
+
+	msg := "TestEncryptPubSec"
+
+	inFile := filepath.Join(inDir, "testImage.pdf")
+	outFile := filepath.Join(outDir, "testPubSec.pdf")
+
+	// Alice uses a PEM key pair, Bob a PKCS#12 file, Eve is no recipient.
+	aliceCert, aliceKey := newTestKeyPair(t, "Alice")
+	aliceFile := filepath.Join(outDir, "alice.pem")
+	writePEM(t, aliceFile,
+		&pem.Block{Type: "CERTIFICATE", Bytes: aliceCert.Raw},
+		&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(aliceKey)})
+
+	eveCert, eveKey := newTestKeyPair(t, "Eve")
+
+	alice, err := pdfcpu.LoadKeyPair(aliceFile, "")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	bob, err := pdfcpu.LoadKeyPair(filepath.Join(inDir, "bob.p12"), "bobpw")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	bobCertFile := filepath.Join(outDir, "bob.crt")
+	writePEM(t, bobCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: bob.Cert.Raw})
+	certs, err := pdfcpu.LoadCertificates(bobCertFile)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(bob.Cert) {
+		t.Fatalf("%s: LoadCertificates: %v\n", msg, err)
+	}
+	eve := &pdfcpu.KeyPair{Cert: eveCert, Key: eveKey}
+
+	for _, tt := range []struct {
+		aes      bool
+		key256   bool
+		wantV    int
+		wantKeyL int
+	}{
+		{false, false, 4, 16},
+		{true, false, 4, 16},
+		{true, true, 5, 32},
+	} {
+		config := pdfcpu.NewDefaultConfiguration()
+		config.EncryptUsingAES = tt.aes
+		config.EncryptUsing256BitKey = tt.key256
+		config.Recipients = []pdfcpu.Recipient{
+			{Cert: alice.Cert, Permissions: pdfcpu.PermissionsAll},
+			{Cert: certs[0], Permissions: pdfcpu.PermissionsNone},
+		}
+		if _, err = Process(EncryptCommand(inFile, outFile, config)); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		for _, r := range []struct {
+			kp   *pdfcpu.KeyPair
+			perm int16
+		}{
+			{alice, pdfcpu.PermissionsAll},
+			{bob, pdfcpu.PermissionsNone},
+		} {
+			config = pdfcpu.NewDefaultConfiguration()
+			config.KeyPair = r.kp
+			ctx, err := Read(outFile, config)
+			if err != nil {
+				t.Fatalf("%s %s: %v\n", msg, r.kp.Cert.Subject.CommonName, err)
+			}
+			if !ctx.E.PubSec || ctx.E.V != tt.wantV || len(ctx.EncKey) != tt.wantKeyL || ctx.AES4Streams != tt.aes {
+				t.Fatalf("%s %s: unexpected encryption %+v\n", msg, r.kp.Cert.Subject.CommonName, ctx.E)
+			}
+			if int16(ctx.E.P) != r.perm {
+				t.Fatalf("%s %s: want permissions %d, got %d\n", msg, r.kp.Cert.Subject.CommonName, r.perm, ctx.E.P)
+			}
+			if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+				t.Fatalf("%s %s: %v\n", msg, r.kp.Cert.Subject.CommonName, err)
+			}
+		}
+
+		// No key pair or the wrong one.
+		for _, kp := range []*pdfcpu.KeyPair{nil, eve} {
+			config = pdfcpu.NewDefaultConfiguration()
+			config.KeyPair = kp
+			if _, err = Read(outFile, config); err == nil {
+				t.Fatalf("%s: reading without recipient key pair should fail\n", msg)
+			}
+		}
+	}
+
+	// Decrypt as Alice.
+	decFile := filepath.Join(outDir, "testPubSecDecrypted.pdf")
+	config := pdfcpu.NewDefaultConfiguration()
+	config.KeyPair = alice
+	if _, err = Process(DecryptCommand(outFile, decFile, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if _, err = Process(ValidateCommand(decFile, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Public-key encryption requires at least 128 bit keys.
+	config = pdfcpu.NewDefaultConfiguration()
+	config.EncryptUsingAES = false
+	config.EncryptUsing128BitKey = false
+	config.Recipients = []pdfcpu.Recipient{{Cert: alice.Cert, Permissions: pdfcpu.PermissionsAll}}
+	if _, err = Process(EncryptCommand(inFile, outFile, config)); err == nil {
+		t.Fatalf("%s: public-key encryption using 40 bit keys should fail\n", msg)
+	}
+}
+
+// streamRaw returns the encoded content of a stream along with its object number.
+func streamRaw(t *testing.T, ctx *pdfcpu.PDFContext, obj pdfcpu.PDFObject) ([]byte, int) {
+
+	if a, ok := obj.(pdfcpu.PDFArray); ok {
+		obj = a[0]
+	}
+
+	indRef, ok := obj.(pdfcpu.PDFIndirectRef)
+	if !ok {
+		t.Fatalf("streamRaw: want indirect ref, got %v\n", obj)
+	}
+
+	sd, err := ctx.DereferenceStreamDict(indRef)
+	if err != nil || sd == nil {
+		t.Fatalf("streamRaw: missing stream %v: %v\n", indRef, err)
+	}
+
+	return sd.Raw, indRef.ObjectNumber.Value()
+}
+
+func pageContentRaw(t *testing.T, ctx *pdfcpu.PDFContext) ([]byte, int) {
+
+	d, _, err := ctx.PageDict(1)
+	if err != nil || d == nil {
+		t.Fatalf("pageContentRaw: %v\n", err)
+	}
+
+	obj, _ := d.Find("Contents")
+
+	return streamRaw(t, ctx, obj)
+}
+
+func metadataRaw(t *testing.T, ctx *pdfcpu.PDFContext) []byte {
+
+	d, err := ctx.Catalog()
+	if err != nil {
+		t.Fatalf("metadataRaw: %v\n", err)
+	}
+
+	obj, _ := d.Find("Metadata")
+	b, _ := streamRaw(t, ctx, obj)
+
+	return b
+}
+
+func encryptedFileContains(t *testing.T, fileName string, bb ...[]byte) []bool {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+
+	var res []bool
+	for _, v := range bb {
+		res = append(res, bytes.Contains(b, v))
+	}
+
+	return res
+}
+
+func TestEncryptMetadataFalse(t *testing.T) {
+
+	msg := "TestEncryptMetadataFalse"
+
+	inFile := filepath.Join(inDir, "Wonderwall.pdf")
+	outFile := filepath.Join(outDir, "testEncryptMetadataFalse.pdf")
+
+	ctx, err := Read(inFile, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	md := metadataRaw(t, ctx)
+	content, _ := pageContentRaw(t, ctx)
+
+	for _, tt := range []struct {
+		encryptMetadata, key256 bool
+	}{
+		{false, false},
+		{false, true},
+		{true, false},
+	} {
+		config := pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		config.OwnerPW = "opw"
+		config.UnencryptedMetadata = !tt.encryptMetadata
+		config.EncryptUsing256BitKey = tt.key256
+		if _, err = Process(EncryptCommand(inFile, outFile, config)); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		// Only the metadata may be readable.
+		found := encryptedFileContains(t, outFile, md, content)
+		if found[0] == tt.encryptMetadata || found[1] {
+			t.Fatalf("%s encryptMetadata=%t: metadata readable: %t, content readable: %t\n", msg, tt.encryptMetadata, found[0], found[1])
+		}
+
+		config = pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		ctx, err = Read(outFile, config)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		if ctx.E.Emd != tt.encryptMetadata {
+			t.Fatalf("%s: want EncryptMetadata %t\n", msg, tt.encryptMetadata)
+		}
+		if !bytes.Equal(metadataRaw(t, ctx), md) {
+			t.Fatalf("%s: metadata corrupt\n", msg)
+		}
+		if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+	}
+
+	// Crypt filters require 128 or 256 bit keys.
+	config := pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.EncryptUsingAES = false
+	config.EncryptUsing128BitKey = false
+	config.UnencryptedMetadata = true
+	if _, err = Process(EncryptCommand(inFile, outFile, config)); err == nil {
+		t.Fatalf("%s: using 40 bit keys should fail\n", msg)
+	}
+}
+
+func TestEncryptEmbeddedFilesOnly(t *testing.T) {
+
+	msg := "TestEncryptEmbeddedFilesOnly"
+
+	// Attach a file.
+	inFile := filepath.Join(outDir, "testEFF.pdf")
+	if err := copyFile(filepath.Join(inDir, "Wonderwall.pdf"), inFile); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	attachment := filepath.Join(outDir, "testEFF.txt")
+	want := bytes.Repeat([]byte("confidential "), 100)
+	if err := ioutil.WriteFile(attachment, want, 0644); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	_, err := Process(AddAttachmentsCommand(inFile, []string{attachment}, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, err := Read(inFile, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	content, _ := pageContentRaw(t, ctx)
+
+	var ef []byte
+	for _, entry := range ctx.Table {
+		if sd, ok := entry.Object.(pdfcpu.PDFStreamDict); ok && sd.Type() != nil && *sd.Type() == "EmbeddedFile" {
+			ef = sd.Raw
+		}
+	}
+	if ef == nil {
+		t.Fatalf("%s: missing embedded file stream\n", msg)
+	}
+
+	for _, recipients := range []bool{false, true} {
+
+		outFile := filepath.Join(outDir, "testEFFEncrypted.pdf")
+
+		config := pdfcpu.NewDefaultConfiguration()
+		config.EncryptEmbeddedFilesOnly = true
+		config.UserAccessPermissions = pdfcpu.PermissionsAll
+		if recipients {
+			cert, key := newTestKeyPair(t, "Alice")
+			config.Recipients = []pdfcpu.Recipient{{Cert: cert, Permissions: pdfcpu.PermissionsAll}}
+			config.KeyPair = &pdfcpu.KeyPair{Cert: cert, Key: key}
+		} else {
+			config.UserPW = "upw"
+			config.OwnerPW = "opw"
+		}
+		if _, err = Process(EncryptCommand(inFile, outFile, config)); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		// Only the embedded file is encrypted, content and strings like the file name are not.
+		found := encryptedFileContains(t, outFile, ef, content, []byte("(testEFF.txt)"))
+		if found[0] || !found[1] || !found[2] {
+			t.Fatalf("%s: embedded file readable: %t, content readable: %t, strings readable: %t\n", msg, found[0], found[1], found[2])
+		}
+
+		kp := config.KeyPair
+		config = pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		config.KeyPair = kp
+		ctx, err = Read(outFile, config)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		if ctx.E.StmF != "Identity" || ctx.E.StrF != "Identity" || ctx.E.EFF == "Identity" {
+			t.Fatalf("%s: unexpected crypt filters %+v\n", msg, ctx.E)
+		}
+		if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		dirOut := filepath.Join(outDir, "eff")
+		if err = os.MkdirAll(dirOut, 0755); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		if _, err = Process(ExtractAttachmentsCommand(outFile, dirOut, nil, config)); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(dirOut, "testEFF.txt"))
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: extracted attachment corrupt\n", msg)
+		}
+	}
+}
+
+func TestIdentityCryptFilter(t *testing.T) {
+
+	msg := "TestIdentityCryptFilter"
+
+	inFile := filepath.Join(inDir, "Wonderwall.pdf")
+	outFile := filepath.Join(outDir, "testIdentityCryptFilter.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.Mode = pdfcpu.ENCRYPT
+
+	ctx, err := Read(inFile, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	defer ctx.Read.Close()
+
+	md := metadataRaw(t, ctx)
+	content, objNr := pageContentRaw(t, ctx)
+
+	// Leave the content of page 1 unencrypted.
+	entry := ctx.Table[objNr]
+	sd := entry.Object.(pdfcpu.PDFStreamDict)
+	sd.InsertCryptFilter("Identity")
+	entry.Object = sd
+
+	ctx.Write.DirName, ctx.Write.FileName = filepath.Split(outFile)
+	if err = Write(ctx); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	found := encryptedFileContains(t, outFile, content, md)
+	if !found[0] || found[1] {
+		t.Fatalf("%s: content readable: %t, metadata readable: %t\n", msg, found[0], found[1])
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	if _, err = Process(ValidateCommand(outFile, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Decryption removes the crypt filter.
+	decFile := filepath.Join(outDir, "testIdentityCryptFilterDecrypted.pdf")
+	if _, err = Process(DecryptCommand(outFile, decFile, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, err = Read(decFile, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	got, objNr := pageContentRaw(t, ctx)
+	if !bytes.Equal(got, content) {
+		t.Fatalf("%s: page content corrupt\n", msg)
+	}
+	if f, _ := ctx.Table[objNr].Object.(pdfcpu.PDFStreamDict).Find("Filter"); f == nil || strings.Contains(f.String(), "Crypt") {
+		t.Fatalf("%s: want crypt filter removed, got %v\n", msg, f)
+	}
+	if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+}
+
+func copyFile(srcFileName, destFileName string) (err error) {
+
+	from, err := os.Open(srcFileName)
+	if err != nil {
+		return
 	}
 	defer from.Close()
 
@@ -1116,135 +2140,2725 @@ func TestAttachments(t *testing.T) {
 	testAttachmentsStage2(fileName, config, t)
 }
 
-func TestListPermissionsCommand(t *testing.T) {
+func checkIncrementalUpdate(t *testing.T, msg string, orig, buf []byte, xRefStream bool) *pdfcpu.PDFContext {
 
-	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
-	outFile := filepath.Join(outDir, "test.pdf")
+	if !bytes.HasPrefix(buf, orig) {
+		t.Fatalf("%s: original bytes modified\n", msg)
+	}
 
-	_, err := Process(ListPermissionsCommand(inFile, pdfcpu.NewDefaultConfiguration()))
-	if err != nil {
-		t.Fatalf("TestListPermissionsCommand: for unencrypted %s: %v\n", inFile, err)
+	if !bytes.Contains(buf[len(orig):], []byte("/Prev")) {
+		t.Fatalf("%s: missing /Prev\n", msg)
 	}
 
-	config := pdfcpu.NewDefaultConfiguration()
-	config.UserPW = "upw"
-	config.OwnerPW = "opw"
-	_, err = Process(EncryptCommand(inFile, outFile, config))
+	ctx, err := ReadFrom(bytes.NewReader(buf), pdfcpu.NewDefaultConfiguration())
 	if err != nil {
-		t.Fatalf("TestEncryptDecrypt - encrypt %s: %v\n", outFile, err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
-	config = pdfcpu.NewDefaultConfiguration()
-	config.UserPW = "upw"
-	config.OwnerPW = "opw"
-	_, err = Process(ListPermissionsCommand(outFile, config))
+	if ctx.Read.UsingXRefStreams != xRefStream {
+		t.Fatalf("%s: UsingXRefStreams should be %t\n", msg, xRefStream)
+	}
+
+	err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
 	if err != nil {
-		t.Fatalf("TestListPermissionsCommand: for encrypted %s: %v\n", outFile, err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
+	return ctx
 }
 
-func TestUnknownCommand(t *testing.T) {
-
-	config := pdfcpu.NewDefaultConfiguration()
-	inFile := filepath.Join(outDir, "go.pdf")
+func testIncrementalWatermark(t *testing.T, fileName string, xRefStream, lazy bool) {
 
-	cmd := &Command{
-		Mode:   99,
-		InFile: &inFile,
-		Config: config}
+	msg := "testIncrementalWatermark " + fileName
+	inFile := filepath.Join(inDir, fileName)
 
-	_, err := Process(cmd)
-	if err == nil {
-		t.Fatal("TestUnknowncommand - should have failed")
+	orig, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
-}
+	config := pdfcpu.NewDefaultConfiguration()
+	config.Incremental = true
+	config.Lazy = lazy
 
-func xxxTestDemoXRef(t *testing.T) {
+	ctx, _, _, err := readAndValidate(inFile, config, time.Now())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	defer ctx.Read.Close()
 
-	xRefTable, err := pdfcpu.CreateAnnotationDemoXRef()
+	pageCount := ctx.PageCount
+
+	keys, err := ctx.DirtyObjects()
 	if err != nil {
-		t.Fatalf("testDemoXRef %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
-	if xRefTable == nil {
-		t.Fatal("testDemoXRef: xRefTable == nil")
+	if len(keys) > 0 {
+		t.Fatalf("%s: objects changed by reading: %v\n", msg, keys)
 	}
 
-	err = pdfcpu.ValidateXRefTable(xRefTable)
+	// Saving without changes leaves the file untouched.
+	var buf bytes.Buffer
+
+	if err = WriteTo(ctx, &buf); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if !bytes.Equal(buf.Bytes(), orig) {
+		t.Fatalf("%s: unchanged file modified\n", msg)
+	}
+
+	var id pdfcpu.PDFArray
+	if ctx.ID != nil {
+		id = *ctx.ID
+	}
+
+	wm, err := pdfcpu.ParseWatermarkDetails("Signed, s:0.5", false)
 	if err != nil {
-		t.Fatalf("testDemoXRef %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
-	// var logStr []string
-	// logStr = xRefTable.List(logStr)
-	// t.Logf("XRefTable:\n%s\n", strings.Join(logStr, ""))
+	err = pdfcpu.AddWatermarks(ctx.XRefTable, pdfcpu.IntSet{1: true}, wm)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	keys, err = ctx.DirtyObjects()
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(keys) == 0 || len(keys) > 20 {
+		t.Fatalf("%s: unexpected changed objects: %v\n", msg, keys)
+	}
+
+	buf.Reset()
+
+	err = WriteTo(ctx, &buf)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx = checkIncrementalUpdate(t, msg, orig, buf.Bytes(), xRefStream)
+
+	// The modified file keeps its permanent identifier.
+	if id != nil {
+		if ctx.ID == nil || len(*ctx.ID) != 2 {
+			t.Fatalf("%s: missing ID\n", msg)
+		}
+		if (*ctx.ID)[0] != id[0] || (*ctx.ID)[1] == id[1] {
+			t.Fatalf("%s: want ID [%s <changed>], got %s\n", msg, id[0], *ctx.ID)
+		}
+	}
+
+	if ctx.PageCount != pageCount {
+		t.Fatalf("%s: pageCount should be %d but is %d\n", msg, pageCount, ctx.PageCount)
+	}
+
+	// Page 1 refers to the watermark.
+	pageDict, _, err := ctx.PageDict(1)
+	if err != nil || pageDict == nil {
+		t.Fatalf("%s: missing page 1: %v\n", msg, err)
+	}
+
+	if obj, found := pageDict.Find("Contents"); !found || !strings.Contains(obj.PDFString(), " R") {
+		t.Fatalf("%s: page 1 has no content\n", msg)
+	}
 }
 
-func TestCreateDemoPDF(t *testing.T) {
+func TestIncrementalUpdate(t *testing.T) {
 
-	xRefTable, err := pdfcpu.CreateDemoXRef()
+	testIncrementalWatermark(t, "ProgrammingInJava.pdf", false, false)
+	testIncrementalWatermark(t, "TheGoProgrammingLanguageCh1.pdf", true, false)
+	testIncrementalWatermark(t, "TheGoProgrammingLanguageCh1.pdf", true, true)
+
+	msg := "TestIncrementalUpdate"
+
+	inFile := filepath.Join(inDir, "go.pdf")
+	fileName := filepath.Join(outDir, "incremental.pdf")
+
+	err := copyFile(inFile, fileName)
 	if err != nil {
-		t.Fatalf("testCreateDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
-	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "demo.pdf")
+	orig, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		t.Fatalf("testCreateDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
 	config := pdfcpu.NewDefaultConfiguration()
-	config.ValidationMode = pdfcpu.ValidationRelaxed
+	config.Incremental = true
 
-	outFile := filepath.Join(outDir, "demo.pdf")
-	_, err = Process(ValidateCommand(outFile, config))
+	_, err = Process(AddAttachmentsCommand(fileName, []string{filepath.Join(inDir, "test.wav")}, config))
 	if err != nil {
-		t.Fatalf("testCreateDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx := checkIncrementalUpdate(t, msg, orig, buf, true)
+
+	list, err := Process(ListAttachmentsCommand(fileName, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("%s: should have 1 attachment, got %v\n", msg, list)
+	}
+
+	// Changing the encryption requires a full rewrite.
+	ctx.Incremental = true
+	ctx.Mode = pdfcpu.ENCRYPT
+	if err = WriteTo(ctx, ioutil.Discard); err == nil {
+		t.Fatalf("%s: incremental encryption should fail\n", msg)
 	}
 }
 
-func TestAnnotationDemoPDF(t *testing.T) {
+func TestRevisions(t *testing.T) {
 
-	xRefTable, err := pdfcpu.CreateAnnotationDemoXRef()
+	msg := "TestRevisions"
+
+	inFile := filepath.Join(inDir, "ProgrammingInJava.pdf")
+	fileName := filepath.Join(outDir, "revisions.pdf")
+
+	err := copyFile(inFile, fileName)
 	if err != nil {
-		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
 	}
 
-	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "annotationDemo.pdf")
+	config := pdfcpu.NewDefaultConfiguration()
+
+	list, err := Process(ListRevisionsCommand(fileName, config))
 	if err != nil {
-		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	n := len(list)
+
+	wm, err := pdfcpu.ParseWatermarkDetails("Draft", false)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	config.Incremental = true
+
+	// Create two incremental updates and remember each revision.
+	var revs [][]byte
+
+	for _, cmd := range []*Command{
+		AddAttachmentsCommand(fileName, []string{filepath.Join(inDir, "test.wav")}, config),
+		AddWatermarksCommand(fileName, fileName, nil, wm, config),
+	} {
+
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		revs = append(revs, b)
+
+		if _, err = Process(cmd); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+	}
+
+	list, err = Process(ListRevisionsCommand(fileName, config))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(list) != n+2 {
+		t.Fatalf("%s: want %d revisions, got %d: %v\n", msg, n+2, len(list), list)
+	}
+	if !strings.HasPrefix(list[n+1], fmt.Sprintf("revision %d: incremental update", n+2)) || !strings.Contains(list[n+1], "objects: ") {
+		t.Fatalf("%s: unexpected revision: %s\n", msg, list[n+1])
+	}
+
+	for i, want := range revs {
+
+		outFile := filepath.Join(outDir, fmt.Sprintf("revisions_rev%d.pdf", n+i))
+
+		_, err = Process(ExtractRevisionCommand(fileName, outFile, n+i, config))
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		got, err := ioutil.ReadFile(outFile)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		// A revision ends with the end of line following its %%EOF marker.
+		if !bytes.Equal(bytes.TrimRight(got, "\r\n"), bytes.TrimRight(want, "\r\n")) {
+			t.Fatalf("%s: revision %d differs from original\n", msg, n+i)
+		}
+
+		_, err = Process(ValidateCommand(outFile, pdfcpu.NewDefaultConfiguration()))
+		if err != nil {
+			t.Fatalf("%s: revision %d: %v\n", msg, n+i, err)
+		}
+	}
+
+	outFile := filepath.Join(outDir, "revisions_rev0.pdf")
+	if _, err = Process(ExtractRevisionCommand(fileName, outFile, n+3, config)); err == nil {
+		t.Fatalf("%s: extracting revision %d should fail\n", msg, n+3)
+	}
+
+	// Extracting revisions of an encrypted file needs no password.
+	encFile := filepath.Join(outDir, "revisionsEnc.pdf")
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	if _, err = Process(EncryptCommand(inFile, encFile, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	want, err := ioutil.ReadFile(encFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.Incremental = true
+	if _, err = Process(AddWatermarksCommand(encFile, encFile, nil, wm, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(ValidateCommand(encFile, pdfcpu.NewDefaultConfiguration())); err == nil {
+		t.Fatalf("%s: reading %s should require a password\n", msg, encFile)
+	}
+
+	list, err = Process(ListRevisionsCommand(encFile, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("%s: want 2 revisions, got %d: %v\n", msg, len(list), list)
+	}
+
+	outFile = filepath.Join(outDir, "revisionsEnc_rev1.pdf")
+	if _, err = Process(ExtractRevisionCommand(encFile, outFile, 1, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	got, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if !bytes.Equal(bytes.TrimRight(got, "\r\n"), bytes.TrimRight(want, "\r\n")) {
+		t.Fatalf("%s: encrypted revision 1 differs from original\n", msg)
+	}
+}
+
+// pageOffsetHintHeader returns the least page length, the least content stream offset
+// and the least content stream length recorded in the page offset hint table of a linearized file.
+func pageOffsetHintHeader(t *testing.T, fileName string, config *pdfcpu.Configuration) (pageLen, contentOffset, contentLen int64) {
+
+	t.Helper()
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+
+	m := regexp.MustCompile(`/H \[0*(\d+) `).FindSubmatch(b)
+	if m == nil {
+		t.Fatalf("%s: missing hint stream\n", fileName)
+	}
+
+	var off int64
+	fmt.Sscan(string(m[1]), &off)
+
+	config.DecodeAllStreams = true
+	ctx, err := Read(fileName, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+
+	for _, entry := range ctx.Table {
+		if entry.Free || entry.Offset == nil || *entry.Offset != off {
+			continue
+		}
+		sd, ok := entry.Object.(pdfcpu.PDFStreamDict)
+		if !ok || len(sd.Content) < 26 {
+			break
+		}
+		c := sd.Content
+		return int64(binary.BigEndian.Uint32(c[10:])), int64(binary.BigEndian.Uint32(c[16:])), int64(binary.BigEndian.Uint32(c[22:]))
 	}
 
+	t.Fatalf("%s: no hint stream at offset %d\n", fileName, off)
+	return 0, 0, 0
+}
+
+func TestLinearize(t *testing.T) {
+
+	msg := "TestLinearize"
+
+	// An encrypted source gets linearized with its encryption in place.
+	encFile := filepath.Join(outDir, "linearizeEnc.pdf")
 	config := pdfcpu.NewDefaultConfiguration()
-	config.ValidationMode = pdfcpu.ValidationRelaxed
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	_, err := Process(EncryptCommand(filepath.Join(inDir, "testImage.pdf"), encFile, config))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
 
-	outFile := filepath.Join(outDir, "annotationDemo.pdf")
-	_, err = Process(ValidateCommand(outFile, config))
+	for _, fileName := range []string{
+		filepath.Join(inDir, "annotTest.pdf"),                     // xref table
+		filepath.Join(inDir, "adobe_supplement_iso32000_1.pdf"),   // xref streams, already linearized
+		filepath.Join(inDir, "TheGoProgrammingLanguageCh1_1.pdf"), // object streams
+		encFile,
+	} {
+
+		config := pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		config.OwnerPW = "opw"
+
+		ctx, err := Read(fileName, config)
+		if err != nil {
+			t.Fatalf("%s: %s: %v\n", msg, fileName, err)
+		}
+		if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+			t.Fatalf("%s: %s: %v\n", msg, fileName, err)
+		}
+		pageCount := ctx.PageCount
+
+		outFile := filepath.Join(outDir, "linearized_"+filepath.Base(fileName))
+		_, err = Process(LinearizeCommand(fileName, outFile, config))
+		if err != nil {
+			t.Fatalf("%s: %s: %v\n", msg, fileName, err)
+		}
+
+		config = pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		config.OwnerPW = "opw"
+
+		ctx, err = Read(outFile, config)
+		if err != nil {
+			t.Fatalf("%s: %s: %v\n", msg, outFile, err)
+		}
+		if !ctx.Read.Linearized {
+			t.Fatalf("%s: %s: not linearized\n", msg, outFile)
+		}
+
+		err = pdfcpu.ValidateXRefTable(ctx.XRefTable)
+		if err != nil {
+			t.Fatalf("%s: %s: %v\n", msg, outFile, err)
+		}
+		if ctx.PageCount != pageCount {
+			t.Fatalf("%s: %s: want %d pages, got %d\n", msg, outFile, pageCount, ctx.PageCount)
+		}
+
+		// Content streams follow their page object and are part of the page.
+		pageLen, contentOffset, contentLen := pageOffsetHintHeader(t, outFile, config)
+		if contentOffset <= 0 || contentLen <= 0 || contentOffset+contentLen > pageLen {
+			t.Fatalf("%s: %s: page length %d, content stream offset %d length %d\n", msg, outFile, pageLen, contentOffset, contentLen)
+		}
+	}
+
+	// Relaxed validation ignores an inconsistent linearization dict.
+	fileName := filepath.Join(outDir, "linearized_annotTest.pdf")
+	b, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	b = regexp.MustCompile(`/H \[\d+`).ReplaceAllFunc(b, func(h []byte) []byte {
+		return []byte("/H [" + strings.Repeat("0", len(h)-4))
+	})
+	corruptFile := filepath.Join(outDir, "linearizedCorrupt.pdf")
+	if err = ioutil.WriteFile(corruptFile, b, 0644); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if _, err = Process(ValidateCommand(corruptFile, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: relaxed validation: %v\n", msg, err)
+	}
+	config = pdfcpu.NewDefaultConfiguration()
+	config.ValidationMode = pdfcpu.ValidationStrict
+	if _, err = Process(ValidateCommand(corruptFile, config)); err == nil {
+		t.Fatalf("%s: strict validation: expected error\n", msg)
 	}
 
+	// Linearization and incremental updates are mutually exclusive.
+	config = pdfcpu.NewDefaultConfiguration()
+	config.Incremental = true
+	config.Linearize = true
+	fileName = filepath.Join(outDir, "linearizeIncr.pdf")
+	if err = copyFile(filepath.Join(inDir, "annotTest.pdf"), fileName); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if _, err = Process(OptimizeCommand(fileName, fileName, config)); err == nil {
+		t.Fatalf("%s: incremental linearization should fail\n", msg)
+	}
 }
 
-func TestAcroformDemoPDF(t *testing.T) {
+func TestListPermissionsCommand(t *testing.T) {
 
-	xRefTable, err := pdfcpu.CreateAcroFormDemoXRef()
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile := filepath.Join(outDir, "test.pdf")
+
+	_, err := Process(ListPermissionsCommand(inFile, pdfcpu.NewDefaultConfiguration()))
 	if err != nil {
-		t.Fatalf("testAcroformDemoPDF %v\n", err)
+		t.Fatalf("TestListPermissionsCommand: for unencrypted %s: %v\n", inFile, err)
 	}
 
-	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "acroFormDemo.pdf")
+	config := pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	_, err = Process(EncryptCommand(inFile, outFile, config))
 	if err != nil {
-		t.Fatalf("testAcroformDemoPDF %v\n", err)
+		t.Fatalf("TestEncryptDecrypt - encrypt %s: %v\n", outFile, err)
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	_, err = Process(ListPermissionsCommand(outFile, config))
+	if err != nil {
+		t.Fatalf("TestListPermissionsCommand: for encrypted %s: %v\n", outFile, err)
+	}
+
+}
+
+func TestPermissionFlags(t *testing.T) {
+
+	msg := "TestPermissionFlags"
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile := filepath.Join(outDir, "testPermissionFlags.pdf")
+
+	newConfig := func() *pdfcpu.Configuration {
+		config := pdfcpu.NewDefaultConfiguration()
+		config.UserPW = "upw"
+		config.OwnerPW = "opw"
+		return config
+	}
+
+	for _, tt := range []struct {
+		aes, key128, key256 bool
+		perm, want          pdfcpu.PermissionFlags
+	}{
+		// Revision 2 does not distinguish between annotating and filling in forms.
+		{false, false, false, pdfcpu.PermPrint | pdfcpu.PermFillForms, pdfcpu.PermPrint | pdfcpu.PermPrintHigh | pdfcpu.PermAnnotate | pdfcpu.PermFillForms},
+		{false, true, false, pdfcpu.PermPrint | pdfcpu.PermFillForms, pdfcpu.PermPrint | pdfcpu.PermFillForms},
+		{true, true, false, pdfcpu.PermExtractAccessibility | pdfcpu.PermAssemble, pdfcpu.PermExtractAccessibility | pdfcpu.PermAssemble},
+		{true, true, true, pdfcpu.PermPrintHigh, pdfcpu.PermPrint | pdfcpu.PermPrintHigh},
+	} {
+		config := newConfig()
+		config.EncryptUsingAES = tt.aes
+		config.EncryptUsing128BitKey = tt.key128
+		config.EncryptUsing256BitKey = tt.key256
+		config.UserAccessPermissions = tt.perm.UserAccessPermissions()
+		if _, err := Process(EncryptCommand(inFile, outFile, config)); err != nil {
+			t.Fatalf("%s: encrypt %s: %v\n", msg, tt.perm, err)
+		}
+
+		f, err := GetPermissions(outFile, newConfig())
+		if err != nil {
+			t.Fatalf("%s: get permissions %s: %v\n", msg, tt.perm, err)
+		}
+		if f != tt.want {
+			t.Fatalf("%s: want %s, got %s\n", msg, tt.want, f)
+		}
+
+		list, err := ListPermissions(outFile, newConfig())
+		if err != nil {
+			t.Fatalf("%s: list permissions %s: %v\n", msg, tt.perm, err)
+		}
+		if len(list) != 9 {
+			t.Fatalf("%s: unexpected permission list: %v\n", msg, list)
+		}
 	}
 
+	// Trimming requires assembling which the user password does not grant.
+	trimFile := filepath.Join(outDir, "testPermissionFlagsTrim.pdf")
 	config := pdfcpu.NewDefaultConfiguration()
-	config.ValidationMode = pdfcpu.ValidationRelaxed
+	config.UserPW = "upw"
+	if _, err := Process(TrimCommand(outFile, trimFile, []string{"1"}, config)); err == nil {
+		t.Fatalf("%s: trim should fail\n", msg)
+	}
 
-	outFile := filepath.Join(outDir, "acroFormDemo.pdf")
-	_, err = Process(ValidateCommand(outFile, config))
+	config = newConfig()
+	config.UserAccessPermissions = (pdfcpu.PermAssemble | pdfcpu.PermPrint).UserAccessPermissions()
+	if _, err := Process(AddPermissionsCommand(outFile, config)); err != nil {
+		t.Fatalf("%s: add permissions: %v\n", msg, err)
+	}
+
+	f, err := GetPermissions(outFile, newConfig())
 	if err != nil {
-		t.Fatalf("testAcroformDemoPDF %v\n", err)
+		t.Fatalf("%s: get permissions: %v\n", msg, err)
+	}
+	if f != pdfcpu.PermAssemble|pdfcpu.PermPrint {
+		t.Fatalf("%s: want assemble and print, got %s\n", msg, f)
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	if _, err := Process(TrimCommand(outFile, trimFile, []string{"1"}, config)); err != nil {
+		t.Fatalf("%s: trim: %v\n", msg, err)
+	}
+}
+
+// signatureDicts returns the signature dicts of all signed top level signature fields of fileName.
+func signatureDicts(t *testing.T, fileName string, config *pdfcpu.Configuration) []*pdfcpu.PDFDict {
+
+	ctx, err := Read(fileName, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+	defer ctx.Read.Close()
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+
+	obj, _ := rootDict.Find("AcroForm")
+	acroForm, err := ctx.DereferenceDict(obj)
+	if err != nil || acroForm == nil {
+		t.Fatalf("%s: missing AcroForm %v\n", fileName, err)
+	}
+
+	obj, _ = acroForm.Find("Fields")
+	fields, err := ctx.DereferenceArray(obj)
+	if err != nil || fields == nil {
+		t.Fatalf("%s: missing Fields %v\n", fileName, err)
+	}
+
+	var dicts []*pdfcpu.PDFDict
+
+	for _, obj := range *fields {
+		field, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			t.Fatalf("%s: %v\n", fileName, err)
+		}
+		if ft := field.NameEntry("FT"); ft == nil || *ft != "Sig" {
+			continue
+		}
+		obj, found := field.Find("V")
+		if !found {
+			continue
+		}
+		dict, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			t.Fatalf("%s: %v\n", fileName, err)
+		}
+		dicts = append(dicts, dict)
 	}
 
+	return dicts
+}
+
+func checkSignedRevision(t *testing.T, msg, fileIn, fileOut string, config *pdfcpu.Configuration, signatures int) {
+
+	bIn, err := ioutil.ReadFile(fileIn)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	bOut, err := ioutil.ReadFile(fileOut)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if !bytes.HasPrefix(bOut, bIn) {
+		t.Fatalf("%s: %s is no incremental update of %s\n", msg, fileOut, fileIn)
+	}
+
+	if _, err = Process(ValidateCommand(fileOut, config)); err != nil {
+		t.Fatalf("%s: validate %s: %v\n", msg, fileOut, err)
+	}
+
+	dicts := signatureDicts(t, fileOut, config)
+	if len(dicts) != signatures {
+		t.Fatalf("%s: want %d signatures, got %d\n", msg, signatures, len(dicts))
+	}
+
+	// The latest signature covers the whole file except its Contents.
+	dict := dicts[len(dicts)-1]
+	br := dict.PDFArrayEntry("ByteRange")
+	if br == nil || len(*br) != 4 {
+		t.Fatalf("%s: corrupt ByteRange\n", msg)
+	}
+
+	var r [4]int
+	for i, o := range *br {
+		r[i] = o.(pdfcpu.PDFInteger).Value()
+	}
+
+	if r[0] != 0 || r[2]+r[3] != len(bOut) || bOut[r[1]] != '<' || bOut[r[2]-1] != '>' {
+		t.Fatalf("%s: ByteRange %v does not cover %d bytes\n", msg, r, len(bOut))
+	}
+
+	contents := dict.PDFHexLiteralEntry("Contents")
+	if contents == nil || strings.Trim(contents.Value(), "0") == "" {
+		t.Fatalf("%s: missing signature\n", msg)
+	}
+}
+
+func TestSign(t *testing.T) {
+
+	msg := "TestSign"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile1 := filepath.Join(outDir, "testSign1.pdf")
+	outFile2 := filepath.Join(outDir, "testSign2.pdf")
+
+	aliceCert, aliceKey := newTestKeyPair(t, "Alice")
+	aliceFile := filepath.Join(outDir, "alice.pem")
+	writePEM(t, aliceFile,
+		&pem.Block{Type: "CERTIFICATE", Bytes: aliceCert.Raw},
+		&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(aliceKey)})
+
+	bobFile := filepath.Join(inDir, "bob.p12")
+
+	// Signing requires a key pair.
+	sig, err := pdfcpu.ParseSignatureDetails("")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if _, err = Process(SignCommand(inFile, outFile1, sig, pdfcpu.NewDefaultConfiguration())); err == nil {
+		t.Fatalf("%s: signing without key pair should fail\n", msg)
+	}
+
+	// Alice signs visibly using adbe.pkcs7.detached.
+	config := pdfcpu.NewDefaultConfiguration()
+	config.KeyPair, err = pdfcpu.LoadKeyPair(aliceFile, "")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	sig, err = pdfcpu.ParseSignatureDetails("field:Approval, reason:Approved (final), location:Berlin, rect:50 50 250 110")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if _, err = Process(SignCommand(inFile, outFile1, sig, config)); err != nil {
+		t.Fatalf("%s: sign %s: %v\n", msg, inFile, err)
+	}
+
+	checkSignedRevision(t, msg, inFile, outFile1, pdfcpu.NewDefaultConfiguration(), 1)
+
+	// The field has been signed already.
+	sig = &pdfcpu.Signature{FieldName: "Approval"}
+	if _, err = Process(SignCommand(outFile1, outFile2, sig, config)); err == nil {
+		t.Fatalf("%s: signing a signed field should fail\n", msg)
+	}
+
+	// Bob countersigns invisibly using ETSI.CAdES.detached.
+	config = pdfcpu.NewDefaultConfiguration()
+	config.KeyPair, err = pdfcpu.LoadKeyPair(bobFile, "bobpw")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Strings of the signature dict may look like its placeholders.
+	sig = &pdfcpu.Signature{
+		SubFilter:   pdfcpu.SubFilterCAdESDetached,
+		Reason:      "/ByteRange[0 1 2 3]",
+		ContactInfo: "/Contents<00>",
+	}
+	if _, err = Process(SignCommand(outFile1, outFile2, sig, config)); err != nil {
+		t.Fatalf("%s: sign %s: %v\n", msg, outFile1, err)
+	}
+
+	if config.Incremental {
+		t.Fatalf("%s: signing modified the configuration\n", msg)
+	}
+
+	checkSignedRevision(t, msg, outFile1, outFile2, pdfcpu.NewDefaultConfiguration(), 2)
+
+	if svs := verifySignatures(t, msg, outFile2, ""); len(svs) != 2 || !svs[1].Valid {
+		t.Fatalf("%s: expected valid countersignature: %+v\n", msg, svs)
+	}
+
+	if sig.FieldName != "Signature1" || sig.Name != "Bob" {
+		t.Fatalf("%s: unexpected defaults: %s %s\n", msg, sig.FieldName, sig.Name)
+	}
+}
+
+func TestSignEncrypted(t *testing.T) {
+
+	msg := "TestSignEncrypted"
+
+	inFile := filepath.Join(inDir, "Wonderwall.pdf")
+	encFile := filepath.Join(outDir, "testSignEncrypted.pdf")
+	outFile := filepath.Join(outDir, "testSignEncryptedSigned.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.OwnerPW = "opw"
+	config.UserAccessPermissions = pdfcpu.PermFillForms.UserAccessPermissions()
+	if _, err := Process(EncryptCommand(inFile, encFile, config)); err != nil {
+		t.Fatalf("%s: encrypt %s: %v\n", msg, inFile, err)
+	}
+
+	cert, key := newTestKeyPair(t, "Alice")
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	config.KeyPair = &pdfcpu.KeyPair{Cert: cert, Key: key}
+
+	sig := &pdfcpu.Signature{Reason: "Reviewed"}
+	if _, err := Process(SignCommand(encFile, outFile, sig, config)); err != nil {
+		t.Fatalf("%s: sign %s: %v\n", msg, encFile, err)
+	}
+
+	config = pdfcpu.NewDefaultConfiguration()
+	config.UserPW = "upw"
+	checkSignedRevision(t, msg, encFile, outFile, config, 1)
+}
+
+// newTestChain returns a CA certificate along with a key pair issued by this CA.
+func newTestCA(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name + " CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	return ca, caKey
+}
+
+func newTestChain(t *testing.T, name string) (*x509.Certificate, *pdfcpu.KeyPair) {
+
+	ca, caKey := newTestCA(t, name)
+
+	return ca, newTestSigner(t, name, ca, caKey)
+}
+
+func newTestSigner(t *testing.T, name string, ca *x509.Certificate, caKey *rsa.PrivateKey) *pdfcpu.KeyPair {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s: %v\n", name, err)
+	}
+
+	return &pdfcpu.KeyPair{Cert: cert, Key: key, Chain: []*x509.Certificate{ca}}
+}
+
+func verifySignatures(t *testing.T, msg, fileName, trustDir string) []pdfcpu.SignatureVerification {
+
+	svs, err := VerifySignatures(fileName, trustDir, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: verify %s: %v\n", msg, fileName, err)
+	}
+
+	return svs
+}
+
+func TestVerifySignatures(t *testing.T) {
+
+	msg := "TestVerifySignatures"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile := filepath.Join(outDir, "testVerifySignatures.pdf")
+	tamperedFile := filepath.Join(outDir, "testVerifySignaturesTampered.pdf")
+
+	ca, kp := newTestChain(t, "Alice")
+
+	trustDir := filepath.Join(outDir, "trust")
+	if err := os.MkdirAll(trustDir, 0755); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	writePEM(t, filepath.Join(trustDir, "ca.pem"), &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	otherCA, _ := newTestChain(t, "Eve")
+	otherTrustDir := filepath.Join(outDir, "trustOther")
+	if err := os.MkdirAll(otherTrustDir, 0755); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(otherTrustDir, "ca.der"), otherCA.Raw, 0644); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.KeyPair = kp
+	sig := &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterCAdESDetached, Reason: "Approved"}
+	if _, err := Process(SignCommand(inFile, outFile, sig, config)); err != nil {
+		t.Fatalf("%s: sign %s: %v\n", msg, inFile, err)
+	}
+
+	// Without trust store the chain does not get checked.
+	svs := verifySignatures(t, msg, outFile, "")
+	if len(svs) != 1 {
+		t.Fatalf("%s: expected 1 signature, got %d\n", msg, len(svs))
+	}
+	sv := svs[0]
+	if !sv.Valid || !sv.ByteRangeValid || !sv.DigestValid || !sv.SignatureValid || sv.ChainChecked || sv.Modified {
+		t.Fatalf("%s: unexpected result: %+v\n", msg, sv)
+	}
+	if sv.Signer != "Alice" || sv.Reason != "Approved" || sv.Revision != 2 || sv.SigningTime == "" {
+		t.Fatalf("%s: unexpected details: %+v\n", msg, sv)
+	}
+
+	// The chain leads up to a trusted CA.
+	sv = verifySignatures(t, msg, outFile, trustDir)[0]
+	if !sv.Valid || !sv.Trusted || len(sv.Chain) != 2 {
+		t.Fatalf("%s: expected trusted chain: %+v\n", msg, sv)
+	}
+
+	sv = verifySignatures(t, msg, outFile, otherTrustDir)[0]
+	if sv.Valid || !sv.ChainChecked || sv.Trusted {
+		t.Fatalf("%s: expected untrusted chain: %+v\n", msg, sv)
+	}
+
+	// Modify a signed byte.
+	b, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	i := bytes.Index(b, []byte("/Reason"))
+	b[i+len("/Reason")+1] ^= 0x01
+	if err = ioutil.WriteFile(tamperedFile, b, 0644); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	sv = verifySignatures(t, msg, tamperedFile, trustDir)[0]
+	if sv.Valid || sv.DigestValid || !sv.ByteRangeValid {
+		t.Fatalf("%s: expected digest mismatch: %+v\n", msg, sv)
+	}
+
+	// Malformed byte ranges.
+	b, err = ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	i = bytes.Index(b, []byte("/ByteRange[")) + len("/ByteRange")
+	j := i + bytes.IndexByte(b[i:], ']') + 1
+	for b[j] == ' ' {
+		j++
+	}
+
+	for _, br := range []string{"[0 1 9000000000000000000 0]", "[0 100 200 9000000000000000000]", "[5 100 200 300]", "[0 100 101 300]"} {
+		bb := append([]byte{}, b...)
+		copy(bb[i:j], br+strings.Repeat(" ", j-i-len(br)))
+		if err = ioutil.WriteFile(tamperedFile, bb, 0644); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		sv = verifySignatures(t, msg, tamperedFile, "")[0]
+		if sv.Valid || sv.ByteRangeValid || len(sv.Problems) == 0 {
+			t.Fatalf("%s: %s: expected invalid ByteRange: %+v\n", msg, br, sv)
+		}
+	}
+
+	// Report as JSON.
+	out, err := Process(VerifySignaturesCommand(outFile, trustDir, true, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err = json.Unmarshal([]byte(strings.Join(out, "\n")), &svs); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(svs) != 1 || !svs[0].Valid || svs[0].SubFilter != pdfcpu.SubFilterCAdESDetached {
+		t.Fatalf("%s: unexpected JSON result: %v\n", msg, out)
+	}
+
+	// Report as text.
+	out, err = Process(VerifySignaturesCommand(outFile, "", false, pdfcpu.NewDefaultConfiguration()))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(out) == 0 || out[len(out)-1] != "  result      : valid" {
+		t.Fatalf("%s: unexpected text result: %v\n", msg, out)
+	}
+
+	// An unsigned file.
+	if svs = verifySignatures(t, msg, inFile, ""); len(svs) != 0 {
+		t.Fatalf("%s: expected no signatures, got %d\n", msg, len(svs))
+	}
+}
+
+func TestVerifyCertifiedSignatures(t *testing.T) {
+
+	msg := "TestVerifyCertifiedSignatures"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	attFile := filepath.Join(inDir, "go.pdf")
+
+	aliceCert, aliceKey := newTestKeyPair(t, "Alice")
+	bobCert, bobKey := newTestKeyPair(t, "Bob")
+
+	sign := func(fileIn, fileOut string, cert *x509.Certificate, key *rsa.PrivateKey, certify int) {
+		config := pdfcpu.NewDefaultConfiguration()
+		config.KeyPair = &pdfcpu.KeyPair{Cert: cert, Key: key}
+		sig := &pdfcpu.Signature{Certify: certify}
+		if _, err := Process(SignCommand(fileIn, fileOut, sig, config)); err != nil {
+			t.Fatalf("%s: sign %s: %v\n", msg, fileIn, err)
+		}
+	}
+
+	for i, tt := range []struct {
+		certify     int
+		countersign bool
+		attach      bool
+		valid       bool
+	}{
+		{1, true, false, false}, // No changes permitted.
+		{2, true, false, true},  // Signing permitted.
+		{2, false, true, false}, // Adding attachments not permitted.
+		{3, true, true, false},  // Adding attachments not permitted.
+	} {
+
+		certFile := filepath.Join(outDir, fmt.Sprintf("testCertified%d.pdf", i))
+		outFile := filepath.Join(outDir, fmt.Sprintf("testCertified%dModified.pdf", i))
+
+		sign(inFile, certFile, aliceCert, aliceKey, tt.certify)
+
+		svs := verifySignatures(t, msg, certFile, "")
+		if len(svs) != 1 || !svs[0].Valid || svs[0].DocMDP != tt.certify {
+			t.Fatalf("%s: unexpected certification: %+v\n", msg, svs)
+		}
+
+		// A certification signature has to be the first signature.
+		config := pdfcpu.NewDefaultConfiguration()
+		config.KeyPair = &pdfcpu.KeyPair{Cert: bobCert, Key: bobKey}
+		if _, err := Process(SignCommand(certFile, outFile, &pdfcpu.Signature{Certify: 2}, config)); err == nil {
+			t.Fatalf("%s: certifying a signed document should fail\n", msg)
+		}
+
+		fileIn := certFile
+
+		if tt.countersign {
+			sign(fileIn, outFile, bobCert, bobKey, 0)
+			fileIn = outFile
+		}
+
+		if tt.attach {
+			config := pdfcpu.NewDefaultConfiguration()
+			config.Incremental = true
+			if fileIn != outFile {
+				if err := copyFile(fileIn, outFile); err != nil {
+					t.Fatalf("%s: %v\n", msg, err)
+				}
+			}
+			if _, err := Process(AddAttachmentsCommand(outFile, []string{attFile}, config)); err != nil {
+				t.Fatalf("%s: attach %s: %v\n", msg, outFile, err)
+			}
+		}
+
+		sv := verifySignatures(t, msg, outFile, "")[0]
+		if !sv.Modified || sv.Valid != tt.valid || sv.Valid != (len(sv.Changes) == 0) {
+			t.Fatalf("%s: P=%d unexpected result: %+v\n", msg, tt.certify, sv)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+
+	config := pdfcpu.NewDefaultConfiguration()
+	inFile := filepath.Join(outDir, "go.pdf")
+
+	cmd := &Command{
+		Mode:   99,
+		InFile: &inFile,
+		Config: config}
+
+	_, err := Process(cmd)
+	if err == nil {
+		t.Fatal("TestUnknowncommand - should have failed")
+	}
+
+}
+
+func xxxTestDemoXRef(t *testing.T) {
+
+	xRefTable, err := pdfcpu.CreateAnnotationDemoXRef()
+	if err != nil {
+		t.Fatalf("testDemoXRef %v\n", err)
+	}
+	if xRefTable == nil {
+		t.Fatal("testDemoXRef: xRefTable == nil")
+	}
+
+	err = pdfcpu.ValidateXRefTable(xRefTable)
+	if err != nil {
+		t.Fatalf("testDemoXRef %v\n", err)
+	}
+
+	// var logStr []string
+	// logStr = xRefTable.List(logStr)
+	// t.Logf("XRefTable:\n%s\n", strings.Join(logStr, ""))
+}
+
+func TestCreateDemoPDF(t *testing.T) {
+
+	xRefTable, err := pdfcpu.CreateDemoXRef()
+	if err != nil {
+		t.Fatalf("testCreateDemoPDF %v\n", err)
+	}
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "demo.pdf")
+	if err != nil {
+		t.Fatalf("testCreateDemoPDF %v\n", err)
+	}
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.ValidationMode = pdfcpu.ValidationRelaxed
+
+	outFile := filepath.Join(outDir, "demo.pdf")
+	_, err = Process(ValidateCommand(outFile, config))
+	if err != nil {
+		t.Fatalf("testCreateDemoPDF %v\n", err)
+	}
+}
+
+func TestAnnotationDemoPDF(t *testing.T) {
+
+	xRefTable, err := pdfcpu.CreateAnnotationDemoXRef()
+	if err != nil {
+		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+	}
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "annotationDemo.pdf")
+	if err != nil {
+		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+	}
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.ValidationMode = pdfcpu.ValidationRelaxed
+
+	outFile := filepath.Join(outDir, "annotationDemo.pdf")
+	_, err = Process(ValidateCommand(outFile, config))
+	if err != nil {
+		t.Fatalf("testAnnotationDemoPDF %v\n", err)
+	}
+
+}
+
+func checkHeaderVersion(t *testing.T, fileName, want string) {
+
+	t.Helper()
+
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(buf, []byte("%PDF-"+want)) {
+		t.Fatalf("%s: header version should be %s: %q\n", fileName, want, buf[:8])
+	}
+}
+
+func validatePDF20(t *testing.T, fileName string, mode int, target *pdfcpu.PDFVersion) error {
+
+	t.Helper()
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.ValidationMode = mode
+	config.ValidationTarget = target
+
+	_, err := Process(ValidateCommand(fileName, config))
+
+	return err
+}
+
+func TestPDF20(t *testing.T) {
+
+	v, err := pdfcpu.Version("2.0")
+	if err != nil || v != pdfcpu.V20 || pdfcpu.VersionString(v) != "2.0" {
+		t.Fatalf("TestPDF20: version 2.0 not supported: %v\n", err)
+	}
+
+	xRefTable, err := pdfcpu.CreatePDF20DemoXRef()
+	if err != nil {
+		t.Fatalf("TestPDF20: %v\n", err)
+	}
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "pdf20Demo.pdf")
+	if err != nil {
+		t.Fatalf("TestPDF20: %v\n", err)
+	}
+
+	inFile := filepath.Join(outDir, "pdf20Demo.pdf")
+	checkHeaderVersion(t, inFile, "2.0")
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationRelaxed, nil); err != nil {
+		t.Fatalf("TestPDF20 relaxed: %v\n", err)
+	}
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationStrict, nil); err != nil {
+		t.Fatalf("TestPDF20 strict: %v\n", err)
+	}
+
+	// Associated files and projection annotations are unknown to PDF 1.7.
+	v17 := pdfcpu.V17
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationStrict, &v17); err == nil {
+		t.Fatal("TestPDF20 strict 1.7: should have failed")
+	}
+
+	// The target applies to strict mode only.
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationRelaxed, &v17); err != nil {
+		t.Fatalf("TestPDF20 relaxed 1.7: %v\n", err)
+	}
+
+	// Optimizing keeps the version.
+	outFile := filepath.Join(outDir, "pdf20DemoOpt.pdf")
+	if _, err = Process(OptimizeCommand(inFile, outFile, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("TestPDF20 optimize: %v\n", err)
+	}
+	checkHeaderVersion(t, outFile, "2.0")
+
+	if err = validatePDF20(t, outFile, pdfcpu.ValidationStrict, nil); err != nil {
+		t.Fatalf("TestPDF20 strict after optimize: %v\n", err)
+	}
+
+	// A strict target overrides the version a file claims.
+	// Writing a PDF 1.7 file adds Producer to the info dict which is deprecated in PDF 2.0.
+	v20 := pdfcpu.V20
+	xRefTable.HeaderVersion = &v17
+	info := xRefTable.Info
+	xRefTable.Info = nil
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "pdf17Demo.pdf")
+	if err != nil {
+		t.Fatalf("TestPDF20: %v\n", err)
+	}
+
+	inFile = filepath.Join(outDir, "pdf17Demo.pdf")
+	checkHeaderVersion(t, inFile, "1.7")
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationStrict, nil); err == nil {
+		t.Fatal("TestPDF20 strict 1.7 file: should have failed")
+	}
+
+	// PDF/A-3 files carry associated files regardless of their version.
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationRelaxed, nil); err != nil {
+		t.Fatalf("TestPDF20 relaxed 1.7 file: %v\n", err)
+	}
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationStrict, &v20); err != nil {
+		t.Fatalf("TestPDF20 strict 1.7 file, 2.0 target: %v\n", err)
+	}
+
+	xRefTable.HeaderVersion = &v20
+	xRefTable.Info = info
+
+	// PDF 2.0 deprecates the document title in the info dict.
+	infoDict, err := xRefTable.DereferenceDict(*xRefTable.Info)
+	if err != nil {
+		t.Fatalf("TestPDF20: %v\n", err)
+	}
+	infoDict.InsertString("Title", "PDF 2.0 demo")
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "pdf20DemoTitle.pdf")
+	if err != nil {
+		t.Fatalf("TestPDF20: %v\n", err)
+	}
+
+	inFile = filepath.Join(outDir, "pdf20DemoTitle.pdf")
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationRelaxed, nil); err != nil {
+		t.Fatalf("TestPDF20 relaxed deprecated: %v\n", err)
+	}
+
+	if err = validatePDF20(t, inFile, pdfcpu.ValidationStrict, nil); err == nil {
+		t.Fatal("TestPDF20 strict deprecated: should have failed")
+	}
+}
+
+func TestAcroformDemoPDF(t *testing.T) {
+
+	xRefTable, err := pdfcpu.CreateAcroFormDemoXRef()
+	if err != nil {
+		t.Fatalf("testAcroformDemoPDF %v\n", err)
+	}
+
+	err = pdfcpu.CreatePDF(xRefTable, outDir+"/", "acroFormDemo.pdf")
+	if err != nil {
+		t.Fatalf("testAcroformDemoPDF %v\n", err)
+	}
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.ValidationMode = pdfcpu.ValidationRelaxed
+
+	outFile := filepath.Join(outDir, "acroFormDemo.pdf")
+	_, err = Process(ValidateCommand(outFile, config))
+	if err != nil {
+		t.Fatalf("testAcroformDemoPDF %v\n", err)
+	}
+
+}
+
+// RFC 6960 OCSPResponse
+type testOCSPResponse struct {
+	Status   asn1.Enumerated
+	Response struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0"`
+}
+
+type testOCSPSingleResponse struct {
+	CertID struct {
+		HashAlgorithm  pkix.AlgorithmIdentifier
+		IssuerNameHash []byte
+		IssuerKeyHash  []byte
+		SerialNumber   *big.Int
+	}
+	CertStatus asn1.RawValue
+	ThisUpdate time.Time `asn1:"generalized"`
+}
+
+type testOCSPResponseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []testOCSPSingleResponse
+}
+
+type testBasicOCSPResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+// newTestOCSPResponse returns a DER encoded OCSP response reporting cert as good.
+func newTestOCSPResponse(t *testing.T, cert, ca *x509.Certificate, caKey *rsa.PrivateKey) []byte {
+
+	nameHash := sha1.Sum(cert.RawIssuer)
+	keyHash := sha1.Sum(ca.RawSubjectPublicKeyInfo)
+
+	sr := testOCSPSingleResponse{CertStatus: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0}, ThisUpdate: time.Now().UTC()}
+	sr.CertID.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, Parameters: asn1.NullRawValue}
+	sr.CertID.IssuerNameHash = nameHash[:]
+	sr.CertID.IssuerKeyHash = keyHash[:]
+	sr.CertID.SerialNumber = cert.SerialNumber
+
+	keyID, err := asn1.Marshal(keyHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbs, err := asn1.Marshal(testOCSPResponseData{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyID},
+		ProducedAt:  time.Now().UTC(),
+		Responses:   []testOCSPSingleResponse{sr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(tbs)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, caKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basic, err := asn1.Marshal(testBasicOCSPResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.NullRawValue},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp testOCSPResponse
+	resp.Response.ResponseType = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	resp.Response.Response = basic
+
+	b, err := asn1.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// dssStreamCounts returns the number of certificates, OCSP responses and CRLs of a DSS dict or VRI dict.
+func dssStreamCounts(t *testing.T, ctx *pdfcpu.PDFContext, d *pdfcpu.PDFDict, keys ...string) []int {
+
+	var counts []int
+
+	for _, k := range keys {
+		a, err := ctx.DereferenceArray(d.Dict[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		if a != nil {
+			n = len(*a)
+		}
+		counts = append(counts, n)
+	}
+
+	return counts
+}
+
+func TestAddDSS(t *testing.T) {
+
+	msg := "TestAddDSS"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	signedFile := filepath.Join(outDir, "testAddDSSSigned.pdf")
+	outFile := filepath.Join(outDir, "testAddDSS.pdf")
+
+	ca, caKey := newTestCA(t, "Alice")
+	kp := newTestSigner(t, "Alice", ca, caKey)
+
+	config := pdfcpu.NewDefaultConfiguration()
+	config.KeyPair = kp
+	if _, err := Process(SignCommand(inFile, signedFile, &pdfcpu.Signature{}, config)); err != nil {
+		t.Fatalf("%s: sign %s: %v\n", msg, inFile, err)
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	caFile := filepath.Join(outDir, "testAddDSSCA.pem")
+	writePEM(t, caFile, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	crlFile := filepath.Join(outDir, "testAddDSS.crl")
+	writePEM(t, crlFile, &pem.Block{Type: "X509 CRL", Bytes: crl})
+
+	ocspFile := filepath.Join(outDir, "testAddDSS.ocsp")
+	if err = ioutil.WriteFile(ocspFile, newTestOCSPResponse(t, kp.Cert, ca, caKey), 0644); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	files := []string{caFile, crlFile, ocspFile}
+
+	// Adding validation data to an unsigned file fails.
+	if _, err = Process(AddDSSCommand(inFile, outFile, files, pdfcpu.NewDefaultConfiguration())); err == nil {
+		t.Fatalf("%s: expected error for unsigned file\n", msg)
+	}
+
+	if _, err = Process(AddDSSCommand(signedFile, outFile, files, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: add DSS: %v\n", msg, err)
+	}
+
+	// Adding the same validation data again does not duplicate any streams.
+	if _, err = Process(AddDSSCommand(outFile, outFile, files, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: add DSS again: %v\n", msg, err)
+	}
+
+	if _, err = Process(ValidateCommand(outFile, pdfcpu.NewDefaultConfiguration())); err != nil {
+		t.Fatalf("%s: validate %s: %v\n", msg, outFile, err)
+	}
+
+	ctx, err := Read(outFile, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: read %s: %v\n", msg, outFile, err)
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	dss, err := ctx.DereferenceDict(rootDict.Dict["DSS"])
+	if err != nil || dss == nil {
+		t.Fatalf("%s: missing DSS\n", msg)
+	}
+
+	if got := dssStreamCounts(t, ctx, dss, "Certs", "OCSPs", "CRLs"); !reflect.DeepEqual(got, []int{2, 1, 1}) {
+		t.Fatalf("%s: DSS Certs, OCSPs, CRLs: want [2 1 1], got %v\n", msg, got)
+	}
+
+	vri, err := ctx.DereferenceDict(dss.Dict["VRI"])
+	if err != nil || vri == nil || len(vri.Dict) != 1 {
+		t.Fatalf("%s: expected 1 VRI entry\n", msg)
+	}
+
+	for k, obj := range vri.Dict {
+
+		if len(k) != 40 || strings.ToUpper(k) != k {
+			t.Fatalf("%s: invalid VRI key %s\n", msg, k)
+		}
+
+		d, err := ctx.DereferenceDict(obj)
+		if err != nil || d == nil {
+			t.Fatalf("%s: corrupt VRI entry %s\n", msg, k)
+		}
+
+		if got := dssStreamCounts(t, ctx, d, "Cert", "OCSP", "CRL"); !reflect.DeepEqual(got, []int{2, 1, 1}) {
+			t.Fatalf("%s: VRI Cert, OCSP, CRL: want [2 1 1], got %v\n", msg, got)
+		}
+	}
+
+	// The DSS does not invalidate the signature.
+	svs := verifySignatures(t, msg, outFile, "")
+	if len(svs) != 1 || !svs[0].Valid {
+		t.Fatalf("%s: expected valid signature: %+v\n", msg, svs)
+	}
+
+	// Relaxed validation accepts a DSS in a PDF 1.4 file using lowercase VRI keys and direct streams.
+	v := pdfcpu.V14
+	ctx.HeaderVersion, ctx.RootVersion = &v, nil
+	rootDict.Delete("Version")
+
+	for k, obj := range vri.Dict {
+		vri.Delete(k)
+		vri.Insert(strings.ToLower(k), obj)
+	}
+
+	certs, err := ctx.DereferenceArray(dss.Dict["Certs"])
+	if err != nil || certs == nil {
+		t.Fatalf("%s: missing DSS Certs\n", msg)
+	}
+	sd, err := ctx.DereferenceStreamDict((*certs)[0])
+	if err != nil || sd == nil {
+		t.Fatalf("%s: corrupt DSS Certs\n", msg)
+	}
+	(*certs)[0] = *sd
+
+	ctx.XRefTable.ValidationMode = pdfcpu.ValidationRelaxed
+	if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err != nil {
+		t.Fatalf("%s: relaxed validation: %v\n", msg, err)
+	}
+
+	ctx.XRefTable.ValidationMode = pdfcpu.ValidationStrict
+	if err = pdfcpu.ValidateXRefTable(ctx.XRefTable); err == nil {
+		t.Fatalf("%s: strict validation: expected error\n", msg)
+	}
+}
+
+// RFC 3161 MessageImprint
+type testMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// RFC 3161 TimeStampReq
+type testTimeStampReq struct {
+	Version        int
+	MessageImprint testMessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+// RFC 3161 TSTInfo
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint testMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// RFC 3161 TimeStampResp
+type testTimeStampResp struct {
+	Status struct {
+		Status int
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// RFC 5652 SignedData and friends
+type testAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []interface{} `asn1:"set"`
+}
+
+type testIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type testSignerInfo struct {
+	Version            int
+	Sid                testIssuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+	Certificates asn1.RawValue
+	SignerInfos  []testSignerInfo `asn1:"set"`
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// testTSA is a local stand-in for a time stamping authority.
+type testTSA struct {
+	kp       *pdfcpu.KeyPair
+	serial   int64
+	tampered bool // Respond with a token for another message imprint.
+}
+
+func (tsa *testTSA) Timestamp(c context.Context, b []byte) ([]byte, error) {
+
+	var req testTimeStampReq
+	if _, err := asn1.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	if tsa.tampered {
+		req.MessageImprint.HashedMessage = make([]byte, len(req.MessageImprint.HashedMessage))
+	}
+
+	tsa.serial++
+
+	content, err := asn1.Marshal(testTSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(tsa.serial),
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oidTSTInfo := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256 := asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+	digest := sha256.Sum256(content)
+
+	var attrs []byte
+	for _, attr := range []testAttribute{
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}, Values: []interface{}{oidTSTInfo}},
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}, Values: []interface{}{digest[:]}},
+	} {
+		b, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b...)
+	}
+
+	// The signature covers the signed attributes using the SET OF tag.
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256(signed)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, tsa.kp.Key.(*rsa.PrivateKey), crypto.SHA256, h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	certs := append(append([]byte{}, tsa.kp.Cert.Raw...), tsa.kp.Chain[0].Raw...)
+
+	sd := testSignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []testSignerInfo{{
+			Version:            1,
+			Sid:                testIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: tsa.kp.Cert.RawIssuer}, SerialNumber: tsa.kp.Cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}, Parameters: asn1.NullRawValue},
+			Signature:          sig,
+		}},
+	}
+	sd.EncapContentInfo.EContentType = oidTSTInfo
+	sd.EncapContentInfo.EContent = content
+
+	b, err = asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp testTimeStampResp
+	resp.TimeStampToken = asn1.RawValue{FullBytes: token}
+
+	return asn1.Marshal(resp)
+}
+
+func TestDocumentTimestamp(t *testing.T) {
+
+	msg := "TestDocumentTimestamp"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	signedFile := filepath.Join(outDir, "testTimestampSigned.pdf")
+	outFile := filepath.Join(outDir, "testTimestamp.pdf")
+
+	tsaCA, tsaKP := newTestChain(t, "TSA")
+	tsa := &testTSA{kp: tsaKP}
+
+	trustDir := filepath.Join(outDir, "trustTSA")
+	if err := os.MkdirAll(trustDir, 0755); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	ca, kp := newTestChain(t, "Alice")
+
+	writePEM(t, filepath.Join(trustDir, "ca.pem"),
+		&pem.Block{Type: "CERTIFICATE", Bytes: tsaCA.Raw},
+		&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	for _, certify := range []int{0, 1} {
+
+		config := pdfcpu.NewDefaultConfiguration()
+		config.KeyPair = kp
+		if _, err := Process(SignCommand(inFile, signedFile, &pdfcpu.Signature{Certify: certify}, config)); err != nil {
+			t.Fatalf("%s: sign %s: %v\n", msg, inFile, err)
+		}
+
+		// A document timestamp needs a TSA.
+		config = pdfcpu.NewDefaultConfiguration()
+		sig := &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterRFC3161}
+		if _, err := Process(SignCommand(signedFile, outFile, sig, config)); err == nil {
+			t.Fatalf("%s: expected error for missing TSA\n", msg)
+		}
+
+		config.Timestamper = tsa
+		sig = &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterRFC3161}
+		if _, err := Process(SignCommand(signedFile, outFile, sig, config)); err != nil {
+			t.Fatalf("%s: timestamp %s: %v\n", msg, signedFile, err)
+		}
+
+		if _, err := Process(ValidateCommand(outFile, pdfcpu.NewDefaultConfiguration())); err != nil {
+			t.Fatalf("%s: validate %s: %v\n", msg, outFile, err)
+		}
+
+		// Even a certification signature permitting no changes remains valid.
+		svs := verifySignatures(t, msg, outFile, trustDir)
+		if len(svs) != 2 {
+			t.Fatalf("%s: expected 2 signatures, got %d\n", msg, len(svs))
+		}
+		if !svs[0].Valid || !svs[0].Modified || svs[0].DocMDP != certify {
+			t.Fatalf("%s: certify=%d: expected valid signature: %+v\n", msg, certify, svs[0])
+		}
+
+		ts := svs[1]
+		if !ts.Valid || ts.SubFilter != pdfcpu.SubFilterRFC3161 || ts.Signer != "TSA" || ts.SigningTime == "" || !ts.Trusted {
+			t.Fatalf("%s: expected valid timestamp: %+v\n", msg, ts)
+		}
+	}
+
+	// A token not matching the request gets rejected.
+	config := pdfcpu.NewDefaultConfiguration()
+	config.Timestamper = &testTSA{kp: tsaKP, tampered: true}
+	sig := &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterRFC3161}
+	if _, err := Process(SignCommand(signedFile, outFile, sig, config)); err == nil || !strings.Contains(err.Error(), "message imprint") {
+		t.Fatalf("%s: expected message imprint mismatch, got %v\n", msg, err)
+	}
+
+	// Timestamping an unsigned document.
+	config.Timestamper = tsa
+	sig = &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterRFC3161}
+	if _, err := Process(SignCommand(inFile, outFile, sig, config)); err != nil {
+		t.Fatalf("%s: timestamp %s: %v\n", msg, inFile, err)
+	}
+
+	svs := verifySignatures(t, msg, outFile, "")
+	if len(svs) != 1 || !svs[0].Valid || svs[0].Modified {
+		t.Fatalf("%s: expected valid timestamp: %+v\n", msg, svs)
+	}
+
+	// Talking to the TSA via HTTP.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		req, _ := ioutil.ReadAll(r.Body)
+		resp, err := tsa.Timestamp(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	config.Timestamper = pdfcpu.TSAClient{URL: server.URL}
+	sig = &pdfcpu.Signature{SubFilter: pdfcpu.SubFilterRFC3161}
+	if _, err := Process(SignCommand(signedFile, outFile, sig, config)); err != nil {
+		t.Fatalf("%s: timestamp %s via HTTP: %v\n", msg, signedFile, err)
+	}
+
+	svs = verifySignatures(t, msg, outFile, "")
+	if len(svs) != 2 || !svs[1].Valid {
+		t.Fatalf("%s: expected valid timestamp: %+v\n", msg, svs)
+	}
+}
+
+// pageRotation returns the Rotate entry of the page dict of page i or -1 if there is none.
+func pageRotation(t *testing.T, fileName string, i int) int {
+	t.Helper()
+
+	ctx, err := Read(fileName, pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("read %s: %v\n", fileName, err)
+	}
+	defer ctx.Read.Close()
+
+	d, _, err := ctx.PageDict(i)
+	if err != nil || d == nil {
+		t.Fatalf("%s: page %d: %v\n", fileName, i, err)
+	}
+
+	r := d.IntEntry("Rotate")
+	if r == nil {
+		return -1
+	}
+
+	return *r
+}
+
+func TestRotateCommand(t *testing.T) {
+
+	msg := "TestRotateCommand"
+
+	inFile := filepath.Join(inDir, "pike-stanford.pdf")
+	outFile := filepath.Join(outDir, "testRotate.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	if _, err := Process(RotateCommand(inFile, outFile, []string{"1-2"}, 45, config)); err == nil {
+		t.Fatalf("%s: expected error for rotation 45\n", msg)
+	}
+
+	if _, err := Process(RotateCommand(inFile, outFile, []string{"1-2"}, 90, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	for i, want := range []int{90, 90, -1} {
+		if r := pageRotation(t, outFile, i+1); r != want {
+			t.Fatalf("%s: page %d: got rotation %d, want %d\n", msg, i+1, r, want)
+		}
+	}
+
+	// Rotating by 270 brings page 1 back up.
+	outFile2 := filepath.Join(outDir, "testRotate2.pdf")
+	if _, err := Process(RotateCommand(outFile, outFile2, []string{"1"}, 270, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if r := pageRotation(t, outFile2, 1); r != 0 {
+		t.Fatalf("%s: got rotation %d, want 0\n", msg, r)
+	}
+
+	// Rotation inherited from the page tree root gets respected.
+	ctx, err := Read(inFile, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	defer ctx.Read.Close()
+
+	root, err := ctx.Pages()
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	d, err := ctx.DereferenceDict(*root)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	d.Insert("Rotate", pdfcpu.PDFInteger(180))
+
+	inheritedFile := filepath.Join(outDir, "testRotateInherited.pdf")
+	ctx.Write.DirName, ctx.Write.FileName = filepath.Split(inheritedFile)
+	if err = Write(ctx); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err := Process(RotateCommand(inheritedFile, outFile, []string{"1"}, 90, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	for i, want := range []int{270, -1} {
+		if r := pageRotation(t, outFile, i+1); r != want {
+			t.Fatalf("%s: page %d: got rotation %d, want %d\n", msg, i+1, r, want)
+		}
+	}
+}
+
+// pageObjNrs returns the object numbers of all pages in order.
+func pageObjNrs(t *testing.T, ctx *pdfcpu.PDFContext, indRef pdfcpu.PDFIndirectRef, objNrs []int) []int {
+	t.Helper()
+
+	d, err := ctx.DereferenceDict(indRef)
+	if err != nil || d == nil {
+		t.Fatalf("page tree node obj#%d: %v\n", indRef.ObjectNumber, err)
+	}
+
+	if *d.Type() == "Page" {
+		return append(objNrs, indRef.ObjectNumber.Value())
+	}
+
+	count := len(objNrs)
+	for _, o := range *d.PDFArrayEntry("Kids") {
+		kid := o.(pdfcpu.PDFIndirectRef)
+		kd, _ := ctx.DereferenceDict(kid)
+		if p := kd.IndirectRefEntry("Parent"); p == nil || *p != indRef {
+			t.Fatalf("obj#%d: wrong parent\n", kid.ObjectNumber)
+		}
+		objNrs = pageObjNrs(t, ctx, kid, objNrs)
+	}
+
+	if c := d.IntEntry("Count"); c == nil || *c != len(objNrs)-count {
+		t.Fatalf("page tree node obj#%d: wrong Count\n", indRef.ObjectNumber)
+	}
+
+	return objNrs
+}
+
+func readPages(t *testing.T, fileName string) (*pdfcpu.PDFContext, []int) {
+	t.Helper()
+
+	ctx, _, _, err := readAndValidate(fileName, pdfcpu.NewDefaultConfiguration(), time.Now())
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+	ctx.Read.Close()
+
+	root, err := ctx.Pages()
+	if err != nil {
+		t.Fatalf("%s: %v\n", fileName, err)
+	}
+
+	objNrs := pageObjNrs(t, ctx, *root, nil)
+	if len(objNrs) != ctx.PageCount {
+		t.Fatalf("%s: %d pages, PageCount %d\n", fileName, len(objNrs), ctx.PageCount)
+	}
+
+	return ctx, objNrs
+}
+
+// outlineDestPages returns the object numbers of the pages the outline items starting at first point to
+// along with the number of visible items.
+func outlineDestPages(t *testing.T, ctx *pdfcpu.PDFContext, first *pdfcpu.PDFIndirectRef, objNrs map[int]bool) int {
+	t.Helper()
+
+	count := 0
+
+	for indRef := first; indRef != nil; {
+
+		d, _ := ctx.DereferenceDict(*indRef)
+
+		dest, found := d.Find("Dest")
+		if !found {
+			if a := d.PDFDictEntry("A"); a != nil {
+				dest, found = a.Find("D")
+			}
+		}
+
+		if found {
+			dest, _ = ctx.Dereference(dest)
+			if name, ok := dest.(pdfcpu.PDFStringLiteral); ok {
+				dest, _ = ctx.Names["Dests"].Value(name.Value())
+				dest, _ = ctx.Dereference(dest)
+			}
+			if dd, ok := dest.(pdfcpu.PDFDict); ok {
+				dest, _ = ctx.Dereference(dd.Dict["D"])
+			}
+			if arr, ok := dest.(pdfcpu.PDFArray); ok {
+				objNrs[arr[0].(pdfcpu.PDFIndirectRef).ObjectNumber.Value()] = true
+			}
+		}
+
+		kids := outlineDestPages(t, ctx, d.IndirectRefEntry("First"), objNrs)
+
+		count++
+		if c := d.IntEntry("Count"); c != nil {
+			if *c != kids && *c != -kids {
+				t.Fatalf("outline item obj#%d: Count %d, want %d\n", indRef.ObjectNumber, *c, kids)
+			}
+			if *c > 0 {
+				count += kids
+			}
+		}
+
+		indRef = d.IndirectRefEntry("Next")
+	}
+
+	return count
+}
+
+// pageMediaBox returns the media box of page i of a rebuilt page tree.
+func pageMediaBox(t *testing.T, ctx *pdfcpu.PDFContext, i int) string {
+	t.Helper()
+
+	d, _, err := ctx.PageDict(i)
+	if err != nil {
+		t.Fatalf("page %d: %v\n", i, err)
+	}
+
+	mb := d.PDFArrayEntry("MediaBox")
+	if mb == nil {
+		// Only the root of a rebuilt page tree holds inherited attributes.
+		root, _ := ctx.Pages()
+		rootDict, _ := ctx.DereferenceDict(*root)
+		mb = rootDict.PDFArrayEntry("MediaBox")
+	}
+
+	return mb.String()
+}
+
+func TestInsertPagesCommand(t *testing.T) {
+
+	msg := "TestInsertPagesCommand"
+
+	inFile := filepath.Join(inDir, "go.pdf")
+	outFile := filepath.Join(outDir, "testInsertPages.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	_, pagesIn := readPages(t, inFile)
+
+	mediaBox, err := pdfcpu.ParseMediaBox("mediabox:0 0 595 842")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(InsertPagesCommand(inFile, outFile, []string{"1", "3"}, false, mediaBox, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, pages := readPages(t, outFile)
+	if len(pages) != len(pagesIn)+2 || pages[0] != pagesIn[0] || pages[2] != pagesIn[1] || pages[3] != pagesIn[2] || pages[5] != pagesIn[3] {
+		t.Fatalf("%s: unexpected page order %v\n", msg, pages)
+	}
+
+	d, _, _ := ctx.PageDict(2)
+	if mb := d.PDFArrayEntry("MediaBox"); mb == nil || mb.String() != pdfcpu.NewRectangle(0, 0, 595, 842).String() {
+		t.Fatalf("%s: blank page with MediaBox %v\n", msg, mb)
+	}
+
+	// Blank pages inherit the media box of the selected page.
+	if _, err = Process(InsertPagesCommand(inFile, outFile, nil, true, nil, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, pages = readPages(t, outFile)
+	if len(pages) != 2*len(pagesIn) || pages[1] != pagesIn[0] {
+		t.Fatalf("%s: unexpected page order %v\n", msg, pages)
+	}
+
+	if mb1, mb2 := pageMediaBox(t, ctx, 1), pageMediaBox(t, ctx, 2); mb1 != mb2 {
+		t.Fatalf("%s: blank page with MediaBox %s, want %s\n", msg, mb1, mb2)
+	}
+}
+
+func TestMovePagesCommand(t *testing.T) {
+
+	msg := "TestMovePagesCommand"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile := filepath.Join(outDir, "testMovePages.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	_, pagesIn := readPages(t, inFile)
+
+	for _, s := range []string{"3,1,2", "1,1,2-", "0,1-", "2-1,1-,"} {
+		order, err := ParsePageOrder(s)
+		if err != nil {
+			continue
+		}
+		if _, err = Process(MovePagesCommand(inFile, outFile, order, config)); err == nil {
+			t.Fatalf("%s: expected error for order %s\n", msg, s)
+		}
+	}
+
+	order, err := ParsePageOrder(fmt.Sprintf("3,1,2,%d-5,4", len(pagesIn)))
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(MovePagesCommand(inFile, outFile, order, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	_, pages := readPages(t, outFile)
+
+	want := []int{pagesIn[2], pagesIn[0], pagesIn[1]}
+	for i := len(pagesIn) - 1; i >= 4; i-- {
+		want = append(want, pagesIn[i])
+	}
+	want = append(want, pagesIn[3])
+
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("%s: got page order %v, want %v\n", msg, pages, want)
+	}
+}
+
+func TestRemovePagesCommand(t *testing.T) {
+
+	msg := "TestRemovePagesCommand"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	outFile := filepath.Join(outDir, "testRemovePages.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	ctx, pagesIn := readPages(t, inFile)
+
+	root, _ := ctx.Catalog()
+	outlines := root.PDFDictEntry("Outlines")
+	if outlines == nil {
+		d, _ := ctx.DereferenceDict(root.Dict["Outlines"])
+		outlines = d
+	}
+
+	destsIn := map[int]bool{}
+	outlineDestPages(t, ctx, outlines.IndirectRefEntry("First"), destsIn)
+
+	removed := map[int]bool{}
+	for _, objNr := range pagesIn[4:7] {
+		removed[objNr] = true
+	}
+
+	found := false
+	for objNr := range destsIn {
+		found = found || removed[objNr]
+	}
+	if !found {
+		t.Fatalf("%s: no outline items pointing to pages 5-7\n", msg)
+	}
+
+	if _, err := Process(RemovePagesCommand(inFile, outFile, []string{"1-"}, config)); err == nil {
+		t.Fatalf("%s: expected error removing all pages\n", msg)
+	}
+
+	if _, err := Process(RemovePagesCommand(inFile, outFile, []string{"5-7"}, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, pages := readPages(t, outFile)
+
+	want := append(append([]int{}, pagesIn[:4]...), pagesIn[7:]...)
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("%s: got pages %v, want %v\n", msg, pages, want)
+	}
+
+	root, _ = ctx.Catalog()
+	outlines, _ = ctx.DereferenceDict(root.Dict["Outlines"])
+
+	dests := map[int]bool{}
+	count := outlineDestPages(t, ctx, outlines.IndirectRefEntry("First"), dests)
+
+	if c := outlines.IntEntry("Count"); c != nil && *c != count {
+		t.Fatalf("%s: outlines Count %d, want %d\n", msg, *c, count)
+	}
+
+	if len(dests) == 0 {
+		t.Fatalf("%s: all outline items removed\n", msg)
+	}
+
+	for objNr := range dests {
+		if removed[objNr] {
+			t.Fatalf("%s: outline item pointing to removed page obj#%d\n", msg, objNr)
+		}
+	}
+
+	if tree := ctx.Names["Dests"]; tree != nil {
+		tree.Process(ctx.XRefTable, func(xRefTable *pdfcpu.XRefTable, k string, v pdfcpu.PDFObject) error {
+			o, _ := xRefTable.Dereference(v)
+			if d, ok := o.(pdfcpu.PDFDict); ok {
+				o, _ = xRefTable.Dereference(d.Dict["D"])
+			}
+			if arr, ok := o.(pdfcpu.PDFArray); ok && removed[arr[0].(pdfcpu.PDFIndirectRef).ObjectNumber.Value()] {
+				t.Fatalf("%s: named destination %s pointing to removed page\n", msg, k)
+			}
+			return nil
+		})
+	}
+}
+
+// addWidget places a widget annotation on page i and returns its indirect reference.
+func addWidget(t *testing.T, ctx *pdfcpu.PDFContext, i int, d pdfcpu.PDFDict) pdfcpu.PDFIndirectRef {
+	t.Helper()
+
+	pageIndRef, err := ctx.PageDictIndRef(i)
+	if err != nil {
+		t.Fatalf("page %d: %v\n", i, err)
+	}
+
+	pageDict, err := ctx.DereferenceDict(*pageIndRef)
+	if err != nil {
+		t.Fatalf("page %d: %v\n", i, err)
+	}
+
+	d.Insert("Type", pdfcpu.PDFName("Annot"))
+	d.Insert("Subtype", pdfcpu.PDFName("Widget"))
+	d.Insert("Rect", pdfcpu.NewRectangle(0, 0, 100, 20))
+	d.Insert("P", *pageIndRef)
+
+	indRef, err := ctx.IndRefForNewObject(d)
+	if err != nil {
+		t.Fatalf("page %d: %v\n", i, err)
+	}
+
+	annots := pdfcpu.PDFArray{}
+	if a, _ := ctx.DereferenceArray(pageDict.Dict["Annots"]); a != nil {
+		annots = append(annots, *a...)
+	}
+	pageDict.Update("Annots", append(annots, *indRef))
+
+	return *indRef
+}
+
+func TestRemovePagesFormFields(t *testing.T) {
+
+	msg := "TestRemovePagesFormFields"
+
+	inFile := filepath.Join(inDir, "5116.DCT_Filter.pdf")
+	formFile := filepath.Join(outDir, "testRemovePagesForm.pdf")
+	outFile := filepath.Join(outDir, "testRemovePagesFormOut.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	ctx, err := Read(inFile, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	defer ctx.Read.Close()
+
+	// A field on a removed page, a field with widgets on a kept and a removed page and a field on a kept page.
+	a := addWidget(t, ctx, 6, pdfcpu.NewPDFDict())
+	a0 := ctx.Table[a.ObjectNumber.Value()].Object.(pdfcpu.PDFDict)
+	a0.Insert("FT", pdfcpu.PDFName("Tx"))
+	a0.Insert("T", pdfcpu.PDFStringLiteral("a"))
+
+	bd := pdfcpu.NewPDFDict()
+	bd.Insert("FT", pdfcpu.PDFName("Btn"))
+	bd.Insert("T", pdfcpu.PDFStringLiteral("b"))
+	b, err := ctx.IndRefForNewObject(bd)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	b2 := addWidget(t, ctx, 2, pdfcpu.PDFDict{Dict: map[string]pdfcpu.PDFObject{"Parent": *b}})
+	b6 := addWidget(t, ctx, 6, pdfcpu.PDFDict{Dict: map[string]pdfcpu.PDFObject{"Parent": *b}})
+	bd.Insert("Kids", pdfcpu.PDFArray{b2, b6})
+
+	c := addWidget(t, ctx, 1, pdfcpu.NewPDFDict())
+	c0 := ctx.Table[c.ObjectNumber.Value()].Object.(pdfcpu.PDFDict)
+	c0.Insert("FT", pdfcpu.PDFName("Tx"))
+	c0.Insert("T", pdfcpu.PDFStringLiteral("c"))
+
+	root, _ := ctx.Catalog()
+	root.Update("AcroForm", pdfcpu.PDFDict{Dict: map[string]pdfcpu.PDFObject{
+		"Fields": pdfcpu.PDFArray{a, *b, c},
+		"CO":     pdfcpu.PDFArray{a, c},
+	}})
+
+	ctx.Write.DirName, ctx.Write.FileName = filepath.Split(formFile)
+	if err = Write(ctx); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(RemovePagesCommand(formFile, outFile, []string{"5-7"}, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, _ = readPages(t, outFile)
+
+	root, _ = ctx.Catalog()
+	acroForm, _ := ctx.DereferenceDict(root.Dict["AcroForm"])
+
+	objNrs := func(key string, d *pdfcpu.PDFDict) []int {
+		arr, _ := ctx.DereferenceArray(d.Dict[key])
+		nrs := []int{}
+		for _, o := range *arr {
+			nrs = append(nrs, o.(pdfcpu.PDFIndirectRef).ObjectNumber.Value())
+		}
+		return nrs
+	}
+
+	if got, want := objNrs("Fields", acroForm), []int{b.ObjectNumber.Value(), c.ObjectNumber.Value()}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got fields %v, want %v\n", msg, got, want)
+	}
+
+	if got, want := objNrs("CO", acroForm), []int{c.ObjectNumber.Value()}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got calculation order %v, want %v\n", msg, got, want)
+	}
+
+	d, _ := ctx.DereferenceDict(*b)
+	if got, want := objNrs("Kids", d), []int{b2.ObjectNumber.Value()}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got kids %v, want %v\n", msg, got, want)
+	}
+}
+
+// sheetForms returns the number of form XObjects placed on page i.
+func sheetForms(t *testing.T, ctx *pdfcpu.PDFContext, i int) int {
+	t.Helper()
+
+	d, _, err := ctx.PageDict(i)
+	if err != nil {
+		t.Fatalf("page %d: %v\n", i, err)
+	}
+
+	res, _ := ctx.DereferenceDict(d.Dict["Resources"])
+	xObjs, _ := ctx.DereferenceDict(res.Dict["XObject"])
+
+	return xObjs.Len()
+}
+
+func TestNUpCommand(t *testing.T) {
+
+	msg := "TestNUpCommand"
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	for _, tt := range []struct {
+		inFiles       []string
+		pageSelection []string
+		n             int
+		landscape     bool
+		order         pdfcpu.NUpOrder
+		sheets        int
+		last          int // number of pages on the last sheet
+	}{
+		{[]string{filepath.Join(inDir, "go.pdf")}, nil, 4, false, pdfcpu.LeftToRight, 6, 3},
+		{[]string{filepath.Join(inDir, "go.pdf")}, []string{"2-8"}, 6, true, pdfcpu.TopToBottom, 2, 1},
+		{[]string{filepath.Join(inDir, "5116.DCT_Filter.pdf")}, []string{"1-9"}, 9, false, pdfcpu.LeftToRight, 1, 9},
+		{[]string{filepath.Join(inDir, "5116.DCT_Filter.pdf")}, nil, 16, true, pdfcpu.LeftToRight, 4, 4},
+		{[]string{"../../resources/pdfchip3.png", "../../resources/demo.png", "../../tiff/testdata/video-001.tiff"}, nil, 2, false, pdfcpu.TopToBottom, 2, 1},
+	} {
+		outFile := filepath.Join(outDir, "testNUp.pdf")
+
+		nup := pdfcpu.DefaultNUpConfig()
+		nup.N = tt.n
+		nup.Landscape = tt.landscape
+		nup.Order = tt.order
+		nup.Border = true
+		nup.Margin = 10
+
+		if _, err := Process(NUpCommand(tt.inFiles, outFile, tt.pageSelection, nup, config)); err != nil {
+			t.Fatalf("%s %s: %v\n", msg, tt.inFiles[0], err)
+		}
+
+		ctx, pages := readPages(t, outFile)
+
+		if len(pages) != tt.sheets {
+			t.Fatalf("%s %s: got %d sheets, want %d\n", msg, tt.inFiles[0], len(pages), tt.sheets)
+		}
+
+		if got := sheetForms(t, ctx, len(pages)); got != tt.last {
+			t.Fatalf("%s %s: got %d pages on last sheet, want %d\n", msg, tt.inFiles[0], got, tt.last)
+		}
+
+		want := pdfcpu.NewRectangle(0, 0, 595, 842).String()
+		if tt.landscape {
+			want = pdfcpu.NewRectangle(0, 0, 842, 595).String()
+		}
+
+		if got := pageMediaBox(t, ctx, 1); got != want {
+			t.Fatalf("%s %s: got MediaBox %s, want %s\n", msg, tt.inFiles[0], got, want)
+		}
+
+		root, _ := ctx.Catalog()
+		if o, found := root.Find("Outlines"); found {
+			if outlines, _ := ctx.DereferenceDict(o); outlines != nil && outlines.IndirectRefEntry("First") != nil {
+				t.Fatalf("%s %s: outline items pointing to removed pages\n", msg, tt.inFiles[0])
+			}
+		}
+	}
+
+	nup := pdfcpu.DefaultNUpConfig()
+	nup.N = 3
+
+	if _, err := Process(NUpCommand([]string{filepath.Join(inDir, "go.pdf")}, filepath.Join(outDir, "testNUp.pdf"), nil, nup, config)); err == nil {
+		t.Fatalf("%s: expected error for 3 pages per sheet\n", msg)
+	}
+
+	nup.N = 4
+	nup.Margin = 200
+
+	if _, err := Process(NUpCommand([]string{filepath.Join(inDir, "go.pdf")}, filepath.Join(outDir, "testNUp.pdf"), nil, nup, config)); err == nil {
+		t.Fatalf("%s: expected error for margin too large\n", msg)
+	}
+}
+
+func TestBookletCommand(t *testing.T) {
+
+	msg := "TestBookletCommand"
+
+	inFile := filepath.Join(inDir, "go.pdf")
+	outFile := filepath.Join(outDir, "testBooklet.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	for _, tt := range []struct {
+		pageSelection []string
+		binding       pdfcpu.BindingEdge
+		sides         int
+		forms         []int // number of pages on the first sheet sides
+	}{
+		// 23 pages padded to 24: n,1 2,n-1 with page 24 blank.
+		{nil, pdfcpu.BindLeft, 12, []int{1, 2}},
+		{[]string{"1-8"}, pdfcpu.BindRight, 4, []int{2, 2}},
+		// 5 pages padded to 8: blanks 8, 7, 6.
+		{[]string{"1-5"}, pdfcpu.BindLeft, 4, []int{1, 1, 1, 2}},
+	} {
+		bl := pdfcpu.DefaultBookletConfig()
+		bl.Binding = tt.binding
+		bl.Creep = 0.5
+
+		if _, err := Process(BookletCommand(inFile, outFile, tt.pageSelection, bl, config)); err != nil {
+			t.Fatalf("%s %v: %v\n", msg, tt.pageSelection, err)
+		}
+
+		ctx, pages := readPages(t, outFile)
+
+		if len(pages) != tt.sides {
+			t.Fatalf("%s %v: got %d sheet sides, want %d\n", msg, tt.pageSelection, len(pages), tt.sides)
+		}
+
+		for i, want := range tt.forms {
+			if got := sheetForms(t, ctx, i+1); got != want {
+				t.Fatalf("%s %v: side %d: got %d pages, want %d\n", msg, tt.pageSelection, i+1, got, want)
+			}
+		}
+
+		if got, want := pageMediaBox(t, ctx, 1), pdfcpu.NewRectangle(0, 0, 842, 595).String(); got != want {
+			t.Fatalf("%s %v: got MediaBox %s, want %s\n", msg, tt.pageSelection, got, want)
+		}
+	}
+
+	bl := pdfcpu.DefaultBookletConfig()
+	bl.Creep = 100
+
+	if _, err := Process(BookletCommand(inFile, outFile, nil, bl, config)); err == nil {
+		t.Fatalf("%s: expected error for creep too large\n", msg)
+	}
+}
+
+func TestBoxesCommand(t *testing.T) {
+
+	msg := "TestBoxesCommand"
+
+	inFile := filepath.Join(inDir, "go.pdf")
+	outFile := filepath.Join(outDir, "testBoxes.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	ctx, _ := readPages(t, inFile)
+
+	pbIn, err := pdfcpu.PageBoxes(ctx.XRefTable, 1)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if pbIn.Crop != pbIn.Media || pbIn.Trim != pbIn.Media {
+		t.Fatalf("%s: boxes don't default to MediaBox: %v\n", msg, pbIn)
+	}
+
+	boxes, err := pdfcpu.ParseBoxes("trim:1 in, bleed:trim -0.5in, art:[100 100 200 200]")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(SetBoxesCommand(inFile, outFile, []string{"1-2"}, boxes, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, _ = readPages(t, outFile)
+
+	m := pbIn.Media
+
+	for i, want := range []*pdfcpu.PageBoundaries{
+		{
+			Media: m,
+			Crop:  m,
+			Trim:  types.NewRectangle(m.LL.X+72, m.LL.Y+72, m.UR.X-72, m.UR.Y-72),
+			Bleed: types.NewRectangle(m.LL.X+36, m.LL.Y+36, m.UR.X-36, m.UR.Y-36),
+			Art:   types.NewRectangle(100, 100, 200, 200),
+		},
+		nil,
+		{Media: m, Crop: m, Trim: m, Bleed: m, Art: m},
+	} {
+		if want == nil {
+			continue
+		}
+		got, err := pdfcpu.PageBoxes(ctx.XRefTable, i+1)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+		if *got != *want {
+			t.Fatalf("%s: page %d: got %v, want %v\n", msg, i+1, *got, *want)
+		}
+	}
+
+	list, err := ListBoxes(outFile, []string{"1"}, config)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if len(list) != 6 || !strings.Contains(list[5], "[100.00 100.00 200.00 200.00]") {
+		t.Fatalf("%s: unexpected list: %v\n", msg, list)
+	}
+
+	// Crop relative to the TrimBox set before and beyond the MediaBox.
+	cropBox, err := pdfcpu.ParseBox("crop", "trim -2 in")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	outFile2 := filepath.Join(outDir, "testCrop.pdf")
+
+	if _, err = Process(CropCommand(outFile, outFile2, []string{"1"}, cropBox, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, _ = readPages(t, outFile2)
+
+	got, err := pdfcpu.PageBoxes(ctx.XRefTable, 1)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if got.Crop != m {
+		t.Fatalf("%s: got CropBox %v, want MediaBox %v\n", msg, got.Crop, m)
+	}
+
+	for _, s := range []string{"", "10 20 30", "[0 0 10]", "trim [0 0 10 10]", "10 km", "[0 0 0 10]"} {
+		if _, err := pdfcpu.ParseBox("crop", s); err == nil {
+			t.Fatalf("%s: expected error parsing %q\n", msg, s)
+		}
+	}
+}
+
+// firstLinkRect returns the page number and Rect of the first link annotation found.
+func firstLinkRect(t *testing.T, ctx *pdfcpu.PDFContext) (int, types.Rectangle) {
+	t.Helper()
+
+	for i := 1; i <= ctx.PageCount; i++ {
+
+		d, _, err := ctx.PageDict(i)
+		if err != nil {
+			t.Fatalf("page %d: %v\n", i, err)
+		}
+
+		o, found := d.Find("Annots")
+		if !found {
+			continue
+		}
+
+		annots, _ := ctx.DereferenceArray(o)
+		if annots == nil {
+			continue
+		}
+
+		for _, v := range *annots {
+			ad, _ := ctx.DereferenceDict(v)
+			if ad == nil || ad.Subtype() == nil || *ad.Subtype() != "Link" {
+				continue
+			}
+			arr, _ := ctx.DereferenceArray(ad.Dict["Rect"])
+			r := types.NewRectangle(
+				ctx.DereferenceNumber((*arr)[0]), ctx.DereferenceNumber((*arr)[1]),
+				ctx.DereferenceNumber((*arr)[2]), ctx.DereferenceNumber((*arr)[3]))
+			return i, r
+		}
+	}
+
+	t.Fatal("no link annotation found")
+	return 0, types.Rectangle{}
+}
+
+// firstOutlineDest returns the page number and the left and top coordinates
+// of the /XYZ destination of the first outline item.
+func firstOutlineDest(t *testing.T, ctx *pdfcpu.PDFContext) (int, float64, float64) {
+	t.Helper()
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outlines, _ := ctx.DereferenceDict(rootDict.Dict["Outlines"])
+	if outlines == nil {
+		t.Fatal("missing outlines")
+	}
+
+	item, _ := ctx.DereferenceDict(*outlines.IndirectRefEntry("First"))
+	if item == nil {
+		t.Fatal("missing outline item")
+	}
+
+	dest, _ := ctx.DereferenceArray(item.Dict["Dest"])
+	if dest == nil || len(*dest) != 5 || (*dest)[1] != pdfcpu.PDFName("XYZ") {
+		t.Fatalf("unexpected outline destination: %v", dest)
+	}
+
+	objNr := (*dest)[0].(pdfcpu.PDFIndirectRef).ObjectNumber.Value()
+
+	for i := 1; i <= ctx.PageCount; i++ {
+		indRef, err := ctx.PageDictIndRef(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indRef.ObjectNumber.Value() == objNr {
+			return i, ctx.DereferenceNumber((*dest)[2]), ctx.DereferenceNumber((*dest)[3])
+		}
+	}
+
+	t.Fatalf("outline destination: page obj#%d not found", objNr)
+	return 0, 0, 0
+}
+
+func TestResizeCommand(t *testing.T) {
+
+	msg := "TestResizeCommand"
+
+	inFile := filepath.Join(inDir, "go-lecture.pdf")
+	outFile := filepath.Join(outDir, "testResize.pdf")
+
+	config := pdfcpu.NewDefaultConfiguration()
+
+	ctx, _ := readPages(t, inFile)
+	pageCount := ctx.PageCount
+
+	i, linkIn := firstLinkRect(t, ctx)
+
+	pbIn, err := pdfcpu.PageBoxes(ctx.XRefTable, i)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	d, err := pdfcpu.ParsePaperSize("A4")
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	for _, fill := range []bool{false, true} {
+
+		rs := &pdfcpu.Resize{Paper: *d, Fill: fill}
+
+		if _, err = Process(ResizeCommand(inFile, outFile, nil, rs, config)); err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		ctx, _ = readPages(t, outFile)
+
+		if ctx.PageCount != pageCount {
+			t.Fatalf("%s: got %d pages, want %d\n", msg, ctx.PageCount, pageCount)
+		}
+
+		pb, err := pdfcpu.PageBoxes(ctx.XRefTable, i)
+		if err != nil {
+			t.Fatalf("%s: %v\n", msg, err)
+		}
+
+		w, h := d.Width, d.Height
+		if pbIn.Crop.Width() > pbIn.Crop.Height() {
+			w, h = h, w
+		}
+
+		if pb.Media != types.NewRectangle(0, 0, w, h) || pb.Crop != pb.Media {
+			t.Fatalf("%s: fill=%t: unexpected page boxes: %v\n", msg, fill, *pb)
+		}
+
+		s := math.Min(w/pbIn.Crop.Width(), h/pbIn.Crop.Height())
+		if fill {
+			s = math.Max(w/pbIn.Crop.Width(), h/pbIn.Crop.Height())
+		}
+
+		_, link := firstLinkRect(t, ctx)
+
+		if math.Abs(link.Width()-s*linkIn.Width()) > 0.01 || math.Abs(link.Height()-s*linkIn.Height()) > 0.01 {
+			t.Fatalf("%s: fill=%t: link %v not scaled by %f from %v\n", msg, fill, link, s, linkIn)
+		}
+
+		dx := (w-s*pbIn.Crop.Width())/2 + s*(linkIn.LL.X-pbIn.Crop.LL.X)
+		if math.Abs(link.LL.X-dx) > 0.01 {
+			t.Fatalf("%s: fill=%t: link %v not centred, want llx %f\n", msg, fill, link, dx)
+		}
+	}
+
+	// Destinations pointing to resized pages get mapped along with their content.
+	inFile = filepath.Join(inDir, "golang.pdf")
+
+	ctx, _ = readPages(t, inFile)
+	i, left, top := firstOutlineDest(t, ctx)
+
+	if pbIn, err = pdfcpu.PageBoxes(ctx.XRefTable, i); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if _, err = Process(ResizeCommand(inFile, outFile, nil, &pdfcpu.Resize{Paper: *d}, config)); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	ctx, _ = readPages(t, outFile)
+	j, x, y := firstOutlineDest(t, ctx)
+
+	w, h := d.Width, d.Height
+	if pbIn.Crop.Width() > pbIn.Crop.Height() {
+		w, h = h, w
+	}
+
+	c := pbIn.Crop
+	s := math.Min(w/c.Width(), h/c.Height())
+	wantX := s*(left-c.LL.X) + (w-s*c.Width())/2
+	wantY := s*(top-c.LL.Y) + (h-s*c.Height())/2
+
+	if j != i || math.Abs(x-wantX) > 0.01 || math.Abs(y-wantY) > 0.01 {
+		t.Fatalf("%s: outline destination: got page %d (%f %f), want page %d (%f %f)\n", msg, j, x, y, i, wantX, wantY)
+	}
+
+	for _, s := range []string{"210x297mm", "612 x 792", "letter"} {
+		if _, err := pdfcpu.ParsePaperSize(s); err != nil {
+			t.Fatalf("%s: %q: %v\n", msg, s, err)
+		}
+	}
+
+	for _, s := range []string{"", "A11", "210x", "0x100", "axb"} {
+		if _, err := pdfcpu.ParsePaperSize(s); err == nil {
+			t.Fatalf("%s: expected error parsing %q\n", msg, s)
+		}
+	}
 }
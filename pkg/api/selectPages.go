@@ -29,6 +29,7 @@ import (
 
 var (
 	selectedPagesRegExp *regexp.Regexp
+	pageOrderRegExp     *regexp.Regexp
 )
 
 func setupRegExpForPageSelection() *regexp.Regexp {
@@ -47,6 +48,7 @@ func setupRegExpForPageSelection() *regexp.Regexp {
 func init() {
 
 	selectedPagesRegExp = setupRegExpForPageSelection()
+	pageOrderRegExp = regexp.MustCompile(`^\d+(-(\d+)?)?(,\d+(-(\d+)?)?)*$`)
 }
 
 // ParsePageSelection ensures a correct page selection expression.
@@ -296,3 +298,61 @@ func ensureSelectedPages(ctx *pdfcpu.PDFContext, selectedPages *pdfcpu.IntSet) {
 
 	*selectedPages = m
 }
+
+// ParsePageOrder ensures a correct page order expression.
+func ParsePageOrder(s string) ([]string, error) {
+
+	// Ensure valid comma separated expression of: { # | #-# | #- }*
+	//
+	// A descending range like 5-3 lists pages 5,4,3.
+	// e.g. "3,1,2,5-10,4" moves page 3 to the front and page 4 behind page 10.
+
+	if !pageOrderRegExp.MatchString(s) {
+		return nil, errors.Errorf("page order \"%s\" => syntax error\n", s)
+	}
+
+	return strings.Split(s, ","), nil
+}
+
+// pagesForPageOrder returns the page numbers listed by a page order expression.
+func pagesForPageOrder(pageCount int, order []string) ([]int, error) {
+
+	pages := []int{}
+
+	for _, v := range order {
+
+		pr := strings.Split(v, "-")
+
+		from, err := strconv.Atoi(pr[0])
+		if err != nil {
+			return nil, err
+		}
+
+		to := from
+		if len(pr) == 2 {
+			to = pageCount
+			if pr[1] != "" {
+				if to, err = strconv.Atoi(pr[1]); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, p := range []int{from, to} {
+			if p < 1 || p > pageCount {
+				return nil, errors.Errorf("page order: page %d out of range 1..%d", p, pageCount)
+			}
+		}
+
+		step := 1
+		if to < from {
+			step = -1
+		}
+
+		for p := from; p != to+step; p += step {
+			pages = append(pages, p)
+		}
+	}
+
+	return pages, nil
+}
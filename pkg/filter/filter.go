@@ -38,6 +38,7 @@ const (
 	JBIG2     = "JBIG2Decode"
 	DCT       = "DCTDecode"
 	JPX       = "JPXDecode"
+	Crypt     = "Crypt" // Applied by en/decryption.
 )
 
 var (
@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// A saddle-stitched booklet is made of sheets printed duplex with two pages per side,
+// stacked, folded in the middle and stapled along the fold.
+//
+// For n pages, n a multiple of 4, the outermost sheet holds the pages n, 1 on its front
+// and 2, n-1 on its back, the next sheet n-2, 3 and 4, n-3 and so on.
+
+// BindingEdge defines the edge of a booklet along which its sheets are stapled.
+type BindingEdge int
+
+// The supported binding edges.
+const (
+	BindLeft  BindingEdge = iota // Reading left to right.
+	BindRight                    // Reading right to left.
+)
+
+// Booklet represents the layout of a saddle-stitched booklet.
+type Booklet struct {
+	Paper   types.Dim   // Sheet dimensions, always used in landscape orientation.
+	Binding BindingEdge // The edge of the booklet along which the sheets are stapled.
+	Creep   float64     // Shift of the pages towards the fold per sheet compensating for the paper thickness.
+}
+
+// DefaultBookletConfig returns the default booklet layout: A4 sheets bound on the left.
+func DefaultBookletConfig() *Booklet {
+	return &Booklet{
+		Paper:   PaperSize["A4"],
+		Binding: BindLeft,
+	}
+}
+
+func (bl Booklet) String() string {
+	return fmt.Sprintf("paper=%s binding=%d creep=%f", bl.Paper, bl.Binding, bl.Creep)
+}
+
+// ParseBindingEdge parses a binding edge: left or right.
+func ParseBindingEdge(s string) (BindingEdge, error) {
+
+	switch strings.ToLower(s) {
+
+	case "left":
+		return BindLeft, nil
+
+	case "right":
+		return BindRight, nil
+	}
+
+	return 0, errors.Errorf("unknown binding edge: %s", s)
+}
+
+// sheetDim returns the sheet dimensions in landscape orientation.
+func (bl Booklet) sheetDim() types.Dim {
+
+	d := bl.Paper
+	if !d.Landscape() {
+		d.Width, d.Height = d.Height, d.Width
+	}
+
+	return d
+}
+
+func (bl Booklet) validate(sheets int) error {
+
+	d := bl.sheetDim()
+	if d.Width <= 0 || d.Height <= 0 {
+		return errors.Errorf("booklet: invalid paper size: %s", d)
+	}
+
+	if bl.Creep < 0 {
+		return errors.Errorf("booklet: invalid creep: %f", bl.Creep)
+	}
+
+	if float64(sheets-1)*bl.Creep >= d.Width/4 {
+		return errors.Errorf("booklet: creep %f too large for %d sheets", bl.Creep, sheets)
+	}
+
+	return nil
+}
+
+// bookletOrder returns the sequence of pages for a booklet of n pages, n a multiple of 4,
+// as pairs of left and right pages for the front and back side of each sheet.
+func bookletOrder(n int) []int {
+
+	order := make([]int, 0, n)
+
+	for k := 0; k < n/4; k++ {
+		order = append(order, n-2*k, 2*k+1, 2*k+2, n-2*k-1)
+	}
+
+	return order
+}
+
+// createBookletSide creates a sheet side holding the left and right tile shifted towards the fold by shift.
+// A nil tile is a blank page.
+func (bl Booklet) createBookletSide(xRefTable *XRefTable, left, right *nupTile, shift float64) (*PDFIndirectRef, error) {
+
+	d := bl.sheetDim()
+	w := d.Width / 2
+
+	xObjDict := NewPDFDict()
+
+	var b bytes.Buffer
+
+	for i, t := range []*nupTile{left, right} {
+
+		if t == nil {
+			continue
+		}
+
+		llx := float64(i) * w
+
+		r := types.NewRectangle(llx, 0, llx+w, d.Height)
+		m := t.transform(r)
+
+		// Shift towards the fold.
+		if i == 0 {
+			m[2][0] += shift
+		} else {
+			m[2][0] -= shift
+		}
+
+		formID := fmt.Sprintf("Fm%d", i)
+		xObjDict.Insert(formID, t.form)
+
+		// Clip at the fold.
+		fmt.Fprintf(&b, "q %f 0 %f %f re W n %f %f %f %f %f %f cm /%s Do Q\n",
+			llx, w, d.Height, m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1], formID)
+	}
+
+	return createSheetPage(xRefTable, d, xObjDict, b.Bytes())
+}
+
+// BookletFromPDF replaces the pages of xRefTable by the sheet sides of a saddle-stitched booklet
+// made of the selected pages padded with blank pages to a multiple of 4.
+// Outline items and destinations pointing to the original pages are removed.
+func BookletFromPDF(xRefTable *XRefTable, selectedPages IntSet, bl *Booklet) error {
+
+	root, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	tiles, err := selectedPageTiles(xRefTable, len(pages), selectedPages)
+	if err != nil {
+		return errors.Wrap(err, "booklet")
+	}
+
+	n := (len(tiles) + 3) / 4 * 4
+
+	if err = bl.validate(n / 4); err != nil {
+		return err
+	}
+
+	log.Debug.Printf("BookletFromPDF: %d pages on %d sheets, %s\n", len(tiles), n/4, bl)
+
+	tile := func(p int) *nupTile {
+		if p > len(tiles) {
+			return nil
+		}
+		return tiles[p-1]
+	}
+
+	order := bookletOrder(n)
+	sides := []PDFIndirectRef{}
+
+	for i := 0; i < n; i += 2 {
+
+		left, right := tile(order[i]), tile(order[i+1])
+		if bl.Binding == BindRight {
+			left, right = right, left
+		}
+
+		// Inner sheets stick out more after folding.
+		shift := float64(i/4) * bl.Creep
+
+		indRef, err := bl.createBookletSide(xRefTable, left, right, shift)
+		if err != nil {
+			return err
+		}
+
+		sides = append(sides, *indRef)
+	}
+
+	return replacePages(xRefTable, *root, pages, sides)
+}
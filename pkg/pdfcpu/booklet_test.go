@@ -0,0 +1,38 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBookletOrder(t *testing.T) {
+
+	for _, tt := range []struct {
+		n    int
+		want []int
+	}{
+		{4, []int{4, 1, 2, 3}},
+		{8, []int{8, 1, 2, 7, 6, 3, 4, 5}},
+		{12, []int{12, 1, 2, 11, 10, 3, 4, 9, 8, 5, 6, 7}},
+	} {
+		if got := bookletOrder(tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bookletOrder(%d): got %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
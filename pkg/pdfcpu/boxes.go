@@ -0,0 +1,408 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// => 14.11.2 Page Boundaries
+//
+// The MediaBox is the extent of the physical medium, the CropBox the visible region of a page.
+// BleedBox, TrimBox and ArtBox are used for production: the region to clip to when printing with bleed,
+// the dimensions of the finished page after trimming and the extent of the meaningful content.
+// The CropBox defaults to the MediaBox, all other boxes default to the CropBox.
+// Every box is clipped to the MediaBox.
+
+// PageBoxNames lists the page boundaries by their short names.
+var PageBoxNames = map[string]string{
+	"media": "MediaBox",
+	"crop":  "CropBox",
+	"trim":  "TrimBox",
+	"bleed": "BleedBox",
+	"art":   "ArtBox",
+}
+
+// The units of page box values.
+var boxUnits = map[string]float64{
+	"pt": 1,
+	"in": 72,
+	"cm": 72 / 2.54,
+	"mm": 72 / 25.4,
+}
+
+// PageBoundaries represents the effective page boxes of a page.
+type PageBoundaries struct {
+	Media, Crop, Trim, Bleed, Art types.Rectangle
+}
+
+// box returns the page box for name, eg. CropBox.
+func (pb *PageBoundaries) box(name string) *types.Rectangle {
+
+	switch name {
+	case "MediaBox":
+		return &pb.Media
+	case "CropBox":
+		return &pb.Crop
+	case "TrimBox":
+		return &pb.Trim
+	case "BleedBox":
+		return &pb.Bleed
+	case "ArtBox":
+		return &pb.Art
+	}
+
+	return nil
+}
+
+// BoxSpec describes the new value of a page box:
+// an absolute rectangle or margins relative to a reference box.
+type BoxSpec struct {
+	Box     string           // The page box to be set, eg. CropBox.
+	Rect    *types.Rectangle // An absolute rectangle in user units.
+	RefBox  string           // The box margins are relative to, eg. MediaBox.
+	Margins [4]float64       // top, right, bottom, left in user units, negative values extend the reference box.
+}
+
+func (bs BoxSpec) String() string {
+
+	if bs.Rect != nil {
+		return fmt.Sprintf("%s: %s", bs.Box, formatBox(*bs.Rect))
+	}
+
+	m := bs.Margins
+
+	return fmt.Sprintf("%s: %s margins %.2f %.2f %.2f %.2f", bs.Box, bs.RefBox, m[0], m[1], m[2], m[3])
+}
+
+func formatBox(r types.Rectangle) string {
+	return fmt.Sprintf("[%.2f %.2f %.2f %.2f]", r.LL.X, r.LL.Y, r.UR.X, r.UR.Y)
+}
+
+// pageBoxName returns the name of the page box for a short name like crop or a name like CropBox.
+func pageBoxName(s string) (string, bool) {
+
+	s = strings.ToLower(s)
+
+	for k, v := range PageBoxNames {
+		if s == k || s == strings.ToLower(v) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// ParseBox parses the value of a page box:
+//
+//	[llx lly urx ury]          absolute rectangle
+//	m | v h | t r b l          margins relative to the MediaBox, see CSS
+//	ref m | ref v h | ...      margins relative to the box ref: media, crop, trim, bleed or art
+//	ref                        the box ref
+//
+// Values may be followed by a unit: pt (default), mm, cm, in.
+// eg. "[0 0 595 842]", "10 mm", "trim -3mm", "crop 10 20 10 20 pt"
+func ParseBox(box, s string) (*BoxSpec, error) {
+
+	name, ok := pageBoxName(box)
+	if !ok {
+		return nil, errors.Errorf("unknown page box: %s", box)
+	}
+
+	bs := &BoxSpec{Box: name, RefBox: "MediaBox"}
+
+	s = strings.Replace(s, "[", " [ ", 1)
+	s = strings.Replace(s, "]", " ] ", 1)
+	ss := strings.Fields(s)
+
+	if len(ss) == 0 {
+		return nil, errors.Errorf("%s: missing value", name)
+	}
+
+	ref, hasRef := pageBoxName(ss[0])
+	if hasRef {
+		bs.RefBox = ref
+		ss = ss[1:]
+	}
+
+	// An optional unit as last field or suffix of the last value.
+	unit := 1.0
+
+	if len(ss) > 0 {
+		last := ss[len(ss)-1]
+		for k, v := range boxUnits {
+			if strings.HasSuffix(last, k) {
+				unit = v
+				ss[len(ss)-1] = strings.TrimSuffix(last, k)
+				if ss[len(ss)-1] == "" {
+					ss = ss[:len(ss)-1]
+				}
+				break
+			}
+		}
+	}
+
+	absolute := len(ss) > 0 && ss[0] == "["
+
+	if absolute {
+		if hasRef || len(ss) != 6 || ss[5] != "]" {
+			return nil, errors.Errorf("%s: invalid rectangle: %s", name, s)
+		}
+		ss = ss[1:5]
+	}
+
+	var f []float64
+
+	for _, v := range ss {
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.Errorf("%s: invalid value: %s", name, v)
+		}
+		f = append(f, x*unit)
+	}
+
+	if absolute {
+		r := types.NewRectangle(f[0], f[1], f[2], f[3])
+		if r.Width() <= 0 || r.Height() <= 0 {
+			return nil, errors.Errorf("%s: empty rectangle: %s", name, s)
+		}
+		bs.Rect = &r
+		return bs, nil
+	}
+
+	switch len(f) {
+	case 0:
+		if !hasRef {
+			return nil, errors.Errorf("%s: missing value", name)
+		}
+	case 1:
+		bs.Margins = [4]float64{f[0], f[0], f[0], f[0]}
+	case 2:
+		bs.Margins = [4]float64{f[0], f[1], f[0], f[1]}
+	case 4:
+		bs.Margins = [4]float64{f[0], f[1], f[2], f[3]}
+	default:
+		return nil, errors.Errorf("%s: need 1, 2 or 4 margins: %s", name, s)
+	}
+
+	return bs, nil
+}
+
+// ParseBoxes parses a comma separated list of page box values, eg. "crop:10 mm, bleed:trim -3 mm".
+// See ParseBox for the syntax of values.
+func ParseBoxes(s string) ([]*BoxSpec, error) {
+
+	var bss []*BoxSpec
+
+	for _, s := range strings.Split(s, ",") {
+
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+
+		ss := strings.SplitN(s, ":", 2)
+		if len(ss) != 2 {
+			return nil, errors.Errorf("invalid page box: %s", s)
+		}
+
+		bs, err := ParseBox(strings.TrimSpace(ss[0]), ss[1])
+		if err != nil {
+			return nil, err
+		}
+
+		bss = append(bss, bs)
+	}
+
+	if len(bss) == 0 {
+		return nil, errors.New("missing page boxes")
+	}
+
+	return bss, nil
+}
+
+// intersect returns the intersection of r1 and r2.
+func intersect(r1, r2 types.Rectangle) types.Rectangle {
+	return types.NewRectangle(
+		math.Max(r1.LL.X, r2.LL.X), math.Max(r1.LL.Y, r2.LL.Y),
+		math.Min(r1.UR.X, r2.UR.X), math.Min(r1.UR.Y, r2.UR.Y))
+}
+
+// normalize returns r with its lower left and upper right corner in place.
+func normalize(r types.Rectangle) types.Rectangle {
+	return types.NewRectangle(
+		math.Min(r.LL.X, r.UR.X), math.Min(r.LL.Y, r.UR.Y),
+		math.Max(r.LL.X, r.UR.X), math.Max(r.LL.Y, r.UR.Y))
+}
+
+// PageBoxes returns the effective page boxes of page i.
+func PageBoxes(xRefTable *XRefTable, i int) (*PageBoundaries, error) {
+
+	d, inhPAttrs, err := xRefTable.PageDict(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if d == nil {
+		return nil, errors.Errorf("page %d not found", i)
+	}
+
+	if inhPAttrs.mediaBox == nil {
+		return nil, errors.Errorf("page %d: missing MediaBox", i)
+	}
+
+	pb := &PageBoundaries{Media: normalize(rect(xRefTable, *inhPAttrs.mediaBox))}
+
+	pb.Crop = pb.Media
+	if inhPAttrs.cropBox != nil {
+		pb.Crop = intersect(normalize(rect(xRefTable, *inhPAttrs.cropBox)), pb.Media)
+	}
+
+	for _, name := range []string{"TrimBox", "BleedBox", "ArtBox"} {
+
+		r := pb.box(name)
+		*r = pb.Crop
+
+		o, found := d.Find(name)
+		if !found {
+			continue
+		}
+
+		arr, err := xRefTable.DereferenceArray(o)
+		if err != nil || arr == nil || len(*arr) != 4 {
+			return nil, errors.Errorf("page %d: invalid %s", i, name)
+		}
+
+		*r = intersect(normalize(rect(xRefTable, *arr)), pb.Media)
+	}
+
+	return pb, nil
+}
+
+// ListPageBoxes returns a list of the effective page boxes of the selected pages.
+// No page selection means all pages.
+func ListPageBoxes(xRefTable *XRefTable, selectedPages IntSet) ([]string, error) {
+
+	var list []string
+
+	for i := 1; i <= xRefTable.PageCount; i++ {
+
+		if len(selectedPages) > 0 && !selectedPages[i] {
+			continue
+		}
+
+		pb, err := PageBoxes(xRefTable, i)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, fmt.Sprintf("page %d:", i))
+
+		for _, name := range []string{"MediaBox", "CropBox", "BleedBox", "TrimBox", "ArtBox"} {
+			r := *pb.box(name)
+			list = append(list, fmt.Sprintf("  %-8s %s %.2f x %.2f", name, formatBox(r), r.Width(), r.Height()))
+		}
+	}
+
+	return list, nil
+}
+
+// setPageBoxes applies bss to page i in the given order.
+func setPageBoxes(xRefTable *XRefTable, i int, bss []*BoxSpec) error {
+
+	pb, err := PageBoxes(xRefTable, i)
+	if err != nil {
+		return err
+	}
+
+	d, _, err := xRefTable.PageDict(i)
+	if err != nil {
+		return err
+	}
+
+	for _, bs := range bss {
+
+		var r types.Rectangle
+
+		if bs.Rect != nil {
+			r = *bs.Rect
+		} else {
+			ref := pb.box(bs.RefBox)
+			m := bs.Margins
+			r = types.NewRectangle(ref.LL.X+m[3], ref.LL.Y+m[2], ref.UR.X-m[1], ref.UR.Y-m[0])
+		}
+
+		if bs.Box != "MediaBox" {
+			r = intersect(r, pb.Media)
+		}
+
+		if r.Width() <= 0 || r.Height() <= 0 {
+			return errors.Errorf("page %d: empty %s", i, bs.Box)
+		}
+
+		log.Debug.Printf("setPageBoxes: page %d %s %s\n", i, bs.Box, formatBox(r))
+
+		d.Update(bs.Box, NewRectangle(r.LL.X, r.LL.Y, r.UR.X, r.UR.Y))
+
+		if bs.Box == "MediaBox" {
+			// Keep the other boxes of this page within the new media box.
+			for _, name := range []string{"CropBox", "TrimBox", "BleedBox", "ArtBox"} {
+				if _, found := d.Find(name); !found {
+					continue
+				}
+				c := intersect(*pb.box(name), r)
+				if c.Width() <= 0 || c.Height() <= 0 {
+					return errors.Errorf("page %d: %s outside of MediaBox", i, name)
+				}
+				d.Update(name, NewRectangle(c.LL.X, c.LL.Y, c.UR.X, c.UR.Y))
+			}
+		}
+
+		// Boxes defaulting to the box just set change too.
+		if pb, err = PageBoxes(xRefTable, i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetPageBoxes sets page boxes of the selected pages as described by bss.
+// Relative values refer to the page boxes in effect including the ones set before.
+// No page selection means all pages.
+func SetPageBoxes(xRefTable *XRefTable, selectedPages IntSet, bss []*BoxSpec) error {
+
+	for i := 1; i <= xRefTable.PageCount; i++ {
+
+		if len(selectedPages) > 0 && !selectedPages[i] {
+			continue
+		}
+
+		if err := setPageBoxes(xRefTable, i, bss); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,413 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// => RFC 5652 Cryptographic Message Syntax, SignedData
+//
+// PDF signatures are detached: the signed content is the byte range of the file
+// and the SignedData only carries its digest as a signed attribute.
+
+var (
+	oidSignedData                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttributeContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA1                          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSASSAPSS                     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidECDSAWithSHA256               = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// digestAlgorithms maps the supported digest algorithms to their hash functions.
+var digestAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA1, crypto.SHA1},
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+// RFC 5652 SignedData
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"` // [0] IMPLICIT CertificateSet
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"` // [1] IMPLICIT RevocationInfoChoices
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// RFC 5652 EncapsulatedContentInfo
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,explicit,tag:0"` // absent for detached signatures
+}
+
+// RFC 5652 SignerInfo
+type signerInfo struct {
+	Version            int
+	Sid                asn1.RawValue // IssuerAndSerialNumber or [0] SubjectKeyIdentifier
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"` // [0] IMPLICIT SET OF Attribute
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"` // [1] IMPLICIT SET OF Attribute
+}
+
+// RFC 5652 Attribute
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue // SET OF AttributeValue
+}
+
+// RFC 5035 ESSCertIDv2 using the default hash algorithm SHA-256.
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+// RFC 5035 SigningCertificateV2
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+func newAttribute(oid asn1.ObjectIdentifier, value interface{}) (attribute, error) {
+
+	b, err := asn1.Marshal(value)
+	if err != nil {
+		return attribute{}, err
+	}
+
+	return attribute{Type: oid, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b}}, nil
+}
+
+// marshalAttributes returns the DER encoded content of a SET OF Attribute.
+func marshalAttributes(attrs []attribute) ([]byte, error) {
+
+	var bb [][]byte
+
+	for _, attr := range attrs {
+		b, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		bb = append(bb, b)
+	}
+
+	// DER requires the elements of a SET OF to be sorted by their encodings.
+	sort.Slice(bb, func(i, j int) bool { return bytes.Compare(bb[i], bb[j]) < 0 })
+
+	return bytes.Join(bb, nil), nil
+}
+
+func signatureAlgorithm(key crypto.PublicKey) (pkix.AlgorithmIdentifier, error) {
+
+	switch key.(type) {
+
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+
+	}
+
+	return pkix.AlgorithmIdentifier{}, errors.Errorf("unsupported public key type %T", key)
+}
+
+// signedAttributes returns the signed attributes for a detached signature over content with the SHA-256 digest.
+// CAdES signatures replace the signing time by a reference to the signing certificate.
+func signedAttributes(digest []byte, kp *KeyPair, cades bool, signingTime time.Time) ([]byte, error) {
+
+	attrs := make([]attribute, 0, 3)
+
+	attr, err := newAttribute(oidAttributeContentType, oidData)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, attr)
+
+	attr, err = newAttribute(oidAttributeMessageDigest, digest)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, attr)
+
+	if cades {
+		h := sha256.Sum256(kp.Cert.Raw)
+		attr, err = newAttribute(oidAttributeSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: h[:]}}})
+	} else {
+		attr, err = newAttribute(oidAttributeSigningTime, signingTime.UTC())
+	}
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, attr)
+
+	return marshalAttributes(attrs)
+}
+
+// signDetached returns a CMS SignedData for content with the SHA-256 digest signed by kp.
+func signDetached(digest []byte, kp *KeyPair, cades bool, signingTime time.Time) ([]byte, error) {
+
+	signer, ok := kp.Key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unsupported private key type %T", kp.Key)
+	}
+
+	sigAlg, err := signatureAlgorithm(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := signedAttributes(digest, kp, cades, signingTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the DER encoding of the signed attributes using the SET OF tag.
+	b, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256(b)
+
+	signature, err := signer.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: kp.Cert.RawIssuer},
+		SerialNumber: kp.Cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var certs bytes.Buffer
+	certs.Write(kp.Cert.Raw)
+	for _, cert := range kp.Chain {
+		certs.Write(cert.Raw)
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs.Bytes()},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			Sid:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	}
+
+	b, err = asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// cmsSignature is a parsed SignedData along with its signer.
+type cmsSignature struct {
+	signer      signerInfo
+	hash        crypto.Hash
+	certs       []*x509.Certificate   // All certificates included.
+	cert        *x509.Certificate     // The signing certificate.
+	contentType asn1.ObjectIdentifier // Type of the encapsulated content.
+	content     []byte                // Encapsulated content, nil for detached signatures.
+	digest      []byte                // Value of the message digest attribute.
+	signingTime time.Time             // Value of the signing time attribute, zero if missing.
+}
+
+func digestHash(alg pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+
+	for _, da := range digestAlgorithms {
+		if alg.Algorithm.Equal(da.oid) {
+			return da.hash, nil
+		}
+	}
+
+	return 0, errors.Errorf("unsupported digest algorithm %v", alg.Algorithm)
+}
+
+// parseSignedAttributes picks up message digest and signing time.
+func (s *cmsSignature) parseSignedAttributes() error {
+
+	for rest := s.signer.SignedAttrs.Bytes; len(rest) > 0; {
+
+		var attr attribute
+		var err error
+
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return err
+		}
+
+		switch {
+
+		case attr.Type.Equal(oidAttributeMessageDigest):
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &s.digest); err != nil {
+				return err
+			}
+
+		case attr.Type.Equal(oidAttributeSigningTime):
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &s.signingTime); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	if s.digest == nil {
+		return errors.New("missing message digest attribute")
+	}
+
+	return nil
+}
+
+// parseSignedData parses a CMS SignedData with a single signer.
+// Trailing bytes like the zero padding of a signature dict's Contents are ignored.
+func parseSignedData(b []byte) (*cmsSignature, error) {
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, err
+	}
+
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.Errorf("unsupported content type %v", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, errors.Errorf("expected 1 signer, got %d", len(sd.SignerInfos))
+	}
+
+	s := &cmsSignature{signer: sd.SignerInfos[0], contentType: sd.EncapContentInfo.EContentType}
+
+	var err error
+
+	if s.hash, err = digestHash(s.signer.DigestAlgorithm); err != nil {
+		return nil, err
+	}
+
+	if len(sd.EncapContentInfo.EContent.Bytes) > 0 {
+		if _, err = asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &s.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sd.Certificates.Bytes) > 0 {
+		if s.certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cert := range s.certs {
+		if identifiesCertificate(s.signer.Sid, cert) {
+			s.cert = cert
+			break
+		}
+	}
+
+	if s.cert == nil {
+		return nil, errors.New("missing signing certificate")
+	}
+
+	if len(s.signer.SignedAttrs.Bytes) > 0 {
+		if err = s.parseSignedAttributes(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// verifyDigest checks the digest of the signed content against the message digest attribute.
+// Without signed attributes the digest is verified along with the signature.
+func (s *cmsSignature) verifyDigest(digest []byte) bool {
+	return s.digest == nil || bytes.Equal(s.digest, digest)
+}
+
+// verifySignature checks the signature over the signed attributes or over the digest of the signed content.
+func (s *cmsSignature) verifySignature(digest []byte) error {
+
+	if len(s.signer.SignedAttrs.Bytes) > 0 {
+
+		// The signature covers the DER encoding of the signed attributes using the SET OF tag.
+		b := append([]byte{0x31}, s.signer.SignedAttrs.FullBytes[1:]...)
+
+		h := s.hash.New()
+		h.Write(b)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := s.cert.PublicKey.(type) {
+
+	case *rsa.PublicKey:
+		if s.signer.SignatureAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+			return rsa.VerifyPSS(pub, s.hash, digest, s.signer.Signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, s.hash, digest, s.signer.Signature)
+
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, s.signer.Signature) {
+			return errors.New("ecdsa: verification error")
+		}
+		return nil
+
+	}
+
+	return errors.Errorf("unsupported public key type %T", s.cert.PublicKey)
+}
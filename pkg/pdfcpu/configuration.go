@@ -16,9 +16,14 @@ limitations under the License.
 
 package pdfcpu
 
+import (
+	"context"
+	"runtime"
+)
+
 const (
 
-	// ValidationStrict ensures 100% compliance with the spec (PDF 32000-1:2008).
+	// ValidationStrict ensures 100% compliance with the spec (PDF 32000-1:2008 or PDF 32000-2:2017).
 	ValidationStrict = 0
 
 	// ValidationRelaxed ensures PDF compliance based on frequently encountered validation errors.
@@ -61,6 +66,22 @@ const (
 	CHANGEOPW
 	STAMP
 	ADDWATERMARKS
+	LISTREVISIONS
+	EXTRACTREVISION
+	LINEARIZE
+	SIGN
+	VERIFYSIGNATURES
+	ADDDSS
+	ROTATE
+	INSERTPAGES
+	REMOVEPAGES
+	MOVEPAGES
+	NUP
+	BOOKLET
+	LISTBOXES
+	SETBOXES
+	CROP
+	RESIZE
 )
 
 // Configuration of a PDFContext.
@@ -72,9 +93,26 @@ type Configuration struct {
 	// Enables decoding of all streams (fontfiles, images..) for logging purposes.
 	DecodeAllStreams bool
 
+	// Enables lazy reading: objects get parsed from file on first access instead of at read time.
+	// Lookups then modify the xRefTable, so a lazily read context is not safe for concurrent use.
+	Lazy bool
+
+	// Number of goroutines decoding object streams and, if DecodeAllStreams is on, all other streams while reading.
+	// Values < 2 turn off concurrent decoding.
+	Workers int
+
+	// Upper limit in bytes for stream content kept in memory in lazy mode.
+	// Least recently used stream content gets evicted and reloaded from file on demand.
+	// 0 means no limit.
+	LazyMemoryBudget int64
+
 	// Validate against ISO-32000: strict or relaxed
 	ValidationMode int
 
+	// Target spec for strict validation: V17 for ISO 32000-1 or V20 for ISO 32000-2.
+	// nil means the version the document claims.
+	ValidationTarget *PDFVersion
+
 	// End of line char sequence for writing.
 	Eol string
 
@@ -87,6 +125,14 @@ type Configuration struct {
 	// Switches between xRefSection (<=V1.4) and objectStream/xRefStream (>=V1.5) writing.
 	WriteXRefStream bool
 
+	// Appends changes as incremental update to the original file instead of rewriting it.
+	// This keeps existing digital signatures valid.
+	Incremental bool
+
+	// Writes a linearized file ("Fast Web View") enabling viewers to display page 1 before the whole file is loaded.
+	// Linearized files are always written using cross reference sections without object streams.
+	Linearize bool
+
 	// Turns on stats collection.
 	CollectStats bool
 
@@ -111,11 +157,40 @@ type Configuration struct {
 	// false: use 40 bit key
 	EncryptUsing128BitKey bool
 
-	// Supplied user access permissions, see Table 22
+	// EncryptUsing256BitKey ensures 256 bit key length using AES-256 (security handler revision 6).
+	// Takes precedence over EncryptUsing128BitKey and requires EncryptUsingAES.
+	EncryptUsing256BitKey bool
+
+	// UnencryptedMetadata leaves XMP metadata streams readable (requires 128 or 256 bit keys).
+	// false: encrypt metadata streams along with everything else.
+	UnencryptedMetadata bool
+
+	// EncryptEmbeddedFilesOnly restricts encryption to embedded file streams (requires 128 or 256 bit keys).
+	// Everything else including strings remains readable.
+	EncryptEmbeddedFilesOnly bool
+
+	// Supplied user access permissions, see Table 22 and PermissionFlags.UserAccessPermissions.
+	// Uses the layout of security handler revisions >= 3 and gets mapped for revision 2.
 	UserAccessPermissions int16
 
+	// Encrypt for these recipients using the public-key security handler (Adobe.PubSec) instead of passwords.
+	Recipients []Recipient
+
+	// Key pair of a recipient needed for reading files encrypted using the public-key security handler
+	// or of the signer for signing,
+	// see LoadKeyPair.
+	KeyPair *KeyPair
+
+	// Time Stamping Authority providing document timestamps, see TSAClient.
+	Timestamper Timestamper
+
 	// Command being executed.
 	Mode CommandMode
+
+	// Context governs the processing of a command.
+	// Reading, validation, optimization and writing stop once it gets cancelled or its deadline expires
+	// and return the context's error. nil means no cancellation.
+	Context context.Context
 }
 
 // NewDefaultConfiguration returns the default pdfcpu configuration.
@@ -124,6 +199,7 @@ func NewDefaultConfiguration() *Configuration {
 	return &Configuration{
 		Reader15:              true,
 		DecodeAllStreams:      false,
+		Workers:               runtime.NumCPU(),
 		ValidationMode:        ValidationRelaxed,
 		Eol:                   EolLF,
 		WriteObjectStream:     true,
@@ -19,7 +19,7 @@ package pdfcpu
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"sort"
 	"strings"
 
@@ -35,22 +35,18 @@ type PDFContext struct {
 	Write    *WriteContext
 }
 
-// NewPDFContext initializes a new PDFContext.
-func NewPDFContext(fileName string, file *os.File, config *Configuration) (*PDFContext, error) {
+// NewPDFContext initializes a new PDFContext for a PDF of fileSize bytes readable via rs.
+// fileName is used for reporting only and may be empty.
+func NewPDFContext(fileName string, rs io.ReadSeeker, fileSize int64, config *Configuration) (*PDFContext, error) {
 
 	if config == nil {
 		config = NewDefaultConfiguration()
 	}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-
 	ctx := &PDFContext{
 		config,
-		newXRefTable(config.ValidationMode),
-		newReadContext(fileName, file, fileInfo.Size()),
+		newXRefTable(config),
+		newReadContext(fileName, rs, fileSize),
 		newOptimizationContext(),
 		NewWriteContext(config.Eol),
 	}
@@ -93,6 +89,11 @@ func (ctx *PDFContext) String() string {
 		logStr = append(logStr, "is hybrid reference file\n")
 	}
 
+	if ctx.Read.Recovered {
+		n, s := ctx.Read.RecoveredObjectsString()
+		logStr = append(logStr, fmt.Sprintf("recovered %d objects from damaged file: %s\n", n, s))
+	}
+
 	if ctx.Tagged {
 		logStr = append(logStr, "is tagged file\n")
 	}
@@ -157,8 +158,9 @@ type ReadContext struct {
 
 	// The PDF-File which gets processed.
 	FileName string
-	File     *os.File
 	FileSize int64
+	rs       io.ReadSeeker
+	closer   io.Closer // set for files kept open in lazy mode.
 
 	BinaryTotalSize     int64 // total stream data
 	BinaryImageSize     int64 // total image stream data
@@ -174,18 +176,39 @@ type ReadContext struct {
 
 	UsingXRefStreams bool   // File is using xref streams.
 	XRefStreams      IntSet // All object numbers of any xref streams found.
+	XRefOffset       int64  // Offset of the last xref section or xref stream.
+
+	Recovered        bool   // The xref table has been rebuilt by scanning a damaged file.
+	RecoveredObjects IntSet // All object numbers found while scanning a damaged file.
+
+	Revisions []*Revision    // The original document followed by all incremental updates.
+	sections  []*xRefSection // xref sections recorded while following Prev, see Revisions.
+	section   *xRefSection   // The xref section being parsed.
 }
 
-func newReadContext(fileName string, file *os.File, fileSize int64) *ReadContext {
+func newReadContext(fileName string, rs io.ReadSeeker, fileSize int64) *ReadContext {
 	return &ReadContext{
 		FileName:      fileName,
-		File:          file,
 		FileSize:      fileSize,
+		rs:            rs,
 		ObjectStreams: IntSet{},
 		XRefStreams:   IntSet{},
 	}
 }
 
+// Close releases the file kept open for lazy reading.
+func (rc *ReadContext) Close() error {
+
+	if rc.closer == nil {
+		return nil
+	}
+
+	err := rc.closer.Close()
+	rc.closer = nil
+
+	return err
+}
+
 // IsObjectStreamObject returns true if object i is a an object stream.
 // All compressed objects are object streams.
 func (rc *ReadContext) IsObjectStreamObject(i int) bool {
@@ -211,6 +234,23 @@ func (rc *ReadContext) ObjectStreamsString() (int, string) {
 	return len(objStreams), strings.Join(objStreams, ",")
 }
 
+// RecoveredObjectsString returns a formatted string and the number of objects recovered from a damaged file.
+func (rc *ReadContext) RecoveredObjectsString() (int, string) {
+
+	var objs []int
+	for k := range rc.RecoveredObjects {
+		objs = append(objs, k)
+	}
+	sort.Ints(objs)
+
+	var recovered []string
+	for _, i := range objs {
+		recovered = append(recovered, fmt.Sprintf("%d", i))
+	}
+
+	return len(recovered), strings.Join(recovered, ",")
+}
+
 // IsXRefStreamObject returns true if object #i is a an xref stream.
 func (rc *ReadContext) IsXRefStreamObject(i int) bool {
 	return rc.XRefStreams[i]
@@ -564,6 +604,10 @@ type WriteContext struct {
 	CurrentObjStream    *int // if not nil, any new non-stream-object gets added to the object stream with this object number.
 
 	Eol string // end of line char sequence
+
+	sigObjNr     int   // signature dict getting signed once written, see WriteSignedPDFFile.
+	sigByteRange int64 // write offset of the signature dict's ByteRange array.
+	sigContents  int64 // write offset of the signature dict's Contents hex string.
 }
 
 // NewWriteContext returns a new WriteContext.
@@ -21,6 +21,7 @@ package pdfcpu
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
 )
@@ -1203,6 +1204,90 @@ func addRequirements(xRefTable *XRefTable, rootDict *PDFDict) {
 	rootDict.Insert("Requirements", PDFArray{d})
 }
 
+// CreatePDF20DemoXRef creates a minimal PDF 2.0 file using associated files and a projection annotation.
+func CreatePDF20DemoXRef() (*XRefTable, error) {
+
+	xRefTable, err := createXRefTableWithRootDict()
+	if err != nil {
+		return nil, err
+	}
+
+	v := V20
+	xRefTable.HeaderVersion = &v
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	pagesDict := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Pages"),
+			"Count":    PDFInteger(1),
+			"MediaBox": NewRectangle(0, 0, 400, 600),
+		},
+	}
+
+	pagesIndRef, err := xRefTable.IndRefForNewObject(pagesDict)
+	if err != nil {
+		return nil, err
+	}
+
+	rootDict.Insert("Pages", *pagesIndRef)
+
+	// PDF 2.0 deprecates all info dict entries but CreationDate and ModDate.
+	infoDict := NewPDFDict()
+	infoDict.Insert("CreationDate", DateStringLiteral(time.Now()))
+
+	xRefTable.Info, err = xRefTable.IndRefForNewObject(infoDict)
+	if err != nil {
+		return nil, err
+	}
+
+	// Associated file of the document.
+	fileSpecDict := NewPDFDict()
+	fileSpecDict.InsertName("Type", "Filespec")
+	fileSpecDict.InsertString("F", "data.csv")
+	fileSpecDict.InsertString("UF", "data.csv")
+	fileSpecDict.InsertName("AFRelationship", "Data")
+
+	fileSpecIndRef, err := xRefTable.IndRefForNewObject(fileSpecDict)
+	if err != nil {
+		return nil, err
+	}
+
+	rootDict.Insert("AF", PDFArray{*fileSpecIndRef})
+
+	annotDict := NewPDFDict()
+	annotDict.InsertName("Type", "Annot")
+	annotDict.InsertName("Subtype", "Projection")
+	annotDict.Insert("Rect", NewRectangle(10, 10, 110, 60))
+	annotDict.InsertString("Contents", "Projection annotation")
+
+	annotIndRef, err := xRefTable.IndRefForNewObject(annotDict)
+	if err != nil {
+		return nil, err
+	}
+
+	pageDict := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":      PDFName("Page"),
+			"Parent":    *pagesIndRef,
+			"Resources": NewPDFDict(),
+			"Annots":    PDFArray{*annotIndRef},
+		},
+	}
+
+	pageIndRef, err := xRefTable.IndRefForNewObject(pageDict)
+	if err != nil {
+		return nil, err
+	}
+
+	pagesDict.Insert("Kids", PDFArray{*pageIndRef})
+
+	return xRefTable, nil
+}
+
 // CreateAnnotationDemoXRef creates a PDF file with examples of annotations and actions.
 func CreateAnnotationDemoXRef() (*XRefTable, error) {
 
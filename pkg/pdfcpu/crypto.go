@@ -25,12 +25,15 @@ import (
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"strconv"
 	"time"
 
+	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
 	"github.com/iPaladinLLC/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
 )
@@ -46,28 +49,30 @@ var (
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 	}
 
-	// Needed permission bits for pdfcpu commands.
-	perm = map[CommandMode]struct{ extract, modify int }{
-		VALIDATE:           {0, 0},
-		OPTIMIZE:           {0, 0},
-		SPLIT:              {1, 0},
-		MERGE:              {0, 0},
-		EXTRACTIMAGES:      {1, 0},
-		EXTRACTFONTS:       {1, 0},
-		EXTRACTPAGES:       {1, 0},
-		EXTRACTCONTENT:     {1, 0},
-		TRIM:               {0, 1},
-		LISTATTACHMENTS:    {0, 0},
-		EXTRACTATTACHMENTS: {1, 0},
-		ADDATTACHMENTS:     {0, 1},
-		REMOVEATTACHMENTS:  {0, 1},
-		LISTPERMISSIONS:    {0, 0},
-		ADDPERMISSIONS:     {0, 0},
+	// Needed permissions for pdfcpu commands.
+	// Extracting needs bit 10 and modifying needs bit 11 for security handler revisions >= 3, bits 5 and 4 for revision 2.
+	perm = map[CommandMode]PermissionFlags{
+		VALIDATE:           PermNone,
+		OPTIMIZE:           PermNone,
+		SPLIT:              PermExtractAccessibility,
+		MERGE:              PermNone,
+		EXTRACTIMAGES:      PermExtractAccessibility,
+		EXTRACTFONTS:       PermExtractAccessibility,
+		EXTRACTPAGES:       PermExtractAccessibility,
+		EXTRACTCONTENT:     PermExtractAccessibility,
+		TRIM:               PermAssemble,
+		LISTATTACHMENTS:    PermNone,
+		EXTRACTATTACHMENTS: PermExtractAccessibility,
+		ADDATTACHMENTS:     PermAssemble,
+		REMOVEATTACHMENTS:  PermAssemble,
+		LISTPERMISSIONS:    PermNone,
+		ADDPERMISSIONS:     PermNone,
+		SIGN:               PermFillForms,
 	}
 )
 
 // NewEncryptDict creates a new EncryptDict using the standard security handler.
-func newEncryptDict(needAES, need128BitKey bool, permissions int16) *PDFDict {
+func newEncryptDict(needAES bool, keyLength int, permissions int16) *PDFDict {
 
 	d := NewPDFDict()
 
@@ -75,11 +80,16 @@ func newEncryptDict(needAES, need128BitKey bool, permissions int16) *PDFDict {
 
 	d.Insert("Filter", PDFName("Standard"))
 
-	if need128BitKey {
+	switch keyLength {
+	case 256:
+		d.Insert("Length", PDFInteger(256))
+		d.Insert("R", PDFInteger(6))
+		d.Insert("V", PDFInteger(5))
+	case 128:
 		d.Insert("Length", PDFInteger(128))
 		d.Insert("R", PDFInteger(4))
 		d.Insert("V", PDFInteger(4))
-	} else {
+	default:
 		d.Insert("R", PDFInteger(2))
 		d.Insert("V", PDFInteger(1))
 	}
@@ -93,17 +103,17 @@ func newEncryptDict(needAES, need128BitKey bool, permissions int16) *PDFDict {
 	d1 := NewPDFDict()
 	d1.Insert("AuthEvent", PDFName("DocOpen"))
 
-	if needAES {
+	switch {
+	case keyLength == 256:
+		d1.Insert("CFM", PDFName("AESV3"))
+	case needAES:
 		d1.Insert("CFM", PDFName("AESV2"))
-	} else {
+	default:
 		d1.Insert("CFM", PDFName("V2"))
 	}
 
-	if need128BitKey {
-		d1.Insert("Length", PDFInteger(16))
-	} else {
-		d1.Insert("Length", PDFInteger(5))
-	}
+	// The crypt filter key length is given in bytes.
+	d1.Insert("Length", PDFInteger(keyLength/8))
 
 	d2 := NewPDFDict()
 	d2.Insert("StdCF", d1)
@@ -111,12 +121,37 @@ func newEncryptDict(needAES, need128BitKey bool, permissions int16) *PDFDict {
 	d.Insert("CF", d2)
 
 	h := "0000000000000000000000000000000000000000000000000000000000000000"
+
+	if keyLength == 256 {
+		// Hash, validation salt and key salt.
+		d.Insert("U", PDFHexLiteral(h+h[:32]))
+		d.Insert("O", PDFHexLiteral(h+h[:32]))
+		d.Insert("UE", PDFHexLiteral(h))
+		d.Insert("OE", PDFHexLiteral(h))
+		d.Insert("Perms", PDFHexLiteral(h[:32]))
+		return &d
+	}
+
 	d.Insert("U", PDFHexLiteral(h))
 	d.Insert("O", PDFHexLiteral(h))
 
 	return &d
 }
 
+// encryptKeyLength returns the key length in bits to be used for encryption.
+func encryptKeyLength(ctx *PDFContext) int {
+
+	if ctx.EncryptUsing256BitKey {
+		return 256
+	}
+
+	if ctx.EncryptUsing128BitKey {
+		return 128
+	}
+
+	return 40
+}
+
 func encKey(userpw string, e *Enc) (key []byte) {
 
 	// 2a
@@ -171,6 +206,10 @@ func encKey(userpw string, e *Enc) (key []byte) {
 // ValidateUserPassword validates the user password aka document open password.
 func validateUserPassword(ctx *PDFContext) (ok bool, key []byte, err error) {
 
+	if ctx.E.R >= 5 {
+		return validateUserPasswordAES256(ctx)
+	}
+
 	// Alg.4/5 p63
 	// 4a/5a create encryption key using Alg.2 p61
 
@@ -335,6 +374,10 @@ func u(ctx *PDFContext) (u []byte, key []byte, err error) {
 // ValidateOwnerPassword validates the owner password aka change permissions password.
 func validateOwnerPassword(ctx *PDFContext) (ok bool, k []byte, err error) {
 
+	if ctx.E.R >= 5 {
+		return validateOwnerPasswordAES256(ctx)
+	}
+
 	ownerpw := ctx.OwnerPW
 	userpw := ctx.UserPW
 
@@ -391,94 +434,374 @@ func validateOwnerPassword(ctx *PDFContext) (ok bool, k []byte, err error) {
 	return ok, k, err
 }
 
-// SupportedCFEntry returns true if all entries found are supported.
-func supportedCFEntry(d *PDFDict) (bool, error) {
+// => 7.6.4.3.3 ff. AES-256 (security handler revisions 5 and 6)
+//
+// The file encryption key is a random 256 bit key which is stored encrypted
+// using a key derived from the user password (UE) and from the owner password (OE).
+// All strings and streams are encrypted using this key directly (AESV3).
 
-	cfm := d.NameEntry("CFM")
-	if cfm != nil && *cfm != "V2" && *cfm != "AESV2" {
-		return false, errors.New("supportedCFEntry: invalid entry \"CFM\"")
+// passwordAES256 returns the UTF-8 representation of pw truncated to 127 bytes.
+func passwordAES256(pw string) []byte {
+
+	b := []byte(pw)
+	if len(b) > 127 {
+		b = b[:127]
 	}
 
-	ae := d.NameEntry("AuthEvent")
-	if ae != nil && *ae != "DocOpen" {
-		return false, errors.New("supportedCFEntry: invalid entry \"AuthEvent\"")
+	return b
+}
+
+// hashAES256 computes the hash of a password as of Algorithm 2.B.
+// Revision 5 (deprecated ExtensionLevel 3) uses a single SHA-256 round.
+func hashAES256(r int, pw, salt, udata []byte) ([]byte, error) {
+
+	h := sha256.New()
+	h.Write(pw)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+
+	if r == 5 {
+		return k, nil
 	}
 
-	l := d.IntEntry("Length")
-	if l != nil && (*l < 8 || *l > 128 || *l%8 > 1) {
-		return false, errors.New("supportedCFEntry: invalid entry \"Length\"")
+	for i := 1; ; i++ {
+
+		// a
+		k1 := make([]byte, 0, 64*(len(pw)+len(k)+len(udata)))
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, pw...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+
+		// b
+		cb, err := aes.NewCipher(k[:16])
+		if err != nil {
+			return nil, err
+		}
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(cb, k[16:32]).CryptBlocks(e, k1)
+
+		// c: The first 16 bytes of e taken as an unsigned big endian integer modulo 3.
+		var sum int
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+
+		// d
+		switch sum % 3 {
+		case 0:
+			b := sha256.Sum256(e)
+			k = b[:]
+		case 1:
+			b := sha512.Sum384(e)
+			k = b[:]
+		case 2:
+			b := sha512.Sum512(e)
+			k = b[:]
+		}
+
+		// e
+		if i >= 64 && int(e[len(e)-1]) <= i-32 {
+			break
+		}
 	}
 
-	return cfm != nil && *cfm == "AESV2", nil
+	return k[:32], nil
 }
 
-func perms(p int) (list []string) {
+// aes256CBCNoPadding en- or decrypts b using AES-256 in CBC mode with a zero IV and no padding.
+func aes256CBCNoPadding(key, b []byte, encrypt bool) ([]byte, error) {
 
-	list = append(list, fmt.Sprintf("%0b", uint32(p)&0x0F3C))
-	list = append(list, fmt.Sprintf("Bit  3: %t (print(rev2), print quality(rev>=3))", p&0x0004 > 0))
-	list = append(list, fmt.Sprintf("Bit  4: %t (modify other than controlled by bits 6,9,11)", p&0x0008 > 0))
-	list = append(list, fmt.Sprintf("Bit  5: %t (extract(rev2), extract other than controlled by bit 10(rev>=3))", p&0x0010 > 0))
-	list = append(list, fmt.Sprintf("Bit  6: %t (add or modify annotations)", p&0x0020 > 0))
-	list = append(list, fmt.Sprintf("Bit  9: %t (fill in form fields(rev>=3)", p&0x0100 > 0))
-	list = append(list, fmt.Sprintf("Bit 10: %t (extract(rev>=3))", p&0x0200 > 0))
-	list = append(list, fmt.Sprintf("Bit 11: %t (modify(rev>=3))", p&0x0400 > 0))
-	list = append(list, fmt.Sprintf("Bit 12: %t (print high-level(rev>=3))", p&0x0800 > 0))
+	if len(b)%aes.BlockSize > 0 {
+		return nil, errors.New("aes256CBCNoPadding: length not a multiple of block size")
+	}
 
-	return list
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	data := make([]byte, len(b))
+
+	if encrypt {
+		cipher.NewCBCEncrypter(cb, iv).CryptBlocks(data, b)
+	} else {
+		cipher.NewCBCDecrypter(cb, iv).CryptBlocks(data, b)
+	}
+
+	return data, nil
 }
 
-// Permissions returns a list of set permissions.
-func Permissions(ctx *PDFContext) (list []string) {
+// permsP decrypts the permissions protected by Perms (Algorithm 13).
+func permsP(e *Enc, key []byte) (int, error) {
 
-	if ctx.E == nil {
-		return append(list, "full access")
+	b, err := aes256CBCNoPadding(key, e.Perms, false)
+	if err != nil {
+		return 0, err
 	}
 
-	return perms(ctx.E.P)
+	if string(b[9:12]) != "adb" {
+		return 0, errors.New("validatePerms: corrupt entry \"Perms\"")
+	}
+
+	return int(int32(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)), nil
 }
 
-func logP(enc *Enc) {
+// validatePerms checks the encrypted copy of the permissions against P.
+// P is not protected otherwise, so relaxed validation replaces P by the permissions
+// protected by Perms or by PermissionsNone if Perms is corrupt.
+func validatePerms(ctx *PDFContext, key []byte) error {
 
-	for _, s := range perms(enc.P) {
-		log.Info.Println(s)
+	e := ctx.E
+
+	p, err := permsP(e, key)
+	if err == nil && p == e.P {
+		return nil
+	}
+
+	if err == nil {
+		err = errors.Errorf("validatePerms: \"Perms\" does not match \"P\" (%d != %d)", p, e.P)
+	} else {
+		p = int(PermissionsNone)
+	}
+
+	if ctx.XRefTable.ValidationMode != ValidationRelaxed {
+		return err
+	}
+
+	log.Info.Printf("%v, using permissions %d\n", err, p)
+	e.P = p
+
+	return nil
+}
+
+// validatePasswordAES256 checks pw against hash and returns the file encryption key decrypted from encKey
+// using Algorithms 2.A, 11 and 12.
+func validatePasswordAES256(ctx *PDFContext, pw string, hash, encKey, udata []byte) (ok bool, key []byte, err error) {
+
+	e := ctx.E
+
+	b := passwordAES256(pw)
+
+	h, err := hashAES256(e.R, b, hash[32:40], udata)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if !bytes.Equal(h, hash[:32]) {
+		return false, nil, nil
+	}
+
+	h, err = hashAES256(e.R, b, hash[40:48], udata)
+	if err != nil {
+		return false, nil, err
+	}
+
+	key, err = aes256CBCNoPadding(h, encKey, false)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err = validatePerms(ctx, key); err != nil {
+		return false, nil, err
+	}
+
+	return true, key, nil
+}
+
+func validateUserPasswordAES256(ctx *PDFContext) (ok bool, key []byte, err error) {
+	return validatePasswordAES256(ctx, ctx.UserPW, ctx.E.U, ctx.E.UE, nil)
+}
+
+func validateOwnerPasswordAES256(ctx *PDFContext) (ok bool, key []byte, err error) {
+	return validatePasswordAES256(ctx, ctx.OwnerPW, ctx.E.O, ctx.E.OE, ctx.E.U)
+}
+
+// hashAndEncryptKeyAES256 computes the password hash (48 bytes) and the encrypted file encryption key
+// using Algorithms 8 and 9.
+func hashAndEncryptKeyAES256(r int, pw string, key, udata []byte) (hash, encKey []byte, err error) {
+
+	b := passwordAES256(pw)
+
+	// Validation salt and key salt.
+	salt := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+
+	hash, err = hashAES256(r, b, salt[:8], udata)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash = append(hash, salt...)
+
+	h, err := hashAES256(r, b, salt[8:], udata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encKey, err = aes256CBCNoPadding(h, key, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return hash, encKey, nil
+}
+
+// permsAES256 computes the encrypted copy of the permissions (Algorithm 10).
+func permsAES256(e *Enc, key []byte) ([]byte, error) {
+
+	b := make([]byte, 16)
+
+	q := uint32(e.P)
+	copy(b, []byte{byte(q), byte(q >> 8), byte(q >> 16), byte(q >> 24), 0xff, 0xff, 0xff, 0xff})
+
+	b[8] = 'F'
+	if e.Emd {
+		b[8] = 'T'
+	}
+
+	copy(b[9:], "adb")
+
+	if _, err := io.ReadFull(rand.Reader, b[12:]); err != nil {
+		return nil, err
+	}
+
+	return aes256CBCNoPadding(key, b, true)
+}
+
+// updateAES256Entries computes U, UE, O, OE and Perms for the file encryption key ctx.EncKey and updates the encrypt dict.
+func updateAES256Entries(ctx *PDFContext, d *PDFDict) (err error) {
+
+	e := ctx.E
+
+	e.U, e.UE, err = hashAndEncryptKeyAES256(e.R, ctx.UserPW, ctx.EncKey, nil)
+	if err != nil {
+		return err
+	}
+
+	ownerpw := ctx.OwnerPW
+	if len(ownerpw) == 0 {
+		ownerpw = ctx.UserPW
+	}
+
+	e.O, e.OE, err = hashAndEncryptKeyAES256(e.R, ownerpw, ctx.EncKey, e.U)
+	if err != nil {
+		return err
+	}
+
+	e.Perms, err = permsAES256(e, ctx.EncKey)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range map[string][]byte{"U": e.U, "UE": e.UE, "O": e.O, "OE": e.OE, "Perms": e.Perms} {
+		d.Update(k, PDFHexLiteral(hex.EncodeToString(v)))
+	}
+
+	return nil
+}
+
+// setupEncryptionAES256 generates a random file encryption key and the corresponding encrypt dict entries.
+func setupEncryptionAES256(ctx *PDFContext, dict *PDFDict) error {
+
+	ctx.EncKey = make([]byte, 32)
+
+	_, err := io.ReadFull(rand.Reader, ctx.EncKey)
+	if err != nil {
+		return err
+	}
+
+	err = updateAES256Entries(ctx, dict)
+	if err != nil {
+		return err
 	}
 
+	return ensureAES256Extension(ctx)
 }
 
-func maskExtract(mode CommandMode, secHandlerRev int) int {
+// ensureAES256Extension declares the Adobe extension defining AES-256 for files written as PDF 1.7.
+// Older files get raised to PDF 1.7 which the extension is based on.
+func ensureAES256Extension(ctx *PDFContext) error {
 
-	p, ok := perm[mode]
+	if ctx.Version() >= V20 {
+		return nil
+	}
+
+	if err := ensureRootVersion(ctx); err != nil {
+		return err
+	}
 
-	// no permissions defined or don't need extract permission
-	if !ok || p.extract == 0 {
-		return 0
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
 	}
 
-	// need extract permission
+	extDict, err := ctx.DereferenceDict(rootDict.Dict["Extensions"])
+	if err != nil {
+		return err
+	}
 
-	if secHandlerRev >= 3 {
-		return 0x0200 // need bit 10
+	if extDict == nil {
+		d := NewPDFDict()
+		extDict = &d
+		rootDict.Insert("Extensions", d)
 	}
 
-	return 0x0010 // need bit 5
+	d := NewPDFDict()
+	d.Insert("BaseVersion", PDFName("1.7"))
+	d.Insert("ExtensionLevel", PDFInteger(8))
+	extDict.Update("ADBE", d)
+
+	return nil
 }
 
-func maskModify(mode CommandMode, secHandlerRev int) int {
+// SupportedCFEntry returns true if all entries found are supported.
+func supportedCFEntry(d *PDFDict) (bool, error) {
 
-	p, ok := perm[mode]
+	cfm := d.NameEntry("CFM")
+	if cfm != nil && *cfm != "V2" && *cfm != "AESV2" && *cfm != "AESV3" {
+		return false, errors.New("supportedCFEntry: invalid entry \"CFM\"")
+	}
 
-	// no permissions defined or don't need modify permission
-	if !ok || p.modify == 0 {
-		return 0
+	ae := d.NameEntry("AuthEvent")
+	if ae != nil && *ae != "DocOpen" && *ae != "EFOpen" {
+		return false, errors.New("supportedCFEntry: invalid entry \"AuthEvent\"")
+	}
+
+	// Some writers express the AESV3 key length in bits.
+	l := d.IntEntry("Length")
+	if l != nil && (*l < 8 || *l > 128 || *l%8 > 1) && *l != 256 {
+		return false, errors.New("supportedCFEntry: invalid entry \"Length\"")
 	}
 
-	// need modify permission
+	return cfm != nil && (*cfm == "AESV2" || *cfm == "AESV3"), nil
+}
+
+func perms(p int) (list []string) {
+
+	list = append(list, fmt.Sprintf("%0b", uint32(p)&0x0F3C))
+	list = append(list, fmt.Sprintf("Bit  3: %t (print(rev2), print quality(rev>=3))", p&0x0004 > 0))
+	list = append(list, fmt.Sprintf("Bit  4: %t (modify other than controlled by bits 6,9,11)", p&0x0008 > 0))
+	list = append(list, fmt.Sprintf("Bit  5: %t (extract(rev2), extract other than controlled by bit 10(rev>=3))", p&0x0010 > 0))
+	list = append(list, fmt.Sprintf("Bit  6: %t (add or modify annotations)", p&0x0020 > 0))
+	list = append(list, fmt.Sprintf("Bit  9: %t (fill in form fields(rev>=3)", p&0x0100 > 0))
+	list = append(list, fmt.Sprintf("Bit 10: %t (extract(rev>=3))", p&0x0200 > 0))
+	list = append(list, fmt.Sprintf("Bit 11: %t (modify(rev>=3))", p&0x0400 > 0))
+	list = append(list, fmt.Sprintf("Bit 12: %t (print high-level(rev>=3))", p&0x0800 > 0))
 
-	if secHandlerRev >= 3 {
-		return 0x0400 // need bit 11
+	return list
+}
+
+func logP(enc *Enc) {
+
+	for _, s := range perms(enc.P) {
+		log.Info.Println(s)
 	}
 
-	return 0x0008 // need bit 4
 }
 
 // HasNeededPermissions returns true if permissions for pdfcpu processing are present.
@@ -488,16 +811,18 @@ func hasNeededPermissions(mode CommandMode, enc *Enc) bool {
 
 	logP(enc)
 
-	m := maskExtract(mode, enc.R)
-	if m > 0 {
-		if enc.P&m == 0 {
-			return false
-		}
-	}
+	f := perm[mode]
 
-	m = maskModify(mode, enc.R)
-	if m > 0 {
-		if enc.P&m == 0 {
+	// Check the bits themselves rather than the permissions they imply.
+	for _, pf := range permissionFlags {
+		if f&pf.flag == 0 {
+			continue
+		}
+		bit := pf.bit
+		if enc.R < 3 {
+			bit = pf.bitR2
+		}
+		if enc.P&permissionBit(bit) == 0 {
 			return false
 		}
 	}
@@ -509,8 +834,8 @@ func getV(dict *PDFDict) (*int, error) {
 
 	v := dict.IntEntry("V")
 
-	if v == nil || (*v != 1 && *v != 2 && *v != 4) {
-		return nil, errors.Errorf("getV: \"V\" must be one of 1,2,4")
+	if v == nil || (*v != 1 && *v != 2 && *v != 4 && *v != 5) {
+		return nil, errors.Errorf("getV: \"V\" must be one of 1,2,4,5")
 	}
 
 	return v, nil
@@ -541,8 +866,8 @@ func checkV(ctx *PDFContext, dict *PDFDict) (*int, error) {
 		return nil, err
 	}
 
-	// Right now we support only 4
-	if *v != 4 {
+	// Crypt filters are used as of 4.
+	if *v < 4 {
 		return v, nil
 	}
 
@@ -573,16 +898,19 @@ func checkV(ctx *PDFContext, dict *PDFDict) (*int, error) {
 		ctx.AES4Strings = aes
 	}
 
-	// EFF
+	// EFF, defaults to StmF.
 	eff := dict.NameEntry("EFF")
-	if eff != nil && *strf != "Identity" {
+	if eff == nil {
+		ctx.AES4EmbeddedStreams = ctx.AES4Streams
+	}
+	if eff != nil && *eff != "Identity" {
 		d := cfDict.PDFDictEntry(*eff)
 		if d == nil {
 			return nil, errors.Errorf("checkV: entry \"%s\" missing in \"CF\"", *eff)
 		}
 		aes, err := supportedCFEntry(d)
 		if err != nil {
-			return nil, errors.Wrapf(err, "checkV: unsupported \"%s\" entry in \"CF\"", *strf)
+			return nil, errors.Wrapf(err, "checkV: unsupported \"%s\" entry in \"CF\"", *eff)
 		}
 		ctx.AES4EmbeddedStreams = aes
 	}
@@ -590,6 +918,140 @@ func checkV(ctx *PDFContext, dict *PDFDict) (*int, error) {
 	return v, nil
 }
 
+// cryptFilters records the crypt filters of an encrypt dict using V>=4.
+func cryptFilters(dict *PDFDict, enc *Enc) error {
+
+	if enc.V < 4 {
+		return nil
+	}
+
+	// StmF and StrF default to Identity, EFF defaults to StmF.
+	enc.StmF, enc.StrF = "Identity", "Identity"
+
+	if n := dict.NameEntry("StmF"); n != nil {
+		enc.StmF = *n
+	}
+
+	if n := dict.NameEntry("StrF"); n != nil {
+		enc.StrF = *n
+	}
+
+	enc.EFF = enc.StmF
+	if n := dict.NameEntry("EFF"); n != nil {
+		enc.EFF = *n
+	}
+
+	enc.CF = map[string]bool{}
+
+	if cfDict := dict.PDFDictEntry("CF"); cfDict != nil {
+		for k, v := range cfDict.Dict {
+			d, ok := v.(PDFDict)
+			if !ok {
+				return errors.Errorf("cryptFilters: corrupt entry \"%s\" in \"CF\"", k)
+			}
+			aes, err := supportedCFEntry(&d)
+			if err != nil {
+				return errors.Wrapf(err, "cryptFilters: unsupported \"%s\" entry in \"CF\"", k)
+			}
+			enc.CF[k] = aes
+		}
+	}
+
+	return nil
+}
+
+// setCryptFilterEntries restricts encryption by setting EncryptMetadata and the crypt filters for streams,
+// strings and embedded files of an encrypt dict using the crypt filter cf.
+func setCryptFilterEntries(dict *PDFDict, cf string, encryptMetadata, embeddedFilesOnly bool) {
+
+	if !encryptMetadata {
+		dict.Insert("EncryptMetadata", PDFBoolean(false))
+	}
+
+	if !embeddedFilesOnly {
+		return
+	}
+
+	dict.Update("StmF", PDFName("Identity"))
+	dict.Update("StrF", PDFName("Identity"))
+	dict.Insert("EFF", PDFName(cf))
+
+	// Authorization is required for accessing embedded files only.
+	if cfDict := dict.PDFDictEntry("CF"); cfDict != nil {
+		if d := cfDict.PDFDictEntry(cf); d != nil {
+			d.Update("AuthEvent", PDFName("EFOpen"))
+		}
+	}
+}
+
+// stringsEncrypted returns true unless strings use the Identity crypt filter.
+func stringsEncrypted(xRefTable *XRefTable) bool {
+
+	return xRefTable.EncKey != nil && (xRefTable.E == nil || xRefTable.E.StrF != "Identity")
+}
+
+// cryptFilterName returns the name of the crypt filter given by a leading Crypt filter in the filter pipeline of sd.
+func cryptFilterName(sd *PDFStreamDict) (string, bool) {
+
+	fpl := sd.FilterPipeline
+	if len(fpl) == 0 || fpl[0].Name != filter.Crypt {
+		return "", false
+	}
+
+	if fpl[0].DecodeParms != nil {
+		if n := fpl[0].DecodeParms.NameEntry("Name"); n != nil {
+			return *n, true
+		}
+	}
+
+	return "Identity", true
+}
+
+// streamEncryption returns true if sd needs to be en/decrypted along with the cipher to be used.
+func streamEncryption(xRefTable *XRefTable, sd *PDFStreamDict) (encrypted, aes bool, err error) {
+
+	if xRefTable.EncKey == nil {
+		return false, false, nil
+	}
+
+	// XRefStreams are not encrypted.
+	t := sd.Type()
+	if t != nil && *t == "XRef" {
+		return false, false, nil
+	}
+
+	e := xRefTable.E
+
+	// A Crypt filter takes precedence.
+	if cf, ok := cryptFilterName(sd); ok {
+		if cf == "Identity" {
+			return false, false, nil
+		}
+		if e == nil || e.CF == nil {
+			return true, xRefTable.AES4Streams, nil
+		}
+		aes, found := e.CF[cf]
+		if !found {
+			return false, false, errors.Errorf("streamEncryption: unknown crypt filter \"%s\"", cf)
+		}
+		return true, aes, nil
+	}
+
+	if e == nil {
+		return true, xRefTable.AES4Streams, nil
+	}
+
+	if t != nil && *t == "Metadata" && !e.Emd {
+		return false, false, nil
+	}
+
+	if t != nil && *t == "EmbeddedFile" && e.EFF != "" {
+		return e.EFF != "Identity", xRefTable.AES4EmbeddedStreams, nil
+	}
+
+	return e.StmF != "Identity", xRefTable.AES4Streams, nil
+}
+
 func length(dict *PDFDict) (int, error) {
 
 	l := dict.IntEntry("Length")
@@ -597,7 +1059,7 @@ func length(dict *PDFDict) (int, error) {
 		return 40, nil
 	}
 
-	if *l < 40 || *l > 128 || *l%8 > 0 {
+	if (*l < 40 || *l > 128 || *l%8 > 0) && *l != 256 {
 		return 0, errors.Errorf("length: \"Length\" %d not supported\n", *l)
 	}
 
@@ -607,8 +1069,8 @@ func length(dict *PDFDict) (int, error) {
 func getR(dict *PDFDict) (int, error) {
 
 	r := dict.IntEntry("R")
-	if r == nil || (*r != 2 && *r != 3 && *r != 4) {
-		return 0, errors.New("getR: \"R\" must be 2,3,4")
+	if r == nil || (*r != 2 && *r != 3 && *r != 4 && *r != 5 && *r != 6) {
+		return 0, errors.New("getR: \"R\" must be 2,3,4,5,6")
 	}
 
 	return *r, nil
@@ -620,8 +1082,11 @@ func supportedEncryption(ctx *PDFContext, dict *PDFDict) (*Enc, error) {
 
 	// Filter
 	filter := dict.NameEntry("Filter")
+	if filter != nil && *filter == "Adobe.PubSec" {
+		return supportedPubSecEncryption(ctx, dict)
+	}
 	if filter == nil || *filter != "Standard" {
-		return nil, errors.New("unsupported encryption: filter must be \"Standard\"")
+		return nil, errors.New("unsupported encryption: filter must be \"Standard\" or \"Adobe.PubSec\"")
 	}
 
 	// SubFilter
@@ -647,12 +1112,22 @@ func supportedEncryption(ctx *PDFContext, dict *PDFDict) (*Enc, error) {
 		return nil, err
 	}
 
+	if r >= 5 && *v != 5 || r < 5 && *v == 5 {
+		return nil, errors.Errorf("unsupported encryption: \"R\" %d does not match \"V\" %d", r, *v)
+	}
+
+	// O and U hold 32 bytes, or 48 bytes for AES-256 which may be padded.
+	n := 32
+	if r >= 5 {
+		n = 48
+	}
+
 	// O
 	o, err := dict.StringEntryBytes("O")
 	if err != nil {
 		return nil, err
 	}
-	if o == nil || len(o) != 32 {
+	if o == nil || len(o) != n && (r < 5 || len(o) < n) {
 		return nil, errors.New("unsupported encryption: required entry \"O\" missing or invalid")
 	}
 
@@ -661,7 +1136,7 @@ func supportedEncryption(ctx *PDFContext, dict *PDFDict) (*Enc, error) {
 	if err != nil {
 		return nil, err
 	}
-	if u == nil || len(u) != 32 {
+	if u == nil || len(u) != n && (r < 5 || len(u) < n) {
 		return nil, errors.Errorf("unsupported encryption: required entry \"U\" missing or invalid %d", len(u))
 	}
 
@@ -678,13 +1153,57 @@ func supportedEncryption(ctx *PDFContext, dict *PDFDict) (*Enc, error) {
 		encMeta = *emd
 	}
 
-	return &Enc{O: o, U: u, L: l, P: *p, R: r, V: *v, Emd: encMeta}, nil
+	enc := &Enc{O: o[:n], U: u[:n], L: l, P: *p, R: r, V: *v, Emd: encMeta}
+
+	err = cryptFilters(dict, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if r >= 5 {
+		err = supportedAES256Entries(dict, enc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return enc, nil
+}
+
+// supportedAES256Entries reads the entries OE, UE and Perms required for AES-256.
+func supportedAES256Entries(dict *PDFDict, enc *Enc) error {
+
+	for _, e := range []struct {
+		key string
+		b   *[]byte
+		n   int
+	}{
+		{"OE", &enc.OE, 32},
+		{"UE", &enc.UE, 32},
+		{"Perms", &enc.Perms, 16},
+	} {
+		b, err := dict.StringEntryBytes(e.key)
+		if err != nil {
+			return err
+		}
+		if len(b) != e.n {
+			return errors.Errorf("unsupported encryption: required entry \"%s\" missing or invalid", e.key)
+		}
+		*e.b = b
+	}
+
+	return nil
 }
 
 func decryptKey(objNumber, generation int, key []byte, aes bool) []byte {
 
 	log.Debug.Printf("decryptKey: obj:%d gen:%d key:%x aes:%t\n", objNumber, generation, key, aes)
 
+	// AES-256 uses the file encryption key for all objects.
+	if len(key) == 32 {
+		return key
+	}
+
 	m := md5.New()
 
 	nr := uint32(objNumber)
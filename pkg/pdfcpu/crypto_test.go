@@ -0,0 +1,186 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func seq(from, to int) []byte {
+
+	b := make([]byte, to-from)
+	for i := range b {
+		b[i] = byte(from + i)
+	}
+
+	return b
+}
+
+// The expected values of the AES-256 tests have been computed independently of this package
+// following ISO 32000-2 Algorithms 2.B, 8, 9 and 10 literally.
+
+func TestHashAES256(t *testing.T) {
+
+	for _, tt := range []struct {
+		pw, salt, udata []byte
+		want            string
+	}{
+		{[]byte("user"), seq(0, 8), nil, "731758c09c8b0160a34721d18bdd24220abada0070aa3f05b8103fd5b8d05f17"},
+		{[]byte("owner"), seq(8, 16), seq(0, 48), "400c13628b144fe2fbb850b65729e9ecb63c00fbb817c685725f25de85af0521"},
+	} {
+		h, err := hashAES256(6, tt.pw, tt.salt, tt.udata)
+		if err != nil {
+			t.Fatalf("hashAES256: %v\n", err)
+		}
+		if got := hex.EncodeToString(h); got != tt.want {
+			t.Fatalf("hashAES256(%s): want %s, got %s\n", tt.pw, tt.want, got)
+		}
+	}
+}
+
+func TestPasswordsAES256(t *testing.T) {
+
+	ctx := &PDFContext{
+		Configuration: NewDefaultConfiguration(),
+		XRefTable:     &XRefTable{E: &Enc{R: 6, V: 5, P: -3904, Emd: true}},
+	}
+	ctx.UserPW = "upw"
+	ctx.OwnerPW = "opw"
+	ctx.EncKey = seq(0, 32)
+
+	d := NewPDFDict()
+	if err := updateAES256Entries(ctx, &d); err != nil {
+		t.Fatalf("updateAES256Entries: %v\n", err)
+	}
+
+	for _, tt := range []struct {
+		upw, opw string
+		user, ok bool
+	}{
+		{"upw", "", true, true},
+		{"upwWrong", "", true, false},
+		{"", "opw", false, true},
+		{"", "opwWrong", false, false},
+	} {
+		ctx.UserPW, ctx.OwnerPW = tt.upw, tt.opw
+
+		validate := validateOwnerPassword
+		if tt.user {
+			validate = validateUserPassword
+		}
+
+		ok, key, err := validate(ctx)
+		if err != nil {
+			t.Fatalf("upw=%s opw=%s: %v\n", tt.upw, tt.opw, err)
+		}
+		if ok != tt.ok {
+			t.Fatalf("upw=%s opw=%s: want %t, got %t\n", tt.upw, tt.opw, tt.ok, ok)
+		}
+		if ok && !bytes.Equal(key, seq(0, 32)) {
+			t.Fatalf("upw=%s opw=%s: wrong file encryption key %x\n", tt.upw, tt.opw, key)
+		}
+	}
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestKnownAnswerAES256(t *testing.T) {
+
+	newContext := func(p int, mode int) *PDFContext {
+		ctx := &PDFContext{
+			Configuration: NewDefaultConfiguration(),
+			XRefTable: &XRefTable{E: &Enc{
+				R: 6, V: 5, P: p, Emd: true,
+				U:     decodeHex(t, "2a20e226b78e2613551acaa3abb4bf63026c9c692de5d2bf5fe1dbae86470b51a1a2a3a4a5a6a7a8b1b2b3b4b5b6b7b8"),
+				UE:    decodeHex(t, "1e116289e0d90ab46d53cb6c5dbc4996bc09da0461dba19c6da09604ff460b35"),
+				O:     decodeHex(t, "fbbd05104e1b7b752f01cda09ae710f7609f6a18814b78a4d71f5a7495f87789c1c2c3c4c5c6c7c8d1d2d3d4d5d6d7d8"),
+				OE:    decodeHex(t, "b7ad2442793aa5b212441eb6c56f3d6ef2c5ccbc1851346488e9bc3542a0029e"),
+				Perms: decodeHex(t, "6158b9ddf626a8fa366820ad7ed7de4d"),
+			}},
+		}
+		ctx.XRefTable.ValidationMode = mode
+		return ctx
+	}
+
+	for _, tt := range []struct {
+		upw, opw string
+		user, ok bool
+	}{
+		{"Ünïcödé user", "", true, true},
+		{"user", "", true, false},
+		{"", "owner", false, true},
+		{"", "Owner", false, false},
+	} {
+		ctx := newContext(-3904, ValidationStrict)
+		ctx.UserPW, ctx.OwnerPW = tt.upw, tt.opw
+
+		validate := validateOwnerPassword
+		if tt.user {
+			validate = validateUserPassword
+		}
+
+		ok, key, err := validate(ctx)
+		if err != nil {
+			t.Fatalf("upw=%s opw=%s: %v\n", tt.upw, tt.opw, err)
+		}
+		if ok != tt.ok {
+			t.Fatalf("upw=%s opw=%s: want %t, got %t\n", tt.upw, tt.opw, tt.ok, ok)
+		}
+		if ok && !bytes.Equal(key, seq(0, 32)) {
+			t.Fatalf("upw=%s opw=%s: wrong file encryption key %x\n", tt.upw, tt.opw, key)
+		}
+	}
+
+	// Perms does not match P.
+	ctx := newContext(-3900, ValidationStrict)
+	ctx.OwnerPW = "owner"
+	if _, _, err := validateOwnerPassword(ctx); err == nil {
+		t.Fatal("Perms mismatch: expected error")
+	}
+
+	// Relaxed validation does not trust P but the permissions protected by Perms.
+	ctx = newContext(-3900, ValidationRelaxed)
+	ctx.UserPW = "Ünïcödé user"
+	if ok, key, err := validateUserPassword(ctx); err != nil || !ok || !bytes.Equal(key, seq(0, 32)) {
+		t.Fatalf("Perms mismatch, relaxed: ok=%t err=%v\n", ok, err)
+	}
+	if ctx.E.P != -3904 {
+		t.Fatalf("Perms mismatch, relaxed: want P=-3904, got %d\n", ctx.E.P)
+	}
+
+	// A corrupt Perms entry leaves no permissions.
+	ctx = newContext(-1, ValidationRelaxed)
+	ctx.E.Perms = make([]byte, 16)
+	ctx.UserPW = "Ünïcödé user"
+	if ok, _, err := validateUserPassword(ctx); err != nil || !ok {
+		t.Fatalf("corrupt Perms, relaxed: ok=%t err=%v\n", ok, err)
+	}
+	if ctx.E.P != int(PermissionsNone) {
+		t.Fatalf("corrupt Perms, relaxed: want P=%d, got %d\n", PermissionsNone, ctx.E.P)
+	}
+}
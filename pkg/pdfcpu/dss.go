@@ -0,0 +1,605 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// => 12.8.4.3 Document Security Store (PDF 2.0, ETSI EN 319 142-1 5.4)
+//
+// The DSS holds the certificates, OCSP responses and CRLs needed to validate signatures
+// long after the signing certificates have expired or the responders have gone offline.
+// Per signature a VRI dict keyed by the SHA-1 digest of the signature's Contents
+// references the validation data relevant to this particular signature.
+
+var oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// RFC 6960 OCSPResponse
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicOCSPResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	CertStatus asn1.RawValue
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// parseOCSPResponse returns the basic response of a successful DER encoded OCSP response.
+func parseOCSPResponse(b []byte) (*basicOCSPResponse, error) {
+
+	var resp ocspResponse
+	rest, err := asn1.Unmarshal(b, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after OCSP response")
+	}
+
+	if resp.Status != 0 {
+		return nil, errors.Errorf("unsuccessful OCSP response status %d", resp.Status)
+	}
+
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, errors.Errorf("unsupported OCSP response type %v", resp.Response.ResponseType)
+	}
+
+	var basic basicOCSPResponse
+	if _, err = asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+
+	return &basic, nil
+}
+
+// covers returns true if r holds a status for cert.
+func (r *basicOCSPResponse) covers(cert *x509.Certificate) bool {
+
+	for _, sr := range r.TBSResponseData.Responses {
+
+		if sr.CertID.SerialNumber == nil || sr.CertID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+
+		hash, err := digestHash(sr.CertID.HashAlgorithm)
+		if err != nil {
+			continue
+		}
+
+		h := hash.New()
+		h.Write(cert.RawIssuer)
+		if bytes.Equal(h.Sum(nil), sr.CertID.IssuerNameHash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidationData holds certificates, OCSP responses and CRLs to be embedded into a DSS.
+type ValidationData struct {
+	Certs []*x509.Certificate
+	OCSPs [][]byte // DER encoded OCSP responses
+	CRLs  [][]byte // DER encoded CRLs
+}
+
+func (vd *ValidationData) add(b []byte, pemType string) error {
+
+	switch pemType {
+
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			return err
+		}
+		vd.Certs = append(vd.Certs, cert)
+		return nil
+
+	case "X509 CRL":
+		if _, err := x509.ParseRevocationList(b); err != nil {
+			return err
+		}
+		vd.CRLs = append(vd.CRLs, b)
+		return nil
+
+	case "OCSP RESPONSE":
+		if _, err := parseOCSPResponse(b); err != nil {
+			return err
+		}
+		vd.OCSPs = append(vd.OCSPs, b)
+		return nil
+
+	}
+
+	// DER encoded data of unknown type.
+
+	if cert, err := x509.ParseCertificate(b); err == nil {
+		vd.Certs = append(vd.Certs, cert)
+		return nil
+	}
+
+	if _, err := x509.ParseRevocationList(b); err == nil {
+		vd.CRLs = append(vd.CRLs, b)
+		return nil
+	}
+
+	if _, err := parseOCSPResponse(b); err == nil {
+		vd.OCSPs = append(vd.OCSPs, b)
+		return nil
+	}
+
+	return errors.New("neither certificate nor CRL nor OCSP response")
+}
+
+// LoadValidationData reads certificates, CRLs and OCSP responses from PEM or DER encoded files.
+func LoadValidationData(fileNames []string) (*ValidationData, error) {
+
+	vd := &ValidationData{}
+
+	for _, fileName := range fileNames {
+
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		var found bool
+
+		for {
+
+			var block *pem.Block
+			block, b = pem.Decode(b)
+			if block == nil {
+				break
+			}
+
+			found = true
+
+			// Skip private keys and the like.
+			if block.Type != "CERTIFICATE" && block.Type != "X509 CRL" && block.Type != "OCSP RESPONSE" {
+				continue
+			}
+
+			if err = vd.add(block.Bytes, block.Type); err != nil {
+				return nil, errors.Wrapf(err, "LoadValidationData: %s", fileName)
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		if err = vd.add(b, ""); err != nil {
+			return nil, errors.Wrapf(err, "LoadValidationData: %s", fileName)
+		}
+	}
+
+	return vd, nil
+}
+
+// dssWriter adds validation data to a DSS dict avoiding duplicate streams.
+type dssWriter struct {
+	xRefTable *XRefTable
+	dss       *PDFDict
+	streams   map[string]map[[32]byte]PDFIndirectRef // indRefs of the streams per DSS entry by content digest.
+}
+
+func newDSSWriter(xRefTable *XRefTable, rootDict *PDFDict) (*dssWriter, error) {
+
+	w := &dssWriter{xRefTable: xRefTable, streams: map[string]map[[32]byte]PDFIndirectRef{}}
+
+	obj, found := rootDict.Find("DSS")
+	if !found || obj == nil {
+		d := NewPDFDict()
+		d.InsertName("Type", "DSS")
+		indRef, err := xRefTable.IndRefForNewObject(d)
+		if err != nil {
+			return nil, err
+		}
+		rootDict.Update("DSS", *indRef)
+		obj = *indRef
+	}
+
+	dss, err := xRefTable.DereferenceDict(obj)
+	if err != nil || dss == nil {
+		return nil, errors.New("dss: corrupt DSS")
+	}
+
+	w.dss = dss
+
+	for _, key := range []string{"Certs", "OCSPs", "CRLs"} {
+
+		m := map[[32]byte]PDFIndirectRef{}
+		w.streams[key] = m
+
+		a, err := xRefTable.DereferenceArray(dss.Dict[key])
+		if err != nil {
+			return nil, err
+		}
+
+		if a == nil {
+			continue
+		}
+
+		for _, o := range *a {
+
+			indRef, ok := o.(PDFIndirectRef)
+			if !ok {
+				continue
+			}
+
+			sd, err := xRefTable.DereferenceStreamDict(indRef)
+			if err != nil || sd == nil {
+				continue
+			}
+
+			if err = decodeStream(sd); err != nil {
+				return nil, err
+			}
+
+			m[sha256.Sum256(sd.Content)] = indRef
+		}
+	}
+
+	return w, nil
+}
+
+// add returns the indRef of a stream holding b referenced by the DSS entry key.
+func (w *dssWriter) add(key string, b []byte) (PDFIndirectRef, error) {
+
+	digest := sha256.Sum256(b)
+
+	if indRef, ok := w.streams[key][digest]; ok {
+		return indRef, nil
+	}
+
+	sd := &PDFStreamDict{
+		PDFDict:        NewPDFDict(),
+		Content:        b,
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	if err := encodeStream(sd); err != nil {
+		return PDFIndirectRef{}, err
+	}
+
+	indRef, err := w.xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		return PDFIndirectRef{}, err
+	}
+
+	if err = appendToArrayEntry(w.xRefTable, w.dss, key, *indRef); err != nil {
+		return PDFIndirectRef{}, err
+	}
+
+	w.streams[key][digest] = *indRef
+
+	return *indRef, nil
+}
+
+// addVRI registers the validation data relevant to a signature under key.
+// An existing VRI entry gets updated in place.
+func (w *dssWriter) addVRI(key string, certs, ocsps, crls PDFArray) error {
+
+	obj, found := w.dss.Find("VRI")
+	if !found || obj == nil {
+		w.dss.Insert("VRI", NewPDFDict())
+		obj, _ = w.dss.Find("VRI")
+	}
+
+	vri, err := w.xRefTable.DereferenceDict(obj)
+	if err != nil || vri == nil {
+		return errors.New("dss: corrupt VRI")
+	}
+
+	var d *PDFDict
+
+	// Some writers use lowercase hex digests.
+	for k := range vri.Dict {
+		if k != key && strings.EqualFold(k, key) {
+			key = k
+			break
+		}
+	}
+
+	if obj, found = vri.Find(key); found {
+		if d, err = w.xRefTable.DereferenceDict(obj); err != nil || d == nil {
+			return errors.Errorf("dss: corrupt VRI entry %s", key)
+		}
+	} else {
+		dict := NewPDFDict()
+		dict.InsertName("Type", "VRI")
+		indRef, err := w.xRefTable.IndRefForNewObject(dict)
+		if err != nil {
+			return err
+		}
+		vri.Insert(key, *indRef)
+		if d, err = w.xRefTable.DereferenceDict(*indRef); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range []struct {
+		key string
+		a   PDFArray
+	}{
+		{"Cert", certs},
+		{"OCSP", ocsps},
+		{"CRL", crls},
+	} {
+		a, err := w.xRefTable.DereferenceArray(d.Dict[e.key])
+		if err != nil {
+			return err
+		}
+		for _, o := range e.a {
+			if a != nil && containsIndRef(*a, o.(PDFIndirectRef)) {
+				continue
+			}
+			if err = appendToArrayEntry(w.xRefTable, d, e.key, o); err != nil {
+				return err
+			}
+			if a, err = w.xRefTable.DereferenceArray(d.Dict[e.key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.Update("TU", DateStringLiteral(time.Now()))
+
+	return nil
+}
+
+func containsIndRef(a PDFArray, indRef PDFIndirectRef) bool {
+
+	for _, o := range a {
+		if ir, ok := o.(PDFIndirectRef); ok && ir.ObjectNumber == indRef.ObjectNumber {
+			return true
+		}
+	}
+
+	return false
+}
+
+// vriKey returns the VRI key of a signature: the uppercase hex SHA-1 digest of its CMS signature.
+func vriKey(contents []byte) string {
+
+	// Drop the zero padding of the Contents placeholder.
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(contents, &raw); err == nil {
+		contents = contents[:len(contents)-len(rest)]
+	}
+
+	digest := sha1.Sum(contents)
+
+	return strings.ToUpper(hex.EncodeToString(digest[:]))
+}
+
+// certificateChain returns cert followed by its issuers as far as they are found in certs.
+func certificateChain(cert *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+
+	chain := []*x509.Certificate{cert}
+
+	for c := cert; !bytes.Equal(c.RawIssuer, c.RawSubject); {
+
+		var issuer *x509.Certificate
+
+		for _, candidate := range certs {
+			if bytes.Equal(candidate.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+
+		if issuer == nil {
+			break
+		}
+
+		for _, cc := range chain {
+			if cc.Equal(issuer) {
+				return chain
+			}
+		}
+
+		chain = append(chain, issuer)
+		c = issuer
+	}
+
+	return chain
+}
+
+// AddDSS adds validation data to the Document Security Store of a signed document
+// along with a VRI dict for each signature.
+// The DSS gets written as an incremental update in order to preserve existing signatures.
+func AddDSS(ctx *PDFContext, vd *ValidationData) error {
+
+	if !ctx.Incremental {
+		return errors.New("dss: adding a DSS requires an incremental update")
+	}
+
+	fields, err := signatureFields(ctx.XRefTable)
+	if err != nil {
+		return err
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	var crls []*x509.RevocationList
+	for _, b := range vd.CRLs {
+		crl, err := x509.ParseRevocationList(b)
+		if err != nil {
+			return err
+		}
+		crls = append(crls, crl)
+	}
+
+	var ocsps []*basicOCSPResponse
+	for _, b := range vd.OCSPs {
+		r, err := parseOCSPResponse(b)
+		if err != nil {
+			return err
+		}
+		ocsps = append(ocsps, r)
+	}
+
+	var w *dssWriter
+	var signed int
+
+	for _, f := range fields {
+
+		if f.sig == nil {
+			continue
+		}
+
+		contents, err := signatureContents(f.sig)
+		if err != nil {
+			return errors.Wrapf(err, "dss: signature field %s", f.name)
+		}
+
+		s, err := parseSignedData(contents)
+		if err != nil {
+			return errors.Wrapf(err, "dss: signature field %s", f.name)
+		}
+
+		if w == nil {
+			if w, err = newDSSWriter(ctx.XRefTable, rootDict); err != nil {
+				return err
+			}
+		}
+
+		log.Info.Printf("adding validation data for signature field %s\n", f.name)
+
+		var certs, ocspRefs, crlRefs PDFArray
+
+		for _, cert := range certificateChain(s.cert, append(s.certs, vd.Certs...)) {
+
+			indRef, err := w.add("Certs", cert.Raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, indRef)
+
+			// Trust anchors do not get revoked.
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+				continue
+			}
+
+			for i, r := range ocsps {
+				if r.covers(cert) {
+					indRef, err := w.add("OCSPs", vd.OCSPs[i])
+					if err != nil {
+						return err
+					}
+					ocspRefs = append(ocspRefs, indRef)
+				}
+			}
+
+			for i, crl := range crls {
+				if bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+					indRef, err := w.add("CRLs", vd.CRLs[i])
+					if err != nil {
+						return err
+					}
+					crlRefs = append(crlRefs, indRef)
+				}
+			}
+		}
+
+		if err = w.addVRI(vriKey(contents), certs, ocspRefs, crlRefs); err != nil {
+			return err
+		}
+
+		signed++
+	}
+
+	if signed == 0 {
+		return errors.New("dss: no signatures found")
+	}
+
+	// Validation data not tied to any signature still goes into the DSS.
+
+	for _, cert := range vd.Certs {
+		if _, err = w.add("Certs", cert.Raw); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range vd.OCSPs {
+		if _, err = w.add("OCSPs", b); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range vd.CRLs {
+		if _, err = w.add("CRLs", b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -21,7 +21,6 @@ package pdfcpu
 import (
 	"bytes"
 	"encoding/hex"
-	"fmt"
 	"io"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
@@ -48,13 +47,29 @@ func parmsForFilter(d *PDFDict) map[string]int {
 	return m
 }
 
+// filtersWithoutCrypt returns the filter pipeline minus a Crypt filter which is applied by en/decryption.
+func filtersWithoutCrypt(fpl []PDFFilter) []PDFFilter {
+
+	if len(fpl) == 0 || fpl[0].Name != filter.Crypt {
+		return fpl
+	}
+
+	if len(fpl) == 1 {
+		return nil
+	}
+
+	return fpl[1:]
+}
+
 // encodeStream encodes stream dict data by applying its filter pipeline.
 func encodeStream(sd *PDFStreamDict) error {
 
 	log.Debug.Printf("encodeStream begin")
 
+	fpl := filtersWithoutCrypt(sd.FilterPipeline)
+
 	// No filter specified, nothing to encode.
-	if sd.FilterPipeline == nil {
+	if fpl == nil {
 		log.Debug.Println("encodeStream: returning uncompressed stream.")
 		sd.Raw = sd.Content
 		streamLength := int64(len(sd.Raw))
@@ -72,7 +87,7 @@ func encodeStream(sd *PDFStreamDict) error {
 	var c *bytes.Buffer
 
 	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
+	for _, f := range fpl {
 
 		if f.DecodeParms != nil {
 			log.Debug.Printf("encodeStream: encoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
@@ -121,10 +136,12 @@ func decodeStream(sd *PDFStreamDict) error {
 		return nil
 	}
 
+	fpl := filtersWithoutCrypt(sd.FilterPipeline)
+
 	// No filter specified, nothing to decode.
-	if sd.FilterPipeline == nil {
+	if fpl == nil {
 		sd.Content = sd.Raw
-		fmt.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
+		log.Debug.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
 		return nil
 	}
 
@@ -136,7 +153,7 @@ func decodeStream(sd *PDFStreamDict) error {
 	var c *bytes.Buffer
 
 	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
+	for _, f := range fpl {
 
 		if f.DecodeParms != nil {
 			log.Debug.Printf("decodeStream: decoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
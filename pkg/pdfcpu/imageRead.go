@@ -17,13 +17,17 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
+	"io/ioutil"
 	"os"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
 	"github.com/iPaladinLLC/pdfcpu/tiff"
+	"github.com/pkg/errors"
 )
 
 func createSMaskObject(xRefTable *XRefTable, buf []byte, w, h int) (*PDFIndirectRef, error) {
@@ -287,3 +291,63 @@ func ReadTIFFFile(xRefTable *XRefTable, fileName string) (*PDFStreamDict, error)
 
 	return imgToImageDict(xRefTable, img)
 }
+
+// ReadJPEGFile generates a PDF image object for a JPEG file
+// and appends this object to the cross reference table.
+// The JPEG data is embedded as is using the DCTDecode filter.
+func ReadJPEGFile(xRefTable *XRefTable, fileName string) (*PDFStreamDict, error) {
+
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := jpeg.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	var cs string
+
+	switch c.ColorModel {
+
+	case color.GrayModel:
+		cs = DeviceGrayCS
+
+	case color.YCbCrModel:
+		cs = DeviceRGBCS
+
+	case color.CMYKModel:
+		cs = DeviceCMYKCS
+
+	default:
+		return nil, errors.Wrap(ErrUnsupportedColorSpace, fileName)
+	}
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":             PDFName("XObject"),
+				"Subtype":          PDFName("Image"),
+				"Width":            PDFInteger(c.Width),
+				"Height":           PDFInteger(c.Height),
+				"BitsPerComponent": PDFInteger(8),
+				"ColorSpace":       PDFName(cs),
+				"Filter":           PDFName(filter.DCT),
+			},
+		},
+		Content: buf,
+	}
+
+	if cs == DeviceCMYKCS {
+		// CMYK JPEGs are usually written by Adobe applications using inverted components.
+		sd.Insert("Decode", NewIntegerArray(1, 0, 1, 0, 1, 0, 1, 0))
+	}
+
+	err = encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
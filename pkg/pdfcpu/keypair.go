@@ -0,0 +1,234 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkcs12"
+	"github.com/pkg/errors"
+)
+
+// KeyPair is a certificate along with its private key.
+type KeyPair struct {
+	Cert  *x509.Certificate
+	Key   crypto.PrivateKey
+	Chain []*x509.Certificate // Issuing certificates, Cert not included.
+}
+
+// publicKeyEqual is implemented by all public key types of the standard library.
+type publicKeyEqual interface {
+	Equal(crypto.PublicKey) bool
+}
+
+func (kp *KeyPair) matches(cert *x509.Certificate) bool {
+
+	signer, ok := kp.Key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+
+	pub, ok := signer.Public().(publicKeyEqual)
+
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+func parsePEMPrivateKey(block *pem.Block, password string) (crypto.PrivateKey, error) {
+
+	b := block.Bytes
+
+	if x509.IsEncryptedPEMBlock(block) {
+		var err error
+		b, err = x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch block.Type {
+
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(b)
+
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(b)
+
+	}
+
+	return x509.ParsePKCS8PrivateKey(b)
+}
+
+func loadPEMKeyPair(b []byte, password string) (*KeyPair, error) {
+
+	kp := &KeyPair{}
+	var certs []*x509.Certificate
+
+	for {
+
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			key, err := parsePEMPrivateKey(block, password)
+			if err != nil {
+				return nil, err
+			}
+			kp.Key = key
+
+		}
+	}
+
+	if kp.Key == nil {
+		return nil, errors.New("missing private key")
+	}
+
+	// The certificate matching the private key, all others make up the chain.
+	for _, cert := range certs {
+		if kp.Cert == nil && kp.matches(cert) {
+			kp.Cert = cert
+			continue
+		}
+		kp.Chain = append(kp.Chain, cert)
+	}
+
+	if kp.Cert == nil {
+		return nil, errors.New("missing certificate for private key")
+	}
+
+	return kp, nil
+}
+
+// LoadKeyPair reads a certificate along with its private key from a PKCS#12 file (.p12, .pfx)
+// or from a PEM file holding the certificate, its private key and optionally the issuing certificates.
+// password protects the PKCS#12 file or an encrypted PEM private key.
+func LoadKeyPair(fileName, password string) (*KeyPair, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(b); block != nil {
+		kp, err := loadPEMKeyPair(b, password)
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadKeyPair: %s", fileName)
+		}
+		return kp, nil
+	}
+
+	key, cert, chain, err := pkcs12.DecodeChain(b, password)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadKeyPair: %s", fileName)
+	}
+
+	return &KeyPair{Cert: cert, Key: key, Chain: chain}, nil
+}
+
+// LoadCertificates reads all certificates of a PEM file or a single DER encoded certificate.
+func LoadCertificates(fileName string) ([]*x509.Certificate, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+
+	for {
+
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadCertificates: %s", fileName)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadCertificates: %s", fileName)
+	}
+
+	return []*x509.Certificate{cert}, nil
+}
+
+// LoadTrustStore reads all certificates of the PEM and DER files (.pem, .crt, .cer, .der) in dir.
+func LoadTrustStore(dir string) ([]*x509.Certificate, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := []*x509.Certificate{}
+
+	for _, f := range files {
+
+		if f.IsDir() {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".pem", ".crt", ".cer", ".der":
+		default:
+			continue
+		}
+
+		cc, err := LoadCertificates(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cc...)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.Errorf("LoadTrustStore: no certificates found in %s", dir)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"container/list"
+	"sort"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// lazyStream records the content of a stream dict loaded on demand.
+type lazyStream struct {
+	objNr   int
+	raw     []byte
+	content []byte
+}
+
+func (ls *lazyStream) size() int64 {
+	return int64(len(ls.raw) + len(ls.content))
+}
+
+// lazyLoader parses objects from file on first access
+// and keeps the stream content loaded within a memory budget.
+//
+// A lazyLoader is not safe for concurrent use.
+// Loading reads from the shared file, evicting drops the content of other entries
+// and both may recursively look up further objects, eg. an indirect stream length.
+// Any goroutines reading a lazily read context need to serialize their access.
+type lazyLoader struct {
+	ctx *PDFContext
+
+	// Decryption parameters in effect at read time.
+	encKey      []byte
+	aes4Strings bool
+	aes4Streams bool
+
+	loaded   int                   // Objects parsed from file.
+	budget   int64                 // Upper limit for stream content kept in memory, 0 means no limit.
+	size     int64                 // Stream content currently kept in memory.
+	streams  *list.List            // Loaded streams, least recently used first.
+	elements map[int]*list.Element // Loaded streams by object number.
+	evicted  IntSet                // Streams whose content has been evicted.
+}
+
+func newLazyLoader(ctx *PDFContext) *lazyLoader {
+	return &lazyLoader{
+		ctx:         ctx,
+		encKey:      ctx.EncKey,
+		aes4Strings: ctx.AES4Strings,
+		aes4Streams: ctx.AES4Streams,
+		budget:      ctx.LazyMemoryBudget,
+		streams:     list.New(),
+		elements:    map[int]*list.Element{},
+		evicted:     IntSet{},
+	}
+}
+
+// sameBytes returns true if a and b share the same backing array and length.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// withReadEncryption runs f using the decryption parameters in effect at read time.
+// Writing may have set up a different encryption key in the meantime.
+func (l *lazyLoader) withReadEncryption(f func() error) error {
+
+	xRefTable := l.ctx.XRefTable
+
+	encKey, aes4Strings, aes4Streams := xRefTable.EncKey, xRefTable.AES4Strings, xRefTable.AES4Streams
+	xRefTable.EncKey, xRefTable.AES4Strings, xRefTable.AES4Streams = l.encKey, l.aes4Strings, l.aes4Streams
+
+	defer func() {
+		xRefTable.EncKey, xRefTable.AES4Strings, xRefTable.AES4Streams = encKey, aes4Strings, aes4Streams
+	}()
+
+	return f()
+}
+
+// load ensures the object for objNr is in memory.
+func (l *lazyLoader) load(objNr int, entry *XRefTableEntry) error {
+
+	if entry == nil || entry.Free {
+		return nil
+	}
+
+	if l.evicted[objNr] {
+		return l.withReadEncryption(func() error { return l.reload(objNr, entry) })
+	}
+
+	if entry.Object != nil {
+		if e, ok := l.elements[objNr]; ok {
+			l.streams.MoveToBack(e)
+		}
+		return nil
+	}
+
+	log.Debug.Printf("lazyLoader: loading obj#%d\n", objNr)
+
+	err := l.withReadEncryption(func() error {
+
+		if entry.Compressed {
+			if err := l.loadObjectStream(*entry.ObjectStream); err != nil {
+				return err
+			}
+			return decompressXRefTableEntry(l.ctx.XRefTable, objNr, entry)
+		}
+
+		if l.ctx.Read.IsObjectStreamObject(objNr) {
+			return decodeObjectStream(l.ctx, objNr)
+		}
+
+		if err := dereferenceObject(l.ctx, objNr); err != nil {
+			return err
+		}
+
+		if sd, ok := entry.Object.(PDFStreamDict); ok {
+			l.track(objNr, sd)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	l.loaded++
+
+	// Loading is no modification.
+	l.ctx.recordFingerprint(objNr, entry)
+
+	return nil
+}
+
+func (l *lazyLoader) loadObjectStream(objNr int) error {
+
+	entry, found := l.ctx.Find(objNr)
+	if !found {
+		return errors.Errorf("lazyLoader: missing object stream obj#%d", objNr)
+	}
+
+	if _, ok := entry.Object.(PDFObjectStreamDict); ok {
+		return nil
+	}
+
+	return decodeObjectStream(l.ctx, objNr)
+}
+
+// reload reads the content of an evicted stream from file again.
+// The stream dict itself stays untouched since it may have been modified.
+func (l *lazyLoader) reload(objNr int, entry *XRefTableEntry) error {
+
+	log.Debug.Printf("lazyLoader: reloading stream content of obj#%d\n", objNr)
+
+	sd, ok := entry.Object.(PDFStreamDict)
+	if !ok {
+		return errors.Errorf("lazyLoader: evicted obj#%d is no stream dict", objNr)
+	}
+
+	o, err := pdfObject(l.ctx, *entry.Offset, objNr, *entry.Generation)
+	if err != nil {
+		return err
+	}
+
+	fresh, ok := o.(PDFStreamDict)
+	if !ok {
+		return errors.Errorf("lazyLoader: obj#%d is no stream dict", objNr)
+	}
+
+	if _, err = loadEncodedStreamContent(l.ctx, &fresh); err != nil {
+		return err
+	}
+
+	if err = saveDecodedStreamContent(l.ctx, &fresh, objNr, *entry.Generation, l.ctx.DecodeAllStreams); err != nil {
+		return err
+	}
+
+	sd.StreamLength = fresh.StreamLength
+	sd.Raw = fresh.Raw
+	sd.Content = fresh.Content
+	entry.Object = sd
+
+	delete(l.evicted, objNr)
+	l.track(objNr, sd)
+
+	return nil
+}
+
+// track records a loaded stream and evicts least recently used stream content if over budget.
+func (l *lazyLoader) track(objNr int, sd PDFStreamDict) {
+
+	ls := &lazyStream{objNr: objNr, raw: sd.Raw, content: sd.Content}
+	l.elements[objNr] = l.streams.PushBack(ls)
+	l.size += ls.size()
+
+	if l.budget <= 0 {
+		return
+	}
+
+	// Never evict the stream just loaded.
+	for l.size > l.budget && l.streams.Len() > 1 {
+		l.evict(l.streams.Front())
+	}
+}
+
+// evict drops the content of a tracked stream unless it has been modified since loading.
+func (l *lazyLoader) evict(e *list.Element) {
+
+	ls := l.streams.Remove(e).(*lazyStream)
+	delete(l.elements, ls.objNr)
+	l.size -= ls.size()
+
+	entry, found := l.ctx.Find(ls.objNr)
+	if !found || entry.Free {
+		return
+	}
+
+	sd, ok := entry.Object.(PDFStreamDict)
+	if !ok || !sameBytes(sd.Raw, ls.raw) || !sameBytes(sd.Content, ls.content) {
+		// Modified content has to stay in memory.
+		return
+	}
+
+	log.Debug.Printf("lazyLoader: evicting stream content of obj#%d\n", ls.objNr)
+
+	sd.Raw = nil
+	sd.Content = nil
+	entry.Object = sd
+
+	l.evicted[ls.objNr] = true
+}
+
+// loadAll loads all objects into memory and turns off eviction.
+func (l *lazyLoader) loadAll() error {
+
+	l.budget = 0
+
+	var keys []int
+	for k := range l.ctx.Table {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	for _, objNr := range keys {
+		if err := l.load(objNr, l.ctx.Table[objNr]); err != nil {
+			return errors.Wrapf(err, "lazyLoader: problem loading obj#%d", objNr)
+		}
+	}
+
+	return nil
+}
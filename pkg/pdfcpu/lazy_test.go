@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Extracting a page reading lazily only loads the objects the page needs
+// and keeps stream content within the memory budget.
+func TestLazyExtractPage(t *testing.T) {
+
+	inFile := filepath.Join("..", "api", "testdata", "TheGoProgrammingLanguageCh1.pdf")
+
+	config := NewDefaultConfiguration()
+	config.Lazy = true
+	config.LazyMemoryBudget = 16 * 1024
+
+	ctx, err := ReadPDFFile(inFile, config)
+	if err != nil {
+		t.Fatalf("TestLazyExtractPage: %v\n", err)
+	}
+	defer ctx.Read.Close()
+
+	w := ctx.Write
+	w.Command = "Split"
+	w.ExtractPageNr = 1
+	w.DirName = outDir + "/"
+	w.FileName = "lazy_1.pdf"
+
+	if err = WritePDFFile(ctx); err != nil {
+		t.Fatalf("TestLazyExtractPage: %v\n", err)
+	}
+
+	l := ctx.lazy
+
+	if l.loaded == 0 || l.loaded > len(ctx.Table)/10 {
+		t.Fatalf("TestLazyExtractPage: loaded %d of %d objects\n", l.loaded, len(ctx.Table))
+	}
+
+	if l.size > config.LazyMemoryBudget {
+		t.Fatalf("TestLazyExtractPage: %d bytes of stream content exceed budget %d\n", l.size, config.LazyMemoryBudget)
+	}
+
+	if len(l.evicted) == 0 {
+		t.Fatalf("TestLazyExtractPage: no stream content evicted\n")
+	}
+
+	ctx, err = ReadPDFFile(filepath.Join(outDir, "lazy_1.pdf"), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("TestLazyExtractPage: %v\n", err)
+	}
+
+	if err = ValidateXRefTable(ctx.XRefTable); err != nil {
+		t.Fatalf("TestLazyExtractPage: %v\n", err)
+	}
+
+	if ctx.PageCount != 1 {
+		t.Fatalf("TestLazyExtractPage: want 1 page, got %d\n", ctx.PageCount)
+	}
+}
@@ -293,6 +293,14 @@ func mergeDuplicateObjNumberIntSets(ctxSource, ctxDest *PDFContext) {
 // MergeXRefTables merges PDFContext ctxSource into ctxDest by appending its page tree.
 func MergeXRefTables(ctxSource, ctxDest *PDFContext) (err error) {
 
+	// Objects of a lazily read source need to be in memory for patching.
+	if ctxSource.lazy != nil {
+		if err = ctxSource.lazy.loadAll(); err != nil {
+			return err
+		}
+		ctxSource.lazy = nil
+	}
+
 	// Sweep over ctxSource cross ref table and ensure valid object numbers in ctxDest's space.
 	patchSourceObjectNumbers(ctxSource, ctxDest)
 
@@ -326,6 +334,9 @@ func MergeXRefTables(ctxSource, ctxDest *PDFContext) (err error) {
 	log.Debug.Println("mergeDuplicateObjNumberIntSets")
 	mergeDuplicateObjNumberIntSets(ctxSource, ctxDest)
 
+	// Any linearization parameter dict read no longer describes the merged document.
+	ctxDest.linearization = nil
+
 	log.Info.Printf("Dest XRefTable after merge:\n%s\n", ctxDest)
 
 	return nil
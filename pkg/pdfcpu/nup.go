@@ -0,0 +1,644 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// NUpOrder defines the sequence in which pages are laid out on a sheet.
+type NUpOrder int
+
+// The supported n-up orders.
+const (
+	LeftToRight NUpOrder = iota // Fill rows first.
+	TopToBottom                 // Fill columns first.
+)
+
+// NUp represents the layout of n-up sheets.
+type NUp struct {
+	N         int       // Number of pages per sheet: 2, 4, 6, 9 or 16.
+	Paper     types.Dim // Sheet dimensions.
+	Landscape bool      // Turn the sheet into landscape orientation.
+	Order     NUpOrder  // Sequence of pages on a sheet.
+	Border    bool      // Draw a border around each page.
+	Margin    float64   // Space around each page within its grid cell.
+}
+
+// DefaultNUpConfig returns the default n-up layout: 4 pages per A4 portrait sheet from left to right.
+func DefaultNUpConfig() *NUp {
+	return &NUp{
+		N:     4,
+		Paper: PaperSize["A4"],
+		Order: LeftToRight,
+	}
+}
+
+func (nup NUp) String() string {
+	return fmt.Sprintf("N=%d paper=%s landscape=%t order=%d border=%t margin=%f",
+		nup.N, nup.Paper, nup.Landscape, nup.Order, nup.Border, nup.Margin)
+}
+
+// ValidNUp returns true if n is a supported number of pages per sheet.
+func ValidNUp(n int) bool {
+	return n == 2 || n == 4 || n == 6 || n == 9 || n == 16
+}
+
+// ParseNUpOrder parses an n-up order: ltr (left to right) or ttb (top to bottom).
+func ParseNUpOrder(s string) (NUpOrder, error) {
+
+	switch strings.ToLower(s) {
+
+	case "ltr":
+		return LeftToRight, nil
+
+	case "ttb":
+		return TopToBottom, nil
+	}
+
+	return 0, errors.Errorf("unknown n-up order: %s", s)
+}
+
+// sheetDim returns the sheet dimensions for the requested orientation.
+func (nup NUp) sheetDim() types.Dim {
+
+	d := nup.Paper
+	if nup.Landscape != d.Landscape() {
+		d.Width, d.Height = d.Height, d.Width
+	}
+
+	return d
+}
+
+// grid returns the number of columns and rows of a sheet.
+func (nup NUp) grid() (int, int) {
+
+	var cols, rows int
+
+	switch nup.N {
+	case 2:
+		cols, rows = 1, 2
+	case 6:
+		cols, rows = 2, 3
+	default:
+		cols = int(math.Sqrt(float64(nup.N)))
+		rows = cols
+	}
+
+	if nup.sheetDim().Landscape() {
+		cols, rows = rows, cols
+	}
+
+	return cols, rows
+}
+
+func (nup NUp) validate() error {
+
+	if !ValidNUp(nup.N) {
+		return errors.Errorf("nup: unsupported number of pages per sheet: %d", nup.N)
+	}
+
+	d := nup.sheetDim()
+	if d.Width <= 0 || d.Height <= 0 {
+		return errors.Errorf("nup: invalid paper size: %s", d)
+	}
+
+	if nup.Margin < 0 {
+		return errors.Errorf("nup: invalid margin: %f", nup.Margin)
+	}
+
+	cols, rows := nup.grid()
+	if 2*nup.Margin >= d.Width/float64(cols) || 2*nup.Margin >= d.Height/float64(rows) {
+		return errors.Errorf("nup: margin %f too large", nup.Margin)
+	}
+
+	return nil
+}
+
+// nupTile is a form XObject to be placed on a sheet.
+type nupTile struct {
+	form PDFIndirectRef
+	bb   types.Rectangle // The form's bounding box.
+	rot  int             // The clockwise rotation in degrees to be applied when displayed.
+}
+
+// transform returns the matrix fitting the rotated tile into r keeping its aspect ratio.
+func (t nupTile) transform(r types.Rectangle) matrix {
+
+	w, h := t.bb.Width(), t.bb.Height()
+
+	// 1) Move the bounding box to the origin.
+	m1 := identMatrix
+	m1[2][0] = -t.bb.LL.X
+	m1[2][1] = -t.bb.LL.Y
+
+	// 2) Rotate clockwise.
+	m2 := identMatrix
+
+	switch t.rot {
+	case 90:
+		m2[0][0], m2[0][1], m2[1][0], m2[1][1] = 0, -1, 1, 0
+		m2[2][1] = w
+		w, h = h, w
+	case 180:
+		m2[0][0], m2[1][1] = -1, -1
+		m2[2][0], m2[2][1] = w, h
+	case 270:
+		m2[0][0], m2[0][1], m2[1][0], m2[1][1] = 0, 1, -1, 0
+		m2[2][0] = h
+		w, h = h, w
+	}
+
+	// 3) Scale and center within r.
+	s := math.Min(r.Width()/w, r.Height()/h)
+
+	m3 := identMatrix
+	m3[0][0], m3[1][1] = s, s
+	m3[2][0] = r.LL.X + (r.Width()-s*w)/2
+	m3[2][1] = r.LL.Y + (r.Height()-s*h)/2
+
+	return m1.multiply(m2).multiply(m3)
+}
+
+// pageContent returns the decoded content of a page.
+func pageContent(xRefTable *XRefTable, pageDict *PDFDict) ([]byte, error) {
+
+	o, found := pageDict.Find("Contents")
+	if !found {
+		return nil, nil
+	}
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	var sds []PDFObject
+
+	switch o := o.(type) {
+
+	case PDFStreamDict:
+		sds = append(sds, o)
+
+	case PDFArray:
+		sds = o
+
+	default:
+		return nil, errors.Errorf("pageContent: invalid Contents: %v", o)
+	}
+
+	var b bytes.Buffer
+
+	for _, o := range sds {
+
+		sd, err := xRefTable.DereferenceStreamDict(o)
+		if err != nil {
+			return nil, err
+		}
+
+		if sd == nil {
+			continue
+		}
+
+		err = decodeStream(sd)
+		if err == filter.ErrUnsupportedFilter {
+			return nil, errors.New("pageContent: unsupported filter")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Content streams are concatenated as if separated by whitespace.
+		b.Write(sd.Content)
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes(), nil
+}
+
+func createFormXObject(xRefTable *XRefTable, bb types.Rectangle, resources PDFObject, content []byte) (*PDFIndirectRef, error) {
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":      PDFName("XObject"),
+				"Subtype":   PDFName("Form"),
+				"BBox":      NewRectangle(bb.LL.X, bb.LL.Y, bb.UR.X, bb.UR.Y),
+				"Matrix":    NewIntegerArray(1, 0, 0, 1, 0, 0),
+				"Resources": resources,
+			},
+		},
+		Content:        content,
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// pageForm wraps page i into a form XObject and returns it along with its bounding box.
+func pageForm(xRefTable *XRefTable, i int) (*PDFIndirectRef, types.Rectangle, error) {
+
+	d, inhPAttrs, err := xRefTable.PageDict(i)
+	if err != nil {
+		return nil, types.Rectangle{}, err
+	}
+
+	if d == nil {
+		return nil, types.Rectangle{}, errors.Errorf("page %d not found", i)
+	}
+
+	box := inhPAttrs.cropBox
+	if box == nil {
+		box = inhPAttrs.mediaBox
+	}
+
+	if box == nil {
+		return nil, types.Rectangle{}, errors.Errorf("page %d: missing MediaBox", i)
+	}
+
+	bb := normalize(rect(xRefTable, *box))
+
+	if bb.Width() == 0 || bb.Height() == 0 {
+		return nil, types.Rectangle{}, errors.Errorf("page %d: empty page boundaries", i)
+	}
+
+	// Keep a page's own resources as they are since they may be shared.
+	res, found := d.Find("Resources")
+	if !found {
+		res = NewPDFDict()
+		if inhPAttrs.resources != nil {
+			res = *inhPAttrs.resources
+		}
+	}
+
+	content, err := pageContent(xRefTable, d)
+	if err != nil {
+		return nil, types.Rectangle{}, errors.Wrapf(err, "page %d", i)
+	}
+
+	indRef, err := createFormXObject(xRefTable, bb, res, content)
+	if err != nil {
+		return nil, types.Rectangle{}, err
+	}
+
+	return indRef, bb, nil
+}
+
+// pageTile wraps page i into a form XObject to be displayed using the page rotation.
+func pageTile(xRefTable *XRefTable, i int) (*nupTile, error) {
+
+	indRef, bb, err := pageForm(xRefTable, i)
+	if err != nil {
+		return nil, err
+	}
+
+	_, inhPAttrs, err := xRefTable.PageDict(i)
+	if err != nil {
+		return nil, err
+	}
+
+	rot := int(inhPAttrs.rotate) % 360
+	if rot < 0 {
+		rot += 360
+	}
+
+	return &nupTile{form: *indRef, bb: bb, rot: rot}, nil
+}
+
+func readImageFile(xRefTable *XRefTable, fileName string) (*PDFStreamDict, error) {
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+
+	case ".png":
+		return ReadPNGFile(xRefTable, fileName)
+
+	case ".jpg", ".jpeg":
+		return ReadJPEGFile(xRefTable, fileName)
+
+	case ".tif", ".tiff":
+		return ReadTIFFFile(xRefTable, fileName)
+	}
+
+	return nil, errors.Errorf("unsupported image file: %s", fileName)
+}
+
+// imageTile wraps an image file into a form XObject.
+func imageTile(xRefTable *XRefTable, fileName string) (*nupTile, error) {
+
+	sd, err := readImageFile(xRefTable, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := *sd.IntEntry("Width"), *sd.IntEntry("Height")
+
+	imgIndRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, err
+	}
+
+	res := PDFDict{
+		Dict: map[string]PDFObject{
+			"ProcSet": NewNameArray("PDF", "ImageC"),
+			"XObject": PDFDict{Dict: map[string]PDFObject{"Im0": *imgIndRef}},
+		},
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "q %d 0 0 %d 0 0 cm /Im0 Do Q", w, h)
+
+	bb := types.NewRectangle(0, 0, float64(w), float64(h))
+
+	indRef, err := createFormXObject(xRefTable, bb, res, b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return &nupTile{form: *indRef, bb: bb}, nil
+}
+
+// createSheet creates a page holding tiles.
+func (nup NUp) createSheet(xRefTable *XRefTable, tiles []*nupTile) (*PDFIndirectRef, error) {
+
+	d := nup.sheetDim()
+	cols, rows := nup.grid()
+
+	cw := d.Width / float64(cols)
+	ch := d.Height / float64(rows)
+
+	xObjDict := NewPDFDict()
+
+	var b bytes.Buffer
+
+	for i, t := range tiles {
+
+		col, row := i%cols, i/cols
+		if nup.Order == TopToBottom {
+			col, row = i/rows, i%rows
+		}
+
+		llx := float64(col) * cw
+		lly := d.Height - float64(row+1)*ch
+
+		if nup.Border {
+			fmt.Fprintf(&b, "q []0 d 1 w 0 G %f %f %f %f re S Q\n", llx, lly, cw, ch)
+		}
+
+		r := types.NewRectangle(llx+nup.Margin, lly+nup.Margin, llx+cw-nup.Margin, lly+ch-nup.Margin)
+		m := t.transform(r)
+
+		formID := fmt.Sprintf("Fm%d", i)
+		xObjDict.Insert(formID, t.form)
+
+		fmt.Fprintf(&b, "q %f %f %f %f %f %f cm /%s Do Q\n", m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1], formID)
+	}
+
+	return createSheetPage(xRefTable, d, xObjDict, b.Bytes())
+}
+
+// createSheetPage creates a page of dimensions d placing the forms of xObjDict using content.
+func createSheetPage(xRefTable *XRefTable, d types.Dim, xObjDict PDFDict, content []byte) (*PDFIndirectRef, error) {
+
+	contentIndRef, err := createContentStream(xRefTable, content)
+	if err != nil {
+		return nil, err
+	}
+
+	pageDict := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":      PDFName("Page"),
+			"MediaBox":  NewRectangle(0, 0, d.Width, d.Height),
+			"Resources": PDFDict{Dict: map[string]PDFObject{"XObject": xObjDict}},
+			"Contents":  *contentIndRef,
+		},
+	}
+
+	return xRefTable.IndRefForNewObject(pageDict)
+}
+
+// createContentStream creates a Flate encoded page content stream.
+func createContentStream(xRefTable *XRefTable, content []byte) (*PDFIndirectRef, error) {
+
+	sd := &PDFStreamDict{
+		PDFDict:        NewPDFDict(),
+		Content:        content,
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// createSheets distributes tiles onto sheets.
+func (nup NUp) createSheets(xRefTable *XRefTable, tiles []*nupTile) ([]PDFIndirectRef, error) {
+
+	log.Debug.Printf("createSheets: %d tiles, %s\n", len(tiles), nup)
+
+	sheets := []PDFIndirectRef{}
+
+	for i := 0; i < len(tiles); i += nup.N {
+
+		j := i + nup.N
+		if j > len(tiles) {
+			j = len(tiles)
+		}
+
+		indRef, err := nup.createSheet(xRefTable, tiles[i:j])
+		if err != nil {
+			return nil, err
+		}
+
+		sheets = append(sheets, *indRef)
+	}
+
+	return sheets, nil
+}
+
+// selectedPageTiles wraps the selected pages into form XObjects.
+// No page selection means all pages.
+func selectedPageTiles(xRefTable *XRefTable, pageCount int, selectedPages IntSet) ([]*nupTile, error) {
+
+	tiles := []*nupTile{}
+
+	for i := 1; i <= pageCount; i++ {
+
+		if len(selectedPages) > 0 && !selectedPages[i] {
+			continue
+		}
+
+		t, err := pageTile(xRefTable, i)
+		if err != nil {
+			return nil, err
+		}
+
+		tiles = append(tiles, t)
+	}
+
+	if len(tiles) == 0 {
+		return nil, errors.New("no pages selected")
+	}
+
+	return tiles, nil
+}
+
+// replacePages makes sheets the pages of the page tree root replacing pages.
+// Outline items and destinations pointing to pages are removed.
+func replacePages(xRefTable *XRefTable, root PDFIndirectRef, pages, sheets []PDFIndirectRef) error {
+
+	// Sheets must not inherit any attributes of the original pages.
+	rootPagesDict, err := xRefTable.DereferenceDict(root)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range inheritablePageAttrs {
+		rootPagesDict.Delete(k)
+	}
+
+	if err = rebuildPageTree(xRefTable, root, sheets); err != nil {
+		return err
+	}
+
+	removed := IntSet{}
+	for _, p := range pages {
+		removed[p.ObjectNumber.Value()] = true
+	}
+
+	if err = removeDestinations(xRefTable, removed, sheets); err != nil {
+		return err
+	}
+
+	// Page labels, form fields and the structure tree refer to the original pages.
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range []string{"PageLabels", "AcroForm", "StructTreeRoot"} {
+		rootDict.Delete(k)
+	}
+
+	return nil
+}
+
+// NUpFromPDF replaces the pages of xRefTable by sheets holding nup.N selected pages each.
+// Outline items and destinations pointing to the original pages are removed.
+func NUpFromPDF(xRefTable *XRefTable, selectedPages IntSet, nup *NUp) error {
+
+	if err := nup.validate(); err != nil {
+		return err
+	}
+
+	root, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	tiles, err := selectedPageTiles(xRefTable, len(pages), selectedPages)
+	if err != nil {
+		return errors.Wrap(err, "nup")
+	}
+
+	sheets, err := nup.createSheets(xRefTable, tiles)
+	if err != nil {
+		return err
+	}
+
+	return replacePages(xRefTable, *root, pages, sheets)
+}
+
+// NUpFromImages creates a PDF context for sheets holding nup.N images each.
+func NUpFromImages(fileNames []string, nup *NUp, config *Configuration) (*PDFContext, error) {
+
+	if err := nup.validate(); err != nil {
+		return nil, err
+	}
+
+	if len(fileNames) == 0 {
+		return nil, errors.New("nup: missing image files")
+	}
+
+	if config == nil {
+		config = NewDefaultConfiguration()
+	}
+
+	xRefTable, err := createXRefTableWithRootDict()
+	if err != nil {
+		return nil, err
+	}
+
+	tiles := []*nupTile{}
+
+	for _, fn := range fileNames {
+
+		t, err := imageTile(xRefTable, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		tiles = append(tiles, t)
+	}
+
+	sheets, err := nup.createSheets(xRefTable, tiles)
+	if err != nil {
+		return nil, err
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := xRefTable.IndRefForNewObject(PDFDict{Dict: map[string]PDFObject{"Type": PDFName("Pages")}})
+	if err != nil {
+		return nil, err
+	}
+
+	rootDict.Insert("Pages", *root)
+
+	if err = rebuildPageTree(xRefTable, *root, sheets); err != nil {
+		return nil, err
+	}
+
+	ctx := &PDFContext{
+		Configuration: config,
+		XRefTable:     xRefTable,
+		Write:         NewWriteContext(config.Eol),
+	}
+
+	return ctx, nil
+}
@@ -514,6 +514,10 @@ func parsePagesDict(ctx *PDFContext, pagesDict *PDFDict, pageNumber int) (int, e
 	kidsArray := pagesDict.PDFArrayEntry("Kids")
 	for _, v := range *kidsArray {
 
+		if err := ctx.cancelled(); err != nil {
+			return 0, err
+		}
+
 		// Dereference next page node dict.
 		indRef, _ := v.(PDFIndirectRef)
 		log.Debug.Printf("parsePagesDict PageNode: %s\n", indRef)
@@ -0,0 +1,876 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// => 7.7.3 Page Tree
+//
+// Inserting, removing and moving pages flattens the page tree into its sequence of pages
+// and rebuilds a balanced tree below the existing root node.
+// Attributes inherited from intermediate page tree nodes get pushed down into the page dicts.
+
+// maxPageTreeKids is the maximum number of kids of a rebuilt page tree node.
+const maxPageTreeKids = 32
+
+var inheritablePageAttrs = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// ParseMediaBox parses a page insertion description "mediabox:llx lly urx ury".
+// An empty description results in nil, meaning the media box of the selected page.
+func ParseMediaBox(s string) (*types.Rectangle, error) {
+
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	ss := strings.Split(s, ":")
+	if len(ss) != 2 || strings.TrimSpace(ss[0]) != "mediabox" {
+		return nil, errors.Errorf("invalid page description: %s", s)
+	}
+
+	r, err := parseRectangle(ss[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "mediabox")
+	}
+
+	return r, nil
+}
+
+// collectPages appends the leaves of the page tree node indRef to pages.
+// inherited holds the attributes inherited from intermediate page tree nodes.
+func collectPages(xRefTable *XRefTable, indRef PDFIndirectRef, root bool, inherited map[string]PDFObject, pages *[]PDFIndirectRef) error {
+
+	d, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		return err
+	}
+
+	if d == nil || d.Type() == nil {
+		return errors.Errorf("corrupt page tree node: obj#%d", indRef.ObjectNumber)
+	}
+
+	switch *d.Type() {
+
+	case "Pages":
+		attrs := map[string]PDFObject{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+
+		// The root stays in place along with its attributes.
+		if !root {
+			for _, k := range inheritablePageAttrs {
+				if v, found := d.Find(k); found {
+					attrs[k] = v
+				}
+			}
+		}
+
+		kids := d.PDFArrayEntry("Kids")
+		if kids == nil {
+			return errors.Errorf("corrupt page tree node: obj#%d missing Kids", indRef.ObjectNumber)
+		}
+
+		for _, o := range *kids {
+
+			if o == nil {
+				continue
+			}
+
+			kid, ok := o.(PDFIndirectRef)
+			if !ok {
+				return errors.Errorf("corrupt page tree node: obj#%d", indRef.ObjectNumber)
+			}
+
+			if err = collectPages(xRefTable, kid, false, attrs, pages); err != nil {
+				return err
+			}
+		}
+
+	case "Page":
+		for k, v := range inherited {
+			if _, found := d.Find(k); !found {
+				d.Insert(k, v)
+			}
+		}
+
+		*pages = append(*pages, indRef)
+
+	default:
+		return errors.Errorf("corrupt page tree node: obj#%d of type %s", indRef.ObjectNumber, *d.Type())
+	}
+
+	return nil
+}
+
+// pageList returns the page tree root along with all pages in order.
+func pageList(xRefTable *XRefTable) (*PDFIndirectRef, []PDFIndirectRef, error) {
+
+	root, err := xRefTable.Pages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if root == nil {
+		return nil, nil, errors.New("missing page tree")
+	}
+
+	pages := []PDFIndirectRef{}
+
+	if err = collectPages(xRefTable, *root, true, nil, &pages); err != nil {
+		return nil, nil, err
+	}
+
+	return root, pages, nil
+}
+
+// buildPageTree makes pages the leaves of the page tree node indRef.
+func buildPageTree(xRefTable *XRefTable, indRef PDFIndirectRef, pages []PDFIndirectRef) error {
+
+	d, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		return err
+	}
+
+	kids := PDFArray{}
+
+	// Split into at most maxPageTreeKids subtrees of equal size.
+	n := (len(pages) + maxPageTreeKids - 1) / maxPageTreeKids
+
+	for i := 0; i < len(pages); i += n {
+
+		j := i + n
+		if j > len(pages) {
+			j = len(pages)
+		}
+
+		if j-i == 1 {
+			pd, err := xRefTable.DereferenceDict(pages[i])
+			if err != nil {
+				return err
+			}
+			pd.Update("Parent", indRef)
+			kids = append(kids, pages[i])
+			continue
+		}
+
+		node := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":   PDFName("Pages"),
+				"Parent": indRef,
+			},
+		}
+
+		kid, err := xRefTable.IndRefForNewObject(node)
+		if err != nil {
+			return err
+		}
+
+		if err = buildPageTree(xRefTable, *kid, pages[i:j]); err != nil {
+			return err
+		}
+
+		kids = append(kids, *kid)
+	}
+
+	d.Update("Kids", kids)
+	d.Update("Count", PDFInteger(len(pages)))
+
+	return nil
+}
+
+// rebuildPageTree replaces the page tree below root by pages.
+func rebuildPageTree(xRefTable *XRefTable, root PDFIndirectRef, pages []PDFIndirectRef) error {
+
+	log.Debug.Printf("rebuildPageTree: %d pages\n", len(pages))
+
+	if err := buildPageTree(xRefTable, root, pages); err != nil {
+		return err
+	}
+
+	xRefTable.PageCount = len(pages)
+
+	return nil
+}
+
+func blankPage(xRefTable *XRefTable, page int, mediaBox *types.Rectangle) (*PDFIndirectRef, error) {
+
+	var mb PDFArray
+
+	if mediaBox != nil {
+		mb = NewRectangle(mediaBox.LL.X, mediaBox.LL.Y, mediaBox.UR.X, mediaBox.UR.Y)
+	} else {
+		_, inhPAttrs, err := xRefTable.PageDict(page)
+		if err != nil {
+			return nil, err
+		}
+		if inhPAttrs.mediaBox == nil {
+			return nil, errors.Errorf("page %d: missing MediaBox", page)
+		}
+		mb = append(PDFArray{}, *inhPAttrs.mediaBox...)
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":      PDFName("Page"),
+			"MediaBox":  mb,
+			"Resources": NewPDFDict(),
+		},
+	}
+
+	return xRefTable.IndRefForNewObject(d)
+}
+
+// InsertPages inserts a blank page before or after each selected page.
+// A nil mediaBox means the media box of the selected page.
+func InsertPages(xRefTable *XRefTable, selectedPages IntSet, before bool, mediaBox *types.Rectangle) error {
+
+	// Blank pages get the media box in effect before any inherited attributes are pushed down.
+	blanks := map[int]PDFIndirectRef{}
+
+	for i := 1; i <= xRefTable.PageCount; i++ {
+		if !selectedPages[i] {
+			continue
+		}
+		indRef, err := blankPage(xRefTable, i, mediaBox)
+		if err != nil {
+			return err
+		}
+		blanks[i] = *indRef
+	}
+
+	root, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	pp := make([]PDFIndirectRef, 0, len(pages)+len(blanks))
+
+	for i, p := range pages {
+		blank, ok := blanks[i+1]
+		if ok && before {
+			pp = append(pp, blank)
+		}
+		pp = append(pp, p)
+		if ok && !before {
+			pp = append(pp, blank)
+		}
+	}
+
+	return rebuildPageTree(xRefTable, *root, pp)
+}
+
+// RemovePages removes selected pages along with any outline items, destinations and form fields pointing to them.
+func RemovePages(xRefTable *XRefTable, selectedPages IntSet) error {
+
+	root, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	removed := IntSet{}
+	pp, dropped := []PDFIndirectRef{}, []PDFIndirectRef{}
+
+	for i, p := range pages {
+		if selectedPages[i+1] {
+			removed[p.ObjectNumber.Value()] = true
+			dropped = append(dropped, p)
+			continue
+		}
+		pp = append(pp, p)
+	}
+
+	if len(pp) == 0 {
+		return errors.New("remove pages: can't remove all pages")
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	if err = rebuildPageTree(xRefTable, *root, pp); err != nil {
+		return err
+	}
+
+	if err = removeFormFields(xRefTable, removed, dropped); err != nil {
+		return err
+	}
+
+	return removeDestinations(xRefTable, removed, pp)
+}
+
+// MovePages rearranges the pages as listed in order, a permutation of all page numbers.
+func MovePages(xRefTable *XRefTable, order []int) error {
+
+	root, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	if len(order) != len(pages) {
+		return errors.Errorf("move pages: order lists %d of %d pages", len(order), len(pages))
+	}
+
+	seen := IntSet{}
+	pp := make([]PDFIndirectRef, len(pages))
+
+	for i, p := range order {
+		if p < 1 || p > len(pages) {
+			return errors.Errorf("move pages: page %d out of range", p)
+		}
+		if seen[p] {
+			return errors.Errorf("move pages: page %d listed twice", p)
+		}
+		seen[p] = true
+		pp[i] = pages[p-1]
+	}
+
+	return rebuildPageTree(xRefTable, *root, pp)
+}
+
+// deadDestinations identifies destinations pointing to removed pages.
+type deadDestinations struct {
+	xRefTable *XRefTable
+	removed   IntSet          // Object numbers of removed pages.
+	names     map[string]bool // Named destinations pointing to removed pages.
+}
+
+// dest returns true if dest points to a removed page.
+func (dd deadDestinations) dest(dest PDFObject) bool {
+
+	o, err := dd.xRefTable.Dereference(dest)
+	if err != nil || o == nil {
+		return false
+	}
+
+	switch o := o.(type) {
+
+	case PDFArray:
+		if len(o) > 0 {
+			if indRef, ok := o[0].(PDFIndirectRef); ok {
+				return dd.removed[indRef.ObjectNumber.Value()]
+			}
+		}
+
+	case PDFDict:
+		if d, found := o.Find("D"); found {
+			return dd.dest(d)
+		}
+
+	case PDFName:
+		return dd.names[o.Value()]
+
+	case PDFStringLiteral:
+		return dd.names[o.Value()]
+
+	case PDFHexLiteral:
+		return dd.names[o.Value()]
+	}
+
+	return false
+}
+
+// action returns true for a GoTo action pointing to a removed page.
+func (dd deadDestinations) action(action PDFObject) bool {
+
+	d, err := dd.xRefTable.DereferenceDict(action)
+	if err != nil || d == nil {
+		return false
+	}
+
+	if s := d.NameEntry("S"); s == nil || *s != "GoTo" {
+		return false
+	}
+
+	dest, found := d.Find("D")
+
+	return found && dd.dest(dest)
+}
+
+// item returns true if the outline item or link annotation d points to a removed page.
+func (dd deadDestinations) item(d *PDFDict) bool {
+
+	if dest, found := d.Find("Dest"); found {
+		return dd.dest(dest)
+	}
+
+	if a, found := d.Find("A"); found {
+		return dd.action(a)
+	}
+
+	return false
+}
+
+func removeNamedDestinations(xRefTable *XRefTable, dd *deadDestinations) error {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	// PDF 1.1 Dests dict
+	if o, found := rootDict.Find("Dests"); found {
+		d, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			for k, v := range d.Dict {
+				if dd.dest(v) {
+					dd.names[k] = true
+					d.Delete(k)
+				}
+			}
+		}
+	}
+
+	tree := xRefTable.Names["Dests"]
+	if tree == nil {
+		return nil
+	}
+
+	var dead []string
+
+	err = tree.Process(xRefTable, func(xRefTable *XRefTable, k string, v PDFObject) error {
+		if dd.dest(v) {
+			dead = append(dead, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range dead {
+
+		dd.names[k] = true
+
+		// Removal must not delete the object graph of the destination including its page.
+		empty, _, err := tree.Remove(nil, k)
+		if err != nil {
+			return err
+		}
+
+		if empty {
+			return removeDestsNameTree(xRefTable, rootDict)
+		}
+	}
+
+	return nil
+}
+
+// removeDestsNameTree removes an empty Dests name tree.
+func removeDestsNameTree(xRefTable *XRefTable, rootDict *PDFDict) error {
+
+	delete(xRefTable.Names, "Dests")
+
+	namesDict, err := xRefTable.NamesDict()
+	if err != nil || namesDict == nil {
+		return err
+	}
+
+	namesDict.Delete("Dests")
+	if namesDict.Len() == 0 {
+		rootDict.Delete("Names")
+	}
+
+	return nil
+}
+
+// pruneOutlineItems removes the outline items pointing to removed pages from the list starting at first.
+// Items with remaining kids stay as headings.
+// Returns the new first and last item and the number of visible items.
+func pruneOutlineItems(xRefTable *XRefTable, first *PDFIndirectRef, dd deadDestinations) (*PDFIndirectRef, *PDFIndirectRef, int, error) {
+
+	var (
+		newFirst, last *PDFIndirectRef
+		lastDict       *PDFDict
+		count          int
+	)
+
+	for indRef := first; indRef != nil; {
+
+		d, err := xRefTable.DereferenceDict(*indRef)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if d == nil {
+			break
+		}
+
+		next := d.IndirectRefEntry("Next")
+
+		kidsFirst, kidsLast, kidsCount, err := pruneOutlineItems(xRefTable, d.IndirectRefEntry("First"), dd)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		if dd.item(d) {
+			if kidsFirst == nil {
+				log.Debug.Printf("pruneOutlineItems: removing obj#%d\n", indRef.ObjectNumber)
+				indRef = next
+				continue
+			}
+			d.Delete("Dest")
+			d.Delete("A")
+		}
+
+		open := false
+		if c := d.IntEntry("Count"); c != nil {
+			open = *c > 0
+		}
+
+		if kidsFirst == nil {
+			d.Delete("First")
+			d.Delete("Last")
+			d.Delete("Count")
+		} else {
+			d.Update("First", *kidsFirst)
+			d.Update("Last", *kidsLast)
+			if open {
+				d.Update("Count", PDFInteger(kidsCount))
+			} else if d.IntEntry("Count") != nil {
+				d.Update("Count", PDFInteger(-kidsCount))
+			}
+		}
+
+		count++
+		if open {
+			count += kidsCount
+		}
+
+		if last == nil {
+			newFirst = indRef
+			d.Delete("Prev")
+		} else {
+			lastDict.Update("Next", *indRef)
+			d.Update("Prev", *last)
+		}
+
+		last, lastDict = indRef, d
+		indRef = next
+	}
+
+	if lastDict != nil {
+		lastDict.Delete("Next")
+	}
+
+	return newFirst, last, count, nil
+}
+
+func removeOutlineItems(xRefTable *XRefTable, dd deadDestinations) error {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	o, found := rootDict.Find("Outlines")
+	if !found {
+		return nil
+	}
+
+	d, err := xRefTable.DereferenceDict(o)
+	if err != nil || d == nil {
+		return err
+	}
+
+	first, last, count, err := pruneOutlineItems(xRefTable, d.IndirectRefEntry("First"), dd)
+	if err != nil {
+		return err
+	}
+
+	if first == nil {
+		d.Delete("First")
+		d.Delete("Last")
+		d.Delete("Count")
+		return nil
+	}
+
+	d.Update("First", *first)
+	d.Update("Last", *last)
+	d.Update("Count", PDFInteger(count))
+
+	return nil
+}
+
+// removeLinks removes link annotations pointing to removed pages.
+func removeLinks(xRefTable *XRefTable, pages []PDFIndirectRef, dd deadDestinations) error {
+
+	for _, p := range pages {
+
+		d, err := xRefTable.DereferenceDict(p)
+		if err != nil {
+			return err
+		}
+
+		o, found := d.Find("Annots")
+		if !found {
+			continue
+		}
+
+		annots, err := xRefTable.DereferenceArray(o)
+		if err != nil || annots == nil {
+			return err
+		}
+
+		a := PDFArray{}
+
+		for _, v := range *annots {
+			ad, err := xRefTable.DereferenceDict(v)
+			if err == nil && ad != nil && ad.Subtype() != nil && *ad.Subtype() == "Link" && dd.item(ad) {
+				continue
+			}
+			a = append(a, v)
+		}
+
+		if len(a) == len(*annots) {
+			continue
+		}
+
+		if len(a) == 0 {
+			d.Delete("Annots")
+			continue
+		}
+
+		updateArrayEntry(xRefTable, d, "Annots", o, a)
+	}
+
+	return nil
+}
+
+// updateArrayEntry replaces the array o found for key in d either in place or by updating d.
+func updateArrayEntry(xRefTable *XRefTable, d *PDFDict, key string, o PDFObject, a PDFArray) {
+
+	if indRef, ok := o.(PDFIndirectRef); ok {
+		entry, _ := xRefTable.FindTableEntryForIndRef(&indRef)
+		entry.Object = a
+		return
+	}
+
+	d.Update(key, a)
+}
+
+// deadFields identifies form fields whose widgets sit on removed pages.
+type deadFields struct {
+	xRefTable *XRefTable
+	removed   IntSet // Object numbers of removed pages.
+	widgets   IntSet // Object numbers of widget annotations of removed pages.
+	fields    IntSet // Object numbers of removed fields.
+}
+
+// widget returns true if d is a widget annotation on a removed page.
+func (df deadFields) widget(objNr int, d *PDFDict) bool {
+
+	if df.widgets[objNr] {
+		return true
+	}
+
+	if d.Subtype() == nil || *d.Subtype() != "Widget" {
+		return false
+	}
+
+	p := d.IndirectRefEntry("P")
+
+	return p != nil && df.removed[p.ObjectNumber.Value()]
+}
+
+// prune returns fields without the fields whose widgets all sit on removed pages.
+// Fields left without kids are removed too.
+func (df deadFields) prune(fields PDFArray) (PDFArray, error) {
+
+	a := PDFArray{}
+
+	for _, o := range fields {
+
+		indRef, ok := o.(PDFIndirectRef)
+		if !ok {
+			a = append(a, o)
+			continue
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+
+		d, err := df.xRefTable.DereferenceDict(indRef)
+		if err != nil {
+			return nil, err
+		}
+
+		if d == nil {
+			a = append(a, o)
+			continue
+		}
+
+		if df.widget(objNr, d) {
+			log.Debug.Printf("deadFields.prune: removing obj#%d\n", objNr)
+			df.fields[objNr] = true
+			continue
+		}
+
+		kidsObj, found := d.Find("Kids")
+		if !found {
+			a = append(a, o)
+			continue
+		}
+
+		kids, err := df.xRefTable.DereferenceArray(kidsObj)
+		if err != nil {
+			return nil, err
+		}
+		if kids == nil {
+			a = append(a, o)
+			continue
+		}
+
+		k, err := df.prune(*kids)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(k) == 0 && len(*kids) > 0 {
+			log.Debug.Printf("deadFields.prune: removing obj#%d\n", objNr)
+			df.fields[objNr] = true
+			continue
+		}
+
+		if len(k) < len(*kids) {
+			updateArrayEntry(df.xRefTable, d, "Kids", kidsObj, k)
+		}
+
+		a = append(a, o)
+	}
+
+	return a, nil
+}
+
+// removeFormFields removes the form fields whose widgets sit on the dropped pages.
+func removeFormFields(xRefTable *XRefTable, removed IntSet, dropped []PDFIndirectRef) error {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	o, found := rootDict.Find("AcroForm")
+	if !found {
+		return nil
+	}
+
+	acroForm, err := xRefTable.DereferenceDict(o)
+	if err != nil || acroForm == nil {
+		return err
+	}
+
+	df := deadFields{xRefTable: xRefTable, removed: removed, widgets: IntSet{}, fields: IntSet{}}
+
+	for _, p := range dropped {
+
+		d, err := xRefTable.DereferenceDict(p)
+		if err != nil {
+			return err
+		}
+
+		annots, err := xRefTable.DereferenceArray(d.Dict["Annots"])
+		if err != nil {
+			return err
+		}
+		if annots == nil {
+			continue
+		}
+
+		for _, v := range *annots {
+			if indRef, ok := v.(PDFIndirectRef); ok {
+				df.widgets[indRef.ObjectNumber.Value()] = true
+			}
+		}
+	}
+
+	for _, k := range []string{"Fields", "CO"} {
+
+		o, found := acroForm.Find(k)
+		if !found {
+			continue
+		}
+
+		fields, err := xRefTable.DereferenceArray(o)
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			continue
+		}
+
+		a := *fields
+
+		if k == "Fields" {
+			if a, err = df.prune(a); err != nil {
+				return err
+			}
+		} else {
+			// The calculation order lists fields possibly removed above.
+			a = PDFArray{}
+			for _, v := range *fields {
+				if indRef, ok := v.(PDFIndirectRef); ok && df.fields[indRef.ObjectNumber.Value()] {
+					continue
+				}
+				a = append(a, v)
+			}
+		}
+
+		if len(a) < len(*fields) {
+			updateArrayEntry(xRefTable, acroForm, k, o, a)
+		}
+	}
+
+	return nil
+}
+
+// removeDestinations cleans up outline items, destinations and links pointing to removed pages.
+func removeDestinations(xRefTable *XRefTable, removed IntSet, pages []PDFIndirectRef) error {
+
+	dd := deadDestinations{xRefTable: xRefTable, removed: removed, names: map[string]bool{}}
+
+	if err := removeNamedDestinations(xRefTable, &dd); err != nil {
+		return err
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	if o, found := rootDict.Find("OpenAction"); found {
+		if oa, _ := xRefTable.Dereference(o); oa != nil {
+			_, isDest := oa.(PDFArray)
+			if isDest && dd.dest(oa) || !isDest && dd.action(oa) {
+				rootDict.Delete("OpenAction")
+			}
+		}
+	}
+
+	if err = removeOutlineItems(xRefTable, dd); err != nil {
+		return err
+	}
+
+	return removeLinks(xRefTable, pages, dd)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// PaperSize is a map of known paper sizes in user units (1/72 inch).
+// All sizes are in portrait orientation except Ledger which is Tabloid in landscape.
+var PaperSize = map[string]types.Dim{
+
+	// ISO 216 A series
+	"A0":  {Width: 2384, Height: 3370},
+	"A1":  {Width: 1684, Height: 2384},
+	"A2":  {Width: 1191, Height: 1684},
+	"A3":  {Width: 842, Height: 1191},
+	"A4":  {Width: 595, Height: 842},
+	"A5":  {Width: 420, Height: 595},
+	"A6":  {Width: 298, Height: 420},
+	"A7":  {Width: 210, Height: 298},
+	"A8":  {Width: 147, Height: 210},
+	"A9":  {Width: 105, Height: 147},
+	"A10": {Width: 74, Height: 105},
+
+	// ISO 216 B series
+	"B0":  {Width: 2835, Height: 4008},
+	"B1":  {Width: 2004, Height: 2835},
+	"B2":  {Width: 1417, Height: 2004},
+	"B3":  {Width: 1001, Height: 1417},
+	"B4":  {Width: 709, Height: 1001},
+	"B5":  {Width: 499, Height: 709},
+	"B6":  {Width: 354, Height: 499},
+	"B7":  {Width: 249, Height: 354},
+	"B8":  {Width: 176, Height: 249},
+	"B9":  {Width: 125, Height: 176},
+	"B10": {Width: 88, Height: 125},
+
+	// ISO 269 C series (envelopes)
+	"C4": {Width: 649, Height: 918},
+	"C5": {Width: 459, Height: 649},
+	"C6": {Width: 323, Height: 459},
+
+	// North American sizes
+	"Letter":    {Width: 612, Height: 792},
+	"Legal":     {Width: 612, Height: 1008},
+	"Tabloid":   {Width: 792, Height: 1224},
+	"Ledger":    {Width: 1224, Height: 792},
+	"Executive": {Width: 522, Height: 756},
+}
+
+// PaperDim returns the dimensions of the named paper size, eg. A4 or Letter.
+// Paper names are case insensitive.
+func PaperDim(paper string) (*types.Dim, error) {
+
+	for k, d := range PaperSize {
+		if strings.EqualFold(k, paper) {
+			d := d
+			return &d, nil
+		}
+	}
+
+	return nil, errors.Errorf("unknown paper size: %s", paper)
+}
+
+// ParsePaperSize parses a paper size given by name, see PaperDim, or as WxH.
+// Custom dimensions may be followed by a unit: pt (default), mm, cm, in.
+// eg. A4, Letter, 500x700, 210x297mm
+func ParsePaperSize(s string) (*types.Dim, error) {
+
+	s = strings.TrimSpace(s)
+
+	if d, err := PaperDim(s); err == nil {
+		return d, nil
+	}
+
+	unit := 1.0
+
+	for k, v := range boxUnits {
+		if strings.HasSuffix(strings.ToLower(s), k) {
+			unit = v
+			s = strings.TrimSpace(s[:len(s)-len(k)])
+			break
+		}
+	}
+
+	ss := strings.Split(strings.ToLower(s), "x")
+	if len(ss) != 2 {
+		return nil, errors.Errorf("unknown paper size: %s", s)
+	}
+
+	w, err := strconv.ParseFloat(strings.TrimSpace(ss[0]), 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid paper width: %s", ss[0])
+	}
+
+	h, err := strconv.ParseFloat(strings.TrimSpace(ss[1]), 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid paper height: %s", ss[1])
+	}
+
+	if w <= 0 || h <= 0 {
+		return nil, errors.Errorf("invalid paper size: %s", s)
+	}
+
+	return &types.Dim{Width: w * unit, Height: h * unit}, nil
+}
@@ -17,12 +17,12 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
 	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
 	"strings"
-	"unicode"
 
 	"github.com/pkg/errors"
 )
@@ -58,127 +58,136 @@ func init() {
 	logInfoParse = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
-func positionToNextWhitespace(s string) (int, string) {
+// lexer tokenizes PDF objects straight out of a byte buffer.
+//
+// Tokens are sliced from the underlying buffer and only get copied
+// when turned into the resulting PDFObject.
+// A lexer may be reused for several buffers by calling reset.
+type lexer struct {
+	buf []byte
+	pos int
+	hex []byte // Scratch buffer for hex literals.
+}
 
-	for i, c := range s {
-		if unicode.IsSpace(c) {
-			return i, s[i:]
-		}
-	}
-	return 0, s
+// reset prepares the lexer for parsing buf.
+func (l *lexer) reset(buf []byte) {
+	l.buf = buf
+	l.pos = 0
+}
+
+func (l *lexer) eof() bool {
+	return l.pos >= len(l.buf)
 }
 
-// PositionToNextWhitespaceOrChar trims a string to next whitespace or one of given chars.
-func positionToNextWhitespaceOrChar(s, chars string) (int, string) {
+// remaining returns the number of unparsed bytes.
+func (l *lexer) remaining() int {
+	return len(l.buf) - l.pos
+}
 
-	if len(chars) == 0 {
-		return positionToNextWhitespace(s)
+// rest returns the unparsed part of the buffer.
+func (l *lexer) rest() []byte {
+	if l.eof() {
+		return nil
 	}
+	return l.buf[l.pos:]
+}
 
-	if len(chars) > 0 {
-		for i, c := range s {
-			for _, m := range chars {
-				if c == m || unicode.IsSpace(c) {
-					return i, s[i:]
-				}
-			}
-		}
+func (l *lexer) hasPrefix(s string) bool {
+	return l.remaining() >= len(s) && string(l.buf[l.pos:l.pos+len(s)]) == s
+}
+
+func whitespace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
 	}
-	return 0, s
+	return false
 }
 
-func positionToNextEOL(s string) string {
+func delimiter(b byte) bool {
 
-	chars := "\x0A\x0D"
+	s := "<>[]()/"
 
-	for i, c := range s {
-		for _, m := range chars {
-			if c == m {
-				return s[i:]
-			}
+	for i := 0; i < len(s); i++ {
+		if b == s[i] {
+			return true
 		}
 	}
-	return ""
-}
 
-// trimLeftSpace trims leading whitespace and trailing comment.
-func trimLeftSpace(s string) (outstr string, trimmedSpaces int) {
+	return false
+}
 
-	logDebugParse.Printf("TrimLeftSpace: begin %s\n", s)
+// skipSpace positions to the next char that is neither whitespace nor part of a comment.
+func (l *lexer) skipSpace() {
 
-	whitespace := func(c rune) bool { return unicode.IsSpace(c) }
+	for {
 
-	outstr = s
+		for l.pos < len(l.buf) && whitespace(l.buf[l.pos]) {
+			l.pos++
+		}
 
-	for {
-		// trim leading whitespace
-		outstr = strings.TrimLeftFunc(outstr, whitespace)
-		logDebugParse.Printf("1 outstr: <%s>\n", outstr)
-		if len(outstr) <= 1 || outstr[0] != '%' {
-			break
+		if l.remaining() <= 1 || l.buf[l.pos] != '%' {
+			return
 		}
-		// trim PDF comment (= '%' up to eol)
-		outstr = positionToNextEOL(outstr)
-		logDebugParse.Printf("2 outstr: <%s>\n", outstr)
 
+		// Skip PDF comment (= '%' up to eol).
+		for l.pos < len(l.buf) && l.buf[l.pos] != 0x0A && l.buf[l.pos] != 0x0D {
+			l.pos++
+		}
 	}
+}
 
-	trimmedSpaces = len(s) - len(outstr)
+// tokenEnd returns the index of the next whitespace or one of chars starting at i
+// or -1 if there is none.
+func (l *lexer) tokenEnd(i int, chars string) int {
 
-	logDebugParse.Printf("TrimLeftSpace: end %s %d\n", outstr, trimmedSpaces)
+	for ; i < len(l.buf); i++ {
+		c := l.buf[i]
+		if whitespace(c) || strings.IndexByte(chars, c) >= 0 {
+			return i
+		}
+	}
 
-	return outstr, trimmedSpaces
+	return -1
 }
 
-// HexString validates and formats a hex string to be of even length.
-func hexString(s string) (*string, bool) {
+// atoi works like strconv.Atoi but avoids allocations for the common case.
+func atoi(b []byte) (int, error) {
 
-	logDebugParse.Printf("HexString(%s)\n", s)
-
-	if len(s) == 0 {
-		s1 := ""
-		return &s1, true
+	digits := b
+	if len(digits) > 0 && (digits[0] == '+' || digits[0] == '-') {
+		digits = digits[1:]
 	}
 
-	uc := strings.ToUpper(s)
+	if len(digits) == 0 || len(digits) > 18 {
+		return strconv.Atoi(string(b))
+	}
 
-	for _, c := range uc {
-		logDebugParse.Printf("checking <%c>\n", c)
-		isHexChar := false
-		for _, hexch := range "ABCDEF1234567890" {
-			logDebugParse.Printf("checking against <%c>\n", hexch)
-			if c == hexch {
-				isHexChar = true
-				break
-			}
-		}
-		if !isHexChar {
-			logDebugParse.Println("isHexStr returning false")
-			return nil, false
+	n := 0
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return strconv.Atoi(string(b))
 		}
+		n = n*10 + int(c-'0')
 	}
 
-	logDebugParse.Println("isHexStr returning true")
-
-	// If the final digit of a hexadecimal string is missing -
-	// that is, if there is an odd number of digits - the final digit shall be assumed to be 0.
-	if len(uc)%2 == 1 {
-		uc = uc + "0"
+	if b[0] == '-' {
+		n = -n
 	}
 
-	return &uc, true
+	return n, nil
 }
 
-// balancedParenthesesPrefix returns the index of the end position of the balanced parentheses prefix of s
-// or -1 if unbalanced. s has to start with '('
-func balancedParenthesesPrefix(s string) int {
+// balancedParenthesesPrefix returns the index of the end position of the balanced parentheses prefix of b
+// or -1 if unbalanced. b has to start with '('
+func balancedParenthesesPrefix(b []byte) int {
 
 	var j int
 	escaped := false
 
-	for i := 0; i < len(s); i++ {
+	for i := 0; i < len(b); i++ {
 
-		c := s[i]
+		c := b[i]
 
 		if !escaped && c == '\\' {
 			escaped = true
@@ -207,155 +216,105 @@ func balancedParenthesesPrefix(s string) int {
 	return -1
 }
 
-func forwardParseBuf(buf string, pos int) string {
-	if pos < len(buf) {
-		return buf[pos:]
-	}
-
-	return ""
-}
+// parseInt parses the decimal integer at the current position
+// that has to be terminated by whitespace or '%'.
+func (l *lexer) parseInt(name string) (int, error) {
 
-func delimiter(b byte) bool {
+	l.skipSpace()
+	if l.eof() {
+		return 0, errors.Errorf("ParseObjectAttributes: can't find %s", name)
+	}
 
-	s := "<>[]()/"
+	i := l.tokenEnd(l.pos, "%")
+	if i <= l.pos {
+		return 0, errors.Errorf("ParseObjectAttributes: can't find end of %s", name)
+	}
 
-	for i := 0; i < len(s); i++ {
-		if b == s[i] {
-			return true
-		}
+	n, err := atoi(l.buf[l.pos:i])
+	if err != nil {
+		return 0, err
 	}
 
-	return false
-}
+	l.pos = i
 
-// parseObjectAttributes parses object number and generation of the next object for given string buffer.
-func parseObjectAttributes(line *string) (objectNumber *int, generationNumber *int, err error) {
+	return n, nil
+}
 
-	logDebugParse.Printf("ParseObjectAttributes: buf=<%s>\n", *line)
+// parseObjectAttributes parses object number and generation of the next object
+// and positions behind "obj".
+func (l *lexer) parseObjectAttributes() (objectNumber *int, generationNumber *int, err error) {
 
-	if line == nil || len(*line) == 0 {
+	if l.eof() {
 		return nil, nil, errors.New("ParseObjectAttributes: buf not available")
 	}
 
-	l := *line
-	var remainder string
-
-	i := strings.Index(l, "obj")
+	i := bytes.Index(l.buf[l.pos:], []byte("obj"))
 	if i < 0 {
 		return nil, nil, errors.New("ParseObjectAttributes: can't find \"obj\"")
 	}
 
-	remainder = l[i+len("obj"):]
-	l = l[:i]
-
-	// object number
-
-	l, _ = trimLeftSpace(l)
-	if len(l) == 0 {
-		return nil, nil, errors.New("ParseObjectAttributes: can't find object number")
-	}
-
-	i, _ = positionToNextWhitespaceOrChar(l, "%")
-	if i == 0 {
-		return nil, nil, errors.New("ParseObjectAttributes: can't find end of object number")
-	}
+	hl := lexer{buf: l.buf[l.pos : l.pos+i]}
 
-	objNr, err := strconv.Atoi(l[:i])
+	objNr, err := hl.parseInt("object number")
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// generation number
-
-	l = l[i:]
-	l, _ = trimLeftSpace(l)
-	if len(l) == 0 {
-		return nil, nil, errors.New("ParseObjectAttributes: can't find generation number")
-	}
-
-	i, _ = positionToNextWhitespaceOrChar(l, "%")
-	if i == 0 {
-		return nil, nil, errors.New("ParseObjectAttributes: can't find end of generation number")
-	}
-
-	genNr, err := strconv.Atoi(l[:i])
+	genNr, err := hl.parseInt("generation number")
 	if err != nil {
 		return nil, nil, err
 	}
 
-	objectNumber = &objNr
-	generationNumber = &genNr
+	l.pos += i + len("obj")
 
-	*line = remainder
-
-	return objectNumber, generationNumber, nil
+	return &objNr, &genNr, nil
 }
 
-func parseArray(line *string) (*PDFArray, error) {
+func (l *lexer) parseArray() (PDFArray, error) {
 
-	if line == nil || len(*line) == 0 {
+	if l.eof() {
 		return nil, errNoArray
 	}
 
-	l := *line
-
-	logDebugParse.Printf("ParseArray: %s\n", l)
-	//logInfoParse.Println("ParseArray begin")
-
-	if !strings.HasPrefix(l, "[") {
+	if l.buf[l.pos] != '[' {
 		return nil, errArrayCorrupt
 	}
 
-	if len(l) == 1 {
-		return nil, errArrayNotTerminated
-	}
-
 	// position behind '['
-	l = forwardParseBuf(l, 1)
+	l.pos++
 
 	// position to first non whitespace char after '['
-	l, _ = trimLeftSpace(l)
+	l.skipSpace()
 
-	if len(l) == 0 {
+	if l.eof() {
 		// only whitespace after '['
 		return nil, errArrayNotTerminated
 	}
 
 	arr := PDFArray{}
 
-	for !strings.HasPrefix(l, "]") {
+	for l.buf[l.pos] != ']' {
 
-		obj, err := parseObject(&l)
+		obj, err := l.parseObject()
 		if err != nil {
 			return nil, err
 		}
-		logDebugParse.Printf("ParseArray: new array obj=%v\n", obj)
 		arr = append(arr, obj)
 
-		// we are positioned on the char behind the last parsed array entry.
-		if len(l) == 0 {
-			return nil, errArrayNotTerminated
-		}
-
 		// position to next non whitespace char.
-		l, _ = trimLeftSpace(l)
-		if len(l) == 0 {
+		l.skipSpace()
+		if l.eof() {
 			return nil, errArrayNotTerminated
 		}
 	}
 
 	// position behind ']'
-	l = forwardParseBuf(l, 1)
-
-	*line = l
+	l.pos++
 
-	//logInfoParse.Printf("ParseArray end: returning array (len=%d)\n", len(arr))
-	logDebugParse.Printf("ParseArray: returning array (len=%d): %v\n", len(arr), arr)
-
-	return &arr, nil
+	return arr, nil
 }
 
-func parseStringLiteral(line *string) (PDFObject, error) {
+func (l *lexer) parseStringLiteral() (PDFObject, error) {
 
 	// Balanced pairs of parenthesis are allowed.
 	// Empty literals are allowed.
@@ -377,432 +336,309 @@ func parseStringLiteral(line *string) (PDFObject, error) {
 
 	// Join split lines by '\' eol.
 
-	if line == nil || len(*line) == 0 {
-		return nil, errBufNotAvailable
-	}
-
-	l := *line
-
-	logDebugParse.Printf("parseStringLiteral: begin <%s>\n", l)
-
-	if len(l) < 2 || !strings.HasPrefix(l, "(") {
+	if l.remaining() < 2 || l.buf[l.pos] != '(' {
 		return nil, errStringLiteralCorrupt
 	}
 
 	// Calculate prefix with balanced parentheses,
 	// return index of enclosing ')'.
-	i := balancedParenthesesPrefix(l)
+	i := balancedParenthesesPrefix(l.buf[l.pos:])
 	if i < 0 {
 		// No balanced parentheses.
 		return nil, errStringLiteralCorrupt
 	}
 
 	// remove enclosing '(', ')'
-	balParStr := l[1:i]
-
-	// Parse string literal, see 7.3.4.2
-	//str := stringLiteral(balParStr)
+	stringLiteral := PDFStringLiteral(l.buf[l.pos+1 : l.pos+i])
 
 	// position behind ')'
-	*line = forwardParseBuf(l[i:], 1)
-
-	stringLiteral := PDFStringLiteral(balParStr)
-	logDebugParse.Printf("parseStringLiteral: end <%s>\n", stringLiteral)
+	l.pos += i + 1
 
 	return stringLiteral, nil
 }
 
-func parseHexLiteral(line *string) (PDFObject, error) {
-
-	// hexliterals have no whitespace and can't be empty.
+func (l *lexer) parseHexLiteral() (PDFObject, error) {
 
-	if line == nil || len(*line) == 0 {
-		return nil, errBufNotAvailable
-	}
-
-	l := *line
+	// hexliterals have no whitespace.
 
-	logDebugParse.Printf("parseHexLiteral: %s\n", l)
-
-	if len(l) < 3 || !strings.HasPrefix(l, "<") {
+	if l.remaining() < 3 || l.buf[l.pos] != '<' {
 		return nil, errHexLiteralCorrupt
 	}
 
 	// position behind '<'
-	l = forwardParseBuf(l, 1)
+	start := l.pos + 1
 
-	eov := strings.Index(l, ">") // end of hex literal.
+	eov := bytes.IndexByte(l.buf[start:], '>') // end of hex literal.
 	if eov < 0 {
 		return nil, errHexLiteralNotTerminated
 	}
 
-	hexStr, ok := hexString(l[:eov])
-	if !ok {
-		return nil, errHexLiteralCorrupt
+	l.hex = l.hex[:0]
+
+	for _, c := range l.buf[start : start+eov] {
+		switch {
+		case '0' <= c && c <= '9', 'A' <= c && c <= 'F':
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 'A'
+		default:
+			return nil, errHexLiteralCorrupt
+		}
+		l.hex = append(l.hex, c)
+	}
+
+	// If the final digit of a hexadecimal string is missing -
+	// that is, if there is an odd number of digits - the final digit shall be assumed to be 0.
+	if len(l.hex)%2 == 1 {
+		l.hex = append(l.hex, '0')
 	}
 
 	// position behind '>'
-	*line = forwardParseBuf(l[eov:], 1)
+	l.pos = start + eov + 1
 
-	return PDFHexLiteral(*hexStr), nil
+	return PDFHexLiteral(l.hex), nil
 }
 
-func parseName(line *string) (*PDFName, error) {
+func (l *lexer) parseName() (PDFName, error) {
 
 	// see 7.3.5
 
-	if line == nil || len(*line) == 0 {
-		return nil, errBufNotAvailable
-	}
-
-	l := *line
-
-	logDebugParse.Printf("parseNameObject: %s\n", l)
-
-	if len(l) < 2 || !strings.HasPrefix(l, "/") {
-		return nil, errNameObjectCorrupt
+	if l.remaining() < 2 || l.buf[l.pos] != '/' {
+		return "", errNameObjectCorrupt
 	}
 
 	// position behind '/'
-	l = forwardParseBuf(l, 1)
+	start := l.pos + 1
 
 	// cut off on whitespace or delimiter
-	eok, _ := positionToNextWhitespaceOrChar(l, "/<>()[]")
-
-	if eok > 0 || unicode.IsSpace(rune(l[0])) {
-		logDebugParse.Printf("parseNameObject: wants to cut off at %d\n", eok)
-		*line = l[eok:]
-		l = l[:eok]
-	} else {
-		logDebugParse.Println("parseNameObject: nothing to cut off")
-		*line = ""
+	// An empty name has to be followed by whitespace.
+	eok := l.tokenEnd(start, "/<>()[]")
+	if eok < 0 || eok == start && !whitespace(l.buf[start]) {
+		eok = len(l.buf)
 	}
 
-	nameObj := PDFName(l)
+	l.pos = eok
 
-	return &nameObj, nil
+	return PDFName(l.buf[start:eok]), nil
 }
 
-func parseDict(line *string) (*PDFDict, error) {
+func (l *lexer) parseDict() (PDFDict, error) {
 
-	if line == nil || len(*line) == 0 {
-		return nil, errNoDictionary
+	if l.eof() {
+		return PDFDict{}, errNoDictionary
 	}
 
-	l := *line
-
-	logDebugParse.Printf("ParseDict: %s\n", l)
-
-	if len(l) < 4 || !strings.HasPrefix(l, "<<") {
-		return nil, errDictionaryCorrupt
+	if l.remaining() < 4 || !l.hasPrefix("<<") {
+		return PDFDict{}, errDictionaryCorrupt
 	}
 
 	// position behind '<<'
-	l = forwardParseBuf(l, 2)
+	l.pos += 2
 
 	// position to first non whitespace char after '<<'
-	l, _ = trimLeftSpace(l)
+	l.skipSpace()
 
-	if len(l) == 0 {
-		// only whitespace after '['
-		return nil, errDictionaryNotTerminated
+	if l.eof() {
+		// only whitespace after '<<'
+		return PDFDict{}, errDictionaryNotTerminated
 	}
 
 	dict := NewPDFDict()
 
-	for !strings.HasPrefix(l, ">>") {
+	for !l.hasPrefix(">>") {
 
-		key, err := parseName(&l)
+		key, err := l.parseName()
 		if err != nil {
-			return nil, err
+			return PDFDict{}, err
 		}
-		logDebugParse.Printf("ParseDict: key = %s\n", key)
 
 		// position to first non whitespace after key
-		l, _ = trimLeftSpace(l)
+		l.skipSpace()
 
-		if len(l) == 0 {
-			logDebugParse.Println("ParseDict: only whitespace after key")
+		if l.eof() {
 			// only whitespace after key
-			return nil, errDictionaryNotTerminated
+			return PDFDict{}, errDictionaryNotTerminated
 		}
 
-		obj, err := parseObject(&l)
+		obj, err := l.parseObject()
 		if err != nil {
-			return nil, err
+			return PDFDict{}, err
 		}
 
 		// Specifying the null object as the value of a dictionary entry (7.3.7, "Dictionary Objects")
 		// shall be equivalent to omitting the entry entirely.
 		if obj != nil {
-			logDebugParse.Printf("ParseDict: dict[%s]=%v\n", key, obj)
-			if ok := dict.Insert(string(*key), obj); !ok {
-				return nil, errDictionaryDuplicateKey
+			if ok := dict.Insert(string(key), obj); !ok {
+				return PDFDict{}, errDictionaryDuplicateKey
 			}
 		}
 
-		// we are positioned on the char behind the last parsed dict value.
-		if len(l) == 0 {
-			return nil, errDictionaryNotTerminated
-		}
-
 		// position to next non whitespace char.
-		l, _ = trimLeftSpace(l)
-		if len(l) == 0 {
-			return nil, errDictionaryNotTerminated
+		l.skipSpace()
+		if l.eof() {
+			return PDFDict{}, errDictionaryNotTerminated
 		}
 
 	}
 
 	// position behind '>>'
-	l = forwardParseBuf(l, 2)
+	l.pos += 2
 
-	*line = l
-
-	logDebugParse.Printf("ParseDict: returning dict at: %v\n", dict)
-
-	return &dict, nil
+	return dict, nil
 }
 
-func noBuf(l *string) bool {
-	return l == nil || len(*l) == 0
-}
-
-func parseNumericOrIndRef(line *string) (PDFObject, error) {
-
-	if noBuf(line) {
-		return nil, errBufNotAvailable
-	}
-
-	l := *line
+func (l *lexer) parseNumericOrIndRef() (PDFObject, error) {
 
 	// if this object is an integer we need to check for an indirect reference eg. 1 0 R
 	// otherwise it has to be a float
 	// we have to check first for integer
 
-	i1, _ := positionToNextWhitespaceOrChar(l, "/<([]>")
-	var l1 string
-	if i1 > 0 {
-		l1 = l[i1:]
-	} else {
-		l1 = l[len(l):]
-	}
+	start := l.pos
 
-	str := l
-	if i1 > 0 {
-		str = l[:i1]
+	i1 := l.tokenEnd(start, "/<([]>")
+	if i1 < 0 {
+		i1 = len(l.buf)
 	}
 
+	str := l.buf[start:i1]
+
 	// Try int
-	i, err := strconv.Atoi(str)
+	i, err := atoi(str)
 	if err != nil {
 
 		// Try float
-		f, err := strconv.ParseFloat(str, 64)
+		f, err := strconv.ParseFloat(string(str), 64)
 		if err != nil {
 			return nil, err
 		}
 
 		// We have a Float!
-		logDebugParse.Printf("parseNumericOrIndRef: value is numeric float: %f\n", f)
-		*line = l1
+		l.pos = i1
 		return PDFFloat(f), nil
 	}
 
 	// We have an Int!
+	l.pos = i1
 
 	// if not followed by whitespace return sole integer value.
-	if i1 == 0 || delimiter(l[i1]) {
-		logDebugParse.Printf("parseNumericOrIndRef: value is numeric int: %d\n", i)
-		*line = l1
+	if i1 == len(l.buf) || delimiter(l.buf[i1]) {
 		return PDFInteger(i), nil
 	}
 
 	// Must be indirect reference. (123 0 R)
 	// Missing is the 2nd int and "R".
 
-	iref1 := i
-
-	l = l[i1:]
-	l, _ = trimLeftSpace(l)
-	if len(l) == 0 {
+	gl := lexer{buf: l.buf, pos: i1}
+	gl.skipSpace()
+	if gl.eof() {
 		// only whitespace
-		*line = l1
 		return PDFInteger(i), nil
 	}
 
-	i2, _ := positionToNextWhitespaceOrChar(l, "/<([]>")
+	i2 := gl.tokenEnd(gl.pos, "/<([]>")
 
 	// if only 2 token, can't be indirect reference.
 	// if not followed by whitespace return sole integer value.
-	if i2 == 0 || delimiter(l[i2]) {
-		logDebugParse.Printf("parseNumericOrIndRef: 2 objects => value is numeric int: %d\n", i)
-		*line = l1
+	if i2 <= gl.pos || delimiter(gl.buf[i2]) {
 		return PDFInteger(i), nil
 	}
 
-	str = l
-	if i2 > 0 {
-		str = l[:i2]
-	}
-
-	iref2, err := strconv.Atoi(str)
+	genNr, err := atoi(gl.buf[gl.pos:i2])
 	if err != nil {
 		// 2nd int(generation number) not available.
 		// Can't be an indirect reference.
-		logDebugParse.Printf("parseNumericOrIndRef: 3 objects, 2nd no int, value is no indirect ref but numeric int: %d\n", i)
-		*line = l1
 		return PDFInteger(i), nil
 	}
 
 	// We have the 2nd int(generation number).
 	// Look for "R"
 
-	l = l[i2:]
-	l, _ = trimLeftSpace(l)
+	gl.pos = i2
+	gl.skipSpace()
 
-	if len(l) == 0 {
-		// only whitespace
-		l = l1
-		return PDFInteger(i), nil
-	}
-
-	if l[0] == 'R' {
+	if !gl.eof() && gl.buf[gl.pos] == 'R' {
 		// We have all 3 components to create an indirect reference.
-		*line = forwardParseBuf(l, 1)
-		return *NewPDFIndirectRef(iref1, iref2), nil
+		l.pos = gl.pos + 1
+		return *NewPDFIndirectRef(i, genNr), nil
 	}
 
 	// 'R' not available.
 	// Can't be an indirect reference.
-	logDebugParse.Printf("parseNumericOrIndRef: value is no indirect ref(no 'R') but numeric int: %d\n", i)
-	*line = l1
-
 	return PDFInteger(i), nil
 }
 
-func parseHexLiteralOrDict(l *string) (val PDFObject, err error) {
+func (l *lexer) parseHexLiteralOrDict() (val PDFObject, err error) {
 
-	if len(*l) < 2 {
+	if l.remaining() < 2 {
 		return nil, errBufNotAvailable
 	}
 
 	// if next char = '<' parseDict.
-	if (*l)[1] == '<' {
-		logDebugParse.Println("parseHexLiteralOrDict: value = Dictionary")
-		pdfDict, err := parseDict(l)
-		if err != nil {
-			return nil, err
-		}
-		val = *pdfDict
-	} else {
-		// hex literals
-		logDebugParse.Println("parseHexLiteralOrDict: value = Hex Literal")
-		if val, err = parseHexLiteral(l); err != nil {
-			return nil, err
-		}
+	if l.buf[l.pos+1] == '<' {
+		return l.parseDict()
 	}
 
-	return val, nil
+	// hex literals
+	return l.parseHexLiteral()
 }
 
-func parseBooleanOrNull(l string) (val PDFObject, s string, ok bool) {
+func (l *lexer) parseBooleanOrNull() (val PDFObject, ok bool) {
 
 	// null, absent object
-	if strings.HasPrefix(l, "null") {
-		logDebugParse.Println("parseBoolean: value = null")
-		return nil, "null", true
+	if l.hasPrefix("null") {
+		l.pos += len("null")
+		return nil, true
 	}
 
 	// boolean true
-	if strings.HasPrefix(l, "true") {
-		logDebugParse.Println("parseBoolean: value = true")
-		return PDFBoolean(true), "true", true
+	if l.hasPrefix("true") {
+		l.pos += len("true")
+		return PDFBoolean(true), true
 	}
 
 	// boolean false
-	if strings.HasPrefix(l, "false") {
-		logDebugParse.Println("parseBoolean: value = false")
-		return PDFBoolean(false), "false", true
+	if l.hasPrefix("false") {
+		l.pos += len("false")
+		return PDFBoolean(false), true
 	}
 
-	return nil, "", false
+	return nil, false
 }
 
-// parseObject parses next PDFObject from string buffer.
-func parseObject(line *string) (PDFObject, error) {
-
-	if noBuf(line) {
-		return nil, errBufNotAvailable
-	}
-
-	l := *line
-
-	logDebugParse.Printf("ParseObject: buf=<%s>\n", l)
+// parseObject parses the next PDFObject.
+func (l *lexer) parseObject() (PDFObject, error) {
 
 	// position to first non whitespace char
-	l, _ = trimLeftSpace(l)
-	if len(l) == 0 {
+	l.skipSpace()
+	if l.eof() {
 		// only whitespace
 		return nil, errBufNotAvailable
 	}
 
-	var value PDFObject
-	var err error
-
-	switch l[0] {
+	switch l.buf[l.pos] {
 
 	case '[': // array
-		logDebugParse.Println("ParseObject: value = Array")
-		pdfArray, err := parseArray(&l)
-		if err != nil {
-			return nil, err
-		}
-		value = *pdfArray
+		return l.parseArray()
 
 	case '/': // name
-		logDebugParse.Println("ParseObject: value = Name Object")
-		nameObj, err := parseName(&l)
-		if err != nil {
-			return nil, err
-		}
-		value = *nameObj
+		return l.parseName()
 
 	case '<': // hex literal or dict
-		value, err = parseHexLiteralOrDict(&l)
-		if err != nil {
-			return nil, err
-		}
+		return l.parseHexLiteralOrDict()
 
 	case '(': // string literal
-		logDebugParse.Printf("ParseObject: value = String Literal: <%s>\n", l)
-		if value, err = parseStringLiteral(&l); err != nil {
-			return nil, err
-		}
-
-	default:
-		var valStr string
-		var ok bool
-		value, valStr, ok = parseBooleanOrNull(l)
-		if ok {
-			l = forwardParseBuf(l, len(valStr))
-			break
-		}
-		// Must be numeric or indirect reference:
-		// int 0 r
-		// int
-		// float
-		if value, err = parseNumericOrIndRef(&l); err != nil {
-			return nil, err
-		}
+		return l.parseStringLiteral()
 
 	}
 
-	logDebugParse.Printf("ParseObject returning %v\n", value)
-
-	*line = l
+	if value, ok := l.parseBooleanOrNull(); ok {
+		return value, nil
+	}
 
-	return value, nil
+	// Must be numeric or indirect reference:
+	// int 0 r
+	// int
+	// float
+	return l.parseNumericOrIndRef()
 }
 
 // parseXRefStreamDict creates a PDFXRefStreamDict out of a PDFStreamDict.
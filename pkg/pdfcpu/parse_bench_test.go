@@ -0,0 +1,188 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var parseSamples = []struct {
+	name string
+	s    string
+}{
+	{"page", "<</Type/Page/Parent 2 0 R/Resources<</Font<</F1 5 0 R/F2 7 0 R/F3 9 0 R>>/XObject<</Image11 11 0 R>>/ProcSet[/PDF/Text/ImageB/ImageC/ImageI]>>/MediaBox[ 0 0 595.32 841.92]/Contents 4 0 R/Group<</Type/Group/S/Transparency/CS/DeviceRGB>>/Tabs/S/StructParents 0>>"},
+	{"pages", "<</Type /Pages /Count 24 /Kids [6 0 R 16 0 R 21 0 R 27 0 R 30 0 R 32 0 R 34 0 R 36 0 R 38 0 R 40 0 R 42 0 R 44 0 R 46 0 R 48 0 R 50 0 R 52 0 R 54 0 R 56 0 R 58 0 R 60 0 R 62 0 R 64 0 R 69 0 R 71 0 R] /MediaBox [0 0 595.2756 841.8898]>>"},
+	{"fontDescriptor", "<</Type/FontDescriptor/FontName/ABCDEF+Helvetica %comment\n/Flags 32/FontBBox[-166 -225 1000 931]/ItalicAngle 0/Ascent 718/Descent -207/CapHeight 718/StemV 88/FontFile2 12 0 R>>"},
+	{"widths", "[278 278 355 556 556 889 667 191 333 333 389 584 278 333 278 278 556 556 556 556 556 556 556 556 556 556 278 278 584 584 584 556 1015 667 667 722 722 667 611 778 722 278 500 667 556 833 722 778 667 778 722 667 611 722 667 944 667 667 611]"},
+	{"strings", "[(abc)(gop\x0aher\\(go)<743EEC2AFD93A438D87F5ED3D51166A8><b7fff0adb814244abd8576d07849be5>(a(b)c) true false null 3.43 -.5]"},
+}
+
+func legacyParse(s string) (PDFObject, error) {
+	return legacyParseObject(&s)
+}
+
+func lexerParse(buf []byte) (PDFObject, error) {
+	l := lexer{buf: buf}
+	return l.parseObject()
+}
+
+func checkEquivalentParse(t *testing.T, b []byte) {
+
+	t.Helper()
+
+	want, wantErr := legacyParse(string(b))
+	got, err := lexerParse(b)
+
+	if (wantErr == nil) != (err == nil) {
+		t.Fatalf("error mismatch for <%s>: legacy: %v, lexer: %v", b, wantErr, err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("result mismatch for <%s>:\nlegacy: %v\nlexer: %v", b, want, got)
+	}
+}
+
+// objectBuffers returns the buffers read.object would parse for all objects of a PDF file.
+func objectBuffers(t testing.TB, fileName string) [][]byte {
+
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bufs [][]byte
+
+	for _, ind := range reObjHeader.FindAllIndex(buf, -1) {
+
+		b := buf[ind[0]:]
+
+		if i := bytes.Index(b, []byte("endobj")); i > 0 {
+			b = b[:i]
+		}
+
+		if i := bytes.Index(b, []byte("stream")); i > 0 {
+			b = b[:i]
+		}
+
+		bufs = append(bufs, b)
+	}
+
+	return bufs
+}
+
+func TestParseLexerEquivalence(t *testing.T) {
+
+	for _, sample := range parseSamples {
+		checkEquivalentParse(t, []byte(sample.s))
+	}
+
+	fileNames, err := filepath.Glob(filepath.Join("..", "api", "testdata", "*.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fileName := range fileNames {
+
+		for _, b := range objectBuffers(t, fileName) {
+
+			s := string(b)
+			wantObjNr, wantGenNr, wantErr := legacyParseObjectAttributes(&s)
+
+			l := lexer{buf: b}
+			objNr, genNr, err := l.parseObjectAttributes()
+
+			if (wantErr == nil) != (err == nil) {
+				t.Fatalf("%s: attributes error mismatch: legacy: %v, lexer: %v", fileName, wantErr, err)
+			}
+
+			if err != nil {
+				continue
+			}
+
+			if *wantObjNr != *objNr || *wantGenNr != *genNr {
+				t.Fatalf("%s: attributes mismatch: legacy: %d %d, lexer: %d %d", fileName, *wantObjNr, *wantGenNr, *objNr, *genNr)
+			}
+
+			checkEquivalentParse(t, l.rest())
+		}
+	}
+}
+
+func BenchmarkParseObject(b *testing.B) {
+
+	for _, sample := range parseSamples {
+
+		buf := []byte(sample.s)
+
+		b.Run(sample.name+"/lexer", func(b *testing.B) {
+			b.ReportAllocs()
+			var l lexer
+			for i := 0; i < b.N; i++ {
+				l.reset(buf)
+				if _, err := l.parseObject(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(sample.name+"/legacy", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// The legacy parser needs a string conversion of the read buffer.
+				if _, err := legacyParse(string(buf)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseFile(b *testing.B) {
+
+	bufs := objectBuffers(b, filepath.Join("..", "api", "testdata", "CenterOfWhy.pdf"))
+
+	b.Run("lexer", func(b *testing.B) {
+		b.ReportAllocs()
+		var l lexer
+		for i := 0; i < b.N; i++ {
+			for _, buf := range bufs {
+				l.reset(buf)
+				if _, _, err := l.parseObjectAttributes(); err != nil {
+					continue
+				}
+				l.parseObject()
+			}
+		}
+	})
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, buf := range bufs {
+				s := string(buf)
+				if _, _, err := legacyParseObjectAttributes(&s); err != nil {
+					continue
+				}
+				legacyParseObject(&s)
+			}
+		}
+	})
+}
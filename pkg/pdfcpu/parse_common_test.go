@@ -18,6 +18,29 @@ package pdfcpu
 
 import "testing"
 
+func noBuf(l *string) bool {
+	return l == nil || len(*l) == 0
+}
+
+// parseObject parses the next PDFObject from line and consumes it.
+func parseObject(line *string) (PDFObject, error) {
+
+	if noBuf(line) {
+		return nil, errBufNotAvailable
+	}
+
+	l := lexer{buf: []byte(*line)}
+
+	value, err := l.parseObject()
+	if err != nil {
+		return nil, err
+	}
+
+	*line = (*line)[l.pos:]
+
+	return value, nil
+}
+
 func doTestParseObjectOK(parseString string, t *testing.T) {
 	//str := parseString
 	_, err := parseObject(&parseString)
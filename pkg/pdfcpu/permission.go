@@ -0,0 +1,223 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PermissionFlags represents user access permissions independent of the security handler revision.
+type PermissionFlags uint16
+
+// The user access permissions, see 7.6.3.2 Table 22.
+const (
+	PermPrint                PermissionFlags = 1 << iota // Print, possibly not at the highest quality level.
+	PermPrintHigh                                        // Print at the highest quality level, implies PermPrint.
+	PermModify                                           // Modify contents other than by PermAnnotate, PermFillForms and PermAssemble.
+	PermExtract                                          // Copy or extract text and graphics.
+	PermExtractAccessibility                             // Extract text and graphics in support of accessibility.
+	PermAnnotate                                         // Add or modify annotations, fill in form fields.
+	PermFillForms                                        // Fill in existing form fields including signature fields.
+	PermAssemble                                         // Insert, rotate or delete pages, create bookmarks or thumbnails.
+
+	PermNone PermissionFlags = 0
+	PermAll                  = PermPrint | PermPrintHigh | PermModify | PermExtract | PermExtractAccessibility |
+		PermAnnotate | PermFillForms | PermAssemble
+)
+
+// permissionFlags maps named permissions to their bits in P for security handler revisions >= 3 and 2.
+// Revision 2 knows about bits 3-6 only which cover more than one permission each.
+var permissionFlags = []struct {
+	flag       PermissionFlags
+	name       string
+	bit, bitR2 uint
+}{
+	{PermPrint, "print", 3, 3},
+	{PermPrintHigh, "print-high", 12, 3},
+	{PermModify, "modify", 4, 4},
+	{PermExtract, "extract", 5, 5},
+	{PermExtractAccessibility, "extract-accessibility", 10, 5},
+	{PermAnnotate, "annotate", 6, 6},
+	{PermFillForms, "fill-forms", 9, 6},
+	{PermAssemble, "assemble", 11, 4},
+}
+
+func permissionBit(bit uint) int {
+	return 1 << (bit - 1)
+}
+
+// ParsePermissionFlags parses a comma separated list of permission names or one of "none" and "all".
+func ParsePermissionFlags(s string) (PermissionFlags, error) {
+
+	switch s {
+	case "", "none":
+		return PermNone, nil
+	case "all":
+		return PermAll, nil
+	}
+
+	var f PermissionFlags
+
+	for _, n := range strings.Split(s, ",") {
+
+		n = strings.TrimSpace(n)
+		found := false
+
+		for _, pf := range permissionFlags {
+			if pf.name == n {
+				f |= pf.flag
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return PermNone, errors.Errorf("unknown permission: %s", n)
+		}
+	}
+
+	return f, nil
+}
+
+// String returns a comma separated list of permission names.
+func (f PermissionFlags) String() string {
+
+	switch f {
+	case PermNone:
+		return "none"
+	case PermAll:
+		return "all"
+	}
+
+	var ss []string
+
+	for _, pf := range permissionFlags {
+		if f&pf.flag > 0 {
+			ss = append(ss, pf.name)
+		}
+	}
+
+	return strings.Join(ss, ",")
+}
+
+// UserAccessPermissions returns P as expected by Configuration.UserAccessPermissions.
+func (f PermissionFlags) UserAccessPermissions() int16 {
+
+	if f == PermAll {
+		return PermissionsAll
+	}
+
+	if f&PermPrintHigh > 0 {
+		f |= PermPrint
+	}
+
+	p := int(PermissionsNone)
+
+	for _, pf := range permissionFlags {
+		if f&pf.flag > 0 {
+			p |= permissionBit(pf.bit)
+		}
+	}
+
+	return int16(p)
+}
+
+// r2UserAccessPermissions adds the revision 2 bits covering the permissions of p
+// which uses the layout of revisions >= 3.
+func r2UserAccessPermissions(p int16) int16 {
+
+	f := PermissionFlagsFor(int(p), 3)
+
+	for _, pf := range permissionFlags {
+		if f&pf.flag > 0 {
+			p |= int16(permissionBit(pf.bitR2))
+		}
+	}
+
+	return p
+}
+
+// PermissionFlagsFor returns the permissions granted by P for security handler revision r.
+func PermissionFlagsFor(p, r int) PermissionFlags {
+
+	var f PermissionFlags
+
+	for _, pf := range permissionFlags {
+		bit := pf.bit
+		if r < 3 {
+			bit = pf.bitR2
+		}
+		if p&permissionBit(bit) > 0 {
+			f |= pf.flag
+		}
+	}
+
+	if r < 3 {
+		return f
+	}
+
+	// High quality printing requires printing.
+	if f&PermPrint == 0 {
+		f &^= PermPrintHigh
+	}
+
+	// Bit 6 includes filling in forms, bit 4 includes assembling, bit 5 includes extracting for accessibility.
+	if f&PermAnnotate > 0 {
+		f |= PermFillForms
+	}
+
+	if f&PermModify > 0 {
+		f |= PermAssemble
+	}
+
+	if f&PermExtract > 0 {
+		f |= PermExtractAccessibility
+	}
+
+	return f
+}
+
+// UserPermissionFlags returns the user access permissions of a PDF file.
+func UserPermissionFlags(ctx *PDFContext) PermissionFlags {
+
+	if ctx.E == nil {
+		return PermAll
+	}
+
+	return PermissionFlagsFor(ctx.E.P, ctx.E.R)
+}
+
+// Permissions returns a list of the user access permissions of a PDF file.
+func Permissions(ctx *PDFContext) (list []string) {
+
+	if ctx.E == nil {
+		return append(list, "full access")
+	}
+
+	f := UserPermissionFlags(ctx)
+
+	list = append(list, fmt.Sprintf("P: %d (security handler revision %d)", ctx.E.P, ctx.E.R))
+
+	for _, pf := range permissionFlags {
+		list = append(list, fmt.Sprintf("%-21s: %t", pf.name, f&pf.flag > 0))
+	}
+
+	return list
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import "testing"
+
+func TestParsePermissionFlags(t *testing.T) {
+
+	for _, tt := range []struct {
+		s    string
+		want PermissionFlags
+	}{
+		{"none", PermNone},
+		{"all", PermAll},
+		{"print,fill-forms", PermPrint | PermFillForms},
+		{"print-high, extract-accessibility,assemble", PermPrintHigh | PermExtractAccessibility | PermAssemble},
+		{"print,print-high,modify,extract,extract-accessibility,annotate,fill-forms,assemble", PermAll},
+	} {
+		f, err := ParsePermissionFlags(tt.s)
+		if err != nil {
+			t.Fatalf("%s: %v\n", tt.s, err)
+		}
+		if f != tt.want {
+			t.Fatalf("%s: want %s, got %s\n", tt.s, tt.want, f)
+		}
+		if g, _ := ParsePermissionFlags(f.String()); g != f {
+			t.Fatalf("%s: String() does not round trip: %s\n", tt.s, f)
+		}
+	}
+
+	if _, err := ParsePermissionFlags("print,copy"); err == nil {
+		t.Fatal("unknown permission should fail")
+	}
+}
+
+func TestUserAccessPermissions(t *testing.T) {
+
+	for _, tt := range []struct {
+		f      PermissionFlags
+		p      int16 // Revision 3+
+		pR2    int16 // Revision 2
+		r3, r2 PermissionFlags
+	}{
+		{PermNone, PermissionsNone, PermissionsNone, PermNone, PermNone},
+		{PermAll, PermissionsAll, PermissionsAll, PermAll, PermAll},
+		{
+			PermPrint | PermFillForms,
+			PermissionsNone | 0x0004 | 0x0100,
+			PermissionsNone | 0x0004 | 0x0100 | 0x0020,
+			PermPrint | PermFillForms,
+			PermPrint | PermPrintHigh | PermAnnotate | PermFillForms,
+		},
+		{
+			// High quality printing implies printing.
+			PermPrintHigh,
+			PermissionsNone | 0x0004 | 0x0800,
+			PermissionsNone | 0x0004 | 0x0800,
+			PermPrint | PermPrintHigh,
+			PermPrint | PermPrintHigh,
+		},
+		{
+			// Modify includes assembling, extract includes extracting for accessibility.
+			PermModify | PermExtract,
+			PermissionsNone | 0x0008 | 0x0010,
+			PermissionsNone | 0x0008 | 0x0010,
+			PermModify | PermAssemble | PermExtract | PermExtractAccessibility,
+			PermModify | PermAssemble | PermExtract | PermExtractAccessibility,
+		},
+		{
+			PermAssemble | PermExtractAccessibility,
+			PermissionsNone | 0x0400 | 0x0200,
+			PermissionsNone | 0x0400 | 0x0200 | 0x0008 | 0x0010,
+			PermAssemble | PermExtractAccessibility,
+			PermModify | PermAssemble | PermExtract | PermExtractAccessibility,
+		},
+	} {
+		p := tt.f.UserAccessPermissions()
+		if p != tt.p {
+			t.Fatalf("%s: want P=%#x, got %#x\n", tt.f, uint16(tt.p), uint16(p))
+		}
+		if pR2 := r2UserAccessPermissions(p); pR2 != tt.pR2 {
+			t.Fatalf("%s: want P=%#x for R2, got %#x\n", tt.f, uint16(tt.pR2), uint16(pR2))
+		}
+		if f := PermissionFlagsFor(int(p), 4); f != tt.r3 {
+			t.Fatalf("%s: want %s for R4, got %s\n", tt.f, tt.r3, f)
+		}
+		if f := PermissionFlagsFor(int(r2UserAccessPermissions(p)), 2); f != tt.r2 {
+			t.Fatalf("%s: want %s for R2, got %s\n", tt.f, tt.r2, f)
+		}
+	}
+}
+
+func TestHasNeededPermissions(t *testing.T) {
+
+	for _, tt := range []struct {
+		mode CommandMode
+		p, r int
+		want bool
+	}{
+		{VALIDATE, int(PermissionsNone), 4, true},
+		{EXTRACTIMAGES, int(PermissionsNone) | 0x0200, 4, true},
+		{EXTRACTIMAGES, int(PermissionsNone) | 0x0010, 4, false},
+		{EXTRACTIMAGES, int(PermissionsNone) | 0x0010, 2, true},
+		{ADDATTACHMENTS, int(PermissionsNone) | 0x0400, 4, true},
+		{ADDATTACHMENTS, int(PermissionsNone) | 0x0008, 4, false},
+		{REMOVEATTACHMENTS, int(PermissionsNone) | 0x0008, 2, true},
+		{TRIM, int(PermissionsNone) | 0x0200, 4, false},
+	} {
+		if got := hasNeededPermissions(tt.mode, &Enc{P: tt.p, R: tt.r}); got != tt.want {
+			t.Fatalf("mode %d P=%#x R=%d: want %t, got %t\n", tt.mode, uint16(tt.p), tt.r, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,608 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/rc2"
+	"github.com/pkg/errors"
+)
+
+// => 7.6.5 Public-Key Security Handlers
+//
+// The file encryption key is derived from a random 20 byte seed which is handed out to each recipient
+// along with the recipient's permissions as CMS enveloped data encrypted for the recipient's certificate.
+// Recipients sharing the same permissions share the same enveloped data.
+
+// Recipient is a certificate a file gets encrypted for along with the user access permissions granted.
+type Recipient struct {
+	Cert        *x509.Certificate
+	Permissions int16
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRC2CBC        = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 2}
+	oidDESEDE3CBC    = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// RFC 5652 ContentInfo
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+// RFC 5652 EnvelopedData
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []keyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+// RFC 5652 KeyTransRecipientInfo
+type keyTransRecipientInfo struct {
+	Version                int
+	Rid                    asn1.RawValue // IssuerAndSerialNumber or [0] SubjectKeyIdentifier
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue // [0] IMPLICIT OCTET STRING
+}
+
+// RFC 2268 RC2-CBC parameters
+type rc2CBCParameter struct {
+	Version int `asn1:"optional"`
+	IV      []byte
+}
+
+var errNotARecipient = errors.New("not a recipient")
+
+// identifiesCertificate returns true if id being an IssuerAndSerialNumber or a [0] SubjectKeyIdentifier refers to cert.
+func identifiesCertificate(id asn1.RawValue, cert *x509.Certificate) bool {
+
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return bytes.Equal(id.Bytes, cert.SubjectKeyId)
+	}
+
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return false
+	}
+
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+func (ri keyTransRecipientInfo) matches(cert *x509.Certificate) bool {
+	return identifiesCertificate(ri.Rid, cert)
+}
+
+// rc2EffectiveKeyBits maps an RC2 parameter version to the effective key length.
+func rc2EffectiveKeyBits(version int) int {
+
+	switch version {
+	case 160:
+		return 40
+	case 120:
+		return 64
+	case 58:
+		return 128
+	}
+
+	if version >= 256 {
+		return version
+	}
+
+	return 32
+}
+
+func contentCipher(alg pkix.AlgorithmIdentifier, key []byte) (cipher.Block, []byte, error) {
+
+	var iv []byte
+
+	switch {
+
+	case alg.Algorithm.Equal(oidRC2CBC):
+		var p rc2CBCParameter
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &p); err != nil {
+			// Parameters may consist of the IV only.
+			if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &p.IV); err != nil {
+				return nil, nil, err
+			}
+		}
+		c, err := rc2.New(key, rc2EffectiveKeyBits(p.Version))
+		return c, p.IV, err
+
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil {
+			return nil, nil, err
+		}
+		c, err := des.NewTripleDESCipher(key)
+		return c, iv, err
+
+	case alg.Algorithm.Equal(oidAES128CBC), alg.Algorithm.Equal(oidAES192CBC), alg.Algorithm.Equal(oidAES256CBC):
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil {
+			return nil, nil, err
+		}
+		c, err := aes.NewCipher(key)
+		return c, iv, err
+
+	}
+
+	return nil, nil, errors.Errorf("unsupported content encryption algorithm %v", alg.Algorithm)
+}
+
+// decryptEnvelope returns the content of CMS enveloped data encrypted for the certificate of kp.
+func decryptEnvelope(b []byte, kp *KeyPair) ([]byte, error) {
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, err
+	}
+
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, errors.Errorf("unexpected content type %v", ci.ContentType)
+	}
+
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, err
+	}
+
+	var ri *keyTransRecipientInfo
+	for i := range ed.RecipientInfos {
+		if ed.RecipientInfos[i].matches(kp.Cert) {
+			ri = &ed.RecipientInfos[i]
+			break
+		}
+	}
+
+	if ri == nil {
+		return nil, errNotARecipient
+	}
+
+	decrypter, ok := kp.Key.(crypto.Decrypter)
+	if !ok || !ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption) {
+		return nil, errors.Errorf("unsupported key encryption algorithm %v", ri.KeyEncryptionAlgorithm.Algorithm)
+	}
+
+	key, err := decrypter.Decrypt(rand.Reader, ri.EncryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	eci := ed.EncryptedContentInfo
+
+	c, iv, err := contentCipher(eci.ContentEncryptionAlgorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decrypt a copy since the recipients' bytes also go into the file encryption key.
+	data := append([]byte{}, eci.EncryptedContent.Bytes...)
+
+	// The encrypted content may be split up into a constructed octet string.
+	if eci.EncryptedContent.IsCompound {
+		var buf bytes.Buffer
+		for rest := data; len(rest) > 0; {
+			var part []byte
+			if rest, err = asn1.Unmarshal(rest, &part); err != nil {
+				return nil, err
+			}
+			buf.Write(part)
+		}
+		data = buf.Bytes()
+	}
+
+	if len(iv) != c.BlockSize() || len(data) == 0 || len(data)%c.BlockSize() > 0 {
+		return nil, errors.New("corrupt encrypted content")
+	}
+
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(data, data)
+
+	// Remove PKCS#7 padding.
+	n := int(data[len(data)-1])
+	if n == 0 || n > c.BlockSize() {
+		return nil, errors.New("corrupt encrypted content padding")
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// encryptEnvelope returns CMS enveloped data holding content encrypted for all certs using AES-256.
+func encryptEnvelope(content []byte, certs []*x509.Certificate) ([]byte, error) {
+
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+
+	for _, b := range [][]byte{key, iv} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	n := aes.BlockSize - len(content)%aes.BlockSize
+	data := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(data, data)
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	ed := envelopedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidAES256CBC,
+				Parameters: asn1.RawValue{FullBytes: ivParam},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: data},
+		},
+	}
+
+	for _, cert := range certs {
+
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("recipient %s: only RSA keys are supported", cert.Subject.CommonName)
+		}
+
+		encKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+
+		rid, err := asn1.Marshal(issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ed.RecipientInfos = append(ed.RecipientInfos, keyTransRecipientInfo{
+			Rid: asn1.RawValue{FullBytes: rid},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidRSAEncryption,
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedKey: encKey,
+		})
+	}
+
+	b, err := asn1.Marshal(ed)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// pubSecFileKey derives the file encryption key from seed (Algorithm 7.6.5.3).
+func pubSecFileKey(e *Enc, seed []byte) []byte {
+
+	var h hash.Hash = sha1.New()
+	if e.L == 256 {
+		h = sha256.New()
+	}
+
+	h.Write(seed)
+
+	for _, r := range e.Recipients {
+		h.Write(r)
+	}
+
+	if !e.Emd {
+		h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+
+	return h.Sum(nil)[:e.L/8]
+}
+
+// pubSecKey returns the file encryption key using the key pair of a recipient and sets the recipient's permissions.
+func pubSecKey(ctx *PDFContext) ([]byte, error) {
+
+	kp := ctx.KeyPair
+	if kp == nil {
+		return nil, errors.New("public-key encryption: missing key pair of recipient")
+	}
+
+	e := ctx.E
+
+	for _, r := range e.Recipients {
+
+		b, err := decryptEnvelope(r, kp)
+		if err == errNotARecipient {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "public-key encryption")
+		}
+
+		if len(b) < 24 {
+			return nil, errors.New("public-key encryption: corrupt recipient seed")
+		}
+
+		e.P = int(int32(binary.BigEndian.Uint32(b[20:24])))
+		log.Debug.Printf("pubSecKey: recipient permissions: %d\n", e.P)
+
+		return pubSecFileKey(e, b[:20]), nil
+	}
+
+	return nil, errors.Errorf("public-key encryption: %s is not a recipient", kp.Cert.Subject.CommonName)
+}
+
+func recipientBytes(obj PDFObject) ([]byte, error) {
+
+	switch o := obj.(type) {
+	case PDFStringLiteral:
+		return Unescape(o.Value())
+	case PDFHexLiteral:
+		return o.Bytes()
+	}
+
+	return nil, errors.Errorf("unsupported encryption: corrupt \"Recipients\" entry %v", obj)
+}
+
+// pubSecKeyLength returns the key length in bits for the encrypt dict or the crypt filter dict cf.
+func pubSecKeyLength(dict, cf *PDFDict) (int, error) {
+
+	if cf == dict {
+		return length(dict)
+	}
+
+	if cfm := cf.NameEntry("CFM"); cfm != nil {
+		switch *cfm {
+		case "AESV3":
+			return 256, nil
+		case "AESV2":
+			return 128, nil
+		}
+	}
+
+	// The crypt filter key length is given in bytes, some writers use bits though.
+	l := cf.IntEntry("Length")
+	if l == nil {
+		return length(dict)
+	}
+
+	if *l <= 16 {
+		return *l * 8, nil
+	}
+
+	return *l, nil
+}
+
+// supportedPubSecEncryption returns the attributes of a public-key security handler encrypt dict.
+func supportedPubSecEncryption(ctx *PDFContext, dict *PDFDict) (*Enc, error) {
+
+	subFilter := dict.NameEntry("SubFilter")
+	if subFilter == nil || *subFilter != "adbe.pkcs7.s4" && *subFilter != "adbe.pkcs7.s5" {
+		return nil, errors.New("unsupported encryption: \"SubFilter\" must be adbe.pkcs7.s4 or adbe.pkcs7.s5")
+	}
+
+	v, err := checkV(ctx, dict)
+	if err != nil {
+		return nil, err
+	}
+
+	// Permissions are given per recipient and interpreted like for security handler revisions >= 3.
+	enc := &Enc{PubSec: true, R: 4, V: *v, Emd: true}
+
+	if emd := dict.BooleanEntry("EncryptMetadata"); emd != nil {
+		enc.Emd = *emd
+	}
+
+	if err = cryptFilters(dict, enc); err != nil {
+		return nil, err
+	}
+
+	// adbe.pkcs7.s4 lists the recipients in the encrypt dict,
+	// adbe.pkcs7.s5 in the crypt filter used for streams.
+	d := dict
+
+	if *subFilter == "adbe.pkcs7.s5" {
+
+		// The crypt filter used for streams unless restricted to embedded files.
+		cf := enc.StmF
+		if cf == "Identity" {
+			cf = enc.EFF
+		}
+
+		cfDict := dict.PDFDictEntry("CF")
+		if cfDict == nil || cfDict.PDFDictEntry(cf) == nil {
+			return nil, errors.New("unsupported encryption: missing crypt filter")
+		}
+		d = cfDict.PDFDictEntry(cf)
+
+		if emd := d.BooleanEntry("EncryptMetadata"); emd != nil {
+			enc.Emd = *emd
+		}
+	}
+
+	enc.L, err = pubSecKeyLength(dict, d)
+	if err != nil {
+		return nil, err
+	}
+
+	a := d.PDFArrayEntry("Recipients")
+	if a == nil || len(*a) == 0 {
+		return nil, errors.New("unsupported encryption: required entry \"Recipients\" missing")
+	}
+
+	for _, obj := range *a {
+		b, err := recipientBytes(obj)
+		if err != nil {
+			return nil, err
+		}
+		enc.Recipients = append(enc.Recipients, b)
+	}
+
+	return enc, nil
+}
+
+// newPubSecEncryptDict creates a new EncryptDict using the public-key security handler.
+func newPubSecEncryptDict(needAES bool, keyLength int, recipients [][]byte, encryptMetadata bool) *PDFDict {
+
+	d := NewPDFDict()
+
+	d.Insert("Filter", PDFName("Adobe.PubSec"))
+	d.Insert("SubFilter", PDFName("adbe.pkcs7.s5"))
+	d.Insert("Length", PDFInteger(keyLength))
+
+	if keyLength == 256 {
+		d.Insert("V", PDFInteger(5))
+	} else {
+		d.Insert("V", PDFInteger(4))
+	}
+
+	d.Insert("StmF", PDFName("DefaultCryptFilter"))
+	d.Insert("StrF", PDFName("DefaultCryptFilter"))
+
+	d1 := NewPDFDict()
+	d1.Insert("AuthEvent", PDFName("DocOpen"))
+
+	switch {
+	case keyLength == 256:
+		d1.Insert("CFM", PDFName("AESV3"))
+	case needAES:
+		d1.Insert("CFM", PDFName("AESV2"))
+	default:
+		d1.Insert("CFM", PDFName("V2"))
+	}
+
+	d1.Insert("Length", PDFInteger(keyLength/8))
+	d1.Insert("EncryptMetadata", PDFBoolean(encryptMetadata))
+
+	a := PDFArray{}
+	for _, r := range recipients {
+		a = append(a, PDFHexLiteral(hex.EncodeToString(r)))
+	}
+	d1.Insert("Recipients", a)
+
+	d2 := NewPDFDict()
+	d2.Insert("DefaultCryptFilter", d1)
+
+	d.Insert("CF", d2)
+
+	return &d
+}
+
+// setupPubSecEncryption encrypts for ctx.Recipients.
+func setupPubSecEncryption(ctx *PDFContext) error {
+
+	keyLength := encryptKeyLength(ctx)
+	if keyLength < 128 {
+		return errors.New("encrypt: public-key encryption requires 128 or 256 bit keys")
+	}
+
+	seed := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return err
+	}
+
+	// Recipients sharing the same permissions share the enveloped data.
+	var perms []int16
+	certs := map[int16][]*x509.Certificate{}
+
+	for _, r := range ctx.Recipients {
+		if _, ok := certs[r.Permissions]; !ok {
+			perms = append(perms, r.Permissions)
+		}
+		certs[r.Permissions] = append(certs[r.Permissions], r.Cert)
+	}
+
+	e := &Enc{PubSec: true, R: 4, V: 4, L: keyLength, Emd: !ctx.UnencryptedMetadata}
+	if keyLength == 256 {
+		e.V = 5
+	}
+
+	for _, p := range perms {
+
+		content := make([]byte, 24)
+		copy(content, seed)
+		binary.BigEndian.PutUint32(content[20:], uint32(int32(p)))
+
+		b, err := encryptEnvelope(content, certs[p])
+		if err != nil {
+			return errors.Wrap(err, "encrypt")
+		}
+
+		e.Recipients = append(e.Recipients, b)
+	}
+
+	dict := newPubSecEncryptDict(ctx.EncryptUsingAES, keyLength, e.Recipients, e.Emd)
+	setCryptFilterEntries(dict, "DefaultCryptFilter", true, ctx.EncryptEmbeddedFilesOnly)
+
+	if err := cryptFilters(dict, e); err != nil {
+		return err
+	}
+
+	ctx.E = e
+	ctx.EncKey = pubSecFileKey(e, seed)
+	ctx.AES4Strings = ctx.EncryptUsingAES
+	ctx.AES4Streams = ctx.EncryptUsingAES
+	ctx.AES4EmbeddedStreams = ctx.EncryptUsingAES
+
+	if keyLength == 256 {
+		if err := ensureAES256Extension(ctx); err != nil {
+			return err
+		}
+	}
+
+	return insertEncryptDict(ctx, dict)
+}
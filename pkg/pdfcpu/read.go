@@ -24,6 +24,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
 	"github.com/iPaladinLLC/pdfcpu/pkg/log"
@@ -46,10 +47,39 @@ func ReadPDFFile(fileName string, config *Configuration) (*PDFContext, error) {
 	}
 
 	defer func() {
-		file.Close()
+		if file != nil {
+			file.Close()
+		}
 	}()
 
-	ctx, err := NewPDFContext(fileName, file, config)
+	ctx, err := ReadPDF(file, fileName, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Lazy || ctx.Incremental {
+		// Keep the file open for loading objects on demand or for copying it on incremental writing.
+		ctx.Read.closer, file = file, nil
+	}
+
+	log.Debug.Println("readPDFFile: end")
+
+	return ctx, nil
+}
+
+// ReadPDF reads in a PDF from rs and generates a PDFContext, an in-memory representation containing a cross reference table.
+// fileName is used for reporting only and may be empty.
+// For lazy reading and incremental writing rs needs to remain readable until writing.
+func ReadPDF(rs io.ReadSeeker, fileName string, config *Configuration) (*PDFContext, error) {
+
+	log.Debug.Println("ReadPDF: begin")
+
+	fileSize, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := NewPDFContext(fileName, rs, fileSize, config)
 	if err != nil {
 		return nil, err
 	}
@@ -63,17 +93,54 @@ func ReadPDFFile(fileName string, config *Configuration) (*PDFContext, error) {
 	// Populate xRefTable.
 	err = readXRefTable(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "xRefTable failed")
+		if err := ctx.cancelled(); err != nil {
+			return nil, err
+		}
+		// Try to rebuild xRefTable by scanning the file.
+		log.Info.Printf("xRefTable failed: %v\n", err)
+		if err = recoverXRefTable(ctx); err != nil {
+			return nil, errors.Wrap(err, "xRefTable failed")
+		}
 	}
 
 	// Make all objects explicitly available (load into memory) in corresponding xRefTable entries.
 	// Also decode any involved object streams.
-	err = dereferenceXRefTable(ctx, config)
+	err = dereferenceXRefTable(ctx, ctx.Configuration)
+	if err != nil && errors.Cause(err) == errObjectNotAtOffset && !ctx.Read.Recovered {
+		// The xref table parsed fine but points to wrong offsets.
+		log.Info.Printf("dereferenceXRefTable failed: %v\n", err)
+		if err = recoverXRefTable(ctx); err != nil {
+			return nil, errors.Wrap(err, "xRefTable failed")
+		}
+		err = dereferenceXRefTable(ctx, ctx.Configuration)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debug.Println("readPDFFile: end")
+	log.Debug.Println("ReadPDF: end")
+
+	return ctx, nil
+}
+
+// ReadRevisions reads the cross reference sections of a PDF from rs in order to identify its revisions.
+// No objects get parsed or decrypted, so no passwords are needed.
+// rs needs to remain readable for writing revisions, see WriteRevision.
+func ReadRevisions(rs io.ReadSeeker, fileName string, config *Configuration) (*PDFContext, error) {
+
+	fileSize, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := NewPDFContext(fileName, rs, fileSize, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = readXRefTable(ctx); err != nil {
+		return nil, errors.Wrap(err, "revisions unavailable for files with a damaged cross reference table")
+	}
 
 	return ctx, nil
 }
@@ -125,6 +192,35 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return 0, nil, nil
 }
 
+// readSeekerAt adapts an io.ReadSeeker to io.ReaderAt.
+type readSeekerAt struct {
+	io.ReadSeeker
+}
+
+func (r readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// readerAt returns rs as io.ReaderAt, wrapping it if necessary.
+func readerAt(rs io.ReadSeeker) io.ReaderAt {
+
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return ra
+	}
+
+	return readSeekerAt{rs}
+}
+
 func newPositionedReader(rs io.ReadSeeker, offset *int64) (*bufio.Reader, error) {
 
 	if _, err := rs.Seek(*offset, 0); err != nil {
@@ -178,21 +274,28 @@ func offsetLastXRefSection(ra io.ReaderAt, fileSize int64) (*int64, error) {
 }
 
 // Read next subsection entry and generate corresponding xref table entry.
-func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber int) error {
+func parseXRefTableEntry(s *bufio.Scanner, ctx *PDFContext, objectNumber int) error {
 
 	log.Debug.Println("parseXRefTableEntry: begin")
 
+	xRefTable := ctx.XRefTable
+
 	line, err := scanLine(s)
 	if err != nil {
 		return err
 	}
 
+	fields := strings.Fields(line)
+
 	if xRefTable.Exists(objectNumber) {
+		// Superseded by a later revision but still touched by this one.
+		if len(fields) == 3 && (fields[2] == "f" || fields[2] == "n" && strings.Trim(fields[0], "0") != "") {
+			ctx.Read.recordXRefEntry(objectNumber, fields[2] == "f")
+		}
 		log.Debug.Printf("parseXRefTableEntry: end - Skip entry %d - already assigned\n", objectNumber)
 		return nil
 	}
 
-	fields := strings.Fields(line)
 	if len(fields) != 3 ||
 		len(fields[0]) != 10 || len(fields[1]) != 5 || len(fields[2]) != 1 {
 		return errors.New("parseXRefTableEntry: corrupt xref subsection header")
@@ -213,6 +316,10 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 		return errors.New("parseXRefTableEntry: corrupt xref subsection entry")
 	}
 
+	if entryType == "f" || offset > 0 {
+		ctx.Read.recordXRefEntry(objectNumber, entryType == "f")
+	}
+
 	var xRefTableEntry XRefTableEntry
 
 	if entryType == "n" {
@@ -256,7 +363,7 @@ func parseXRefTableEntry(s *bufio.Scanner, xRefTable *XRefTable, objectNumber in
 }
 
 // Process xRef table subsection and create corrresponding xRef table entries.
-func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []string) error {
+func parseXRefTableSubSection(s *bufio.Scanner, ctx *PDFContext, fields []string) error {
 
 	log.Debug.Println("parseXRefTableSubSection: begin")
 
@@ -274,7 +381,7 @@ func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []s
 
 	// Process all entries of this subsection into xRefTable entries.
 	for i := 0; i < objCount; i++ {
-		if err = parseXRefTableEntry(s, xRefTable, startObjNumber+i); err != nil {
+		if err = parseXRefTableEntry(s, ctx, startObjNumber+i); err != nil {
 			return err
 		}
 	}
@@ -285,11 +392,11 @@ func parseXRefTableSubSection(s *bufio.Scanner, xRefTable *XRefTable, fields []s
 }
 
 // Parse compressed object.
-func compressedObject(s string) (PDFObject, error) {
+func compressedObject(l *lexer) (PDFObject, error) {
 
 	log.Debug.Println("compressedObject: begin")
 
-	pdfObject, err := parseObject(&s)
+	pdfObject, err := l.parseObject()
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +426,7 @@ func parseObjectStream(objectStreamDict *PDFObjectStreamDict) error {
 	decodedContent := objectStreamDict.Content
 	prolog := decodedContent[:objectStreamDict.FirstObjOffset]
 
-	objs := strings.Fields(string(prolog))
+	objs := bytes.Fields(prolog)
 	if len(objs)%2 > 0 {
 		return errors.New("parseObjectStream: corrupt object stream dict")
 	}
@@ -330,9 +437,12 @@ func parseObjectStream(objectStreamDict *PDFObjectStreamDict) error {
 
 	var offsetOld int
 
+	// All objects share one lexer.
+	var l lexer
+
 	for i := 0; i < len(objs); i += 2 {
 
-		offset, err := strconv.Atoi(objs[i+1])
+		offset, err := atoi(objs[i+1])
 		if err != nil {
 			return err
 		}
@@ -340,9 +450,8 @@ func parseObjectStream(objectStreamDict *PDFObjectStreamDict) error {
 		offset += objectStreamDict.FirstObjOffset
 
 		if i > 0 {
-			dstr := string(decodedContent[offsetOld:offset])
-			log.Debug.Printf("parseObjectStream: objString = %s\n", dstr)
-			pdfObject, err := compressedObject(dstr)
+			l.reset(decodedContent[offsetOld:offset])
+			pdfObject, err := compressedObject(&l)
 			if err != nil {
 				return err
 			}
@@ -352,9 +461,8 @@ func parseObjectStream(objectStreamDict *PDFObjectStreamDict) error {
 		}
 
 		if i == len(objs)-2 {
-			dstr := string(decodedContent[offset:])
-			log.Debug.Printf("parseObjectStream: objString = %s\n", dstr)
-			pdfObject, err := compressedObject(dstr)
+			l.reset(decodedContent[offset:])
+			pdfObject, err := compressedObject(&l)
 			if err != nil {
 				return err
 			}
@@ -471,6 +579,8 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xRefStreamDict PDFXRefStr
 
 		}
 
+		ctx.Read.recordXRefEntry(objectNumber, xRefTableEntry.Free)
+
 		if ctx.XRefTable.Exists(objectNumber) {
 			log.Debug.Printf("extractXRefTableEntriesFromXRefStream: Skip entry %d - already assigned\n", objectNumber)
 		} else {
@@ -532,8 +642,6 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *PDFContext) (prevOffset *
 
 	log.Debug.Printf("parseXRefStream: endInd=%[1]d(%[1]x) streamInd=%[2]d(%[2]x)\n", endInd, streamInd)
 
-	line := string(buf)
-
 	// We expect a stream and therefore "stream" before "endobj" if "endobj" within buffer.
 	// There is no guarantee that "endobj" is contained in this buffer for large streams!
 	if streamInd < 0 || (endInd > 0 && endInd < streamInd) {
@@ -541,9 +649,9 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *PDFContext) (prevOffset *
 	}
 
 	// Init object parse buf.
-	l := line[:streamInd]
+	l := lexer{buf: buf[:streamInd]}
 
-	objectNumber, generationNumber, err := parseObjectAttributes(&l)
+	objectNumber, generationNumber, err := l.parseObjectAttributes()
 	if err != nil {
 		return nil, err
 	}
@@ -551,7 +659,7 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *PDFContext) (prevOffset *
 	// parse this object
 	log.Debug.Printf("parseXRefStream: xrefstm obj#:%d gen:%d\n", *objectNumber, *generationNumber)
 	log.Debug.Printf("parseXRefStream: dereferencing object %d\n", *objectNumber)
-	pdfObject, err := parseObject(&l)
+	pdfObject, err := l.parseObject()
 	if err != nil {
 		return nil, errors.Wrapf(err, "parseXRefStream: no pdfObject")
 	}
@@ -586,6 +694,8 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *PDFContext) (prevOffset *
 
 	log.Debug.Printf("parseXRefStream: Insert new xRefTable entry for Object %d\n", *objectNumber)
 
+	ctx.Read.recordXRefEntry(*objectNumber, false)
+
 	ctx.Table[*objectNumber] = &entry
 	ctx.Read.XRefStreams[*objectNumber] = true
 	prevOffset = pdfXRefStreamDict.PreviousOffset
@@ -600,7 +710,7 @@ func parseHybridXRefStream(offset *int64, ctx *PDFContext) error {
 
 	log.Debug.Println("parseHybridXRefStream: begin")
 
-	rd, err := newPositionedReader(ctx.Read.File, offset)
+	rd, err := newPositionedReader(ctx.Read.rs, offset)
 	if err != nil {
 		return err
 	}
@@ -733,50 +843,60 @@ func parseTrailerDict(trailerDict PDFDict, ctx *PDFContext) (*int64, error) {
 }
 
 func scanLine(s *bufio.Scanner) (string, error) {
+	b, err := scanLineBytes(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// scanLineBytes returns the next non empty line.
+// The result is only valid until the next call to s.Scan.
+func scanLineBytes(s *bufio.Scanner) ([]byte, error) {
 	for i := 0; i <= 1; i++ {
 		if ok := s.Scan(); !ok {
 			err := s.Err()
 			if err != nil {
-				return "", err
+				return nil, err
 			}
-			return "", errors.New("scanner: returning nothing")
+			return nil, errors.New("scanner: returning nothing")
 		}
-		if len(s.Text()) > 0 {
+		if len(s.Bytes()) > 0 {
 			break
 		}
 	}
-	return s.Text(), nil
+	return s.Bytes(), nil
 }
 
-func scanTrailerDict(s *bufio.Scanner, startTag bool) (string, error) {
+// scanTrailerDict appends lines to buf until the trailer dict is complete.
+func scanTrailerDict(s *bufio.Scanner, buf *bytes.Buffer, startTag bool) error {
 
-	var buf bytes.Buffer
-	var line string
+	var line []byte
 	var err error
 
 	if !startTag {
 		// scan for dict start tag <<
-		for strings.Index(line, "<<") < 0 {
-			line, err = scanLine(s)
+		for bytes.Index(line, []byte("<<")) < 0 {
+			line, err = scanLineBytes(s)
 			if err != nil {
-				return "", err
+				return err
 			}
-			buf.WriteString(line)
-			buf.WriteString(" ")
+			buf.Write(line)
+			buf.WriteByte(' ')
 		}
 	}
 
 	// scan for dict end tag >>
-	for strings.Index(line, ">>") < 0 {
-		line, err = scanLine(s)
+	for bytes.Index(line, []byte(">>")) < 0 {
+		line, err = scanLineBytes(s)
 		if err != nil {
-			return "", err
+			return err
 		}
-		buf.WriteString(line)
-		buf.WriteString(" ")
+		buf.Write(line)
+		buf.WriteByte(' ')
 	}
 
-	return buf.String(), nil
+	return nil
 }
 
 // Parse xRef section into corresponding number of xRef table entries.
@@ -796,7 +916,7 @@ func parseXRefSection(s *bufio.Scanner, ctx *PDFContext) (*int64, error) {
 	// Process all sub sections of this xRef section.
 	for !strings.HasPrefix(line, "trailer") && len(fields) == 2 {
 
-		if err = parseXRefTableSubSection(s, ctx.XRefTable, fields); err != nil {
+		if err = parseXRefTableSubSection(s, ctx, fields); err != nil {
 			return nil, err
 		}
 
@@ -823,30 +943,30 @@ func parseXRefSection(s *bufio.Scanner, ctx *PDFContext) (*int64, error) {
 
 	log.Debug.Println("parseXRefSection: parsing trailer dict..")
 
-	var trailerString string
+	var trailer bytes.Buffer
 
 	if line != "trailer" {
-		trailerString = line[7:]
-		log.Debug.Printf("parseXRefSection: trailer leftover: <%s>\n", trailerString)
+		trailer.WriteString(line[7:])
+		log.Debug.Printf("parseXRefSection: trailer leftover: <%s>\n", trailer.Bytes())
 	} else {
 		log.Debug.Printf("line (len %d) <%s>\n", len(line), line)
 	}
 
-	// Unless trailerDict already scanned into trailerString
-	if strings.Index(trailerString, ">>") == -1 {
+	// Unless trailerDict already scanned into trailer
+	if bytes.Index(trailer.Bytes(), []byte(">>")) == -1 {
 
 		// scan lines until we have the complete trailer dict:  << ... >>
-		trailerDictString, err := scanTrailerDict(s, strings.Index(trailerString, "<<") > 0)
+		err = scanTrailerDict(s, &trailer, bytes.Index(trailer.Bytes(), []byte("<<")) > 0)
 		if err != nil {
 			return nil, err
 		}
-
-		trailerString += trailerDictString
 	}
 
-	log.Debug.Printf("parseXRefSection: trailerString: (len:%d) <%s>\n", len(trailerString), trailerString)
+	log.Debug.Printf("parseXRefSection: trailer: (len:%d) <%s>\n", trailer.Len(), trailer.Bytes())
+
+	l := lexer{buf: trailer.Bytes()}
 
-	pdfObject, err := parseObject(&trailerString)
+	pdfObject, err := l.parseObject()
 	if err != nil {
 		return nil, err
 	}
@@ -911,9 +1031,9 @@ func buildXRefTableStartingAt(ctx *PDFContext, offset *int64) error {
 
 	log.Debug.Println("buildXRefTableStartingAt: begin")
 
-	file := ctx.Read.File
+	rs := ctx.Read.rs
 
-	hv, err := headerVersion(file)
+	hv, err := headerVersion(readerAt(rs))
 	if err != nil {
 		return err
 	}
@@ -922,7 +1042,13 @@ func buildXRefTableStartingAt(ctx *PDFContext, offset *int64) error {
 
 	for offset != nil {
 
-		rd, err := newPositionedReader(file, offset)
+		if err := ctx.cancelled(); err != nil {
+			return err
+		}
+
+		ctx.Read.newXRefSection(*offset)
+
+		rd, err := newPositionedReader(rs, offset)
 		if err != nil {
 			return err
 		}
@@ -941,7 +1067,7 @@ func buildXRefTableStartingAt(ctx *PDFContext, offset *int64) error {
 
 			log.Debug.Println("buildXRefTableStartingAt: found xref stream")
 			ctx.Read.UsingXRefStreams = true
-			rd, err = newPositionedReader(file, offset)
+			rd, err = newPositionedReader(rs, offset)
 			if err != nil {
 				return err
 			}
@@ -974,11 +1100,13 @@ func readXRefTable(ctx *PDFContext) (err error) {
 
 	log.Debug.Println("readXRefTable: begin")
 
-	offset, err := offsetLastXRefSection(ctx.Read.File, ctx.Read.FileSize)
+	offset, err := offsetLastXRefSection(readerAt(ctx.Read.rs), ctx.Read.FileSize)
 	if err != nil {
 		return
 	}
 
+	ctx.Read.XRefOffset = *offset
+
 	err = buildXRefTableStartingAt(ctx, offset)
 	if err == io.EOF {
 		return errors.Wrap(err, "readXRefTable: unexpected eof")
@@ -987,6 +1115,8 @@ func readXRefTable(ctx *PDFContext) (err error) {
 		return
 	}
 
+	buildRevisions(ctx)
+
 	// Log list of free objects (not the "free list").
 	//log.Debug.Printf("freelist: %v\n", ctx.FreeObjects)
 
@@ -1291,7 +1421,7 @@ func streamDict(ctx *PDFContext, pdfDict PDFDict, objNr, streamInd int, streamOf
 
 func dict(ctx *PDFContext, pdfDict PDFDict, objNr, genNr, endInd, streamInd int) (d *PDFDict, err error) {
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		_, err := decryptDeepObject(pdfDict, objNr, genNr, ctx.EncKey, ctx.AES4Strings)
 		if err != nil {
 			return nil, err
@@ -1306,10 +1436,13 @@ func dict(ctx *PDFContext, pdfDict PDFDict, objNr, genNr, endInd, streamInd int)
 	return d, nil
 }
 
+// errObjectNotAtOffset signals an xref table entry not pointing to its object.
+var errObjectNotAtOffset = errors.New("object not found at offset")
+
 func object(ctx *PDFContext, offset int64, objNr, genNr int) (o PDFObject, endInd, streamInd int, streamOffset int64, err error) {
 
 	var rd io.Reader
-	rd, err = newPositionedReader(ctx.Read.File, &offset)
+	rd, err = newPositionedReader(ctx.Read.rs, &offset)
 	if err != nil {
 		return nil, 0, 0, 0, err
 	}
@@ -1322,54 +1455,52 @@ func object(ctx *PDFContext, offset int64, objNr, genNr int) (o PDFObject, endIn
 	var buf []byte
 	buf, endInd, streamInd, streamOffset, err = buffer(rd)
 	if err != nil {
-		return nil, 0, 0, 0, err
+		return nil, 0, 0, 0, errors.Wrapf(errObjectNotAtOffset, "object: obj#%d at offset %d: %v", objNr, offset, err)
 	}
 
 	//log.Debug.Printf("streamInd:%d(#%x) streamOffset:%d(#%x) endInd:%d(#%x)\n", streamInd, streamInd, streamOffset, streamOffset, endInd, endInd)
 	//log.Debug.Printf("buflen=%d\n%s", len(buf), hex.Dump(buf))
 
-	line := string(buf)
-
-	var l string
+	var l lexer
 
 	if endInd < 0 { // && streamInd >= 0, streamdict
 		// buf: # gen obj ... obj dict ... stream ... data
 		// implies we detected no endobj and a stream starting at streamInd.
 		// big stream, we parse object until "stream"
 		log.Debug.Println("object: big stream, we parse object until stream")
-		l = line[:streamInd]
+		l.reset(buf[:streamInd])
 	} else if streamInd < 0 { // dict
 		// buf: # gen obj ... obj dict ... endobj
 		// implies we detected endobj and no stream.
 		// small object w/o stream, parse until "endobj"
 		log.Debug.Println("object: small object w/o stream, parse until endobj")
-		l = line[:endInd]
+		l.reset(buf[:endInd])
 	} else if streamInd < endInd { // streamdict
 		// buf: # gen obj ... obj dict ... stream ... data ... endstream endobj
 		// implies we detected endobj and stream.
 		// small stream within buffer, parse until "stream"
 		log.Debug.Println("object: small stream within buffer, parse until stream")
-		l = line[:streamInd]
+		l.reset(buf[:streamInd])
 	} else { // dict
 		// buf: # gen obj ... obj dict ... endobj # gen obj ... obj dict ... stream
 		// small obj w/o stream, parse until "endobj"
 		// stream in buf belongs to subsequent object.
 		log.Debug.Println("object: small obj w/o stream, parse until endobj")
-		l = line[:endInd]
+		l.reset(buf[:endInd])
 	}
 
 	// Parse object number and object generation.
 	var objectNr, generationNr *int
-	objectNr, generationNr, err = parseObjectAttributes(&l)
+	objectNr, generationNr, err = l.parseObjectAttributes()
 	if err != nil {
-		return nil, 0, 0, 0, err
+		return nil, 0, 0, 0, errors.Wrapf(errObjectNotAtOffset, "object: obj#%d at offset %d: %v", objNr, offset, err)
 	}
 
 	if objNr != *objectNr || genNr != *generationNr {
-		return nil, 0, 0, 0, errors.Errorf("object: non matching objNr(%d) or generationNumber(%d) tags found.", *objectNr, *generationNr)
+		return nil, 0, 0, 0, errors.Wrapf(errObjectNotAtOffset, "object: non matching objNr(%d) or generationNumber(%d) tags found.", *objectNr, *generationNr)
 	}
 
-	o, err = parseObject(&l)
+	o, err = l.parseObject()
 
 	return o, endInd, streamInd, streamOffset, err
 }
@@ -1396,7 +1527,7 @@ func pdfObject(ctx *PDFContext, offset int64, objNr, genNr int) (PDFObject, erro
 		return streamDict(ctx, o, objNr, streamInd, streamOffset, offset)
 
 	case PDFArray:
-		if ctx.EncKey != nil {
+		if stringsEncrypted(ctx.XRefTable) {
 			if _, err = decryptDeepObject(o, objNr, genNr, ctx.EncKey, ctx.AES4Strings); err != nil {
 				return nil, err
 			}
@@ -1404,7 +1535,7 @@ func pdfObject(ctx *PDFContext, offset int64, objNr, genNr int) (PDFObject, erro
 		return o, nil
 
 	case PDFStringLiteral:
-		if ctx.EncKey != nil {
+		if stringsEncrypted(ctx.XRefTable) {
 			s1, err := decryptString(ctx.AES4Strings, o.Value(), objNr, genNr, ctx.EncKey)
 			if err != nil {
 				return nil, err
@@ -1414,7 +1545,7 @@ func pdfObject(ctx *PDFContext, offset int64, objNr, genNr int) (PDFObject, erro
 		return o, nil
 
 	case PDFHexLiteral:
-		if ctx.EncKey != nil {
+		if stringsEncrypted(ctx.XRefTable) {
 			s1, err := decryptString(ctx.AES4Strings, o.Value(), objNr, genNr, ctx.EncKey)
 			if err != nil {
 				return nil, err
@@ -1570,7 +1701,7 @@ func loadEncodedStreamContent(ctx *PDFContext, streamDict *PDFStreamDict) ([]byt
 	}
 
 	newOffset := streamDict.StreamOffset
-	rd, err := newPositionedReader(ctx.Read.File, &newOffset)
+	rd, err := newPositionedReader(ctx.Read.rs, &newOffset)
 	if err != nil {
 		return nil, err
 	}
@@ -1600,14 +1731,6 @@ func saveDecodedStreamContent(ctx *PDFContext, streamDict *PDFStreamDict, objNr,
 
 	log.Debug.Printf("saveDecodedStreamContent: begin decode=%t\n", decode)
 
-	// If the "Identity" crypt filter is used we do not need to decrypt.
-	if ctx != nil && ctx.EncKey != nil {
-		if len(streamDict.FilterPipeline) == 1 && streamDict.FilterPipeline[0].Name == "Crypt" {
-			streamDict.Content = streamDict.Raw
-			return nil
-		}
-	}
-
 	// Special case: If the length of the encoded data is 0, we do not need to decode anything.
 	if len(streamDict.Raw) == 0 {
 		streamDict.Content = streamDict.Raw
@@ -1615,12 +1738,18 @@ func saveDecodedStreamContent(ctx *PDFContext, streamDict *PDFStreamDict, objNr,
 	}
 
 	// ctx gets created after XRefStream parsing.
-	// XRefStreams are not encrypted.
+	// XRefStreams are not encrypted, neither are streams using the "Identity" crypt filter.
 	if ctx != nil && ctx.EncKey != nil {
-		streamDict.Raw, err = decryptStream(ctx.AES4Streams, streamDict.Raw, objNr, genNr, ctx.EncKey)
+		encrypted, aes, err := streamEncryption(ctx.XRefTable, streamDict)
 		if err != nil {
 			return err
 		}
+		if encrypted {
+			streamDict.Raw, err = decryptStream(aes, streamDict.Raw, objNr, genNr, ctx.EncKey)
+			if err != nil {
+				return err
+			}
+		}
 		l := int64(len(streamDict.Raw))
 		streamDict.StreamLength = &l
 	}
@@ -1713,6 +1842,184 @@ func logStream(obj PDFObject) {
 
 }
 
+// Decode an object stream so contained objects are ready to be used.
+func decodeObjectStream(ctx *PDFContext, objectNumber int) error {
+
+	entry, pdfStreamDict, err := readObjectStream(ctx, objectNumber)
+	if err != nil {
+		return err
+	}
+
+	pdfObjectStreamDict, err := decodeObjectStreamDict(ctx, pdfStreamDict, objectNumber, *entry.Generation)
+	if err != nil {
+		return err
+	}
+
+	ctx.Read.UsingObjectStreams = true
+
+	// Save object stream dict to xRefTableEntry.
+	entry.Object = *pdfObjectStreamDict
+
+	return nil
+}
+
+// readObjectStream parses the object stream dict for objectNumber from file and loads its encoded content.
+func readObjectStream(ctx *PDFContext, objectNumber int) (*XRefTableEntry, *PDFStreamDict, error) {
+
+	// Get XRefTableEntry.
+	entry := ctx.XRefTable.Table[objectNumber]
+	if entry == nil {
+		return nil, nil, errors.Errorf("decodeObjectStream: missing entry for obj#%d\n", objectNumber)
+	}
+
+	log.Debug.Printf("decodeObjectStream: parsing object stream for obj#%d\n", objectNumber)
+
+	// Parse object stream from file.
+	obj, err := pdfObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
+	if err != nil || obj == nil {
+		return nil, nil, errors.New("decodeObjectStream: corrupt object stream")
+	}
+
+	// Ensure PDFStreamDict
+	pdfStreamDict, ok := obj.(PDFStreamDict)
+	if !ok {
+		return nil, nil, errors.New("decodeObjectStream: corrupt object stream")
+	}
+
+	// Load encoded stream content to xRefTable.
+	if _, err = loadEncodedStreamContent(ctx, &pdfStreamDict); err != nil {
+		return nil, nil, errors.Wrapf(err, "decodeObjectStream: problem dereferencing object stream %d", objectNumber)
+	}
+
+	return entry, &pdfStreamDict, nil
+}
+
+// decodeObjectStreamDict decodes the loaded content of an object stream and parses all contained objects.
+// It does not access the file and may run concurrently.
+func decodeObjectStreamDict(ctx *PDFContext, pdfStreamDict *PDFStreamDict, objectNumber, generationNumber int) (*PDFObjectStreamDict, error) {
+
+	// Save decoded stream content to xRefTable.
+	if err := saveDecodedStreamContent(ctx, pdfStreamDict, objectNumber, generationNumber, true); err != nil {
+		log.Debug.Printf("obj %d: %s", objectNumber, err)
+		return nil, err
+	}
+
+	// Ensure decoded objectArray for object stream dicts.
+	if !pdfStreamDict.IsObjStm() {
+		return nil, errors.New("decodeObjectStream: corrupt object stream")
+	}
+
+	// We have an object stream.
+	log.Debug.Printf("decodeObjectStream: object stream #%d\n", objectNumber)
+
+	// Create new object stream dict.
+	pdfObjectStreamDict, err := objectStreamDict(*pdfStreamDict)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decodeObjectStream: problem dereferencing object stream %d", objectNumber)
+	}
+
+	log.Debug.Printf("decodeObjectStream: decoding object stream %d:\n", objectNumber)
+
+	// Parse all objects of this object stream and save them to pdfObjectStreamDict.ObjArray.
+	if err = parseObjectStream(pdfObjectStreamDict); err != nil {
+		return nil, errors.Wrapf(err, "decodeObjectStream: problem decoding object stream %d\n", objectNumber)
+	}
+
+	if pdfObjectStreamDict.ObjArray == nil {
+		return nil, errors.Wrap(err, "decodeObjectStream: objArray should be set!")
+	}
+
+	log.Debug.Printf("decodeObjectStream: decoded object stream %d:\n", objectNumber)
+
+	return pdfObjectStreamDict, nil
+}
+
+// decodeConcurrently calls decode for 0 <= i < n using up to ctx.Workers goroutines.
+// decode has to store its result by index so results do not depend on scheduling.
+// The returned error is the one for the lowest failing i.
+func decodeConcurrently(ctx *PDFContext, n int, decode func(i int) error) error {
+
+	workers := ctx.Workers
+	if workers > n {
+		workers = n
+	}
+
+	if workers < 2 {
+		for i := 0; i < n; i++ {
+			if err := decode(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+
+	// Jobs beyond the lowest failing one get skipped.
+	var mu sync.Mutex
+	failed := n
+
+	skip := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i > failed
+	}
+
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[i] = err
+		if i < failed {
+			failed = i
+		}
+	}
+
+	run := func(i int) {
+		defer func() {
+			if r := recover(); r != nil {
+				fail(i, errors.Errorf("decodeConcurrently: unexpected panic: %v", r))
+			}
+		}()
+		if skip(i) {
+			return
+		}
+		err := ctx.cancelled()
+		if err == nil {
+			err = decode(i)
+		}
+		if err != nil {
+			fail(i, err)
+		}
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	if failed < n {
+		return errs[failed]
+	}
+
+	return nil
+}
+
 // Decode all object streams so contained objects are ready to be used.
 func decodeObjectStreams(ctx *PDFContext) error {
 
@@ -1729,70 +2036,43 @@ func decodeObjectStreams(ctx *PDFContext) error {
 	}
 	sort.Ints(keys)
 
-	for _, objectNumber := range keys {
-
-		// Get XRefTableEntry.
-		entry := ctx.XRefTable.Table[objectNumber]
-		if entry == nil {
-			return errors.Errorf("decodeObjectStream: missing entry for obj#%d\n", objectNumber)
-		}
-
-		log.Debug.Printf("decodeObjectStreams: parsing object stream for obj#%d\n", objectNumber)
+	var objNrs, genNrs []int
+	var entries []*XRefTableEntry
+	var sds []*PDFStreamDict
 
-		// Parse object stream from file.
-		obj, err := pdfObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
-		if err != nil || obj == nil {
-			return errors.New("decodeObjectStreams: corrupt object stream")
-		}
-
-		// Ensure PDFStreamDict
-		pdfStreamDict, ok := obj.(PDFStreamDict)
-		if !ok {
-			return errors.New("decodeObjectStreams: corrupt object stream")
-		}
-
-		// Load encoded stream content to xRefTable.
-		if _, err = loadEncodedStreamContent(ctx, &pdfStreamDict); err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem dereferencing object stream %d", objectNumber)
-		}
-
-		// Save decoded stream content to xRefTable.
-		if err = saveDecodedStreamContent(ctx, &pdfStreamDict, objectNumber, *entry.Generation, true); err != nil {
-			log.Debug.Printf("obj %d: %s", objectNumber, err)
+	// Reading from file has to happen sequentially.
+	for _, objectNumber := range keys {
+		if err := ctx.cancelled(); err != nil {
 			return err
 		}
-
-		// Ensure decoded objectArray for object stream dicts.
-		if !pdfStreamDict.IsObjStm() {
-			return errors.New("decodeObjectStreams: corrupt object stream")
+		if _, ok := ctx.Table[objectNumber].Object.(PDFObjectStreamDict); ok {
+			// Already decoded.
+			continue
 		}
-
-		// We have an object stream.
-		log.Debug.Printf("decodeObjectStreams: object stream #%d\n", objectNumber)
-
-		ctx.Read.UsingObjectStreams = true
-
-		// Create new object stream dict.
-		pdfObjectStreamDict, err := objectStreamDict(pdfStreamDict)
+		entry, sd, err := readObjectStream(ctx, objectNumber)
 		if err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem dereferencing object stream %d", objectNumber)
-		}
-
-		log.Debug.Printf("decodeObjectStreams: decoding object stream %d:\n", objectNumber)
-
-		// Parse all objects of this object stream and save them to pdfObjectStreamDict.ObjArray.
-		if err = parseObjectStream(pdfObjectStreamDict); err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem decoding object stream %d\n", objectNumber)
+			return err
 		}
+		objNrs = append(objNrs, objectNumber)
+		genNrs = append(genNrs, *entry.Generation)
+		entries = append(entries, entry)
+		sds = append(sds, sd)
+	}
 
-		if pdfObjectStreamDict.ObjArray == nil {
-			return errors.Wrap(err, "decodeObjectStreams: objArray should be set!")
-		}
+	// Decoding and parsing is independent for each object stream.
+	osds := make([]*PDFObjectStreamDict, len(objNrs))
 
-		log.Debug.Printf("decodeObjectStreams: decoded object stream %d:\n", objectNumber)
+	err := decodeConcurrently(ctx, len(objNrs), func(i int) (err error) {
+		osds[i], err = decodeObjectStreamDict(ctx, sds[i], objNrs[i], genNrs[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-		// Save object stream dict to xRefTableEntry.
-		entry.Object = *pdfObjectStreamDict
+	for i, osd := range osds {
+		entries[i].Object = *osd
+		ctx.Read.UsingObjectStreams = true
 	}
 
 	log.Debug.Println("decodeObjectStreams: end")
@@ -1842,12 +2122,22 @@ func handleLinearizationParmDict(ctx *PDFContext, obj PDFObject, objNr int) erro
 			offset64 := int64(offset.Value())
 			ctx.OffsetOverflowHintTable = &offset64
 		}
+
+		// Record for validation.
+		lp := &linearizationParms{objNr: objNr, dict: pdfDict, offset: -1, fileSize: ctx.Read.FileSize}
+		if entry, found := ctx.Find(objNr); found && !entry.Compressed && entry.Offset != nil {
+			lp.offset = *entry.Offset
+		}
+		for _, s := range ctx.Read.sections {
+			lp.xRefOffsets = append(lp.xRefOffsets, s.offset)
+		}
+		ctx.linearization = lp
 	}
 
 	return nil
 }
 
-func loadPDFStreamDict(ctx *PDFContext, sd *PDFStreamDict, objNr, genNr int) error {
+func loadPDFStreamDict(ctx *PDFContext, sd *PDFStreamDict, objNr int) error {
 
 	// Load encoded stream content for stream dicts into xRefTable entry.
 	if _, err := loadEncodedStreamContent(ctx, sd); err != nil {
@@ -1856,8 +2146,27 @@ func loadPDFStreamDict(ctx *PDFContext, sd *PDFStreamDict, objNr, genNr int) err
 
 	ctx.Read.BinaryTotalSize += *sd.StreamLength
 
-	// Decode stream content.
-	return saveDecodedStreamContent(ctx, sd, objNr, genNr, ctx.DecodeAllStreams)
+	return nil
+}
+
+// streamJob represents a stream dict whose encoded content has been loaded
+// but still needs to be decrypted and decoded.
+type streamJob struct {
+	entry        *XRefTableEntry
+	objNr, genNr int
+	sd           PDFStreamDict
+}
+
+// decode decrypts and optionally decodes the stream content.
+// It does not access the file and may run concurrently.
+func (j *streamJob) decode(ctx *PDFContext) error {
+	return saveDecodedStreamContent(ctx, &j.sd, j.objNr, j.genNr, ctx.DecodeAllStreams)
+}
+
+// save puts the processed stream dict into its xRefTable entry.
+func (j *streamJob) save() {
+	j.entry.Object = j.sd
+	logStream(j.entry.Object)
 }
 
 func updateBinaryTotalSize(ctx *PDFContext, o PDFObject) {
@@ -1879,6 +2188,24 @@ func updateBinaryTotalSize(ctx *PDFContext, o PDFObject) {
 
 func dereferenceObject(ctx *PDFContext, objNr int) error {
 
+	job, err := loadObject(ctx, objNr)
+	if err != nil || job == nil {
+		return err
+	}
+
+	if err = job.decode(ctx); err != nil {
+		return err
+	}
+
+	job.save()
+
+	return nil
+}
+
+// loadObject parses the object for objNr from file into its xRefTable entry.
+// Any stream content gets loaded only and is returned as streamJob for further processing.
+func loadObject(ctx *PDFContext, objNr int) (*streamJob, error) {
+
 	xRefTable := ctx.XRefTable
 	xRefTableSize := len(xRefTable.Table)
 
@@ -1888,16 +2215,16 @@ func dereferenceObject(ctx *PDFContext, objNr int) error {
 
 	if entry.Free {
 		log.Debug.Printf("free object %d\n", objNr)
-		return nil
+		return nil, nil
 	}
 
 	if entry.Compressed {
 		err := decompressXRefTableEntry(xRefTable, objNr, entry)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		//log.Debug.Printf("dereferenceObject: decompressed entry, Compressed=%v\n%s\n", entry.Compressed, entry.Object)
-		return nil
+		return nil, nil
 	}
 
 	// entry is in use.
@@ -1905,7 +2232,7 @@ func dereferenceObject(ctx *PDFContext, objNr int) error {
 
 	if entry.Offset == nil || *entry.Offset == 0 {
 		log.Debug.Printf("dereferenceObject: already decompressed or used object w/o offset -> ignored")
-		return nil
+		return nil, nil
 	}
 
 	obj := entry.Object
@@ -1915,7 +2242,7 @@ func dereferenceObject(ctx *PDFContext, objNr int) error {
 		logStream(entry.Object)
 		updateBinaryTotalSize(ctx, obj)
 		log.Debug.Printf("handleCachedStreamDict: using cached object %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
-		return nil
+		return nil, nil
 	}
 
 	// Dereference (load from disk into memory).
@@ -1925,7 +2252,7 @@ func dereferenceObject(ctx *PDFContext, objNr int) error {
 	// Parse object from file: anything goes dict, array, integer, float, streamdicts...
 	obj, err := pdfObject(ctx, *entry.Offset, objNr, *entry.Generation)
 	if err != nil {
-		return errors.Wrapf(err, "dereferenceObject: problem dereferencing object %d", objNr)
+		return nil, errors.Wrapf(err, "dereferenceObject: problem dereferencing object %d", objNr)
 	}
 
 	entry.Object = obj
@@ -1933,34 +2260,38 @@ func dereferenceObject(ctx *PDFContext, objNr int) error {
 	// Linearization dicts are validated and recorded for stats only.
 	err = handleLinearizationParmDict(ctx, obj, objNr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Handle stream dicts.
 
 	if _, ok := obj.(PDFObjectStreamDict); ok {
-		return errors.Errorf("dereferenceObject: object stream should already be dereferenced at obj:%d", objNr)
+		return nil, errors.Errorf("dereferenceObject: object stream should already be dereferenced at obj:%d", objNr)
 	}
 
 	if _, ok := obj.(PDFXRefStreamDict); ok {
-		return errors.Errorf("dereferenceObject: xref stream should already be dereferenced at obj:%d", objNr)
+		return nil, errors.Errorf("dereferenceObject: xref stream should already be dereferenced at obj:%d", objNr)
 	}
 
 	if pdfStreamDict, ok := obj.(PDFStreamDict); ok {
 
-		err = loadPDFStreamDict(ctx, &pdfStreamDict, objNr, *entry.Generation)
+		err = loadPDFStreamDict(ctx, &pdfStreamDict, objNr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		entry.Object = pdfStreamDict
+
+		log.Debug.Printf("dereferenceObject: end obj %d of %d, stream content loaded\n", objNr, xRefTableSize)
+
+		return &streamJob{entry: entry, objNr: objNr, genNr: *entry.Generation, sd: pdfStreamDict}, nil
 	}
 
 	log.Debug.Printf("dereferenceObject: end obj %d of %d\n<%s>\n", objNr, xRefTableSize, entry.Object)
 
 	logStream(entry.Object)
 
-	return nil
+	return nil, nil
 }
 
 // Dereferences all objects including compressed objects from object streams.
@@ -1976,11 +2307,32 @@ func dereferenceObjects(ctx *PDFContext) error {
 	}
 	sort.Ints(keys)
 
+	var jobs []*streamJob
+
+	// Reading from file has to happen sequentially.
 	for _, objNr := range keys {
-		err := dereferenceObject(ctx, objNr)
+		if err := ctx.cancelled(); err != nil {
+			return err
+		}
+		job, err := loadObject(ctx, objNr)
 		if err != nil {
 			return err
 		}
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	// Decrypting and decoding is independent for each stream.
+	err := decodeConcurrently(ctx, len(jobs), func(i int) error {
+		return jobs[i].decode(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		job.save()
 	}
 
 	log.Debug.Println("dereferenceObjects: end")
@@ -2041,6 +2393,18 @@ func dereferenceXRefTable(ctx *PDFContext, config *Configuration) error {
 	}
 	//logErrorReader.Println("pw authenticated")
 
+	if ctx.Read.Recovered {
+		// Register objects found in object streams.
+		recoverCompressedObjects(ctx)
+	}
+
+	if config.Lazy {
+		// Objects get parsed from file on first access.
+		ctx.Read.UsingObjectStreams = len(ctx.Read.ObjectStreams) > 0
+		xRefTable.lazy = newLazyLoader(ctx)
+		return identifyRootVersion(xRefTable)
+	}
+
 	// Prepare decompressed objects.
 	err = decodeObjectStreams(ctx)
 	if err != nil {
@@ -2076,8 +2440,8 @@ func handleUnencryptedFile(ctx *PDFContext) error {
 
 	// Encrypt subcommand found.
 
-	if len(ctx.UserPW) == 0 && len(ctx.OwnerPW) == 0 {
-		return errors.New("encrypt: user or/and owner password missing")
+	if len(ctx.Recipients) == 0 && len(ctx.UserPW) == 0 && len(ctx.OwnerPW) == 0 {
+		return errors.New("encrypt: user or/and owner password or recipients missing")
 	}
 
 	// Ensure ctx.ID
@@ -2163,6 +2527,17 @@ func setupEncryptionKey(ctx *PDFContext, encryptDictObjNr int) error {
 	//fmt.Printf("read: O = %0X\n", enc.O)
 	//fmt.Printf("read: U = %0X\n", enc.U)
 
+	if enc.PubSec {
+		ctx.EncKey, err = pubSecKey(ctx)
+		if err != nil {
+			return err
+		}
+		if !hasNeededPermissions(ctx.Mode, ctx.E) {
+			return errors.New("Insufficient access permissions")
+		}
+		return nil
+	}
+
 	enc.ID, err = idBytes(ctx)
 	if err != nil {
 		return err
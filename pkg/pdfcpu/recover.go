@@ -0,0 +1,378 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	recoverChunkSize = 1 << 20
+	recoverOverlap   = 64 // Covers the longest possible object header.
+)
+
+var (
+	reObjHeader = regexp.MustCompile(`(\d{1,10})[\x00\t\n\f\r ]+(\d{1,5})[\x00\t\n\f\r ]+obj`)
+	reTrailer   = regexp.MustCompile(`trailer`)
+)
+
+// recoveredObject is an object header found while scanning a damaged file.
+type recoveredObject struct {
+	objNr, genNr int
+	offset       int64
+}
+
+func whitespaceOrDelimiter(b byte) bool {
+	return strings.IndexByte("\x00\t\n\f\r ", b) >= 0 || delimiter(b)
+}
+
+// scanFile calls f for all matches of re in the file at increasing offsets.
+// Matches have to start at a token boundary.
+func scanFile(ctx *PDFContext, re *regexp.Regexp, f func(off int64, match [][]byte)) error {
+
+	ra := readerAt(ctx.Read.rs)
+	fileSize := ctx.Read.FileSize
+
+	buf := make([]byte, recoverChunkSize+recoverOverlap)
+
+	for off := int64(0); off < fileSize; off += recoverChunkSize {
+
+		if err := ctx.cancelled(); err != nil {
+			return err
+		}
+
+		n, err := ra.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		chunk := buf[:n]
+
+		for _, ind := range re.FindAllSubmatchIndex(chunk, -1) {
+
+			// Matches starting in the overlap get processed with the next chunk.
+			if ind[0] >= recoverChunkSize {
+				break
+			}
+
+			if ind[0] > 0 && !whitespaceOrDelimiter(chunk[ind[0]-1]) {
+				continue
+			}
+
+			if ind[1] < len(chunk) && !whitespaceOrDelimiter(chunk[ind[1]]) {
+				continue
+			}
+
+			match := make([][]byte, len(ind)/2)
+			for i := range match {
+				if ind[2*i] >= 0 {
+					match[i] = chunk[ind[2*i]:ind[2*i+1]]
+				}
+			}
+
+			f(off+int64(ind[0]), match)
+		}
+	}
+
+	return nil
+}
+
+// scanObjectHeaders returns the latest occurrence of every object header "objNr genNr obj" found in the file.
+func scanObjectHeaders(ctx *PDFContext) (map[int]recoveredObject, error) {
+
+	objs := map[int]recoveredObject{}
+
+	err := scanFile(ctx, reObjHeader, func(off int64, match [][]byte) {
+
+		objNr, err := strconv.Atoi(string(match[1]))
+		if err != nil {
+			return
+		}
+
+		genNr, err := strconv.Atoi(string(match[2]))
+		if err != nil {
+			return
+		}
+
+		// Later definitions win as a result of incremental updates.
+		objs[objNr] = recoveredObject{objNr: objNr, genNr: genNr, offset: off}
+	})
+
+	return objs, err
+}
+
+// trailerDicts returns all parsable trailer dicts, the latest first.
+func trailerDicts(ctx *PDFContext) ([]PDFDict, error) {
+
+	var offsets []int64
+
+	err := scanFile(ctx, reTrailer, func(off int64, match [][]byte) {
+		offsets = append(offsets, off+int64(len("trailer")))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dicts []PDFDict
+
+	for i := len(offsets) - 1; i >= 0; i-- {
+
+		off := offsets[i]
+
+		buf := make([]byte, 4*defaultBufSize)
+		n, err := readerAt(ctx.Read.rs).ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		l := lexer{buf: buf[:n]}
+		o, err := l.parseObject()
+		if err != nil {
+			log.Debug.Printf("trailerDicts: skipping corrupt trailer at offset %d: %v\n", off, err)
+			continue
+		}
+
+		if d, ok := o.(PDFDict); ok {
+			dicts = append(dicts, d)
+		}
+	}
+
+	return dicts, nil
+}
+
+// recoverTrailerInfo takes over any trailer information not yet set.
+func recoverTrailerInfo(d PDFDict, xRefTable *XRefTable) {
+
+	if xRefTable.Root == nil {
+		xRefTable.Root = d.IndirectRefEntry("Root")
+	}
+
+	if xRefTable.Info == nil {
+		xRefTable.Info = d.IndirectRefEntry("Info")
+	}
+
+	if xRefTable.ID == nil {
+		xRefTable.ID = d.PDFArrayEntry("ID")
+	}
+
+	if xRefTable.Encrypt == nil {
+		xRefTable.Encrypt = d.IndirectRefEntry("Encrypt")
+	}
+}
+
+// streamWithinFile returns true if the stream content of a stream dict with direct length lies within the file.
+func streamWithinFile(ctx *PDFContext, d PDFDict, streamOffset int64) bool {
+
+	l, _ := d.Length()
+	if l == nil {
+		return true
+	}
+
+	return streamOffset+*l <= ctx.Read.FileSize
+}
+
+// recoverXRefTable rebuilds the cross reference table of a damaged file
+// by scanning for object headers, trailers, xref streams and object streams.
+func recoverXRefTable(ctx *PDFContext) error {
+
+	log.Info.Println("recoverXRefTable: scanning file for objects")
+
+	ctx.XRefTable = newXRefTable(ctx.Configuration)
+	ctx.Read = newReadContext(ctx.Read.FileName, ctx.Read.rs, ctx.Read.FileSize)
+	ctx.Read.Recovered = true
+	ctx.Read.RecoveredObjects = IntSet{}
+
+	hv, err := headerVersion(readerAt(ctx.Read.rs))
+	if err != nil {
+		log.Info.Printf("recoverXRefTable: %v, assuming %s\n", err, VersionString(V17))
+		v := V17
+		hv = &v
+	}
+	ctx.HeaderVersion = hv
+
+	objs, err := scanObjectHeaders(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.Table[0] = NewFreeHeadXRefTableEntry()
+
+	var catalogs []recoveredObject
+	var xRefStreamDicts []recoveredObject
+	xRefStreamDict := map[int]PDFDict{}
+
+	for _, ro := range objs {
+
+		if err := ctx.cancelled(); err != nil {
+			return err
+		}
+
+		if ro.objNr == 0 {
+			continue
+		}
+
+		o, endInd, streamInd, streamOffset, err := object(ctx, ro.offset, ro.objNr, ro.genNr)
+		if err != nil || o == nil {
+			log.Info.Printf("recoverXRefTable: skipping corrupt obj#%d at offset %d\n", ro.objNr, ro.offset)
+			continue
+		}
+
+		if d, ok := o.(PDFDict); ok {
+
+			isStream := streamInd > 0 && (endInd < 0 || streamInd < endInd)
+			if isStream && !streamWithinFile(ctx, d, ro.offset+streamOffset) {
+				log.Info.Printf("recoverXRefTable: skipping truncated stream obj#%d at offset %d\n", ro.objNr, ro.offset)
+				continue
+			}
+
+			switch t := d.Type(); {
+
+			case t == nil:
+
+			case *t == "Catalog":
+				catalogs = append(catalogs, ro)
+
+			case *t == "XRef" && isStream:
+				xRefStreamDicts = append(xRefStreamDicts, ro)
+				xRefStreamDict[ro.objNr] = d
+				ctx.Read.XRefStreams[ro.objNr] = true
+				ctx.Read.UsingXRefStreams = true
+
+			case *t == "ObjStm" && isStream:
+				ctx.Read.ObjectStreams[ro.objNr] = true
+
+			}
+		}
+
+		offset, genNr := ro.offset, ro.genNr
+		ctx.Table[ro.objNr] = &XRefTableEntry{Offset: &offset, Generation: &genNr}
+		ctx.Read.RecoveredObjects[ro.objNr] = true
+	}
+
+	if len(ctx.Read.RecoveredObjects) == 0 {
+		return errors.New("recoverXRefTable: no objects found")
+	}
+
+	// Take over trailer info, the latest trailer or xref stream dict first.
+
+	dicts, err := trailerDicts(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(xRefStreamDicts, func(i, j int) bool { return xRefStreamDicts[i].offset > xRefStreamDicts[j].offset })
+	for _, ro := range xRefStreamDicts {
+		dicts = append(dicts, xRefStreamDict[ro.objNr])
+	}
+
+	for _, d := range dicts {
+		recoverTrailerInfo(d, ctx.XRefTable)
+	}
+
+	if ctx.Root != nil && !ctx.Exists(ctx.Root.ObjectNumber.Value()) {
+		log.Info.Printf("recoverXRefTable: ignoring trailer Root %s\n", *ctx.Root)
+		ctx.Root = nil
+	}
+
+	if ctx.Root == nil {
+		if len(catalogs) == 0 {
+			return errors.New("recoverXRefTable: no catalog found")
+		}
+		sort.Slice(catalogs, func(i, j int) bool { return catalogs[i].offset > catalogs[j].offset })
+		ctx.Root = NewPDFIndirectRef(catalogs[0].objNr, catalogs[0].genNr)
+	}
+
+	if ctx.Info != nil && !ctx.Exists(ctx.Info.ObjectNumber.Value()) {
+		ctx.Info = nil
+	}
+
+	ctx.setRecoveredSize()
+
+	log.Info.Printf("recoverXRefTable: recovered %d objects\n", len(ctx.Read.RecoveredObjects))
+
+	return ctx.EnsureValidFreeList()
+}
+
+func (xRefTable *XRefTable) setRecoveredSize() {
+
+	size := 0
+	for k := range xRefTable.Table {
+		if k >= size {
+			size = k + 1
+		}
+	}
+
+	xRefTable.Size = &size
+}
+
+// recoverCompressedObjects decodes all object streams of a recovered file
+// and registers any contained objects not defined by a newer direct object.
+func recoverCompressedObjects(ctx *PDFContext) {
+
+	var objStreams []int
+	for k := range ctx.Read.ObjectStreams {
+		objStreams = append(objStreams, k)
+	}
+
+	// Latest object stream first.
+	sort.Slice(objStreams, func(i, j int) bool {
+		return *ctx.Table[objStreams[i]].Offset > *ctx.Table[objStreams[j]].Offset
+	})
+
+	compressed := IntSet{}
+
+	for _, osNr := range objStreams {
+
+		if err := decodeObjectStream(ctx, osNr); err != nil {
+			log.Info.Printf("recoverCompressedObjects: skipping corrupt object stream obj#%d: %v\n", osNr, err)
+			delete(ctx.Read.ObjectStreams, osNr)
+			delete(ctx.Table, osNr)
+			delete(ctx.Read.RecoveredObjects, osNr)
+			continue
+		}
+
+		osEntry := ctx.Table[osNr]
+		osd := osEntry.Object.(PDFObjectStreamDict)
+
+		fields := strings.Fields(string(osd.Content[:osd.FirstObjOffset]))
+
+		for i := 0; i+1 < len(fields) && i/2 < len(osd.ObjArray); i += 2 {
+
+			objNr, err := strconv.Atoi(fields[i])
+			if err != nil || objNr == 0 || compressed[objNr] {
+				continue
+			}
+
+			if e, found := ctx.Find(objNr); found && (e.Compressed || *e.Offset > *osEntry.Offset) {
+				continue
+			}
+
+			objStreamNr, ind := osNr, i/2
+			ctx.Table[objNr] = &XRefTableEntry{Compressed: true, ObjectStream: &objStreamNr, ObjectStreamInd: &ind}
+			ctx.Read.RecoveredObjects[objNr] = true
+			compressed[objNr] = true
+		}
+	}
+
+	ctx.setRecoveredSize()
+}
@@ -0,0 +1,573 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Resizing a page wraps its content into a form XObject which is scaled and centred onto a new MediaBox.
+// The paper follows the orientation of the page, the page rotation is kept.
+// Annotations and destinations pointing to resized pages are mapped using the same transformation.
+
+// Resize represents the target paper format for resizing pages.
+type Resize struct {
+	Paper types.Dim // Target paper dimensions.
+	Fill  bool      // Scale to cover the paper cropping the content, scale to fit otherwise.
+}
+
+// DefaultResizeConfig returns the default resize configuration: fit onto A4.
+func DefaultResizeConfig() *Resize {
+	return &Resize{Paper: PaperSize["A4"]}
+}
+
+func (rs Resize) String() string {
+	return fmt.Sprintf("paper=%s fill=%t", rs.Paper, rs.Fill)
+}
+
+func (rs Resize) validate() error {
+
+	if rs.Paper.Width <= 0 || rs.Paper.Height <= 0 {
+		return errors.Errorf("resize: invalid paper size: %s", rs.Paper)
+	}
+
+	return nil
+}
+
+// paperDim returns the paper dimensions oriented like r.
+func (rs Resize) paperDim(r types.Rectangle) types.Dim {
+
+	d := rs.Paper
+	if d.Landscape() != (r.Width() > r.Height()) && r.Width() != r.Height() {
+		d.Width, d.Height = d.Height, d.Width
+	}
+
+	return d
+}
+
+// transform returns the matrix mapping r onto the paper d.
+func (rs Resize) transform(r types.Rectangle, d types.Dim) matrix {
+
+	w, h := r.Width(), r.Height()
+
+	s := math.Min(d.Width/w, d.Height/h)
+	if rs.Fill {
+		s = math.Max(d.Width/w, d.Height/h)
+	}
+
+	m := identMatrix
+	m[0][0], m[1][1] = s, s
+	m[2][0] = (d.Width-s*w)/2 - s*r.LL.X
+	m[2][1] = (d.Height-s*h)/2 - s*r.LL.Y
+
+	return m
+}
+
+func (m matrix) transformPoint(x, y float64) (float64, float64) {
+	return m[0][0]*x + m[1][0]*y + m[2][0], m[0][1]*x + m[1][1]*y + m[2][1]
+}
+
+func (m matrix) transformRect(r types.Rectangle) types.Rectangle {
+	llx, lly := m.transformPoint(r.LL.X, r.LL.Y)
+	urx, ury := m.transformPoint(r.UR.X, r.UR.Y)
+	return normalize(types.NewRectangle(llx, lly, urx, ury))
+}
+
+// transformPoints returns a copy of a flat array of x y coordinates transformed by m.
+func transformPoints(xRefTable *XRefTable, o PDFObject, m matrix) (PDFArray, error) {
+
+	arr, err := xRefTable.DereferenceArray(o)
+	if err != nil || arr == nil || len(*arr)%2 != 0 {
+		return nil, errors.New("invalid coordinates")
+	}
+
+	a := make(PDFArray, len(*arr))
+
+	for i := 0; i < len(*arr); i += 2 {
+		x, y := m.transformPoint(xRefTable.DereferenceNumber((*arr)[i]), xRefTable.DereferenceNumber((*arr)[i+1]))
+		a[i], a[i+1] = PDFFloat(x), PDFFloat(y)
+	}
+
+	return a, nil
+}
+
+// transformAnnotation maps the coordinates of an annotation dict using m.
+func transformAnnotation(xRefTable *XRefTable, d *PDFDict, m matrix) error {
+
+	if o, found := d.Find("Rect"); found {
+		arr, err := xRefTable.DereferenceArray(o)
+		if err != nil || arr == nil || len(*arr) != 4 {
+			return errors.New("invalid annotation Rect")
+		}
+		r := m.transformRect(normalize(rect(xRefTable, *arr)))
+		d.Update("Rect", NewRectangle(r.LL.X, r.LL.Y, r.UR.X, r.UR.Y))
+	}
+
+	for _, key := range []string{"QuadPoints", "L", "Vertices", "CL"} {
+		o, found := d.Find(key)
+		if !found {
+			continue
+		}
+		a, err := transformPoints(xRefTable, o, m)
+		if err != nil {
+			return errors.Wrapf(err, "annotation %s", key)
+		}
+		d.Update(key, a)
+	}
+
+	if o, found := d.Find("InkList"); found {
+		arr, err := xRefTable.DereferenceArray(o)
+		if err != nil || arr == nil {
+			return errors.New("invalid annotation InkList")
+		}
+		inkList := PDFArray{}
+		for _, path := range *arr {
+			a, err := transformPoints(xRefTable, path, m)
+			if err != nil {
+				return errors.Wrap(err, "annotation InkList")
+			}
+			inkList = append(inkList, a)
+		}
+		d.Update("InkList", inkList)
+	}
+
+	return nil
+}
+
+// transformAnnotations maps the annotations of a page using m.
+// Annotations already mapped are skipped.
+func transformAnnotations(xRefTable *XRefTable, d *PDFDict, m matrix, done map[int]bool) error {
+
+	o, found := d.Find("Annots")
+	if !found {
+		return nil
+	}
+
+	annots, err := xRefTable.DereferenceArray(o)
+	if err != nil || annots == nil {
+		return err
+	}
+
+	for _, v := range *annots {
+
+		if indRef, ok := v.(PDFIndirectRef); ok {
+			objNr := indRef.ObjectNumber.Value()
+			if done[objNr] {
+				continue
+			}
+			done[objNr] = true
+		}
+
+		ad, err := xRefTable.DereferenceDict(v)
+		if err != nil || ad == nil {
+			continue
+		}
+
+		if err = transformAnnotation(xRefTable, ad, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destTransformer maps destinations pointing to resized pages.
+type destTransformer struct {
+	xRefTable *XRefTable
+	matrices  map[int]matrix // Transformations of resized pages by page object number.
+	done      IntSet         // Indirect objects already mapped.
+}
+
+// visit returns false if o is an indirect object already visited.
+func (dt destTransformer) visit(o PDFObject) bool {
+
+	indRef, ok := o.(PDFIndirectRef)
+	if !ok {
+		return true
+	}
+
+	objNr := indRef.ObjectNumber.Value()
+	if dt.done[objNr] {
+		return false
+	}
+
+	dt.done[objNr] = true
+
+	return true
+}
+
+// destArray maps the coordinates of an explicit destination in place.
+func (dt destTransformer) destArray(a PDFArray) {
+
+	if len(a) < 2 {
+		return
+	}
+
+	indRef, ok := a[0].(PDFIndirectRef)
+	if !ok {
+		return
+	}
+
+	m, ok := dt.matrices[indRef.ObjectNumber.Value()]
+	if !ok {
+		return
+	}
+
+	fit, ok := a[1].(PDFName)
+	if !ok {
+		return
+	}
+
+	// Coordinates may be null meaning unchanged.
+	// Resizing does not rotate so x and y may be mapped independently.
+	coord := func(i int, x bool) {
+		if i >= len(a) {
+			return
+		}
+		o, _ := dt.xRefTable.Dereference(a[i])
+		switch o.(type) {
+		case PDFInteger, PDFFloat:
+		default:
+			return
+		}
+		v := dt.xRefTable.DereferenceNumber(o)
+		if x {
+			v, _ = m.transformPoint(v, 0)
+		} else {
+			_, v = m.transformPoint(0, v)
+		}
+		a[i] = PDFFloat(v)
+	}
+
+	switch fit.Value() {
+
+	case "XYZ":
+		coord(2, true)
+		coord(3, false)
+
+	case "FitH", "FitBH":
+		coord(2, false)
+
+	case "FitV", "FitBV":
+		coord(2, true)
+
+	case "FitR":
+		coord(2, true)
+		coord(3, false)
+		coord(4, true)
+		coord(5, false)
+
+	}
+}
+
+// dest maps an explicit destination or a destination dict.
+// Named destinations get mapped along with the name tree.
+func (dt destTransformer) dest(o PDFObject) error {
+
+	if !dt.visit(o) {
+		return nil
+	}
+
+	o, err := dt.xRefTable.Dereference(o)
+	if err != nil || o == nil {
+		return err
+	}
+
+	switch o := o.(type) {
+
+	case PDFArray:
+		dt.destArray(o)
+
+	case PDFDict:
+		if d, found := o.Find("D"); found {
+			return dt.dest(d)
+		}
+
+	}
+
+	return nil
+}
+
+// action maps the destination of a GoTo action.
+func (dt destTransformer) action(o PDFObject) error {
+
+	if !dt.visit(o) {
+		return nil
+	}
+
+	d, err := dt.xRefTable.DereferenceDict(o)
+	if err != nil || d == nil {
+		return err
+	}
+
+	if s := d.NameEntry("S"); s == nil || *s != "GoTo" {
+		return nil
+	}
+
+	if dest, found := d.Find("D"); found {
+		return dt.dest(dest)
+	}
+
+	return nil
+}
+
+// item maps the destination of an outline item or a link annotation.
+func (dt destTransformer) item(d *PDFDict) error {
+
+	if dest, found := d.Find("Dest"); found {
+		return dt.dest(dest)
+	}
+
+	if a, found := d.Find("A"); found {
+		return dt.action(a)
+	}
+
+	return nil
+}
+
+func (dt destTransformer) outlineItems(first *PDFIndirectRef) error {
+
+	for indRef := first; indRef != nil; {
+
+		if !dt.visit(*indRef) {
+			break
+		}
+
+		d, err := dt.xRefTable.DereferenceDict(*indRef)
+		if err != nil || d == nil {
+			return err
+		}
+
+		if err = dt.item(d); err != nil {
+			return err
+		}
+
+		if err = dt.outlineItems(d.IndirectRefEntry("First")); err != nil {
+			return err
+		}
+
+		indRef = d.IndirectRefEntry("Next")
+	}
+
+	return nil
+}
+
+func (dt destTransformer) annotations(pages []PDFIndirectRef) error {
+
+	for _, p := range pages {
+
+		d, err := dt.xRefTable.DereferenceDict(p)
+		if err != nil || d == nil {
+			return err
+		}
+
+		annots, err := dt.xRefTable.DereferenceArray(d.Dict["Annots"])
+		if err != nil || annots == nil {
+			continue
+		}
+
+		for _, v := range *annots {
+
+			if !dt.visit(v) {
+				continue
+			}
+
+			ad, err := dt.xRefTable.DereferenceDict(v)
+			if err != nil || ad == nil {
+				continue
+			}
+
+			if err = dt.item(ad); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// transformDestinations maps the destinations of links, outline items, named destinations and the open action
+// pointing to resized pages.
+func (dt destTransformer) transformDestinations(pages []PDFIndirectRef) error {
+
+	if len(dt.matrices) == 0 {
+		return nil
+	}
+
+	rootDict, err := dt.xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	if o, found := rootDict.Find("OpenAction"); found {
+		if oa, _ := dt.xRefTable.Dereference(o); oa != nil {
+			if _, isDest := oa.(PDFArray); isDest {
+				err = dt.dest(o)
+			} else {
+				err = dt.action(o)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = dt.annotations(pages); err != nil {
+		return err
+	}
+
+	if o, found := rootDict.Find("Outlines"); found {
+		d, err := dt.xRefTable.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			if err = dt.outlineItems(d.IndirectRefEntry("First")); err != nil {
+				return err
+			}
+		}
+	}
+
+	// PDF 1.1 Dests dict
+	if o, found := rootDict.Find("Dests"); found {
+		d, err := dt.xRefTable.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			for _, v := range d.Dict {
+				if err = dt.dest(v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	tree := dt.xRefTable.Names["Dests"]
+	if tree == nil {
+		return nil
+	}
+
+	return tree.Process(dt.xRefTable, func(xRefTable *XRefTable, k string, v PDFObject) error {
+		return dt.dest(v)
+	})
+}
+
+func (rs Resize) resizePage(xRefTable *XRefTable, i int, done map[int]bool) (matrix, error) {
+
+	pb, err := PageBoxes(xRefTable, i)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	if pb.Crop.Width() <= 0 || pb.Crop.Height() <= 0 {
+		return identMatrix, errors.Errorf("page %d: empty page boundaries", i)
+	}
+
+	// The page keeps its rotation, so does the wrapped content.
+	form, _, err := pageForm(xRefTable, i)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	d, inhPAttrs, err := xRefTable.PageDict(i)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	pd := rs.paperDim(pb.Crop)
+	m := rs.transform(pb.Crop, pd)
+
+	log.Debug.Printf("resizePage: page %d %s -> %s\n", i, formatBox(pb.Crop), pd)
+
+	content := fmt.Sprintf("q %f %f %f %f %f %f cm /Fm0 Do Q\n", m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1])
+
+	contentIndRef, err := createContentStream(xRefTable, []byte(content))
+	if err != nil {
+		return identMatrix, err
+	}
+
+	media := types.NewRectangle(0, 0, pd.Width, pd.Height)
+
+	d.Update("MediaBox", NewRectangle(0, 0, pd.Width, pd.Height))
+	d.Update("Resources", PDFDict{Dict: map[string]PDFObject{"XObject": PDFDict{Dict: map[string]PDFObject{"Fm0": *form}}}})
+	d.Update("Contents", *contentIndRef)
+
+	// The CropBox defaults to the new MediaBox unless inherited.
+	d.Delete("CropBox")
+	if inhPAttrs.cropBox != nil {
+		d.Update("CropBox", NewRectangle(0, 0, pd.Width, pd.Height))
+	}
+
+	for _, name := range []string{"TrimBox", "BleedBox", "ArtBox"} {
+		if _, found := d.Find(name); !found {
+			continue
+		}
+		r := intersect(m.transformRect(*pb.box(name)), media)
+		if r.Width() <= 0 || r.Height() <= 0 {
+			d.Delete(name)
+			continue
+		}
+		d.Update(name, NewRectangle(r.LL.X, r.LL.Y, r.UR.X, r.UR.Y))
+	}
+
+	// Thumbnails are outdated.
+	d.Delete("Thumb")
+
+	return m, transformAnnotations(xRefTable, d, m, done)
+}
+
+// ResizePages scales and centres the content of the selected pages onto a new MediaBox of the given paper size.
+func ResizePages(xRefTable *XRefTable, selectedPages IntSet, rs *Resize) error {
+
+	if err := rs.validate(); err != nil {
+		return err
+	}
+
+	log.Debug.Printf("ResizePages: %s\n", rs)
+
+	_, pages, err := pageList(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	done := map[int]bool{}
+	dt := destTransformer{xRefTable: xRefTable, matrices: map[int]matrix{}, done: IntSet{}}
+
+	for i := 1; i <= xRefTable.PageCount; i++ {
+
+		if len(selectedPages) > 0 && !selectedPages[i] {
+			continue
+		}
+
+		m, err := rs.resizePage(xRefTable, i, done)
+		if err != nil {
+			return errors.Wrap(err, "resize")
+		}
+
+		if i <= len(pages) {
+			dt.matrices[pages[i-1].ObjectNumber.Value()] = m
+		}
+	}
+
+	return errors.Wrap(dt.transformDestinations(pages), "resize")
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// => 7.5.6 Incremental Updates
+//
+// A PDF file consists of the original document followed by any number of incremental updates.
+// Each of these revisions ends with its own xref section or xref stream, trailer and %%EOF marker.
+// Truncating a file right after the %%EOF marker of a revision yields the document as it was back then.
+
+// Revision represents the original document or an incremental update of a PDF file.
+type Revision struct {
+	Nr         int    // 1 for the original document.
+	XRefOffset int64  // Offset of the xref section or xref stream startxref points to.
+	Size       int64  // File size up to and including the %%EOF marker of this revision.
+	Objects    IntSet // All in use objects written by this revision.
+	Freed      IntSet // All objects freed by this revision.
+}
+
+// xRefSection records the objects listed by a single xref section or xref stream while reading.
+type xRefSection struct {
+	offset  int64
+	objects IntSet
+	freed   IntSet
+}
+
+// newXRefSection starts recording the xref section at offset.
+func (rc *ReadContext) newXRefSection(offset int64) {
+	rc.section = &xRefSection{offset: offset, objects: IntSet{}, freed: IntSet{}}
+	rc.sections = append(rc.sections, rc.section)
+}
+
+// recordXRefEntry registers an xref entry for the xref section being parsed.
+func (rc *ReadContext) recordXRefEntry(objNr int, free bool) {
+
+	if rc.section == nil {
+		return
+	}
+
+	if free {
+		// The head of the free list is part of every xref section.
+		if objNr > 0 {
+			rc.section.freed[objNr] = true
+		}
+		return
+	}
+
+	rc.section.objects[objNr] = true
+}
+
+// eofOffset returns the offset right after the first %%EOF marker and its end of line following offset.
+func eofOffset(ra io.ReaderAt, offset, fileSize int64) int64 {
+
+	marker := []byte("%%EOF")
+	buf := make([]byte, defaultBufSize)
+
+	for off := offset; off < fileSize; off += int64(len(buf) - len(marker)) {
+
+		n, err := ra.ReadAt(buf, off)
+		b := buf[:n]
+
+		if i := bytes.Index(b, marker); i >= 0 {
+			j := i + len(marker)
+			if j < n && b[j] == '\r' {
+				j++
+			}
+			if j < n && b[j] == '\n' {
+				j++
+			}
+			return off + int64(j)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return fileSize
+}
+
+// buildRevisions groups the recorded xref sections into revisions.
+func buildRevisions(ctx *PDFContext) {
+
+	rc := ctx.Read
+	ra := readerAt(rc.rs)
+
+	rc.Revisions = nil
+
+	// Sections have been recorded following Prev, so start with the oldest one.
+	for i := len(rc.sections) - 1; i >= 0; i-- {
+
+		s := rc.sections[i]
+		size := eofOffset(ra, s.offset, rc.FileSize)
+
+		n := len(rc.Revisions)
+
+		// A section ending before the previous revision belongs to it,
+		// eg. the first page xref section of a linearized file.
+		if n > 0 && size <= rc.Revisions[n-1].Size {
+			r := rc.Revisions[n-1]
+			r.XRefOffset = s.offset
+			for objNr := range s.objects {
+				r.Objects[objNr] = true
+			}
+			for objNr := range s.freed {
+				r.Freed[objNr] = true
+			}
+			continue
+		}
+
+		rc.Revisions = append(rc.Revisions, &Revision{
+			Nr:         n + 1,
+			XRefOffset: s.offset,
+			Size:       size,
+			Objects:    s.objects,
+			Freed:      s.freed,
+		})
+	}
+
+	rc.section = nil
+
+	log.Debug.Printf("buildRevisions: %d revisions\n", len(rc.Revisions))
+}
+
+func sortedObjNrs(set IntSet) []string {
+
+	var keys []int
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	ss := make([]string, len(keys))
+	for i, k := range keys {
+		ss[i] = fmt.Sprintf("%d", k)
+	}
+
+	return ss
+}
+
+// RevisionList returns a list of all revisions of this PDF file.
+func RevisionList(ctx *PDFContext) []string {
+
+	var list []string
+
+	for _, r := range ctx.Read.Revisions {
+
+		if r.Nr == 1 {
+			list = append(list, fmt.Sprintf("revision 1: original document, %d bytes, %d objects", r.Size, len(r.Objects)))
+			continue
+		}
+
+		s := fmt.Sprintf("revision %d: incremental update, %d bytes, %d objects", r.Nr, r.Size, len(r.Objects))
+
+		if len(r.Objects) > 0 {
+			s += ": " + strings.Join(sortedObjNrs(r.Objects), " ")
+		}
+
+		if len(r.Freed) > 0 {
+			s += fmt.Sprintf(", %d freed: %s", len(r.Freed), strings.Join(sortedObjNrs(r.Freed), " "))
+		}
+
+		list = append(list, s)
+	}
+
+	return list
+}
+
+// WriteRevision writes this PDF file as it was at revision nr to w.
+func WriteRevision(ctx *PDFContext, nr int, w io.Writer) error {
+
+	rc := ctx.Read
+
+	if rc.Recovered {
+		return errors.New("WriteRevision: revisions unavailable for files with a damaged cross reference table")
+	}
+
+	if nr < 1 || nr > len(rc.Revisions) {
+		return errors.Errorf("WriteRevision: revision %d not available, %d revisions found", nr, len(rc.Revisions))
+	}
+
+	r := rc.Revisions[nr-1]
+
+	_, err := rc.rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, rc.rs, r.Size)
+
+	return err
+}
+
+// WriteRevisionFile writes this PDF file as it was at revision nr to fileName.
+func WriteRevisionFile(ctx *PDFContext, nr int, fileName string) error {
+
+	log.Info.Printf("writing revision %d to %s\n", nr, fileName)
+
+	return writeFile(fileName, func(w io.Writer) error { return WriteRevision(ctx, nr, w) })
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// ValidRotation returns true if rotation is a multiple of 90 degrees.
+func ValidRotation(rotation int) bool {
+	return rotation%90 == 0
+}
+
+// rotatePage turns page i clockwise by rotation degrees.
+func rotatePage(xRefTable *XRefTable, i, rotation int) error {
+
+	d, inhPAttrs, err := xRefTable.PageDict(i)
+	if err != nil {
+		return err
+	}
+
+	if d == nil {
+		return errors.Errorf("rotate: unknown page %d", i)
+	}
+
+	// The effective rotation may be inherited from the page tree.
+	r := (int(inhPAttrs.rotate) + rotation) % 360
+	if r < 0 {
+		r += 360
+	}
+
+	log.Debug.Printf("rotatePage: page %d: %d -> %d\n", i, int(inhPAttrs.rotate), r)
+
+	d.Update("Rotate", PDFInteger(r))
+
+	return nil
+}
+
+// RotatePages turns selected pages clockwise by rotation degrees, a multiple of 90.
+func RotatePages(xRefTable *XRefTable, selectedPages IntSet, rotation int) error {
+
+	if !ValidRotation(rotation) {
+		return errors.Errorf("rotate: rotation must be a multiple of 90, got %d", rotation)
+	}
+
+	for k, v := range selectedPages {
+		if v {
+			if err := rotatePage(xRefTable, k, rotation); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,766 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/iPaladinLLC/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// => 12.8 Digital Signatures
+//
+// Signing adds a signature field whose signature dict reserves space for ByteRange and Contents
+// and gets written as an incremental update. Once the file has been written ByteRange gets filled in,
+// the digest of the covered bytes computed and the resulting CMS signature embedded into Contents.
+
+// The supported signature formats, see SubFilter.
+const (
+	SubFilterPKCS7Detached = "adbe.pkcs7.detached"
+	SubFilterCAdESDetached = "ETSI.CAdES.detached"
+)
+
+// byteRangePlaceholder reserves room for offsets up to 2 GB.
+const byteRangePlaceholder = PDFInteger(1<<31 - 1)
+
+// Signature describes a digital signature to be added to a PDF file.
+type Signature struct {
+	SubFilter   string           // SubFilterPKCS7Detached (default), SubFilterCAdESDetached or SubFilterRFC3161 for a document timestamp.
+	FieldName   string           // An unsigned signature field of this name gets signed, otherwise a new field gets added.
+	Name        string           // Name of the signer, defaults to the common name of the signing certificate.
+	Reason      string           // Reason for signing.
+	Location    string           // Location of signing.
+	ContactInfo string           // Contact information of the signer.
+	Page        int              // Page holding the signature widget, defaults to 1.
+	Rect        *types.Rectangle // Location of a visible signature, nil for an invisible signature.
+	Size        int              // Bytes reserved for the CMS signature, 0 for an estimate based on the certificates.
+	Certify     int              // DocMDP permissions 1, 2 or 3 of a certification signature, 0 for an approval signature.
+
+	objNr int       // Signature dict.
+	time  time.Time // Signing time.
+}
+
+func (sig Signature) String() string {
+
+	s := fmt.Sprintf("SubFilter: %s, Field: %s, Page: %d", sig.SubFilter, sig.FieldName, sig.Page)
+
+	if sig.Rect != nil {
+		s += fmt.Sprintf(", Rect: %s", sig.Rect)
+	}
+
+	if sig.Certify > 0 {
+		s += fmt.Sprintf(", Certify: %d", sig.Certify)
+	}
+
+	return s
+}
+
+// parseRectangle parses "llx lly urx ury".
+func parseRectangle(v string) (*types.Rectangle, error) {
+
+	ss := strings.Fields(v)
+	if len(ss) != 4 {
+		return nil, errors.New("expected 4 numbers: llx lly urx ury")
+	}
+
+	var f [4]float64
+
+	for i, s := range ss {
+		var err error
+		f[i], err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Errorf("%s is not a number", s)
+		}
+	}
+
+	if f[2] <= f[0] || f[3] <= f[1] {
+		return nil, errors.New("empty rectangle")
+	}
+
+	r := types.NewRectangle(f[0], f[1], f[2], f[3])
+
+	return &r, nil
+}
+
+func parseSignatureRect(v string, sig *Signature) error {
+
+	r, err := parseRectangle(v)
+	if err != nil {
+		return errors.Wrap(err, "rect")
+	}
+
+	sig.Rect = r
+
+	return nil
+}
+
+// ParseSignatureDetails parses a sign command string into an internal structure.
+// s is a comma separated list of key:value pairs using the keys
+// field, name, reason, location, contact, page, rect and certify.
+func ParseSignatureDetails(s string) (*Signature, error) {
+
+	sig := &Signature{SubFilter: SubFilterPKCS7Detached, Page: 1}
+
+	if strings.TrimSpace(s) == "" {
+		return sig, nil
+	}
+
+	for _, s := range strings.Split(s, ",") {
+
+		ss := strings.Split(s, ":")
+		if len(ss) != 2 {
+			return nil, errors.Errorf("invalid signature description: %s", s)
+		}
+
+		k := strings.TrimSpace(ss[0])
+		v := strings.TrimSpace(ss[1])
+
+		var err error
+
+		switch k {
+		case "field":
+			sig.FieldName = v
+
+		case "name":
+			sig.Name = v
+
+		case "reason":
+			sig.Reason = v
+
+		case "location":
+			sig.Location = v
+
+		case "contact":
+			sig.ContactInfo = v
+
+		case "page":
+			sig.Page, err = strconv.Atoi(v)
+			if err == nil && sig.Page < 1 {
+				err = errors.Errorf("page: %d out of range", sig.Page)
+			}
+
+		case "rect":
+			err = parseSignatureRect(v, sig)
+
+		case "certify":
+			sig.Certify, err = strconv.Atoi(v)
+			if err == nil && (sig.Certify < 1 || sig.Certify > 3) {
+				err = errors.Errorf("certify: %d out of range 1..3", sig.Certify)
+			}
+
+		default:
+			err = errors.Errorf("unknown signature description key: %s", k)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sig, nil
+}
+
+func escapedStringLiteral(s string) PDFStringLiteral {
+	s1, _ := Escape(s)
+	return PDFStringLiteral(*s1)
+}
+
+// appendToArrayEntry appends obj to the array held by dict under key which may be an indirect reference.
+func appendToArrayEntry(xRefTable *XRefTable, dict *PDFDict, key string, obj PDFObject) error {
+
+	o, found := dict.Find(key)
+	if !found || o == nil {
+		dict.Update(key, PDFArray{obj})
+		return nil
+	}
+
+	if indRef, ok := o.(PDFIndirectRef); ok {
+		entry, found := xRefTable.FindTableEntryForIndRef(&indRef)
+		if !found {
+			return errors.Errorf("appendToArrayEntry: missing %s", key)
+		}
+		a, ok := entry.Object.(PDFArray)
+		if !ok {
+			return errors.Errorf("appendToArrayEntry: corrupt %s", key)
+		}
+		entry.Object = append(a, obj)
+		return nil
+	}
+
+	a, ok := o.(PDFArray)
+	if !ok {
+		return errors.Errorf("appendToArrayEntry: corrupt %s", key)
+	}
+
+	dict.Update(key, append(a, obj))
+
+	return nil
+}
+
+func ensureAcroForm(xRefTable *XRefTable) (*PDFDict, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	obj, found := rootDict.Find("AcroForm")
+	if found {
+		return xRefTable.DereferenceDict(obj)
+	}
+
+	dict := NewPDFDict()
+	dict.Insert("Fields", PDFArray{})
+
+	indRef, err := xRefTable.IndRefForNewObject(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	rootDict.Insert("AcroForm", *indRef)
+
+	return &dict, nil
+}
+
+// signatureField returns the top level field named fieldName along with the names of all top level fields.
+func signatureField(xRefTable *XRefTable, acroForm *PDFDict, fieldName string) (*PDFDict, StringSet, error) {
+
+	names := StringSet{}
+
+	obj, found := acroForm.Find("Fields")
+	if !found {
+		return nil, names, nil
+	}
+
+	fields, err := xRefTable.DereferenceArray(obj)
+	if err != nil || fields == nil {
+		return nil, names, err
+	}
+
+	var field *PDFDict
+
+	for _, obj := range *fields {
+
+		dict, err := xRefTable.DereferenceDict(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if dict == nil {
+			continue
+		}
+
+		t := dict.StringEntry("T")
+		if t == nil {
+			continue
+		}
+
+		names[*t] = true
+
+		if fieldName != "" && *t == fieldName {
+			field = dict
+		}
+	}
+
+	return field, names, nil
+}
+
+func newSignatureFieldName(names StringSet) string {
+
+	for i := 1; ; i++ {
+		s := fmt.Sprintf("Signature%d", i)
+		if !names[s] {
+			return s
+		}
+	}
+}
+
+func signatureAppearanceLines(sig *Signature) []string {
+
+	lines := []string{
+		"Digitally signed by " + sig.Name,
+		"Date: " + sig.time.Format("2006.01.02 15:04:05 -07'00'"),
+	}
+
+	if sig.Reason != "" {
+		lines = append(lines, "Reason: "+sig.Reason)
+	}
+
+	if sig.Location != "" {
+		lines = append(lines, "Location: "+sig.Location)
+	}
+
+	return lines
+}
+
+// createSignatureAppearance returns a form XObject showing the signer and the signing time.
+func createSignatureAppearance(xRefTable *XRefTable, sig *Signature) (*PDFIndirectRef, error) {
+
+	w, h := sig.Rect.Width(), sig.Rect.Height()
+
+	lines := signatureAppearanceLines(sig)
+
+	fontSize := h / (float64(len(lines))*1.2 + 0.5)
+	if fontSize > 10 {
+		fontSize = 10
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "q 0 G 0.5 w 0.25 0.25 %.2f %.2f re S Q ", w-0.5, h-0.5)
+	fmt.Fprintf(&b, "BT 0 g /F0 %.2f Tf %.2f TL 2 %.2f Td", fontSize, fontSize*1.2, h-fontSize-1)
+
+	for i, s := range lines {
+		if i > 0 {
+			b.WriteString(" T*")
+		}
+		fmt.Fprintf(&b, " %sTj", escapedStringLiteral(s))
+	}
+
+	b.WriteString(" ET")
+
+	fontDict := NewPDFDict()
+	fontDict.InsertName("Type", "Font")
+	fontDict.InsertName("Subtype", "Type1")
+	fontDict.InsertName("BaseFont", "Helvetica")
+	fontDict.InsertName("Encoding", "WinAnsiEncoding")
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("XObject"),
+				"Subtype":  PDFName("Form"),
+				"FormType": PDFInteger(1),
+				"BBox":     NewRectangle(0, 0, w, h),
+				"Matrix":   NewIntegerArray(1, 0, 0, 1, 0, 0),
+				"Resources": PDFDict{
+					Dict: map[string]PDFObject{
+						"Font":    PDFDict{Dict: map[string]PDFObject{"F0": fontDict}},
+						"ProcSet": NewNameArray("PDF", "Text"),
+					},
+				},
+			},
+		},
+		Content:        b.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// estimatedSignatureSize leaves room for the certificates embedded along with the signature.
+func estimatedSignatureSize(kp *KeyPair) int {
+
+	n := 8192 + len(kp.Cert.Raw)
+
+	for _, cert := range kp.Chain {
+		n += len(cert.Raw)
+	}
+
+	return n
+}
+
+// docMDPReference returns the signature reference dict of a certification signature, see 12.8.2.2 DocMDP.
+func docMDPReference(p int) PDFDict {
+
+	params := NewPDFDict()
+	params.InsertName("Type", "TransformParams")
+	params.InsertInt("P", p)
+	params.InsertName("V", "1.2")
+
+	dict := NewPDFDict()
+	dict.InsertName("Type", "SigRef")
+	dict.InsertName("TransformMethod", "DocMDP")
+	dict.Insert("TransformParams", params)
+
+	return dict
+}
+
+func createSignatureDict(xRefTable *XRefTable, sig *Signature) (*PDFIndirectRef, error) {
+
+	dict := NewPDFDict()
+	dict.InsertName("Type", "Sig")
+	dict.InsertName("Filter", "Adobe.PPKLite")
+	dict.InsertName("SubFilter", sig.SubFilter)
+	dict.Insert("ByteRange", PDFArray{PDFInteger(0), byteRangePlaceholder, byteRangePlaceholder, byteRangePlaceholder})
+	dict.Insert("Contents", PDFHexLiteral(strings.Repeat("0", 2*sig.Size)))
+
+	// The timestamp token takes care of the signing time and the signer.
+	if sig.SubFilter == SubFilterRFC3161 {
+		dict.Update("Type", PDFName("DocTimeStamp"))
+		return xRefTable.IndRefForNewObject(dict)
+	}
+
+	dict.Insert("M", DateStringLiteral(sig.time))
+	dict.Insert("Name", escapedStringLiteral(sig.Name))
+
+	for k, v := range map[string]string{"Reason": sig.Reason, "Location": sig.Location, "ContactInfo": sig.ContactInfo} {
+		if v != "" {
+			dict.Insert(k, escapedStringLiteral(v))
+		}
+	}
+
+	if sig.Certify > 0 {
+		dict.Insert("Reference", PDFArray{docMDPReference(sig.Certify)})
+	}
+
+	return xRefTable.IndRefForNewObject(dict)
+}
+
+// setDocMDPSignature registers the signature dict of a certification signature in the permissions dict of the catalog.
+func setDocMDPSignature(xRefTable *XRefTable, rootDict *PDFDict, sigIndRef PDFIndirectRef) error {
+
+	obj, found := rootDict.Find("Perms")
+	if !found {
+		rootDict.Insert("Perms", PDFDict{Dict: map[string]PDFObject{"DocMDP": sigIndRef}})
+		return nil
+	}
+
+	dict, err := xRefTable.DereferenceDict(obj)
+	if err != nil || dict == nil {
+		return errors.New("sign: corrupt permissions dict")
+	}
+
+	dict.Update("DocMDP", sigIndRef)
+
+	return nil
+}
+
+// createSignatureWidget adds a signature field along with its widget annotation to the page.
+func createSignatureWidget(xRefTable *XRefTable, acroForm *PDFDict, sig *Signature, sigIndRef PDFIndirectRef) error {
+
+	pageIndRef, err := xRefTable.PageDictIndRef(sig.Page)
+	if err != nil {
+		return err
+	}
+
+	pageDict, err := xRefTable.DereferenceDict(*pageIndRef)
+	if err != nil {
+		return err
+	}
+
+	rect := NewRectangle(0, 0, 0, 0)
+
+	dict := NewPDFDict()
+	dict.InsertName("FT", "Sig")
+	dict.Insert("T", escapedStringLiteral(sig.FieldName))
+	dict.Insert("V", sigIndRef)
+	dict.InsertName("Type", "Annot")
+	dict.InsertName("Subtype", "Widget")
+	dict.InsertInt("F", 4) // Print
+	dict.Insert("P", *pageIndRef)
+
+	if sig.Rect != nil {
+		rect = NewRectangle(sig.Rect.LL.X, sig.Rect.LL.Y, sig.Rect.UR.X, sig.Rect.UR.Y)
+		apIndRef, err := createSignatureAppearance(xRefTable, sig)
+		if err != nil {
+			return err
+		}
+		dict.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": *apIndRef}})
+	}
+
+	dict.Insert("Rect", rect)
+
+	indRef, err := xRefTable.IndRefForNewObject(dict)
+	if err != nil {
+		return err
+	}
+
+	err = appendToArrayEntry(xRefTable, pageDict, "Annots", *indRef)
+	if err != nil {
+		return err
+	}
+
+	return appendToArrayEntry(xRefTable, acroForm, "Fields", *indRef)
+}
+
+// AddSignatureField prepares signing ctx using ctx.KeyPair by adding a signature dict
+// along with a signature field unless sig names an existing unsigned signature field.
+// A certification signature also gets registered as DocMDP signature in the catalog.
+// A document timestamp gets obtained from ctx.Timestamper instead.
+// The signature gets computed by WriteSignedPDFFile.
+func AddSignatureField(ctx *PDFContext, sig *Signature) error {
+
+	if !ctx.Incremental {
+		return errors.New("sign: signing requires an incremental update")
+	}
+
+	switch sig.SubFilter {
+	case "":
+		sig.SubFilter = SubFilterPKCS7Detached
+	case SubFilterPKCS7Detached, SubFilterCAdESDetached, SubFilterRFC3161:
+	default:
+		return errors.Errorf("sign: unsupported SubFilter %s", sig.SubFilter)
+	}
+
+	timestamp := sig.SubFilter == SubFilterRFC3161
+
+	kp := ctx.KeyPair
+
+	switch {
+	case timestamp && ctx.Timestamper == nil:
+		return errors.New("sign: missing timestamp authority")
+	case timestamp && sig.Certify > 0:
+		return errors.New("sign: a document timestamp can't certify")
+	case timestamp && sig.Rect != nil:
+		return errors.New("sign: a document timestamp is invisible")
+	case !timestamp && kp == nil:
+		return errors.New("sign: missing certificate and private key")
+	}
+
+	if sig.Page == 0 {
+		sig.Page = 1
+	}
+
+	if sig.Page > ctx.PageCount {
+		return errors.Errorf("sign: page %d out of range", sig.Page)
+	}
+
+	if sig.Certify < 0 || sig.Certify > 3 {
+		return errors.Errorf("sign: invalid DocMDP permissions %d", sig.Certify)
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	if sig.Certify > 0 {
+		// A certification signature has to be the first signature of a document.
+		fields, err := signatureFields(ctx.XRefTable)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if f.sig != nil {
+				return errors.New("sign: certification requires an unsigned document")
+			}
+		}
+	}
+
+	if timestamp {
+		if sig.Size == 0 {
+			sig.Size = timestampTokenSize
+		}
+	} else {
+		if sig.Name == "" {
+			sig.Name = kp.Cert.Subject.CommonName
+		}
+		if sig.Size == 0 {
+			sig.Size = estimatedSignatureSize(kp)
+		}
+	}
+
+	sig.time = time.Now()
+
+	acroForm, err := ensureAcroForm(ctx.XRefTable)
+	if err != nil {
+		return err
+	}
+
+	field, names, err := signatureField(ctx.XRefTable, acroForm, sig.FieldName)
+	if err != nil {
+		return err
+	}
+
+	if field != nil {
+		if ft := field.NameEntry("FT"); ft == nil || *ft != "Sig" {
+			return errors.Errorf("sign: field %s is not a signature field", sig.FieldName)
+		}
+		if _, found := field.Find("V"); found {
+			return errors.Errorf("sign: field %s is already signed", sig.FieldName)
+		}
+	}
+
+	if sig.FieldName == "" {
+		sig.FieldName = newSignatureFieldName(names)
+	}
+
+	sigIndRef, err := createSignatureDict(ctx.XRefTable, sig)
+	if err != nil {
+		return err
+	}
+
+	sig.objNr = sigIndRef.ObjectNumber.Value()
+
+	if sig.Certify > 0 {
+		if err = setDocMDPSignature(ctx.XRefTable, rootDict, *sigIndRef); err != nil {
+			return err
+		}
+	}
+
+	if field != nil {
+		field.Insert("V", *sigIndRef)
+	} else {
+		err = createSignatureWidget(ctx.XRefTable, acroForm, sig, *sigIndRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	// SignaturesExist, AppendOnly
+	acroForm.Update("SigFlags", PDFInteger(3))
+
+	log.Info.Printf("sign: field %s, signature dict obj#%d\n", sig.FieldName, sig.objNr)
+
+	return nil
+}
+
+// signatureFile is the written file getting signed in place.
+type signatureFile interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// writeSignatureDictObject writes the signature dict starting with ByteRange and Contents
+// and records their offsets for signWrittenFile.
+func writeSignatureDictObject(ctx *PDFContext, objNr, genNr int, dict PDFDict) error {
+
+	br, ok1 := dict.Find("ByteRange")
+	contents, ok2 := dict.Find("Contents")
+	if !ok1 || !ok2 {
+		return errors.New("sign: corrupt signature dict")
+	}
+
+	d := NewPDFDict()
+	for k, v := range dict.Dict {
+		if k != "ByteRange" && k != "Contents" {
+			d.Insert(k, v)
+		}
+	}
+
+	if stringsEncrypted(ctx.XRefTable) {
+		if _, err := encryptDeepObject(d, objNr, genNr, ctx.EncKey, ctx.AES4Strings); err != nil {
+			return err
+		}
+	}
+
+	prefix := "<</ByteRange" + br.PDFString() + "/Contents"
+
+	w := ctx.Write
+	offset := w.Offset + int64(len(objectHeader(w, objNr, genNr)))
+	w.sigByteRange = offset + int64(len("<</ByteRange"))
+	w.sigContents = offset + int64(len(prefix))
+
+	return writePDFObject(ctx, objNr, genNr, prefix+contents.PDFString()+strings.TrimPrefix(d.PDFString(), "<<"))
+}
+
+// byteRangeDigest returns the digest of the file excluding the Contents hex string.
+func byteRangeDigest(f io.ReaderAt, br [4]int64, h hash.Hash) ([]byte, error) {
+
+	for i := 0; i < 4; i += 2 {
+		if _, err := io.Copy(h, io.NewSectionReader(f, br[i], br[i+1])); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// signWrittenFile fills in ByteRange and Contents of the signature dict written to f.
+func signWrittenFile(ctx *PDFContext, sig *Signature, f signatureFile) error {
+
+	brOffset, contentsOffset := ctx.Write.sigByteRange, ctx.Write.sigContents
+	if contentsOffset == 0 {
+		return errors.New("sign: signature dict not written")
+	}
+
+	fileSize := ctx.Write.FileSize
+
+	contentsEnd := contentsOffset + int64(2*sig.Size+2)
+
+	br := [4]int64{0, contentsOffset, contentsEnd, fileSize - contentsEnd}
+
+	placeholder := PDFArray{PDFInteger(0), byteRangePlaceholder, byteRangePlaceholder, byteRangePlaceholder}.PDFString()
+
+	s := fmt.Sprintf("[%d %d %d %d]", br[0], br[1], br[2], br[3])
+	if len(s) > len(placeholder) {
+		return errors.New("sign: file too large")
+	}
+
+	s += strings.Repeat(" ", len(placeholder)-len(s))
+
+	if _, err := f.WriteAt([]byte(s), brOffset); err != nil {
+		return err
+	}
+
+	digest, err := byteRangeDigest(f, br, sha256.New())
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+
+	if sig.SubFilter == SubFilterRFC3161 {
+		b, err = requestTimestamp(ctx.Context, ctx.Timestamper, digest, crypto.SHA256)
+	} else {
+		b, err = signDetached(digest, ctx.KeyPair, sig.SubFilter == SubFilterCAdESDetached, sig.time)
+	}
+	if err != nil {
+		return errors.Wrap(err, "sign")
+	}
+
+	if len(b) > sig.Size {
+		return errors.Errorf("sign: signature needs %d bytes, only %d reserved", len(b), sig.Size)
+	}
+
+	contents := fmt.Sprintf("%X", b)
+
+	_, err = f.WriteAt([]byte(contents), contentsOffset+1)
+
+	return err
+}
+
+// WriteSignedPDFFile writes ctx prepared by AddSignatureField as an incremental update to fileName and signs it.
+func WriteSignedPDFFile(ctx *PDFContext, sig *Signature, fileName string) error {
+
+	log.Info.Printf("writing to %s\n", fileName)
+
+	return writeFile(fileName, func(w io.Writer) error {
+
+		f, ok := w.(signatureFile)
+		if !ok {
+			return errors.New("sign: output does not support random access")
+		}
+
+		ctx.Write.sigObjNr = sig.objNr
+
+		err := WritePDF(ctx, w)
+		if err != nil {
+			return err
+		}
+
+		return signWrittenFile(ctx, sig, f)
+	})
+}
@@ -65,6 +65,77 @@ func (streamDict PDFStreamDict) HasSoleFilterNamed(filterName string) bool {
 	return soleFilter.Name == filterName
 }
 
+// updateFilterEntries sets the entries "Filter" and "DecodeParms" according to the filter pipeline.
+func (streamDict *PDFStreamDict) updateFilterEntries() {
+
+	streamDict.Delete("Filter")
+	streamDict.Delete("DecodeParms")
+
+	fpl := streamDict.FilterPipeline
+
+	if len(fpl) == 0 {
+		streamDict.FilterPipeline = nil
+		return
+	}
+
+	if len(fpl) == 1 {
+		streamDict.Insert("Filter", PDFName(fpl[0].Name))
+		if fpl[0].DecodeParms != nil {
+			streamDict.Insert("DecodeParms", *fpl[0].DecodeParms)
+		}
+		return
+	}
+
+	var filters, decodeParms PDFArray
+	var hasDecodeParms bool
+
+	for _, f := range fpl {
+		filters = append(filters, PDFName(f.Name))
+		if f.DecodeParms == nil {
+			decodeParms = append(decodeParms, nil)
+			continue
+		}
+		decodeParms = append(decodeParms, *f.DecodeParms)
+		hasDecodeParms = true
+	}
+
+	streamDict.Insert("Filter", filters)
+	if hasDecodeParms {
+		streamDict.Insert("DecodeParms", decodeParms)
+	}
+}
+
+// InsertCryptFilter applies the named crypt filter to this stream.
+// Use "Identity" in order to leave this stream unencrypted when writing an encrypted file.
+func (streamDict *PDFStreamDict) InsertCryptFilter(name string) {
+
+	d := NewPDFDict()
+	d.Insert("Type", PDFName("CryptFilterDecodeParms"))
+	d.Insert("Name", PDFName(name))
+
+	f := PDFFilter{Name: filter.Crypt, DecodeParms: &d}
+
+	fpl := streamDict.FilterPipeline
+	if len(fpl) > 0 && fpl[0].Name == filter.Crypt {
+		fpl[0] = f
+	} else {
+		streamDict.FilterPipeline = append([]PDFFilter{f}, fpl...)
+	}
+
+	streamDict.updateFilterEntries()
+}
+
+// removeCryptFilter removes the crypt filter of this stream.
+func (streamDict *PDFStreamDict) removeCryptFilter() {
+
+	if _, ok := cryptFilterName(streamDict); !ok {
+		return
+	}
+
+	streamDict.FilterPipeline = streamDict.FilterPipeline[1:]
+	streamDict.updateFilterEntries()
+}
+
 // PDFObjectStreamDict represents a object stream dictionary.
 type PDFObjectStreamDict struct {
 	PDFStreamDict
@@ -0,0 +1,262 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// => RFC 3161 Time-Stamp Protocol, 12.8.5 Document timestamp dictionary (PDF 2.0)
+//
+// A document timestamp is a signature dict of type DocTimeStamp using the SubFilter ETSI.RFC3161.
+// Its Contents is a timestamp token obtained from a Time Stamping Authority (TSA)
+// for the digest of the byte range: a SignedData encapsulating a TSTInfo.
+
+// SubFilterRFC3161 is the format of document timestamps.
+const SubFilterRFC3161 = "ETSI.RFC3161"
+
+// timestampTokenSize is the default number of bytes reserved for a timestamp token
+// which includes the certificates of the TSA.
+const timestampTokenSize = 16384
+
+var oidTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+// RFC 3161 MessageImprint
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// RFC 3161 TimeStampReq
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+// RFC 3161 PKIStatusInfo
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// RFC 3161 TimeStampResp
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// RFC 3161 Accuracy
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// RFC 3161 TSTInfo
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue    // GeneralizedTime possibly including fractional seconds.
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,explicit,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Timestamper obtains RFC 3161 timestamp tokens from a Time Stamping Authority (TSA).
+type Timestamper interface {
+	// Timestamp sends the DER encoded TimeStampReq req and returns the DER encoded TimeStampResp.
+	Timestamp(c context.Context, req []byte) ([]byte, error)
+}
+
+// TSAClient is a Timestamper talking to a TSA via HTTP, see RFC 3161 3.4.
+type TSAClient struct {
+	URL    string
+	Client *http.Client // nil for http.DefaultClient.
+}
+
+// Timestamp posts req to the URL of the TSA.
+func (tsa TSAClient) Timestamp(c context.Context, req []byte) ([]byte, error) {
+
+	r, err := http.NewRequest(http.MethodPost, tsa.URL, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.WithContext(c)
+	r.Header.Set("Content-Type", "application/timestamp-query")
+
+	client := tsa.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", tsa.URL, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func digestAlgorithm(hash crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+
+	for _, da := range digestAlgorithms {
+		if da.hash == hash {
+			return pkix.AlgorithmIdentifier{Algorithm: da.oid, Parameters: asn1.NullRawValue}, nil
+		}
+	}
+
+	return pkix.AlgorithmIdentifier{}, errors.Errorf("unsupported digest algorithm %v", hash)
+}
+
+// genTime returns the time the timestamp token has been created.
+func (info *tstInfo) genTime() (time.Time, error) {
+
+	if info.GenTime.Class != asn1.ClassUniversal || info.GenTime.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, errors.New("invalid genTime")
+	}
+
+	// Fractional seconds are accepted although not part of the layout.
+	return time.Parse("20060102150405Z0700", string(info.GenTime.Bytes))
+}
+
+// parseTimestampToken returns the TSTInfo of a timestamp token.
+func parseTimestampToken(s *cmsSignature) (*tstInfo, error) {
+
+	if !s.contentType.Equal(oidTSTInfo) {
+		return nil, errors.Errorf("timestamp token: unexpected content type %v", s.contentType)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(s.content, &info); err != nil {
+		return nil, errors.Wrap(err, "timestamp token")
+	}
+
+	if _, err := info.genTime(); err != nil {
+		return nil, errors.Wrap(err, "timestamp token")
+	}
+
+	return &info, nil
+}
+
+// requestTimestamp returns a timestamp token for digest computed using hash.
+func requestTimestamp(c context.Context, tsa Timestamper, digest []byte, hash crypto.Hash) ([]byte, error) {
+
+	alg, err := digestAlgorithm(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{HashAlgorithm: alg, HashedMessage: digest},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		c = context.Background()
+	}
+
+	b, err := tsa.Timestamp(c, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "timestamp")
+	}
+
+	var resp timeStampResp
+	if _, err = asn1.Unmarshal(b, &resp); err != nil {
+		return nil, errors.Wrap(err, "timestamp: invalid response")
+	}
+
+	// granted or grantedWithMods
+	if resp.Status.Status > 1 {
+		return nil, errors.Errorf("timestamp: rejected with status %d %s", resp.Status.Status, strings.Join(resp.Status.StatusString, " "))
+	}
+
+	token := resp.TimeStampToken.FullBytes
+	if len(token) == 0 {
+		return nil, errors.New("timestamp: missing token")
+	}
+
+	s, err := parseSignedData(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "timestamp token")
+	}
+
+	info, err := parseTimestampToken(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(alg.Algorithm) || !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("timestamp token: message imprint mismatch")
+	}
+
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp token: nonce mismatch")
+	}
+
+	h := s.hash.New()
+	h.Write(s.content)
+	contentDigest := h.Sum(nil)
+
+	if !s.verifyDigest(contentDigest) {
+		return nil, errors.New("timestamp token: digest mismatch")
+	}
+
+	if err = s.verifySignature(contentDigest); err != nil {
+		return nil, errors.Wrap(err, "timestamp token")
+	}
+
+	return token, nil
+}
@@ -28,7 +28,7 @@ func validateSignatureDict(xRefTable *XRefTable, obj PDFObject) error {
 	}
 
 	// Type, optional, name
-	_, err = validateNameEntry(xRefTable, dict, "signatureDict", "Type", OPTIONAL, V10, func(s string) bool { return s == "Sig" })
+	_, err = validateNameEntry(xRefTable, dict, "signatureDict", "Type", OPTIONAL, V10, func(s string) bool { return s == "Sig" || s == "DocTimeStamp" })
 
 	// process signature dict fields.
 
@@ -366,7 +366,13 @@ func validateAcroFormXFA(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVe
 		return errors.New("validateAcroFormXFA: needs to be streamDict or array")
 	}
 
-	return xRefTable.ValidateVersion("AcroFormXFA", sinceVersion)
+	err = xRefTable.ValidateVersion("AcroFormXFA", sinceVersion)
+	if err != nil {
+		return err
+	}
+
+	// XFA forms are deprecated in PDF 2.0.
+	return xRefTable.ValidateDeprecated("AcroFormXFA", V20)
 }
 
 func validateQ(i int) bool { return i >= 0 && i <= 2 }
@@ -589,7 +589,7 @@ func validateEntryIT(xRefTable *XRefTable, dict *PDFDict, dictName string, requi
 			return s == "PolygonCloud"
 		}
 
-		if xRefTable.Version() == V17 {
+		if xRefTable.Version() >= V17 {
 			if memberOf(s, []string{"PolygonCloud", "PolyLineDimension", "PolygonDimension"}) {
 				return true
 			}
@@ -1423,6 +1423,24 @@ func validateAnnotationDictGeneral(xRefTable *XRefTable, dict *PDFDict, dictName
 		return nil, err
 	}
 
+	// AF, optional, array of file specification dicts, since V2.0
+	err = validateEntryAF(xRefTable, dict, dictName, OPTIONAL, V20)
+	if err != nil {
+		return nil, err
+	}
+
+	// BM, optional, name, since V2.0
+	err = validateBlendModeEntry(xRefTable, dict, dictName, "BM", OPTIONAL, V20)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lang, optional, text string, since V2.0
+	_, err = validateStringEntry(xRefTable, dict, dictName, "Lang", OPTIONAL, V20, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	return subtype, nil
 }
 
@@ -1461,6 +1479,8 @@ func validateAnnotationDictConcrete(xRefTable *XRefTable, dict *PDFDict, subtype
 		"Watermark":      {validateAnnotationDictWatermark, V16, false},
 		"3D":             {validateAnnotationDict3D, V16, false},
 		"Redact":         {validateAnnotationDictRedact, V17, true},
+		"Projection":     {validateAnnotationDictProjection, V20, true},
+		"RichMedia":      {validateAnnotationDictRichMedia, V20, false},
 	} {
 		if subtype.Value() == k {
 
@@ -1483,6 +1503,32 @@ func validateAnnotationDictConcrete(xRefTable *XRefTable, dict *PDFDict, subtype
 	return errors.Errorf("validateAnnotationDictConcrete: unsupported annotation subtype:%s\n", subtype)
 }
 
+func validateAnnotationDictProjection(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	// see 12.5.6.24
+
+	// ExData, optional, dict
+	_, err := validateDictEntry(xRefTable, dict, dictName, "ExData", OPTIONAL, V20, nil)
+
+	return err
+}
+
+func validateAnnotationDictRichMedia(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	// see 13.7.2 RichMedia annotations
+
+	// RichMediaContent, required, dict
+	_, err := validateDictEntry(xRefTable, dict, dictName, "RichMediaContent", REQUIRED, V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// RichMediaSettings, optional, dict
+	_, err = validateDictEntry(xRefTable, dict, dictName, "RichMediaSettings", OPTIONAL, V20, nil)
+
+	return err
+}
+
 func validateAnnotationDictSpecial(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
 
 	// AAPL:AKExtras
@@ -329,3 +329,48 @@ func validateDate(s string) bool {
 
 // Date validates an ISO/IEC 8824 compliant date string.
 func Date(s string) bool { return validateDate(s) }
+
+// DateTime returns the time represented by an ISO/IEC 8824 compliant date string.
+func DateTime(s string) (time.Time, bool) {
+
+	if !validateDate(s) {
+		return time.Time{}, false
+	}
+
+	s, _ = prevalidateDate(s)
+	s = s[2:]
+
+	i := strings.IndexAny(s, "Z+-")
+	if i < 0 {
+		i = len(s)
+	}
+
+	// Missing components default to the start of the enclosing period.
+	digits := s[:i] + "0101000000"[i-4:]
+
+	t, err := time.Parse("20060102150405", digits)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	tz := s[i:]
+	if len(tz) < 3 || tz[0] == 'Z' {
+		return t, true
+	}
+
+	// "OHH'mm"
+	h, _ := strconv.Atoi(tz[1:3])
+	m := 0
+	if len(tz) >= 6 {
+		m, _ = strconv.Atoi(tz[4:6])
+	}
+
+	offset := h*3600 + m*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	loc := time.FixedZone("", offset)
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), true
+}
@@ -395,10 +395,52 @@ func validateFileSpecDict(xRefTable *XRefTable, dict *PDFDict) error {
 
 	// CI, optional, collection item dict, since V1.7
 	_, err = validateDictEntry(xRefTable, dict, dictName, "CI", OPTIONAL, V17, nil)
+	if err != nil {
+		return err
+	}
+
+	// AFRelationship, optional, name, since V2.0
+	var validateAFRelationship func(s string) bool
+	if xRefTable.ValidationMode == ValidationStrict {
+		validateAFRelationship = func(s string) bool {
+			return memberOf(s, []string{"Source", "Data", "Alternative", "Supplement", "EncryptedPayload", "FormData", "Schema", "Unspecified"})
+		}
+	}
+	_, err = validateNameEntry(xRefTable, dict, dictName, "AFRelationship", OPTIONAL, V20, validateAFRelationship)
 
 	return err
 }
 
+func validateEntryAF(xRefTable *XRefTable, dict *PDFDict, dictName string, required bool, sinceVersion PDFVersion) error {
+
+	// AF, optional, array of file specification dicts, since V2.0
+	// => 14.13 Associated Files
+
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, "AF", required, sinceVersion, nil)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	for _, v := range *arr {
+
+		d, err := xRefTable.DereferenceDict(v)
+		if err != nil {
+			return err
+		}
+
+		if d == nil {
+			continue
+		}
+
+		err = validateFileSpecDict(xRefTable, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func validateFileSpecification(xRefTable *XRefTable, obj PDFObject) (PDFObject, error) {
 
 	// See 7.11.4
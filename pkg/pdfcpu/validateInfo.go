@@ -73,6 +73,14 @@ func validateDocumentInfoDict(xRefTable *XRefTable, obj PDFObject) (hasModDate b
 
 	for k, v := range dict.Dict {
 
+		// PDF 2.0 deprecates all entries but CreationDate and ModDate in favour of XMP metadata.
+		if k != "CreationDate" && k != "ModDate" {
+			err = xRefTable.ValidateDeprecated("dict=infoDict entry="+k, V20)
+			if err != nil {
+				return false, err
+			}
+		}
+
 		switch k {
 
 		// text string, opt, since V1.1
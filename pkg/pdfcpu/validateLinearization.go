@@ -0,0 +1,181 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// linearizationParms holds the linearization parameter dict of a file along with the file properties it describes.
+type linearizationParms struct {
+	objNr       int
+	dict        PDFDict
+	offset      int64   // Offset of the linearization parameter dict, -1 if compressed.
+	fileSize    int64   // Size of the file read.
+	xRefOffsets []int64 // Offsets of all xref sections following Prev starting with startxref.
+}
+
+func firstPageObjNr(xRefTable *XRefTable) (int, error) {
+
+	indRef, err := xRefTable.Pages()
+	if err != nil || indRef == nil {
+		return 0, err
+	}
+
+	// Guard against cycles in the page tree.
+	visited := IntSet{}
+
+	for !visited[indRef.ObjectNumber.Value()] {
+
+		visited[indRef.ObjectNumber.Value()] = true
+
+		dict, err := xRefTable.DereferenceDict(*indRef)
+		if err != nil || dict == nil {
+			return 0, err
+		}
+
+		if t := dict.Type(); t == nil || *t != "Pages" {
+			return indRef.ObjectNumber.Value(), nil
+		}
+
+		kids, err := xRefTable.DereferenceArray(dict.Dict["Kids"])
+		if err != nil || kids == nil || len(*kids) == 0 {
+			return 0, err
+		}
+
+		ir, ok := (*kids)[0].(PDFIndirectRef)
+		if !ok {
+			return 0, nil
+		}
+		indRef = &ir
+	}
+
+	return 0, nil
+}
+
+func validateHintStreamOffset(xRefTable *XRefTable, offset, length, fileSize int) error {
+
+	if offset <= 0 || length <= 0 || offset+length > fileSize {
+		return errors.Errorf("validateLinearization: hint stream [%d %d] out of range", offset, length)
+	}
+
+	for _, entry := range xRefTable.Table {
+		if entry.Free || entry.Compressed || entry.Offset == nil || *entry.Offset != int64(offset) {
+			continue
+		}
+		if _, ok := entry.Object.(PDFStreamDict); ok {
+			return nil
+		}
+	}
+
+	return errors.Errorf("validateLinearization: no hint stream at offset %d", offset)
+}
+
+// validateLinearization checks that the linearization parameter dict of a linearized file is consistent with the file.
+// Relaxed validation only logs inconsistencies since readers fall back to reading the file as a whole.
+func validateLinearization(xRefTable *XRefTable) error {
+
+	lp := xRefTable.linearization
+	if lp == nil {
+		return nil
+	}
+
+	log.Debug.Printf("validateLinearization: obj#%d\n", lp.objNr)
+
+	err := validateLinearizationParms(xRefTable, lp)
+	if err != nil && xRefTable.ValidationMode == ValidationRelaxed {
+		log.Info.Printf("ignoring inconsistent linearization dict: %v\n", err)
+		return nil
+	}
+
+	return err
+}
+
+func validateLinearizationParms(xRefTable *XRefTable, lp *linearizationParms) error {
+
+	// => F.2 Linearization Parameter Dictionary
+
+	dict := lp.dict
+
+	vals := map[string]int{}
+	for _, k := range []string{"L", "O", "E", "N", "T"} {
+		i := dict.IntEntry(k)
+		if i == nil {
+			return errors.Errorf("validateLinearization: missing integer entry \"%s\"", k)
+		}
+		vals[k] = *i
+	}
+
+	// An incremental update invalidates the linearization.
+	if int64(vals["L"]) != lp.fileSize {
+		log.Info.Printf("validateLinearization: ignoring outdated linearization dict (L=%d, file size=%d)\n", vals["L"], lp.fileSize)
+		return nil
+	}
+
+	fileSize := vals["L"]
+
+	if lp.offset < 0 || lp.offset > 1024 {
+		return errors.New("validateLinearization: linearization dict must be the first object within the first 1024 bytes")
+	}
+
+	h := dict.PDFArrayEntry("H")
+	if h == nil || len(*h) != 2 && len(*h) != 4 {
+		return errors.New("validateLinearization: corrupt entry \"H\"")
+	}
+
+	for i := 0; i < len(*h); i += 2 {
+		offset, ok1 := (*h)[i].(PDFInteger)
+		length, ok2 := (*h)[i+1].(PDFInteger)
+		if !ok1 || !ok2 {
+			return errors.New("validateLinearization: corrupt entry \"H\"")
+		}
+		if err := validateHintStreamOffset(xRefTable, offset.Value(), length.Value(), fileSize); err != nil {
+			return err
+		}
+	}
+
+	if vals["N"] != xRefTable.PageCount {
+		return errors.Errorf("validateLinearization: N=%d, but document has %d pages", vals["N"], xRefTable.PageCount)
+	}
+
+	objNr, err := firstPageObjNr(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	if vals["O"] != objNr {
+		return errors.Errorf("validateLinearization: O=%d, but first page is obj#%d", vals["O"], objNr)
+	}
+
+	if vals["E"] <= 0 || vals["E"] > fileSize {
+		return errors.Errorf("validateLinearization: E=%d out of range", vals["E"])
+	}
+
+	// The first page cross reference section points to the main cross reference section.
+	if len(lp.xRefOffsets) != 2 {
+		return errors.Errorf("validateLinearization: %d cross reference sections, expected 2", len(lp.xRefOffsets))
+	}
+
+	// T is the offset of the white-space character preceding the first entry of the main cross reference section.
+	main := int(lp.xRefOffsets[1])
+	if vals["T"] < main-1 || vals["T"] > main+32 {
+		return errors.Errorf("validateLinearization: T=%d, but main cross reference section at offset %d", vals["T"], main)
+	}
+
+	return nil
+}
@@ -732,10 +732,37 @@ func validatePageEntryVP(xRefTable *XRefTable, pagesDict *PDFDict, required bool
 	return nil
 }
 
+func validatePageEntryAF(xRefTable *XRefTable, pageDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// see 14.13 Associated Files
+
+	return validateEntryAF(xRefTable, pageDict, "pageDict", required, sinceVersion)
+}
+
+func validatePageEntryOutputIntents(xRefTable *XRefTable, pageDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// see 14.11.5 Output Intents
+
+	return validateOutputIntentsEntry(xRefTable, pageDict, "pageDict", required, sinceVersion)
+}
+
+func validatePageEntryDPart(xRefTable *XRefTable, pageDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// see 14.12 Document Parts
+
+	_, err := validateDictEntry(xRefTable, pageDict, "pageDict", "DPart", required, sinceVersion, nil)
+
+	return err
+}
+
 func validatePageDict(xRefTable *XRefTable, pageDict *PDFDict, objNumber, genNumber int, hasResources, hasMediaBox bool) error {
 
 	dictName := "pageDict"
 
+	if err := xRefTable.cancelled(); err != nil {
+		return err
+	}
+
 	if indref := pageDict.IndirectRefEntry("Parent"); indref == nil {
 		return errors.New("validatePageDict: missing parent")
 	}
@@ -812,6 +839,9 @@ func validatePageDict(xRefTable *XRefTable, pageDict *PDFDict, objNumber, genNum
 		{validatePageEntryPresSteps, OPTIONAL, V15},
 		{validatePageEntryUserUnit, OPTIONAL, V16},
 		{validatePageEntryVP, OPTIONAL, V16},
+		{validatePageEntryAF, OPTIONAL, V20},
+		{validatePageEntryOutputIntents, OPTIONAL, V20},
+		{validatePageEntryDPart, OPTIONAL, V20},
 	} {
 		err = f.validate(xRefTable, pageDict, f.required, f.sinceVersion)
 		if err != nil {
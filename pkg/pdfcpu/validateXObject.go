@@ -513,7 +513,8 @@ func validateImageStreamDictPart2(xRefTable *XRefTable, streamDict *PDFStreamDic
 		}
 	}
 
-	return nil
+	// AF, array of dicts, optional, since V2.0
+	return validateEntryAF(xRefTable, &dict, dictName, OPTIONAL, V20)
 }
 
 func validateImageStreamDict(xRefTable *XRefTable, streamDict *PDFStreamDict, isAlternate bool) error {
@@ -731,7 +732,8 @@ func validateFormStreamDictPart2(xRefTable *XRefTable, dict *PDFDict, dictName s
 		return err
 	}
 
-	return nil
+	// AF, array of dicts, optional, since V2.0
+	return validateEntryAF(xRefTable, dict, dictName, OPTIONAL, V20)
 }
 
 func validateFormStreamDict(xRefTable *XRefTable, streamDict *PDFStreamDict) error {
@@ -17,6 +17,9 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"encoding/hex"
+	"strings"
+
 	"github.com/iPaladinLLC/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
 )
@@ -39,6 +42,12 @@ func ValidateXRefTable(xRefTable *XRefTable) error {
 		return err
 	}
 
+	// Validate linearization parameters against the file.
+	err = validateLinearization(xRefTable)
+	if err != nil {
+		return err
+	}
+
 	// Validate offspec additional streams as declared in pdf trailer.
 	err = validateAdditionalStreams(xRefTable)
 	if err != nil {
@@ -491,7 +500,12 @@ func validateOutputIntents(xRefTable *XRefTable, rootDict *PDFDict, required boo
 		sinceVersion = V13
 	}
 
-	arr, err := validateArrayEntry(xRefTable, rootDict, "rootDict", "OutputIntents", required, sinceVersion, nil)
+	return validateOutputIntentsEntry(xRefTable, rootDict, "rootDict", required, sinceVersion)
+}
+
+func validateOutputIntentsEntry(xRefTable *XRefTable, dict *PDFDict, dictName string, required bool, sinceVersion PDFVersion) error {
+
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, "OutputIntents", required, sinceVersion, nil)
 	if err != nil || arr == nil {
 		return err
 	}
@@ -570,17 +584,129 @@ func validatePieceInfo(xRefTable *XRefTable, dict *PDFDict, dictName, entryName
 	return hasPieceInfo, nil
 }
 
-// TODO implement
 func validatePermissions(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
 
 	// => 12.8.4 Permissions
 
-	dict, err := validateDictEntry(xRefTable, rootDict, "rootDict", "Permissions", required, sinceVersion, nil)
+	dict, err := validateDictEntry(xRefTable, rootDict, "rootDict", "Perms", required, sinceVersion, nil)
 	if err != nil || dict == nil {
 		return err
 	}
 
-	return errors.New("*** validatePermissions: not supported ***")
+	// DocMDP and UR3, optional, signature dicts
+	for _, k := range []string{"DocMDP", "UR3"} {
+		if obj, found := dict.Find(k); found {
+			if err = validateSignatureDict(xRefTable, obj); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateStreamArrayEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, sinceVersion PDFVersion) error {
+
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, entryName, OPTIONAL, sinceVersion, nil)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	for _, obj := range *arr {
+		if _, ok := obj.(PDFIndirectRef); !ok && xRefTable.ValidationMode != ValidationRelaxed {
+			return errors.Errorf("validateStreamArrayEntry: dict=%s entry=%s stream must be indirect", dictName, entryName)
+		}
+		if _, err = validateStreamDict(xRefTable, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateVRIDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVersion) error {
+
+	dictName := "VRIDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "VRI" })
+	if err != nil {
+		return err
+	}
+
+	// Cert, OCSP, CRL, optional, arrays of streams
+	for _, k := range []string{"Cert", "OCSP", "CRL"} {
+		if err = validateStreamArrayEntry(xRefTable, dict, dictName, k, sinceVersion); err != nil {
+			return err
+		}
+	}
+
+	// TU, optional, date
+	if _, err = validateDateEntry(xRefTable, dict, dictName, "TU", OPTIONAL, sinceVersion); err != nil {
+		return err
+	}
+
+	// TS, optional, stream
+	_, err = validateStreamDictEntry(xRefTable, dict, dictName, "TS", OPTIONAL, sinceVersion, nil)
+
+	return err
+}
+
+func validateDSS(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// => 12.8.4.3 Document Security Store (PDF 2.0), ETSI EN 319 142-1 5.4
+
+	// PAdES applies the DSS to any PDF version.
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		sinceVersion = V10
+	}
+
+	dict, err := validateDictEntry(xRefTable, rootDict, "rootDict", "DSS", required, sinceVersion, nil)
+	if err != nil || dict == nil {
+		return err
+	}
+
+	dictName := "DSS"
+
+	// Type, optional, name
+	_, err = validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "DSS" })
+	if err != nil {
+		return err
+	}
+
+	// Certs, OCSPs, CRLs, optional, arrays of streams
+	for _, k := range []string{"Certs", "OCSPs", "CRLs"} {
+		if err = validateStreamArrayEntry(xRefTable, dict, dictName, k, sinceVersion); err != nil {
+			return err
+		}
+	}
+
+	// VRI, optional, dict of VRI dicts keyed by the uppercase hex SHA-1 digest of a signature
+	vri, err := validateDictEntry(xRefTable, dict, dictName, "VRI", OPTIONAL, sinceVersion, nil)
+	if err != nil || vri == nil {
+		return err
+	}
+
+	for k, obj := range vri.Dict {
+
+		if len(k) != 40 || (strings.ToUpper(k) != k && xRefTable.ValidationMode != ValidationRelaxed) {
+			return errors.Errorf("validateDSS: invalid VRI key %s", k)
+		}
+		if _, err = hex.DecodeString(k); err != nil {
+			return errors.Errorf("validateDSS: invalid VRI key %s", k)
+		}
+
+		d, err := xRefTable.DereferenceDict(obj)
+		if err != nil || d == nil {
+			return errors.Errorf("validateDSS: invalid VRI entry %s", k)
+		}
+
+		if err = validateVRIDict(xRefTable, d, sinceVersion); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // TODO implement
@@ -808,7 +934,53 @@ func validateCollection(xRefTable *XRefTable, rootDict *PDFDict, required bool,
 
 func validateNeedsRendering(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
 
-	_, err := validateBooleanEntry(xRefTable, rootDict, "rootDict", "NeedsRendering", required, sinceVersion, nil)
+	b, err := validateBooleanEntry(xRefTable, rootDict, "rootDict", "NeedsRendering", required, sinceVersion, nil)
+	if err != nil || b == nil {
+		return err
+	}
+
+	// XFA forms are deprecated in PDF 2.0.
+	return xRefTable.ValidateDeprecated("dict=rootDict entry=NeedsRendering", V20)
+}
+
+func validateRootAF(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// => 14.13 Associated Files
+
+	return validateEntryAF(xRefTable, rootDict, "rootDict", required, sinceVersion)
+}
+
+func validateDPartRoot(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
+
+	// => 14.12 Document Parts
+
+	dict, err := validateDictEntry(xRefTable, rootDict, "rootDict", "DPartRoot", required, sinceVersion, nil)
+	if err != nil || dict == nil {
+		return err
+	}
+
+	dictName := "DPartRootDict"
+
+	// Type, optional, name
+	_, err = validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "DPartRoot" })
+	if err != nil {
+		return err
+	}
+
+	// DPartRootNode, required, dict
+	_, err = validateDictEntry(xRefTable, dict, dictName, "DPartRootNode", REQUIRED, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
+
+	// RecordLevel, optional, integer
+	_, err = validateIntegerEntry(xRefTable, dict, dictName, "RecordLevel", OPTIONAL, sinceVersion, func(i int) bool { return i >= 0 })
+	if err != nil {
+		return err
+	}
+
+	// NodeNameList, optional, array of names
+	_, err = validateNameArrayEntry(xRefTable, dict, dictName, "NodeNameList", OPTIONAL, sinceVersion, nil)
 
 	return err
 }
@@ -846,10 +1018,13 @@ func validateRootObject(xRefTable *XRefTable) error {
 	// PieceInfo            y   1.4         dict            => 14.5 Page-Piece Dictionaries
 	// OCProperties         y   1.5         dict            => 8.11.4 Configuring Optional Content
 	// Perms                y   1.5         dict            => 12.8.4 Permissions
+	// DSS                  y   1.7         dict            => 12.8.4.3 Document Security Store (PDF 2.0)
 	// Legal                y   1.5         dict            => 12.8.5 Legal Content Attestations
 	// Requirements         y   1.7         array           => 12.10 Document Requirements
 	// Collection           y   1.7         dict            => 12.3.5 Collections
-	// NeedsRendering       y   1.7         boolean         => XML Forms Architecture (XFA) Spec.
+	// NeedsRendering       y   1.7         boolean         => XML Forms Architecture (XFA) Spec., deprecated in 2.0
+	// AF                   y   2.0         array of dicts  => 14.13 Associated Files
+	// DPartRoot            y   2.0         dict            => 14.12 Document Parts
 
 	rootDict, err := xRefTable.Catalog()
 	if err != nil {
@@ -896,11 +1071,17 @@ func validateRootObject(xRefTable *XRefTable) error {
 		{validateRootPieceInfo, OPTIONAL, V14},
 		{validateOCProperties, OPTIONAL, V15},
 		{validatePermissions, OPTIONAL, V15},
+		{validateDSS, OPTIONAL, V17},
 		{validateLegal, OPTIONAL, V17},
 		{validateRequirements, OPTIONAL, V17},
 		{validateCollection, OPTIONAL, V17},
 		{validateNeedsRendering, OPTIONAL, V17},
+		{validateRootAF, OPTIONAL, V20},
+		{validateDPartRoot, OPTIONAL, V20},
 	} {
+		if err = xRefTable.cancelled(); err != nil {
+			return err
+		}
 		err = f.validate(xRefTable, rootDict, f.required, f.sinceVersion)
 		if err != nil {
 			return err
@@ -0,0 +1,1416 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// => 12.8.1 Digital Signatures, 12.8.2 Transform Methods
+//
+// A signature is intact if its ByteRange covers a complete revision except for Contents
+// and the CMS signature matches the digest of the covered bytes.
+// The signing certificate gets verified by building a chain up to a trusted certificate.
+// Incremental updates following the signed revision are checked against the DocMDP permissions
+// of a certification signature and the FieldMDP locks of the signature.
+
+// SubFilterPKCS7SHA1 is a deprecated signature format supported by verification only.
+const SubFilterPKCS7SHA1 = "adbe.pkcs7.sha1"
+
+// Changes made after signing classified by the DocMDP permissions P needed.
+const (
+	mdpAlways = 1 // DSS, document timestamps, document info, version.
+	mdpForms  = 2 // Filling in forms and signing.
+	mdpAnnots = 3 // Creating, deleting and modifying annotations.
+	mdpNever  = 4 // Anything else.
+)
+
+// SignatureVerification is the result of verifying a digital signature.
+type SignatureVerification struct {
+	Field          string   `json:"field"`
+	SubFilter      string   `json:"subFilter"`
+	Signer         string   `json:"signer,omitempty"`
+	SigningTime    string   `json:"signingTime,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+	Location       string   `json:"location,omitempty"`
+	DocMDP         int      `json:"docMDP,omitempty"`   // Permissions of a certification signature.
+	Revision       int      `json:"revision"`           // The signed revision, 0 if unknown.
+	Revisions      int      `json:"revisions"`          // All revisions of the file.
+	ByteRangeValid bool     `json:"byteRangeValid"`     // ByteRange covers the signed revision except Contents.
+	DigestValid    bool     `json:"digestValid"`        // The signed digest matches the covered bytes.
+	SignatureValid bool     `json:"signatureValid"`     // The signature matches the signing certificate.
+	ChainChecked   bool     `json:"chainChecked"`       // A trust store has been supplied.
+	Trusted        bool     `json:"trusted"`            // The signing certificate chains up to the trust store.
+	Chain          []string `json:"chain,omitempty"`    // Subjects from the signer up to the trusted root.
+	Modified       bool     `json:"modified"`           // Revisions have been added after signing.
+	Changes        []string `json:"changes,omitempty"`  // Changes made after signing not permitted by DocMDP or FieldMDP.
+	Problems       []string `json:"problems,omitempty"` // Everything rendering this signature invalid.
+	Valid          bool     `json:"valid"`
+}
+
+func (sv SignatureVerification) status(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "failed"
+}
+
+// Lines returns a text report of this signature verification.
+func (sv SignatureVerification) Lines() []string {
+
+	ss := []string{fmt.Sprintf("field %s: %s", sv.Field, sv.SubFilter)}
+
+	add := func(k, v string) {
+		if v != "" {
+			ss = append(ss, fmt.Sprintf("  %-12s: %s", k, v))
+		}
+	}
+
+	if sv.SubFilter == SubFilterRFC3161 {
+		add("TSA", sv.Signer)
+		add("timestamp", sv.SigningTime)
+	} else {
+		add("signer", sv.Signer)
+		add("signing time", sv.SigningTime)
+	}
+	add("reason", sv.Reason)
+	add("location", sv.Location)
+
+	if sv.DocMDP > 0 {
+		add("certified", fmt.Sprintf("DocMDP permissions %d", sv.DocMDP))
+	}
+
+	if sv.Revision > 0 {
+		add("revision", fmt.Sprintf("%d of %d", sv.Revision, sv.Revisions))
+	}
+
+	add("byte range", sv.status(sv.ByteRangeValid))
+	add("digest", sv.status(sv.DigestValid))
+	add("signature", sv.status(sv.SignatureValid))
+
+	switch {
+	case !sv.ChainChecked:
+		add("certificate", "not checked")
+	case sv.Trusted:
+		add("certificate", "trusted: "+strings.Join(sv.Chain, " <- "))
+	default:
+		add("certificate", "not trusted")
+	}
+
+	switch {
+	case !sv.Modified:
+		add("changes", "none")
+	case len(sv.Changes) == 0:
+		add("changes", "permitted")
+	default:
+		add("changes", fmt.Sprintf("%d not permitted", len(sv.Changes)))
+		for _, s := range sv.Changes {
+			ss = append(ss, "    "+s)
+		}
+	}
+
+	for _, s := range sv.Problems {
+		add("problem", s)
+	}
+
+	if sv.Valid {
+		add("result", "valid")
+	} else {
+		add("result", "invalid")
+	}
+
+	return ss
+}
+
+// formField is a node of the field hierarchy.
+type formField struct {
+	objNr int      // 0 for direct objects.
+	name  string   // Fully qualified field name.
+	ft    string   // Field type, possibly inherited.
+	dict  *PDFDict // The field dict, possibly merged with its widget annotation.
+}
+
+func decodedText(obj PDFObject) string {
+
+	var s string
+
+	switch obj := obj.(type) {
+	case PDFStringLiteral:
+		s, _ = StringLiteralToString(obj.Value())
+	case PDFHexLiteral:
+		s, _ = HexLiteralToString(obj.Value())
+	}
+
+	return s
+}
+
+// formFields returns all nodes of the field hierarchy of the interactive form.
+func formFields(xRefTable *XRefTable) ([]formField, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	obj, found := rootDict.Find("AcroForm")
+	if !found {
+		return nil, nil
+	}
+
+	acroForm, err := xRefTable.DereferenceDict(obj)
+	if err != nil || acroForm == nil {
+		return nil, err
+	}
+
+	var ff []formField
+	visited := IntSet{}
+
+	var walk func(obj PDFObject, parent, ft string) error
+
+	walk = func(obj PDFObject, parent, ft string) error {
+
+		arr, err := xRefTable.DereferenceArray(obj)
+		if err != nil || arr == nil {
+			return err
+		}
+
+		for _, obj := range *arr {
+
+			f := formField{name: parent, ft: ft}
+
+			if indRef, ok := obj.(PDFIndirectRef); ok {
+				f.objNr = indRef.ObjectNumber.Value()
+				if visited[f.objNr] {
+					return errors.Errorf("formFields: cycle at obj#%d", f.objNr)
+				}
+				visited[f.objNr] = true
+			}
+
+			f.dict, err = xRefTable.DereferenceDict(obj)
+			if err != nil {
+				return err
+			}
+
+			if f.dict == nil {
+				continue
+			}
+
+			if o, found := f.dict.Find("T"); found {
+				t := decodedText(o)
+				if f.name != "" {
+					t = f.name + "." + t
+				}
+				f.name = t
+			}
+
+			if s := f.dict.NameEntry("FT"); s != nil {
+				f.ft = *s
+			}
+
+			ff = append(ff, f)
+
+			if o, found := f.dict.Find("Kids"); found {
+				if err = walk(o, f.name, f.ft); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	obj, found = acroForm.Find("Fields")
+	if !found {
+		return nil, nil
+	}
+
+	if err = walk(obj, "", ""); err != nil {
+		return nil, err
+	}
+
+	return ff, nil
+}
+
+// signatureFieldInfo is a signature field along with its signature dict.
+type signatureFieldInfo struct {
+	formField
+	sig      *PDFDict // nil for unsigned fields.
+	sigObjNr int
+}
+
+// signatureFields returns all terminal signature fields.
+func signatureFields(xRefTable *XRefTable) ([]signatureFieldInfo, error) {
+
+	ff, err := formFields(xRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []signatureFieldInfo
+
+	for _, f := range ff {
+
+		if f.ft != "Sig" {
+			continue
+		}
+
+		// Skip widgets of a parent field holding the value.
+		if _, found := f.dict.Find("T"); !found {
+			if _, found := f.dict.Find("V"); !found {
+				continue
+			}
+		}
+
+		sf := signatureFieldInfo{formField: f}
+
+		if obj, found := f.dict.Find("V"); found {
+			if indRef, ok := obj.(PDFIndirectRef); ok {
+				sf.sigObjNr = indRef.ObjectNumber.Value()
+			}
+			sf.sig, err = xRefTable.DereferenceDict(obj)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fields = append(fields, sf)
+	}
+
+	return fields, nil
+}
+
+// fieldLock restricts the fields that may be changed after signing, see 12.8.2.4 FieldMDP.
+type fieldLock struct {
+	action string // All, Include or Exclude
+	fields StringSet
+}
+
+func newFieldLock(xRefTable *XRefTable, dict *PDFDict) (*fieldLock, error) {
+
+	action := dict.NameEntry("Action")
+	if action == nil {
+		return nil, errors.New("missing lock action")
+	}
+
+	l := &fieldLock{action: *action, fields: StringSet{}}
+
+	if obj, found := dict.Find("Fields"); found {
+		arr, err := xRefTable.DereferenceArray(obj)
+		if err != nil {
+			return nil, err
+		}
+		if arr != nil {
+			for _, o := range *arr {
+				l.fields[decodedText(o)] = true
+			}
+		}
+	}
+
+	return l, nil
+}
+
+func (l fieldLock) locks(name string) bool {
+
+	listed := false
+	for s := range l.fields {
+		if name == s || strings.HasPrefix(name, s+".") {
+			listed = true
+			break
+		}
+	}
+
+	switch l.action {
+	case "All":
+		return true
+	case "Include":
+		return listed
+	case "Exclude":
+		return !listed
+	}
+
+	return false
+}
+
+// transformParams returns the parameters of the signature reference dict using method.
+func transformParams(xRefTable *XRefTable, sig *PDFDict, method string) ([]*PDFDict, error) {
+
+	obj, found := sig.Find("Reference")
+	if !found {
+		return nil, nil
+	}
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return nil, err
+	}
+
+	var params []*PDFDict
+
+	for _, o := range *arr {
+
+		ref, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return nil, err
+		}
+
+		if ref == nil {
+			continue
+		}
+
+		if tm := ref.NameEntry("TransformMethod"); tm == nil || *tm != method {
+			continue
+		}
+
+		d, err := xRefTable.DereferenceDict(ref.Dict["TransformParams"])
+		if err != nil {
+			return nil, err
+		}
+
+		if d == nil {
+			d = &PDFDict{Dict: map[string]PDFObject{}}
+		}
+
+		params = append(params, d)
+	}
+
+	return params, nil
+}
+
+// docMDP returns the signature dict number and the permissions of a certification signature.
+func docMDP(xRefTable *XRefTable) (objNr, p int, err error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	perms, err := xRefTable.DereferenceDict(rootDict.Dict["Perms"])
+	if err != nil || perms == nil {
+		return 0, 0, err
+	}
+
+	indRef := perms.IndirectRefEntry("DocMDP")
+	if indRef == nil {
+		return 0, 0, nil
+	}
+
+	sig, err := xRefTable.DereferenceDict(*indRef)
+	if err != nil || sig == nil {
+		return 0, 0, err
+	}
+
+	params, err := transformParams(xRefTable, sig, "DocMDP")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// P defaults to 2.
+	p = 2
+	if len(params) > 0 {
+		if i := params[0].IntEntry("P"); i != nil && *i >= 1 && *i <= 3 {
+			p = *i
+		}
+	}
+
+	return indRef.ObjectNumber.Value(), p, nil
+}
+
+// fieldLocks returns the FieldMDP restrictions of a signature field.
+func fieldLocks(xRefTable *XRefTable, f signatureFieldInfo) ([]*fieldLock, error) {
+
+	params, err := transformParams(xRefTable, f.sig, "FieldMDP")
+	if err != nil {
+		return nil, err
+	}
+
+	if obj, found := f.dict.Find("Lock"); found {
+		d, err := xRefTable.DereferenceDict(obj)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			params = append(params, d)
+		}
+	}
+
+	var locks []*fieldLock
+
+	for _, d := range params {
+		l, err := newFieldLock(xRefTable, d)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+
+	return locks, nil
+}
+
+// byteRange returns the ByteRange of a signature dict
+// after making sure it lies within a file of fileSize bytes.
+func byteRange(xRefTable *XRefTable, sig *PDFDict, fileSize int64) ([4]int64, error) {
+
+	var br [4]int64
+
+	arr, err := xRefTable.DereferenceArray(sig.Dict["ByteRange"])
+	if err != nil {
+		return br, err
+	}
+
+	if arr == nil || len(*arr) != 4 {
+		return br, errors.New("ByteRange: expected 4 integers")
+	}
+
+	for i, o := range *arr {
+		n, ok := o.(PDFInteger)
+		if !ok || n < 0 {
+			return br, errors.New("ByteRange: expected 4 integers")
+		}
+		br[i] = int64(n)
+	}
+
+	if br[0] != 0 {
+		return br, errors.New("ByteRange does not start at the beginning of the file")
+	}
+
+	// The gap holds at least the delimiters of the Contents hex string.
+	if br[2]-br[1] < 2 {
+		return br, errors.New("ByteRange gap does not match Contents")
+	}
+
+	if br[2] > fileSize || br[3] > fileSize-br[2] {
+		return br, errors.New("ByteRange exceeds file size")
+	}
+
+	return br, nil
+}
+
+// signedRevision checks that br covers a complete revision except for the Contents hex string
+// and returns the number of this revision.
+func signedRevision(ctx *PDFContext, ra io.ReaderAt, br [4]int64, contents []byte) (int, error) {
+
+	// The gap consists of the Contents hex string including its delimiters.
+	b := make([]byte, br[2]-br[1])
+	if _, err := ra.ReadAt(b, br[1]); err != nil {
+		return 0, errors.Wrap(err, "ByteRange")
+	}
+
+	if b[0] != '<' || b[len(b)-1] != '>' {
+		return 0, errors.New("ByteRange gap does not match Contents")
+	}
+
+	h, err := PDFHexLiteral(b[1 : len(b)-1]).Bytes()
+	if err != nil || !bytes.Equal(h, contents) {
+		return 0, errors.New("ByteRange gap does not match Contents")
+	}
+
+	end := br[2] + br[3]
+
+	for _, r := range ctx.Read.Revisions {
+		// Allow for the end of line following %%EOF.
+		if end <= r.Size && end >= r.Size-2 {
+			return r.Nr, nil
+		}
+	}
+
+	return 0, errors.New("ByteRange does not cover a complete revision")
+}
+
+// signatureContents returns the CMS signature of a signature dict.
+func signatureContents(sig *PDFDict) ([]byte, error) {
+
+	b, err := sig.StringEntryBytes("Contents")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("missing Contents")
+	}
+
+	return b, nil
+}
+
+// signedDigest returns the digest to be checked against the CMS signature.
+func signedDigest(ra io.ReaderAt, br [4]int64, subFilter string, s *cmsSignature) ([]byte, error) {
+
+	switch subFilter {
+
+	case SubFilterPKCS7Detached, SubFilterCAdESDetached:
+		return byteRangeDigest(ra, br, s.hash.New())
+
+	case SubFilterPKCS7SHA1:
+		// The SHA-1 digest of the byte range is the signed content.
+		digest, err := byteRangeDigest(ra, br, crypto.SHA1.New())
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(digest, s.content) {
+			return nil, errors.New("SHA-1 digest does not match the signed content")
+		}
+		h := s.hash.New()
+		h.Write(s.content)
+		return h.Sum(nil), nil
+
+	case SubFilterRFC3161:
+		// The timestamp token carries the digest of the byte range as message imprint.
+		info, err := parseTimestampToken(s)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := digestHash(info.MessageImprint.HashAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := byteRangeDigest(ra, br, hash.New())
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(digest, info.MessageImprint.HashedMessage) {
+			return nil, errors.New("message imprint mismatch, the timestamped bytes have been modified")
+		}
+		h := s.hash.New()
+		h.Write(s.content)
+		return h.Sum(nil), nil
+
+	}
+
+	return nil, errors.Errorf("unsupported SubFilter %s", subFilter)
+}
+
+// verifyCertificateChain builds a chain from the signing certificate up to a trusted certificate.
+func verifyCertificateChain(s *cmsSignature, trusted []*x509.Certificate, t time.Time) ([]string, error) {
+
+	roots := x509.NewCertPool()
+	for _, cert := range trusted {
+		roots.AddCert(cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range s.certs {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := s.cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ss []string
+	for _, cert := range chains[0] {
+		ss = append(ss, cert.Subject.CommonName)
+	}
+
+	return ss, nil
+}
+
+// signatureVerifier holds the state shared by the verification of all signatures of a file.
+type signatureVerifier struct {
+	ctx         *PDFContext
+	ra          io.ReaderAt
+	trusted     []*x509.Certificate
+	docMDPObjNr int
+	docMDPPerms int
+	changes     *changeClassifier
+	revisions   map[int]*PDFContext // Earlier revisions read so far.
+}
+
+// revision returns the PDF file as it was at revision nr.
+func (v *signatureVerifier) revision(nr int) (*PDFContext, error) {
+
+	if ctx, found := v.revisions[nr]; found {
+		return ctx, nil
+	}
+
+	r := v.ctx.Read.Revisions[nr-1]
+
+	config := *v.ctx.Configuration
+	config.Lazy = false
+	config.Incremental = false
+
+	ctx, err := ReadPDF(io.NewSectionReader(v.ra, 0, r.Size), v.ctx.Read.FileName, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "revision %d", nr)
+	}
+
+	v.revisions[nr] = ctx
+
+	return ctx, nil
+}
+
+// verifyCMS checks the CMS signature of a signature dict covering the bytes described by br.
+func (v *signatureVerifier) verifyCMS(sv *SignatureVerification, sig *PDFDict, br [4]int64, contents []byte) {
+
+	s, err := parseSignedData(contents)
+	if err != nil {
+		sv.Problems = append(sv.Problems, "CMS: "+err.Error())
+		return
+	}
+
+	sv.Signer = s.cert.Subject.CommonName
+
+	t := s.signingTime
+
+	if sv.SubFilter == SubFilterRFC3161 {
+		if info, err := parseTimestampToken(s); err == nil {
+			t, _ = info.genTime()
+		}
+	}
+
+	if t.IsZero() {
+		if m, ok := sig.Find("M"); ok {
+			t, _ = DateTime(decodedText(m))
+		}
+	}
+
+	if !t.IsZero() {
+		sv.SigningTime = t.Format(time.RFC3339)
+	}
+
+	digest, err := signedDigest(v.ra, br, sv.SubFilter, s)
+	if err != nil {
+		sv.Problems = append(sv.Problems, err.Error())
+		return
+	}
+
+	sv.DigestValid = s.verifyDigest(digest)
+	if !sv.DigestValid {
+		sv.Problems = append(sv.Problems, "digest mismatch, the signed bytes have been modified")
+	}
+
+	if err = s.verifySignature(digest); err != nil {
+		sv.Problems = append(sv.Problems, "signature: "+err.Error())
+	} else {
+		sv.SignatureValid = true
+	}
+
+	if v.trusted == nil {
+		return
+	}
+
+	sv.ChainChecked = true
+
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	sv.Chain, err = verifyCertificateChain(s, v.trusted, t)
+	if err != nil {
+		sv.Problems = append(sv.Problems, "certificate: "+err.Error())
+		return
+	}
+
+	sv.Trusted = true
+}
+
+// verifyChanges checks the revisions following the signed revision against DocMDP and FieldMDP.
+func (v *signatureVerifier) verifyChanges(sv *SignatureVerification, f signatureFieldInfo) error {
+
+	locks, err := fieldLocks(v.ctx.XRefTable, f)
+	if err != nil {
+		return err
+	}
+
+	old, err := v.revision(sv.Revision)
+	if err != nil {
+		return err
+	}
+
+	if v.changes == nil {
+		if v.changes, err = newChangeClassifier(v.ctx); err != nil {
+			return err
+		}
+	}
+
+	// Without certification the document may still be signed, filled in and annotated.
+	p := mdpAnnots
+	if v.docMDPObjNr > 0 {
+		p = v.docMDPPerms
+	}
+
+	objNrs := IntSet{}
+	for _, r := range v.ctx.Read.Revisions[sv.Revision:] {
+		for objNr := range r.Objects {
+			objNrs[objNr] = true
+		}
+		for objNr := range r.Freed {
+			objNrs[objNr] = true
+		}
+	}
+
+	var keys []int
+	for objNr := range objNrs {
+		keys = append(keys, objNr)
+	}
+	sort.Ints(keys)
+
+	for _, objNr := range keys {
+
+		level, desc, field := v.changes.classify(old, objNr)
+
+		if level > p {
+			sv.Changes = append(sv.Changes, fmt.Sprintf("obj#%d: %s", objNr, desc))
+			continue
+		}
+
+		if field == "" {
+			continue
+		}
+
+		for _, l := range locks {
+			if l.locks(field) {
+				sv.Changes = append(sv.Changes, fmt.Sprintf("obj#%d: locked field %s", objNr, field))
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *signatureVerifier) verify(f signatureFieldInfo) (sv SignatureVerification) {
+
+	sig := f.sig
+
+	sv.Field = f.name
+	sv.Revisions = len(v.ctx.Read.Revisions)
+
+	if s := sig.NameEntry("SubFilter"); s != nil {
+		sv.SubFilter = *s
+	}
+
+	for k, p := range map[string]*string{"Reason": &sv.Reason, "Location": &sv.Location} {
+		if o, found := sig.Find(k); found {
+			*p = decodedText(o)
+		}
+	}
+
+	if f.sigObjNr > 0 && f.sigObjNr == v.docMDPObjNr {
+		sv.DocMDP = v.docMDPPerms
+	}
+
+	defer func() {
+		sv.Valid = sv.ByteRangeValid && sv.DigestValid && sv.SignatureValid &&
+			(sv.Trusted || !sv.ChainChecked) && len(sv.Changes) == 0 && len(sv.Problems) == 0
+	}()
+
+	br, err := byteRange(v.ctx.XRefTable, sig, v.ctx.Read.FileSize)
+	if err != nil {
+		sv.Problems = append(sv.Problems, err.Error())
+		return sv
+	}
+
+	contents, err := signatureContents(sig)
+	if err != nil {
+		sv.Problems = append(sv.Problems, err.Error())
+		return sv
+	}
+
+	if v.ctx.Read.Recovered {
+		sv.Problems = append(sv.Problems, "revisions unavailable for files with a damaged cross reference table")
+	} else if sv.Revision, err = signedRevision(v.ctx, v.ra, br, contents); err != nil {
+		sv.Problems = append(sv.Problems, err.Error())
+	} else {
+		sv.ByteRangeValid = true
+	}
+
+	v.verifyCMS(&sv, sig, br, contents)
+
+	if sv.Revision == 0 || sv.Revision == sv.Revisions {
+		return sv
+	}
+
+	sv.Modified = true
+
+	if err = v.verifyChanges(&sv, f); err != nil {
+		sv.Problems = append(sv.Problems, "changes: "+err.Error())
+	}
+
+	return sv
+}
+
+// VerifySignatures verifies all signatures of ctx which has been read from a source still open.
+// The signing certificates get verified against trusted unless trusted is nil.
+func VerifySignatures(ctx *PDFContext, trusted []*x509.Certificate) ([]SignatureVerification, error) {
+
+	fields, err := signatureFields(ctx.XRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &signatureVerifier{
+		ctx:       ctx,
+		ra:        readerAt(ctx.Read.rs),
+		trusted:   trusted,
+		revisions: map[int]*PDFContext{},
+	}
+
+	v.docMDPObjNr, v.docMDPPerms, err = docMDP(ctx.XRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var svs []SignatureVerification
+
+	for _, f := range fields {
+
+		if f.sig == nil {
+			continue
+		}
+
+		log.Info.Printf("verifying signature field %s\n", f.name)
+
+		svs = append(svs, v.verify(f))
+	}
+
+	return svs, nil
+}
+
+// backLinkKeys are not followed when collecting the objects belonging to an annotation or a form
+// since they lead back into the page tree or the field hierarchy.
+var backLinkKeys = map[string]bool{"P": true, "Parent": true, "Dest": true, "A": true, "AA": true, "IRT": true, "Pg": true}
+
+// collectObjects adds the numbers of all indirect objects reachable from obj to objs.
+func collectObjects(xRefTable *XRefTable, obj PDFObject, objs IntSet) error {
+
+	switch obj := obj.(type) {
+
+	case PDFIndirectRef:
+		objNr := obj.ObjectNumber.Value()
+		if objs[objNr] {
+			return nil
+		}
+		objs[objNr] = true
+		o, err := xRefTable.Dereference(obj)
+		if err != nil {
+			return err
+		}
+		return collectObjects(xRefTable, o, objs)
+
+	case PDFDict:
+		for k, v := range obj.Dict {
+			if backLinkKeys[k] {
+				continue
+			}
+			if err := collectObjects(xRefTable, v, objs); err != nil {
+				return err
+			}
+		}
+
+	case PDFStreamDict:
+		return collectObjects(xRefTable, obj.PDFDict, objs)
+
+	case PDFArray:
+		for _, v := range obj {
+			if err := collectObjects(xRefTable, v, objs); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+func objectKind(obj PDFObject) string {
+
+	switch obj := obj.(type) {
+
+	case PDFDict:
+		if t := obj.Type(); t != nil {
+			return *t + " dict"
+		}
+		return "dict"
+
+	case PDFStreamDict:
+		if t := obj.Type(); t != nil {
+			return *t + " stream"
+		}
+		return "stream"
+
+	case PDFArray:
+		return "array"
+
+	}
+
+	return "object"
+}
+
+func sameObject(o1, o2 PDFObject) bool {
+
+	if o1.PDFString() != o2.PDFString() {
+		return false
+	}
+
+	sd1, ok1 := o1.(PDFStreamDict)
+	sd2, ok2 := o2.(PDFStreamDict)
+	if ok1 != ok2 {
+		return false
+	}
+
+	return !ok1 || bytes.Equal(sd1.Raw, sd2.Raw)
+}
+
+// changedKeys returns the sorted keys of all entries added, removed or modified.
+func changedKeys(d1, d2 PDFDict) []string {
+
+	var keys []string
+
+	str := func(o PDFObject) string {
+		if o == nil {
+			return ""
+		}
+		return o.PDFString()
+	}
+
+	for k, v := range d2.Dict {
+		if str(v) != str(d1.Dict[k]) {
+			keys = append(keys, k)
+		}
+	}
+
+	for k := range d1.Dict {
+		if _, found := d2.Dict[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// changeClassifier classifies the objects of the latest revision by the DocMDP permissions needed to change them.
+type changeClassifier struct {
+	ctx         *PDFContext
+	fields      map[int]formField
+	acroForm    int
+	formObjs    IntSet // Kids arrays, widget appearances and default resources of the form.
+	annotObjs   IntSet // Annotations except widgets along with their appearances.
+	annotArrays IntSet // Indirect page Annots arrays.
+	dssObjs     IntSet
+	fieldsArray int    // Indirect AcroForm Fields array.
+	timestamps  IntSet // Signature fields holding document timestamps.
+}
+
+func newChangeClassifier(ctx *PDFContext) (*changeClassifier, error) {
+
+	c := &changeClassifier{
+		ctx:         ctx,
+		fields:      map[int]formField{},
+		formObjs:    IntSet{},
+		annotObjs:   IntSet{},
+		annotArrays: IntSet{},
+		dssObjs:     IntSet{},
+		timestamps:  IntSet{},
+	}
+
+	ff, err := formFields(ctx.XRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range ff {
+		if f.objNr > 0 {
+			c.fields[f.objNr] = f
+			if f.ft == "Sig" {
+				if d, _ := ctx.DereferenceDict(f.dict.Dict["V"]); d != nil && d.Type() != nil && *d.Type() == "DocTimeStamp" {
+					c.timestamps[f.objNr] = true
+				}
+			}
+		}
+		if indRef, ok := f.dict.Dict["Kids"].(PDFIndirectRef); ok {
+			c.formObjs[indRef.ObjectNumber.Value()] = true
+		}
+		if err = collectObjects(ctx.XRefTable, f.dict.Dict["AP"], c.formObjs); err != nil {
+			return nil, err
+		}
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	if obj, found := rootDict.Find("AcroForm"); found {
+		if indRef, ok := obj.(PDFIndirectRef); ok {
+			c.acroForm = indRef.ObjectNumber.Value()
+		}
+		acroForm, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return nil, err
+		}
+		if acroForm != nil {
+			if indRef, ok := acroForm.Dict["Fields"].(PDFIndirectRef); ok {
+				c.fieldsArray = indRef.ObjectNumber.Value()
+			}
+			if err = collectObjects(ctx.XRefTable, acroForm.Dict["DR"], c.formObjs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = collectObjects(ctx.XRefTable, rootDict.Dict["DSS"], c.dssObjs); err != nil {
+		return nil, err
+	}
+
+	root, err := ctx.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.collectAnnotations(*root, IntSet{})
+}
+
+// collectAnnotations walks the page tree and registers all annotations.
+func (c *changeClassifier) collectAnnotations(indRef PDFIndirectRef, visited IntSet) error {
+
+	objNr := indRef.ObjectNumber.Value()
+	if visited[objNr] {
+		return errors.Errorf("collectAnnotations: cycle at obj#%d", objNr)
+	}
+	visited[objNr] = true
+
+	dict, err := c.ctx.DereferenceDict(indRef)
+	if err != nil || dict == nil {
+		return err
+	}
+
+	if kids := dict.PDFArrayEntry("Kids"); kids != nil {
+		for _, o := range *kids {
+			if ir, ok := o.(PDFIndirectRef); ok {
+				if err = c.collectAnnotations(ir, visited); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	obj, found := dict.Find("Annots")
+	if !found {
+		return nil
+	}
+
+	if ir, ok := obj.(PDFIndirectRef); ok {
+		c.annotArrays[ir.ObjectNumber.Value()] = true
+	}
+
+	annots, err := c.ctx.DereferenceArray(obj)
+	if err != nil || annots == nil {
+		return err
+	}
+
+	for _, o := range *annots {
+
+		d, err := c.ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+
+		if d == nil {
+			continue
+		}
+
+		if st := d.Subtype(); st != nil && *st == "Widget" {
+			err = collectObjects(c.ctx.XRefTable, d.Dict["AP"], c.formObjs)
+		} else {
+			err = collectObjects(c.ctx.XRefTable, o, c.annotObjs)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isWidget(xRefTable *XRefTable, obj PDFObject) bool {
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return false
+	}
+
+	st := d.Subtype()
+
+	return st != nil && *st == "Widget"
+}
+
+func (c *changeClassifier) isTimestampField(obj PDFObject) bool {
+
+	indRef, ok := obj.(PDFIndirectRef)
+
+	return ok && c.timestamps[indRef.ObjectNumber.Value()]
+}
+
+// classifyAdditions compares two versions of an Annots or Fields array.
+// Adding document timestamp fields is always permitted, adding other widgets is part of signing and filling in forms.
+// Adding anything else as well as removing or rearranging entries needs the permissions p.
+func (c *changeClassifier) classifyAdditions(old *PDFContext, oldObj, obj PDFObject, p int) int {
+
+	arr1, _ := old.DereferenceArray(oldObj)
+	arr2, _ := c.ctx.DereferenceArray(obj)
+
+	var n1, n2 int
+
+	ss := StringSet{}
+	if arr1 != nil {
+		n1 = len(*arr1)
+		for _, o := range *arr1 {
+			ss[o.PDFString()] = true
+		}
+	}
+
+	level, added := mdpAlways, 0
+
+	raise := func(l int) {
+		if l > level {
+			level = l
+		}
+	}
+
+	if arr2 != nil {
+		n2 = len(*arr2)
+		for _, o := range *arr2 {
+			if ss[o.PDFString()] {
+				continue
+			}
+			added++
+			switch {
+			case c.isTimestampField(o):
+			case isWidget(c.ctx.XRefTable, o):
+				raise(mdpForms)
+			default:
+				raise(p)
+			}
+		}
+	}
+
+	// Removed or rearranged entries.
+	if n1+added != n2 {
+		raise(p)
+	}
+
+	return level
+}
+
+// classifyAnnots compares two versions of an Annots array.
+func (c *changeClassifier) classifyAnnots(old *PDFContext, oldObj, obj PDFObject) (int, string) {
+	return c.classifyAdditions(old, oldObj, obj, mdpAnnots), "annotations"
+}
+
+// classifyAcroForm compares two versions of the interactive form dict.
+func (c *changeClassifier) classifyAcroForm(old *PDFContext, oldObj, obj PDFObject) int {
+
+	d1, _ := old.DereferenceDict(oldObj)
+	d2, _ := c.ctx.DereferenceDict(obj)
+	if d1 == nil || d2 == nil {
+		return mdpForms
+	}
+
+	level := mdpAlways
+
+	for _, k := range changedKeys(*d1, *d2) {
+		switch k {
+		case "Fields":
+			if l := c.classifyAdditions(old, d1.Dict[k], d2.Dict[k], mdpForms); l > level {
+				level = l
+			}
+		case "SigFlags":
+		default:
+			level = mdpForms
+		}
+	}
+
+	return level
+}
+
+func (c *changeClassifier) classifyCatalog(old *PDFContext, oldObj, obj PDFObject) (int, string) {
+
+	d1, ok1 := oldObj.(PDFDict)
+	d2, ok2 := obj.(PDFDict)
+	if !ok1 || !ok2 {
+		return mdpNever, "catalog"
+	}
+
+	level := mdpAlways
+
+	for _, k := range changedKeys(d1, d2) {
+		switch k {
+		case "Version", "Extensions", "DSS":
+		case "AcroForm":
+			if l := c.classifyAcroForm(old, d1.Dict[k], d2.Dict[k]); l > level {
+				level = l
+			}
+		default:
+			return mdpNever, "catalog entry " + k
+		}
+	}
+
+	return level, "catalog"
+}
+
+func (c *changeClassifier) classifyPage(old *PDFContext, oldObj, obj PDFObject) (int, string) {
+
+	d1, ok1 := oldObj.(PDFDict)
+	d2, ok2 := obj.(PDFDict)
+	if !ok1 || !ok2 {
+		return mdpNever, "page"
+	}
+
+	for _, k := range changedKeys(d1, d2) {
+		if k != "Annots" {
+			return mdpNever, "page entry " + k
+		}
+	}
+
+	return c.classifyAnnots(old, d1.Dict["Annots"], d2.Dict["Annots"])
+}
+
+func (c *changeClassifier) classifyField(f formField, oldObj PDFObject) (int, string) {
+
+	if oldObj == nil {
+		if c.timestamps[f.objNr] {
+			return mdpAlways, "document timestamp field " + f.name
+		}
+		if f.ft == "Sig" {
+			return mdpForms, "signature field " + f.name
+		}
+		return mdpNever, "new form field " + f.name
+	}
+
+	d1, ok := oldObj.(PDFDict)
+	if !ok {
+		return mdpNever, "form field " + f.name
+	}
+
+	level := mdpForms
+
+	for _, k := range changedKeys(d1, *f.dict) {
+		switch k {
+		case "V", "AP", "AS", "I", "Kids":
+		case "Rect", "F", "MK", "C", "BS", "Border", "M", "NM", "Contents":
+			level = mdpAnnots
+		default:
+			return mdpNever, "form field " + f.name + " entry " + k
+		}
+	}
+
+	return level, "form field " + f.name
+}
+
+// classify returns the DocMDP permissions needed for the change of object objNr since revision old
+// along with a description and the name of the changed form field.
+func (c *changeClassifier) classify(old *PDFContext, objNr int) (level int, desc, field string) {
+
+	var obj, oldObj PDFObject
+
+	if entry, found := c.ctx.FindTableEntryLight(objNr); found && !entry.Free {
+		obj = entry.Object
+	}
+
+	if entry, found := old.FindTableEntryLight(objNr); found && !entry.Free {
+		oldObj = entry.Object
+	}
+
+	if obj == nil {
+		if oldObj == nil {
+			return 0, "", ""
+		}
+		if d, ok := oldObj.(PDFDict); ok && d.Type() != nil && *d.Type() == "Annot" && !isWidget(old.XRefTable, d) {
+			return mdpAnnots, "deleted annotation", ""
+		}
+		return mdpNever, "deleted " + objectKind(oldObj), ""
+	}
+
+	if oldObj != nil && sameObject(oldObj, obj) {
+		return 0, "", ""
+	}
+
+	if c.ctx.Read.XRefStreams[objNr] || c.ctx.Read.ObjectStreams[objNr] {
+		return 0, "", ""
+	}
+
+	if objNr == c.ctx.Root.ObjectNumber.Value() {
+		level, desc = c.classifyCatalog(old, oldObj, obj)
+		return level, desc, ""
+	}
+
+	if c.ctx.Info != nil && objNr == c.ctx.Info.ObjectNumber.Value() {
+		return mdpAlways, "document info", ""
+	}
+
+	if c.dssObjs[objNr] {
+		return mdpAlways, "DSS", ""
+	}
+
+	if d, ok := obj.(PDFDict); ok && d.Type() != nil {
+		switch *d.Type() {
+		case "DocTimeStamp":
+			if oldObj == nil {
+				return mdpAlways, "document timestamp", ""
+			}
+			return mdpNever, "modified document timestamp", ""
+		case "Sig":
+			if oldObj == nil {
+				return mdpForms, "signature", ""
+			}
+			return mdpNever, "modified signature", ""
+		case "Page":
+			level, desc = c.classifyPage(old, oldObj, obj)
+			return level, desc, ""
+		}
+	}
+
+	if f, found := c.fields[objNr]; found {
+		level, desc = c.classifyField(f, oldObj)
+		return level, desc, f.name
+	}
+
+	switch {
+	case objNr == c.acroForm:
+		return c.classifyAcroForm(old, oldObj, obj), "form " + objectKind(obj), ""
+	case objNr == c.fieldsArray:
+		return c.classifyAdditions(old, oldObj, obj, mdpForms), "form fields", ""
+	case c.formObjs[objNr]:
+		return mdpForms, "form " + objectKind(obj), ""
+	case c.annotArrays[objNr]:
+		level, desc = c.classifyAnnots(old, oldObj, obj)
+		return level, desc, ""
+	case c.annotObjs[objNr]:
+		return mdpAnnots, "annotation " + objectKind(obj), ""
+	}
+
+	return mdpNever, objectKind(obj), ""
+}
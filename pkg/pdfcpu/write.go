@@ -21,7 +21,10 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -30,42 +33,108 @@ import (
 )
 
 // WritePDFFile generates a PDF file for the cross reference table contained in PDFContext.
+//
+// The PDF gets written to a temporary file in the same directory which replaces fileName on success only.
+// This way no partial output is left behind on errors or cancellation and fileName may also be the file being read.
 func WritePDFFile(ctx *PDFContext) error {
 
 	fileName := ctx.Write.DirName + ctx.Write.FileName
 
 	log.Info.Printf("writing to %s\n", fileName)
 
-	file, err := os.Create(fileName)
+	return writeFile(fileName, func(w io.Writer) error { return WritePDF(ctx, w) })
+}
+
+// writeFile creates fileName using write via a temporary file.
+func writeFile(fileName string, write func(w io.Writer) error) error {
+
+	file, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
 	if err != nil {
 		return errors.Wrapf(err, "can't create %s\n%s", fileName, err)
 	}
 
-	ctx.Write.Writer = bufio.NewWriter(file)
+	tmpFileName := file.Name()
 
-	defer func() {
+	err = write(file)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
 
-		// The underlying bufio.Writer has already been flushed.
+	// Do not miss out on closing errors.
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
 
-		// Processing error takes precedence.
+	if err == nil {
+		err = os.Rename(tmpFileName, fileName)
+	}
+
+	if err != nil {
+		os.Remove(tmpFileName)
+		return err
+	}
+
+	return nil
+}
+
+// countingWriter keeps track of the number of bytes written to the underlying io.Writer.
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
+
+// WritePDF generates a PDF for the cross reference table contained in PDFContext and writes it to w.
+func WritePDF(ctx *PDFContext, w io.Writer) error {
+
+	cw := &countingWriter{w: w}
+
+	ctx.Write.Writer = bufio.NewWriter(cw)
+
+	if ctx.Incremental {
+		if ctx.Linearize {
+			return errors.New("incremental update: linearization requires rewriting the file")
+		}
+		err := writeIncrement(ctx)
 		if err != nil {
-			file.Close()
-			return
+			return err
 		}
+		err = ctx.Write.Flush()
+		ctx.Write.FileSize = cw.count
+		return err
+	}
 
-		// Do not miss out on closing errors.
-		err = file.Close()
-
-	}()
+	if ctx.Linearize {
+		err := writeLinearized(ctx)
+		if err != nil {
+			return err
+		}
+		err = ctx.Write.Flush()
+		ctx.Write.FileSize = cw.count
+		if err == nil && ctx.Read != nil {
+			logWriteStats(ctx)
+		}
+		return err
+	}
 
-	err = handleEncryption(ctx)
+	err := handleEncryption(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Since we support PDF Collections (since V1.7) for file attachments
-	// we need to always generate V1.7 PDF filess.
-	err = writeHeader(ctx.Write, V17)
+	// we need to always generate V1.7 PDF files unless the source is a PDF 2.0 file.
+	v := V17
+	if ctx.Version() == V20 {
+		v = V20
+	}
+
+	err = writeHeader(ctx.Write, v)
 	if err != nil {
 		return err
 	}
@@ -121,11 +190,14 @@ func WritePDFFile(ctx *PDFContext) error {
 		return err
 	}
 
-	err = setFileSizeOfWrittenFile(ctx.Write, file)
+	// Flush first to get the correct size.
+	err = ctx.Write.Flush()
 	if err != nil {
 		return err
 	}
 
+	ctx.Write.FileSize = cw.count
+
 	if ctx.Read != nil {
 		ctx.Write.BinaryImageSize = ctx.Read.BinaryImageSize
 		ctx.Write.BinaryFontSize = ctx.Read.BinaryFontSize
@@ -313,23 +385,10 @@ func writeRootObject(ctx *PDFContext) error {
 	return nil
 }
 
-func writeTrailerDict(ctx *PDFContext) error {
+func trailerDict(ctx *PDFContext) PDFDict {
 
-	log.Debug.Printf("writeTrailerDict begin\n")
-
-	w := ctx.Write
 	xRefTable := ctx.XRefTable
 
-	_, err := w.WriteString("trailer")
-	if err != nil {
-		return err
-	}
-
-	err = w.WriteEol()
-	if err != nil {
-		return err
-	}
-
 	dict := NewPDFDict()
 	dict.Insert("Size", PDFInteger(*xRefTable.Size))
 	dict.Insert("Root", *xRefTable.Root)
@@ -346,6 +405,31 @@ func writeTrailerDict(ctx *PDFContext) error {
 		dict.Insert("ID", *xRefTable.ID)
 	}
 
+	return dict
+}
+
+func writeTrailerDict(ctx *PDFContext, prev *int64) error {
+
+	log.Debug.Printf("writeTrailerDict begin\n")
+
+	w := ctx.Write
+
+	_, err := w.WriteString("trailer")
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteEol()
+	if err != nil {
+		return err
+	}
+
+	dict := trailerDict(ctx)
+
+	if prev != nil {
+		dict.Insert("Prev", PDFInteger(*prev))
+	}
+
 	_, err = w.WriteString(dict.PDFString())
 	if err != nil {
 		return err
@@ -505,12 +589,17 @@ func writeXRefTable(ctx *PDFContext) error {
 		return err
 	}
 
-	keys := sortedWritableKeys(ctx)
+	return writeXRefSection(ctx, sortedWritableKeys(ctx), nil)
+}
+
+// writeXRefSection writes a cross reference table section for the objects in keys and the trailer.
+// prev is the offset of the previous section for incremental updates.
+func writeXRefSection(ctx *PDFContext, keys []int, prev *int64) error {
 
 	objCount := len(keys)
 	log.Debug.Printf("xref has %d entries\n", objCount)
 
-	_, err = ctx.Write.WriteString("xref")
+	_, err := ctx.Write.WriteString("xref")
 	if err != nil {
 		return err
 	}
@@ -545,7 +634,7 @@ func writeXRefTable(ctx *PDFContext) error {
 		return err
 	}
 
-	err = writeTrailerDict(ctx)
+	err = writeTrailerDict(ctx, prev)
 	if err != nil {
 		return err
 	}
@@ -599,7 +688,7 @@ func int64ToBuf(i int64, byteCount int) (buf []byte) {
 	return
 }
 
-func createXRefStream(ctx *PDFContext, i1, i2, i3 int) ([]byte, *PDFArray, error) {
+func createXRefStream(ctx *PDFContext, keys []int, i1, i2, i3 int) ([]byte, *PDFArray, error) {
 
 	log.Debug.Println("createXRefStream begin")
 
@@ -610,14 +699,6 @@ func createXRefStream(ctx *PDFContext, i1, i2, i3 int) ([]byte, *PDFArray, error
 		arr PDFArray
 	)
 
-	var keys []int
-	for i, e := range xRefTable.Table {
-		if e.Free || ctx.Write.HasWriteOffset(i) {
-			keys = append(keys, i)
-		}
-	}
-	sort.Ints(keys)
-
 	objCount := len(keys)
 	log.Debug.Printf("createXRefStream: xref has %d entries\n", objCount)
 
@@ -714,6 +795,19 @@ func writeXRefStream(ctx *PDFContext) error {
 
 	xRefStreamDict.Insert("Size", PDFInteger(*xRefTable.Size))
 
+	err = writeXRefStreamObject(ctx, objNumber, xRefStreamDict, sortedWritableKeys(ctx))
+	if err != nil {
+		return err
+	}
+
+	log.Debug.Println("writeXRefStream end")
+
+	return nil
+}
+
+// writeXRefStreamObject writes an xref stream for the objects in keys followed by startxref.
+func writeXRefStreamObject(ctx *PDFContext, objNumber int, xRefStreamDict *PDFXRefStreamDict, keys []int) error {
+
 	offset := ctx.Write.Offset
 
 	i2Base := int64(*ctx.Size)
@@ -737,7 +831,7 @@ func writeXRefStream(ctx *PDFContext) error {
 	xRefStreamDict.Insert("W", wArr)
 
 	// Generate xRefStreamDict data = xref entries -> xRefStreamDict.Content
-	content, indArr, err := createXRefStream(ctx, i1, i2, i3)
+	content, indArr, err := createXRefStream(ctx, keys, i1, i2, i3)
 	if err != nil {
 		return err
 	}
@@ -780,14 +874,7 @@ func writeXRefStream(ctx *PDFContext) error {
 		return err
 	}
 
-	err = w.WriteEol()
-	if err != nil {
-		return err
-	}
-
-	log.Debug.Println("writeXRefStream end")
-
-	return nil
+	return w.WriteEol()
 }
 
 func writeEncryptDict(ctx *PDFContext) error {
@@ -813,9 +900,28 @@ func writeEncryptDict(ctx *PDFContext) error {
 
 func setupEncryption(ctx *PDFContext) error {
 
+	if len(ctx.Recipients) > 0 {
+		return setupPubSecEncryption(ctx)
+	}
+
 	var err error
 
-	dict := newEncryptDict(ctx.EncryptUsingAES, ctx.EncryptUsing128BitKey, ctx.UserAccessPermissions)
+	keyLength := encryptKeyLength(ctx)
+	if keyLength == 256 && !ctx.EncryptUsingAES {
+		return errors.New("encrypt: 256 bit keys require AES")
+	}
+
+	if (ctx.UnencryptedMetadata || ctx.EncryptEmbeddedFilesOnly) && keyLength < 128 {
+		return errors.New("encrypt: crypt filters require 128 or 256 bit keys")
+	}
+
+	p := ctx.UserAccessPermissions
+	if keyLength == 40 {
+		p = r2UserAccessPermissions(p)
+	}
+
+	dict := newEncryptDict(ctx.EncryptUsingAES, keyLength, p)
+	setCryptFilterEntries(dict, "StdCF", !ctx.UnencryptedMetadata, ctx.EncryptEmbeddedFilesOnly)
 
 	ctx.E, err = supportedEncryption(ctx, dict)
 	if err != nil {
@@ -834,6 +940,14 @@ func setupEncryption(ctx *PDFContext) error {
 
 	ctx.E.ID = id
 
+	if keyLength == 256 {
+		err = setupEncryptionAES256(ctx, dict)
+		if err != nil {
+			return err
+		}
+		return insertEncryptDict(ctx, dict)
+	}
+
 	//fmt.Printf("opw before: length:%d <%s>\n", len(ctx.E.O), ctx.E.O)
 	ctx.E.O, err = o(ctx)
 	if err != nil {
@@ -852,11 +966,15 @@ func setupEncryption(ctx *PDFContext) error {
 	dict.Update("U", PDFHexLiteral(hex.EncodeToString(ctx.E.U)))
 	dict.Update("O", PDFHexLiteral(hex.EncodeToString(ctx.E.O)))
 
+	return insertEncryptDict(ctx, dict)
+}
+
+func insertEncryptDict(ctx *PDFContext, dict *PDFDict) error {
+
 	xRefTableEntry := NewXRefTableEntryGen0(*dict)
 
 	// Reuse free objects (including recycled objects from this run).
-	var objNumber int
-	objNumber, err = ctx.InsertAndUseRecycled(*xRefTableEntry)
+	objNumber, err := ctx.InsertAndUseRecycled(*xRefTableEntry)
 	if err != nil {
 		return err
 	}
@@ -868,6 +986,10 @@ func setupEncryption(ctx *PDFContext) error {
 
 func updateEncryption(ctx *PDFContext) error {
 
+	if ctx.E.PubSec {
+		return errors.New("public-key encryption: permissions are defined per recipient, there are no passwords")
+	}
+
 	d, err := ctx.EncryptDict()
 	if err != nil {
 		return err
@@ -875,7 +997,11 @@ func updateEncryption(ctx *PDFContext) error {
 
 	if ctx.Mode == ADDPERMISSIONS {
 		//fmt.Printf("updating permissions to: %v\n", ctx.UserAccessPermissions)
-		ctx.E.P = int(ctx.UserAccessPermissions)
+		p := ctx.UserAccessPermissions
+		if ctx.E.R == 2 {
+			p = r2UserAccessPermissions(p)
+		}
+		ctx.E.P = int(p)
 		d.Update("P", PDFInteger(ctx.E.P))
 		// and moving on, U is dependent on P
 	}
@@ -893,6 +1019,11 @@ func updateEncryption(ctx *PDFContext) error {
 		ctx.OwnerPW = *ctx.OwnerPWNew
 	}
 
+	// The file encryption key stays the same, just re-encrypt it for the current passwords.
+	if ctx.E.R >= 5 {
+		return updateAES256Entries(ctx, d)
+	}
+
 	//fmt.Printf("opw before: length:%d <%s>\n", len(ctx.E.O), ctx.E.O)
 	ctx.E.O, err = o(ctx)
 	if err != nil {
@@ -959,22 +1090,3 @@ func writeXRef(ctx *PDFContext) error {
 	// Write cross reference table section.
 	return writeXRefTable(ctx)
 }
-
-func setFileSizeOfWrittenFile(w *WriteContext, f *os.File) error {
-
-	// Get file info for file just written but flush first to get correct file size.
-
-	err := w.Flush()
-	if err != nil {
-		return err
-	}
-
-	fileInfo, err := f.Stat()
-	if err != nil {
-		return err
-	}
-
-	w.FileSize = fileInfo.Size()
-
-	return nil
-}
@@ -0,0 +1,324 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"io"
+	"time"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// => 7.5.6 Incremental Updates
+//
+// An incremental update leaves the original file untouched and appends
+// all objects inserted, modified or deleted since reading (see XRefTable.TrackChanges),
+// a new xref section or xref stream and a trailer pointing to the previous xref section via Prev.
+
+func ensureIncrementalWritable(ctx *PDFContext) error {
+
+	if ctx.Read == nil || ctx.Read.rs == nil {
+		return errors.New("incremental update: missing original file")
+	}
+
+	if ctx.Read.Recovered {
+		return errors.New("incremental update: original file has a damaged cross reference table")
+	}
+
+	if !ctx.TracksChanges() {
+		return errors.New("incremental update: changes are not being tracked")
+	}
+
+	if ctx.Mode == ENCRYPT || ctx.Mode == DECRYPT || ctx.Mode == ADDPERMISSIONS ||
+		ctx.UserPWNew != nil || ctx.OwnerPWNew != nil {
+		return errors.New("incremental update: changing the encryption requires rewriting the file")
+	}
+
+	if ctx.Write.ReducedFeatureSet() {
+		return errors.New("incremental update: not supported for split, trim and page extraction")
+	}
+
+	return nil
+}
+
+// copyOriginal writes the bytes of the original file.
+func copyOriginal(ctx *PDFContext) error {
+
+	rs := ctx.Read.rs
+	w := ctx.Write
+
+	_, err := rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.CopyN(w, rs, ctx.Read.FileSize)
+	if err != nil {
+		return errors.Wrapf(err, "incremental update: copied %d of %d bytes", n, ctx.Read.FileSize)
+	}
+
+	w.Offset = n
+
+	return nil
+}
+
+// ensureNewLine ensures the update starts on a new line.
+func ensureNewLine(ctx *PDFContext) error {
+
+	w := ctx.Write
+	n := ctx.Read.FileSize
+
+	if n == 0 {
+		return nil
+	}
+
+	b := make([]byte, 1)
+	_, err := readerAt(ctx.Read.rs).ReadAt(b, n-1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if b[0] == '\n' || b[0] == '\r' {
+		return nil
+	}
+
+	err = w.WriteEol()
+	if err != nil {
+		return err
+	}
+
+	w.Offset += int64(len(w.Eol))
+
+	return nil
+}
+
+// ensureRootVersion raises the version to V1.7 like a full rewrite would do.
+// Since the header is part of the original bytes this is done via the catalog's Version entry.
+func ensureRootVersion(ctx *PDFContext) error {
+
+	if ctx.Version() >= V17 {
+		return nil
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	rootDict.Update("Version", PDFName(VersionString(V17)))
+
+	v := V17
+	ctx.RootVersion = &v
+
+	return nil
+}
+
+// updateInfoDict sets the modification date and producer of the document info dict.
+func updateInfoDict(ctx *PDFContext) error {
+
+	if ctx.Info == nil {
+		return nil
+	}
+
+	dict, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || dict == nil {
+		return err
+	}
+
+	dict.Update("ModDate", DateStringLiteral(time.Now()))
+
+	// Producer is deprecated in PDF 2.0.
+	if ctx.Version() < V20 {
+		dict.Update("Producer", PDFStringLiteral(PDFCPULongVersion))
+	}
+
+	return nil
+}
+
+// updateID replaces the second element of the file identifier since the file has been modified.
+// The first element stays the permanent identifier, see 14.4 File Identifiers.
+func updateID(ctx *PDFContext) {
+
+	if ctx.ID == nil || len(*ctx.ID) != 2 {
+		return
+	}
+
+	ctx.ID = &PDFArray{(*ctx.ID)[0], fileID(ctx)}
+}
+
+// writeIncrementObject writes a single object without following its indirect references.
+func writeIncrementObject(ctx *PDFContext, objNr, genNr int, obj PDFObject) error {
+
+	if obj == nil {
+		return writeNullObject(ctx, objNr, genNr)
+	}
+
+	switch obj := obj.(type) {
+
+	case PDFDict:
+		if objNr == ctx.Write.sigObjNr {
+			return writeSignatureDictObject(ctx, objNr, genNr, obj)
+		}
+		return writePDFDictObject(ctx, objNr, genNr, obj)
+
+	case PDFStreamDict:
+		if stringsEncrypted(ctx.XRefTable) {
+			_, err := encryptDeepObject(obj, objNr, genNr, ctx.EncKey, ctx.AES4Strings)
+			if err != nil {
+				return err
+			}
+		}
+		return writePDFStreamDictObject(ctx, objNr, genNr, obj)
+
+	case PDFArray:
+		return writePDFArrayObject(ctx, objNr, genNr, obj)
+
+	case PDFInteger:
+		return writePDFIntegerObject(ctx, objNr, genNr, obj)
+
+	case PDFFloat:
+		return writePDFFloatObject(ctx, objNr, genNr, obj)
+
+	case PDFStringLiteral:
+		return writePDFStringLiteralObject(ctx, objNr, genNr, obj)
+
+	case PDFHexLiteral:
+		return writePDFHexLiteralObject(ctx, objNr, genNr, obj)
+
+	case PDFBoolean:
+		return writePDFBooleanObject(ctx, objNr, genNr, obj)
+
+	case PDFName:
+		return writePDFNameObject(ctx, objNr, genNr, obj)
+
+	}
+
+	return errors.Errorf("writeIncrementObject: unsupported PDF object #%d %T\n", objNr, obj)
+}
+
+func writeIncrementXRefStream(ctx *PDFContext, keys []int) error {
+
+	xRefStreamDict := NewPDFXRefStreamDict(ctx)
+	objNr := ctx.InsertNew(*NewXRefTableEntryGen0(*xRefStreamDict))
+
+	xRefStreamDict.Insert("Size", PDFInteger(*ctx.Size))
+	xRefStreamDict.Insert("Prev", PDFInteger(ctx.Read.XRefOffset))
+
+	// The xref stream covers itself.
+	ctx.Write.SetWriteOffset(objNr)
+	keys = append(keys, objNr)
+
+	return writeXRefStreamObject(ctx, objNr, xRefStreamDict, keys)
+}
+
+// writeIncrement writes the original file followed by an incremental update.
+func writeIncrement(ctx *PDFContext) error {
+
+	log.Debug.Println("writeIncrement begin")
+
+	err := ensureIncrementalWritable(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = copyOriginal(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Ensure corresponding and accurate name tree object graphs.
+	err = ctx.BindNameTrees()
+	if err != nil {
+		return err
+	}
+
+	err = ctx.EnsureValidFreeList()
+	if err != nil {
+		return err
+	}
+
+	keys, err := ctx.DirtyObjects()
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		// Leave the original file untouched.
+		log.Info.Println("incremental update: no changes")
+		return nil
+	}
+
+	err = ensureNewLine(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ensureRootVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = updateInfoDict(ctx)
+	if err != nil {
+		return err
+	}
+
+	updateID(ctx)
+
+	keys, err = ctx.DirtyObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, objNr := range keys {
+
+		if err = ctx.cancelled(); err != nil {
+			return err
+		}
+
+		entry := ctx.Table[objNr]
+		if entry.Free {
+			continue
+		}
+
+		err = writeIncrementObject(ctx, objNr, *entry.Generation, entry.Object)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info.Printf("incremental update: %d objects\n", len(keys))
+
+	if ctx.Read.UsingXRefStreams {
+		err = writeIncrementXRefStream(ctx, keys)
+	} else {
+		err = writeXRefSection(ctx, keys, &ctx.Read.XRefOffset)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = writeTrailer(ctx.Write)
+	if err != nil {
+		return err
+	}
+
+	log.Debug.Println("writeIncrement end")
+
+	return nil
+}
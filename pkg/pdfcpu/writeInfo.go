@@ -158,7 +158,11 @@ func writeDocumentInfoDict(ctx *PDFContext) error {
 
 	dict.Update("CreationDate", dateStringLiteral)
 	dict.Update("ModDate", dateStringLiteral)
-	dict.Update("Producer", PDFStringLiteral(PDFCPULongVersion))
+
+	// Producer is deprecated in PDF 2.0.
+	if ctx.Version() < V20 {
+		dict.Update("Producer", PDFStringLiteral(PDFCPULongVersion))
+	}
 
 	_, _, err = writeDeepObject(ctx, obj)
 	if err != nil {
@@ -0,0 +1,1003 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/iPaladinLLC/pdfcpu/pkg/filter"
+	"github.com/iPaladinLLC/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// => Annex F Linearized PDF
+//
+// A linearized file is organized as follows:
+//
+//  1 Header
+//  2 Linearization parameter dictionary
+//  3 First page cross reference section and trailer
+//  4 Document catalog and document level objects
+//  5 Primary hint stream
+//  6 First page section: the page object of page 1 and all objects needed to display page 1
+//  7 Remaining pages: for each page the page object and all objects private to this page
+//  8 Objects shared by the remaining pages
+//  9 All other objects
+// 10 Main cross reference section and trailer
+//
+// Objects get renumbered so that the first page cross reference section covers parts 2 to 6
+// and the main cross reference section parts 7 to 9.
+// Linearized files are always written using cross reference sections without object streams
+// and without an overflow hint stream.
+//
+// Offsets stored in the hint tables are computed as if the primary hint stream was not present.
+
+// linearizer arranges the objects of a PDFContext for linearized writing.
+type linearizer struct {
+	ctx *PDFContext
+
+	pages     []int  // Page object numbers in page order.
+	nodes     IntSet // Page tree nodes and pages, not to be entered when collecting page objects.
+	assigned  IntSet // Objects placed into one of the parts.
+	firstPage IntSet // Objects of part 6.
+
+	part4 []int   // Catalog and document level objects.
+	part6 []int   // First page objects starting with the page object.
+	part7 [][]int // For each remaining page its page object followed by its private objects.
+	part8 []int   // Objects shared by remaining pages.
+	part9 []int   // All other objects.
+
+	shared [][]int // For each page the indices of referenced entries of the shared object hint table.
+
+	linNr  int // Object number of the linearization parameter dict.
+	hintNr int // Object number of the primary hint stream.
+
+	chunks  map[int][]byte // Serialized objects.
+	offsets map[int]int64  // Object offsets.
+}
+
+// collect appends the objects reachable from obj to objs in a deterministic order.
+// Objects in seen are skipped.
+//
+// Collecting page objects does not follow Parent entries, does not enter the page tree
+// and skips document level objects. First page objects are recorded without descending into them
+// since everything they refer to is part of the first page section already.
+func (l *linearizer) collect(obj PDFObject, seen IntSet, objs *[]int, page bool) error {
+
+	switch obj := obj.(type) {
+
+	case PDFIndirectRef:
+		objNr := obj.ObjectNumber.Value()
+		if seen[objNr] || page && (l.nodes[objNr] || l.assigned[objNr] && !l.firstPage[objNr]) {
+			return nil
+		}
+		entry, found := l.ctx.Find(objNr)
+		if !found || entry.Free || entry.Object == nil {
+			// Missing objects resolve to null.
+			return nil
+		}
+		seen[objNr] = true
+		*objs = append(*objs, objNr)
+		if page && l.firstPage[objNr] {
+			return nil
+		}
+		return l.collect(entry.Object, seen, objs, page)
+
+	case PDFDict:
+		return l.collectDict(obj, seen, objs, page)
+
+	case PDFStreamDict:
+		return l.collectDict(obj.PDFDict, seen, objs, page)
+
+	case PDFArray:
+		for _, o := range obj {
+			if err := l.collect(o, seen, objs, page); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+func (l *linearizer) collectDict(dict PDFDict, seen IntSet, objs *[]int, page bool) error {
+
+	var keys []string
+	for k := range dict.Dict {
+		if page && k == "Parent" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := l.collect(dict.Dict[k], seen, objs, page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectPages records all pages and page tree nodes of the page tree rooted at indRef.
+func (l *linearizer) collectPages(indRef PDFIndirectRef) error {
+
+	objNr := indRef.ObjectNumber.Value()
+	if l.nodes[objNr] {
+		return errors.Errorf("linearization: corrupt page tree at obj#%d", objNr)
+	}
+
+	dict, err := l.ctx.DereferenceDict(indRef)
+	if err != nil {
+		return err
+	}
+	if dict == nil {
+		return errors.Errorf("linearization: missing page tree node obj#%d", objNr)
+	}
+
+	l.nodes[objNr] = true
+
+	if t := dict.Type(); t == nil || *t != "Pages" {
+		l.pages = append(l.pages, objNr)
+		return nil
+	}
+
+	kids, err := l.ctx.DereferenceArray(dict.Dict["Kids"])
+	if err != nil || kids == nil {
+		return errors.Errorf("linearization: corrupt page tree node obj#%d", objNr)
+	}
+
+	for _, o := range *kids {
+		indRef, ok := o.(PDFIndirectRef)
+		if !ok {
+			return errors.Errorf("linearization: corrupt page tree node obj#%d", objNr)
+		}
+		if err = l.collectPages(indRef); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pageObjects returns the page object of page i followed by all objects needed for rendering this page
+// including inherited resources but excluding document level objects.
+func (l *linearizer) pageObjects(i int) ([]int, error) {
+
+	objNr := l.pages[i]
+	objs := []int{objNr}
+	seen := IntSet{objNr: true}
+
+	dict, ok := l.ctx.Table[objNr].Object.(PDFDict)
+	if !ok {
+		return nil, errors.Errorf("linearization: corrupt page dict obj#%d", objNr)
+	}
+
+	err := l.collectDict(dict, seen, &objs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dict
+
+	// Walk up the page tree for inherited attributes.
+	for j := 0; j < len(l.nodes); j++ {
+
+		indRef := d.IndirectRefEntry("Parent")
+		if indRef == nil {
+			break
+		}
+
+		if d, err = l.ctx.DereferenceDict(*indRef); err != nil || d == nil {
+			return nil, err
+		}
+
+		for _, k := range []string{"Resources", "MediaBox", "CropBox", "Rotate"} {
+			if o, found := d.Find(k); found {
+				if err = l.collect(o, seen, &objs, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return objs, nil
+}
+
+func (l *linearizer) assign(part *[]int, objs ...int) {
+	for _, objNr := range objs {
+		if !l.assigned[objNr] {
+			l.assigned[objNr] = true
+			*part = append(*part, objNr)
+		}
+	}
+}
+
+// arrange distributes all objects to be written into parts 4 to 9.
+func (l *linearizer) arrange() error {
+
+	ctx := l.ctx
+
+	indRef, err := ctx.Pages()
+	if err != nil {
+		return err
+	}
+	if indRef == nil {
+		return errors.New("linearization: missing page tree")
+	}
+
+	if err = l.collectPages(*indRef); err != nil {
+		return err
+	}
+
+	if len(l.pages) == 0 {
+		return errors.New("linearization: no pages")
+	}
+
+	// Part 4: Catalog and document level objects.
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	objs := []int{ctx.Root.ObjectNumber.Value()}
+	seen := IntSet{objs[0]: true}
+	for _, k := range []string{"ViewerPreferences", "PageMode", "Threads", "OpenAction", "AcroForm"} {
+		if o, found := rootDict.Find(k); found {
+			if err = l.collect(o, seen, &objs, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ctx.Encrypt != nil && ctx.EncKey != nil {
+		objs = append(objs, ctx.Encrypt.ObjectNumber.Value())
+	}
+
+	l.assign(&l.part4, objs...)
+
+	// Part 6: First page section.
+	objs, err = l.pageObjects(0)
+	if err != nil {
+		return err
+	}
+	l.assign(&l.part6, objs...)
+	for _, objNr := range l.part6 {
+		l.firstPage[objNr] = true
+	}
+
+	// Part 7 and 8: Private and shared objects of the remaining pages.
+	pageObjs := make([][]int, len(l.pages))
+	users := map[int]int{}
+
+	for i := 1; i < len(l.pages); i++ {
+		if pageObjs[i], err = l.pageObjects(i); err != nil {
+			return err
+		}
+		for _, objNr := range pageObjs[i] {
+			users[objNr]++
+		}
+	}
+
+	for i := 1; i < len(l.pages); i++ {
+		var private []int
+		for _, objNr := range pageObjs[i] {
+			if users[objNr] == 1 {
+				private = append(private, objNr)
+			}
+		}
+		l.part7 = append(l.part7, nil)
+		l.assign(&l.part7[i-1], private...)
+	}
+
+	for i := 1; i < len(l.pages); i++ {
+		for _, objNr := range pageObjs[i] {
+			if users[objNr] > 1 {
+				l.assign(&l.part8, objNr)
+			}
+		}
+	}
+
+	// Shared object references of the remaining pages.
+	index := map[int]int{}
+	for i, objNr := range append(append([]int{}, l.part6...), l.part8...) {
+		index[objNr] = i
+	}
+
+	l.shared = make([][]int, len(l.pages))
+	for i := 1; i < len(l.pages); i++ {
+		for _, objNr := range pageObjs[i] {
+			if j, ok := index[objNr]; ok {
+				l.shared[i] = append(l.shared[i], j)
+			}
+		}
+	}
+
+	// Part 9: All remaining objects eg. the page tree, outlines, name trees and the document info dict.
+	objs = nil
+	seen = IntSet{}
+	for _, indRef := range []*PDFIndirectRef{ctx.Root, ctx.Info} {
+		if indRef != nil {
+			if err = l.collect(*indRef, seen, &objs, false); err != nil {
+				return err
+			}
+		}
+	}
+	l.assign(&l.part9, objs...)
+
+	log.Debug.Printf("linearization: part4:%d part6:%d part8:%d part9:%d objects\n",
+		len(l.part4), len(l.part6), len(l.part8), len(l.part9))
+
+	return nil
+}
+
+// renumber assigns new object numbers following the order of the parts in the file.
+// Parts 7 to 9 are numbered starting with 1 followed by the linearization dict, part 4, the hint stream and part 6.
+func (l *linearizer) renumber() {
+
+	ctx := l.ctx
+
+	var objs []int
+	for _, part := range l.part7 {
+		objs = append(objs, part...)
+	}
+	objs = append(objs, l.part8...)
+	objs = append(objs, l.part9...)
+
+	lookup := map[int]int{}
+	next := 1
+
+	number := func(part []int) []int {
+		renumbered := make([]int, len(part))
+		for i, objNr := range part {
+			lookup[objNr] = next
+			renumbered[i] = next
+			next++
+		}
+		return renumbered
+	}
+
+	for i, part := range l.part7 {
+		l.part7[i] = number(part)
+	}
+	l.part8 = number(l.part8)
+	l.part9 = number(l.part9)
+
+	l.linNr = next
+	next++
+	part4 := number(l.part4)
+	l.hintNr = next
+	next++
+	part6 := number(l.part6)
+
+	table := map[int]*XRefTableEntry{0: NewFreeHeadXRefTableEntry()}
+
+	for _, objNr := range append(append(objs, l.part4...), l.part6...) {
+		entry := ctx.Table[objNr]
+		if o := patchObject(entry.Object, lookup); o != nil {
+			entry.Object = o
+		}
+		table[lookup[objNr]] = entry
+	}
+
+	l.part4, l.part6 = part4, part6
+
+	for i, objNr := range l.pages {
+		l.pages[i] = lookup[objNr]
+	}
+
+	patchIndRef(ctx.Root, lookup)
+	if ctx.Info != nil {
+		patchIndRef(ctx.Info, lookup)
+	}
+	if ctx.Encrypt != nil && ctx.EncKey != nil {
+		patchIndRef(ctx.Encrypt, lookup)
+	}
+
+	table[l.linNr] = NewXRefTableEntryGen0(nil)
+	table[l.hintNr] = NewXRefTableEntryGen0(nil)
+
+	ctx.Table = table
+	*ctx.Size = next
+
+	ctx.LinearizationObjs = IntSet{l.linNr: true, l.hintNr: true}
+}
+
+// capture returns the bytes written by f as if written at offset.
+func (l *linearizer) capture(offset int64, f func() error) ([]byte, error) {
+
+	w := l.ctx.Write
+	bw := w.Writer
+
+	var buf bytes.Buffer
+	w.Writer = bufio.NewWriter(&buf)
+	w.Offset = offset
+
+	err := f()
+	if err == nil {
+		err = w.Flush()
+	}
+
+	w.Writer = bw
+
+	return buf.Bytes(), err
+}
+
+func (l *linearizer) serialize(objNr int) error {
+
+	ctx := l.ctx
+	entry := ctx.Table[objNr]
+
+	b, err := l.capture(0, func() error {
+		if ctx.Encrypt != nil && ctx.EncKey != nil && objNr == ctx.Encrypt.ObjectNumber.Value() {
+			// The encryption dict itself must not be encrypted.
+			return writePDFObject(ctx, objNr, *entry.Generation, entry.Object.PDFString())
+		}
+		return writeIncrementObject(ctx, objNr, *entry.Generation, entry.Object)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.chunks[objNr] = b
+
+	return nil
+}
+
+// fileOrder returns all object numbers from part 4 on in file order.
+func (l *linearizer) fileOrder() []int {
+
+	objs := append([]int{}, l.part4...)
+	objs = append(objs, l.hintNr)
+	objs = append(objs, l.part6...)
+	for _, part := range l.part7 {
+		objs = append(objs, part...)
+	}
+	objs = append(objs, l.part8...)
+
+	return append(objs, l.part9...)
+}
+
+// layout computes object offsets for objects starting at offset.
+func (l *linearizer) layout(offset int64) int64 {
+
+	for _, objNr := range l.fileOrder() {
+		l.offsets[objNr] = offset
+		offset += int64(len(l.chunks[objNr]))
+	}
+
+	return offset
+}
+
+func (l *linearizer) length(objs []int) int64 {
+	var n int64
+	for _, objNr := range objs {
+		n += int64(len(l.chunks[objNr]))
+	}
+	return n
+}
+
+// bitWriter packs unsigned integers into a fixed number of bits each, most significant bit first.
+type bitWriter struct {
+	bytes.Buffer
+	cur  byte
+	nbit uint
+}
+
+func (w *bitWriter) write(v int64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | byte(v>>uint(i)&1)
+		w.nbit++
+		if w.nbit == 8 {
+			w.WriteByte(w.cur)
+			w.cur, w.nbit = 0, 0
+		}
+	}
+}
+
+// align pads the current byte with zero bits.
+func (w *bitWriter) align() {
+	if w.nbit > 0 {
+		w.WriteByte(w.cur << (8 - w.nbit))
+		w.cur, w.nbit = 0, 0
+	}
+}
+
+func nbits(v int64) int {
+	return bits.Len64(uint64(v))
+}
+
+func minMax(vals []int64) (min, max int64) {
+	min, max = vals[0], vals[0]
+	for _, v := range vals {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+// contentStreams returns the offset of the content streams of page i relative to its page object
+// and the length of the range they cover within the page section objs.
+// Content streams outside of the page section are not taken into account.
+func (l *linearizer) contentStreams(i int, objs []int) (offset, length int64) {
+
+	pageNr := l.pages[i]
+
+	dict, ok := l.ctx.Table[pageNr].Object.(PDFDict)
+	if !ok {
+		return 0, 0
+	}
+
+	var refs []PDFIndirectRef
+
+	switch o := dict.Dict["Contents"].(type) {
+
+	case PDFIndirectRef:
+		entry, found := l.ctx.Find(o.ObjectNumber.Value())
+		if !found {
+			break
+		}
+		arr, ok := entry.Object.(PDFArray)
+		if !ok {
+			refs = append(refs, o)
+			break
+		}
+		// An indirect array of content streams.
+		for _, o := range arr {
+			if indRef, ok := o.(PDFIndirectRef); ok {
+				refs = append(refs, indRef)
+			}
+		}
+
+	case PDFArray:
+		for _, o := range o {
+			if indRef, ok := o.(PDFIndirectRef); ok {
+				refs = append(refs, indRef)
+			}
+		}
+
+	}
+
+	section := IntSet{}
+	for _, objNr := range objs {
+		section[objNr] = true
+	}
+
+	start, end := int64(-1), int64(-1)
+
+	for _, indRef := range refs {
+		objNr := indRef.ObjectNumber.Value()
+		if !section[objNr] {
+			continue
+		}
+		off := l.offsets[objNr]
+		if start < 0 || off < start {
+			start = off
+		}
+		if e := off + int64(len(l.chunks[objNr])); e > end {
+			end = e
+		}
+	}
+
+	if start < 0 {
+		return 0, 0
+	}
+
+	return start - l.offsets[pageNr], end - start
+}
+
+// writePageOffsetHintTable writes the page offset hint table.
+func (l *linearizer) writePageOffsetHintTable(w *bitWriter) {
+
+	// => F.4.1 Page Offset Hint Table
+
+	n := len(l.pages)
+	nobjs := make([]int64, n)
+	lengths := make([]int64, n)
+	nshared := make([]int64, n)
+	contentOffsets := make([]int64, n)
+	contentLengths := make([]int64, n)
+
+	nobjs[0], lengths[0] = int64(len(l.part6)), l.length(l.part6)
+	contentOffsets[0], contentLengths[0] = l.contentStreams(0, l.part6)
+	for i := 1; i < n; i++ {
+		nobjs[i], lengths[i] = int64(len(l.part7[i-1])), l.length(l.part7[i-1])
+		nshared[i] = int64(len(l.shared[i]))
+		contentOffsets[i], contentLengths[i] = l.contentStreams(i, l.part7[i-1])
+	}
+
+	minObjs, maxObjs := minMax(nobjs)
+	minLen, maxLen := minMax(lengths)
+	_, maxShared := minMax(nshared)
+	minContentOffset, maxContentOffset := minMax(contentOffsets)
+	minContentLen, maxContentLen := minMax(contentLengths)
+
+	bitsObjs := nbits(maxObjs - minObjs)
+	bitsLen := nbits(maxLen - minLen)
+	bitsShared := nbits(maxShared)
+	bitsID := nbits(int64(len(l.part6) + len(l.part8)))
+	bitsContentOffset := nbits(maxContentOffset - minContentOffset)
+	bitsContentLen := nbits(maxContentLen - minContentLen)
+
+	// Header
+	w.write(minObjs, 32)
+	w.write(l.offsets[l.pages[0]], 32)
+	w.write(int64(bitsObjs), 16)
+	w.write(minLen, 32)
+	w.write(int64(bitsLen), 16)
+	w.write(minContentOffset, 32)
+	w.write(int64(bitsContentOffset), 16)
+	w.write(minContentLen, 32)
+	w.write(int64(bitsContentLen), 16)
+	w.write(int64(bitsShared), 16)
+	w.write(int64(bitsID), 16)
+	w.write(0, 16) // bits for the numerator of the fractional position of shared object references
+	w.write(4, 16) // denominator
+
+	// Each item for all pages starting at a byte boundary.
+	for i := 0; i < n; i++ {
+		w.write(nobjs[i]-minObjs, bitsObjs)
+	}
+	w.align()
+
+	for i := 0; i < n; i++ {
+		w.write(lengths[i]-minLen, bitsLen)
+	}
+	w.align()
+
+	for i := 0; i < n; i++ {
+		w.write(nshared[i], bitsShared)
+	}
+	w.align()
+
+	for i := 0; i < n; i++ {
+		for _, j := range l.shared[i] {
+			w.write(int64(j), bitsID)
+		}
+	}
+	w.align()
+
+	// Content stream offsets
+	for i := 0; i < n; i++ {
+		w.write(contentOffsets[i]-minContentOffset, bitsContentOffset)
+	}
+	w.align()
+
+	// Content stream lengths
+	for i := 0; i < n; i++ {
+		w.write(contentLengths[i]-minContentLen, bitsContentLen)
+	}
+	w.align()
+}
+
+// writeSharedObjectHintTable writes the shared object hint table using one object per group.
+func (l *linearizer) writeSharedObjectHintTable(w *bitWriter) {
+
+	// => F.4.2 Shared Object Hint Table
+
+	objs := append(append([]int{}, l.part6...), l.part8...)
+
+	lengths := make([]int64, len(objs))
+	for i, objNr := range objs {
+		lengths[i] = int64(len(l.chunks[objNr]))
+	}
+
+	minLen, maxLen := minMax(lengths)
+	bitsLen := nbits(maxLen - minLen)
+
+	var firstObjNr, firstOffset int64
+	if len(l.part8) > 0 {
+		firstObjNr = int64(l.part8[0])
+		firstOffset = l.offsets[l.part8[0]]
+	}
+
+	// Header
+	w.write(firstObjNr, 32)
+	w.write(firstOffset, 32)
+	w.write(int64(len(l.part6)), 32)
+	w.write(int64(len(objs)), 32)
+	w.write(0, 16) // bits for the number of objects in a group
+	w.write(minLen, 32)
+	w.write(int64(bitsLen), 16)
+
+	for _, n := range lengths {
+		w.write(n-minLen, bitsLen)
+	}
+	w.align()
+
+	// No MD5 signatures.
+	for range lengths {
+		w.write(0, 1)
+	}
+	w.align()
+}
+
+// hintStream creates the primary hint stream based on the current layout.
+func (l *linearizer) hintStream() (*PDFStreamDict, error) {
+
+	w := &bitWriter{}
+
+	l.writePageOffsetHintTable(w)
+	s := w.Len()
+	l.writeSharedObjectHintTable(w)
+
+	sd := &PDFStreamDict{
+		PDFDict:        NewPDFDict(),
+		Content:        w.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+	sd.Insert("S", PDFInteger(s))
+
+	if err := encodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
+
+func (l *linearizer) linearizationDict(fileSize, hintOffset, hintLength, endOfFirstPage, mainXRef int64) string {
+	return fmt.Sprintf("<</Linearized 1/L %010d/H [%010d %010d]/O %d/E %010d/N %d/T %010d>>",
+		fileSize, hintOffset, hintLength, l.pages[0], endOfFirstPage, len(l.pages), mainXRef)
+}
+
+// writeFirstPageXRefSection writes the first page cross reference section and trailer.
+// The offset of the main cross reference section gets padded in order to keep the length independent of its value.
+func (l *linearizer) writeFirstPageXRefSection(mainXRef int64) error {
+
+	ctx := l.ctx
+	w := ctx.Write
+
+	_, err := w.WriteString("xref" + w.Eol)
+	if err != nil {
+		return err
+	}
+
+	err = writeXRefSubsection(ctx, l.linNr, *ctx.Size-l.linNr)
+	if err != nil {
+		return err
+	}
+
+	s := trailerDict(ctx).PDFString()
+	s = s[:len(s)-2] + fmt.Sprintf("/Prev %010d>>", mainXRef)
+
+	_, err = w.WriteString("trailer" + w.Eol + s + w.Eol + "startxref" + w.Eol + "0" + w.Eol + "%%EOF" + w.Eol)
+
+	return err
+}
+
+// writeMainXRefSection writes the main cross reference section and trailer.
+func (l *linearizer) writeMainXRefSection(firstPageXRef int64) error {
+
+	ctx := l.ctx
+	w := ctx.Write
+
+	_, err := w.WriteString("xref" + w.Eol)
+	if err != nil {
+		return err
+	}
+
+	err = writeXRefSubsection(ctx, 0, l.linNr)
+	if err != nil {
+		return err
+	}
+
+	dict := NewPDFDict()
+	dict.Insert("Size", PDFInteger(l.linNr))
+
+	_, err = w.WriteString(fmt.Sprintf("trailer%s%s%sstartxref%s%d%s", w.Eol, dict.PDFString(), w.Eol, w.Eol, firstPageXRef, w.Eol))
+	if err != nil {
+		return err
+	}
+
+	_, err = writeTrailer(w)
+
+	return err
+}
+
+func (l *linearizer) setWriteOffsets(linOffset int64) {
+	w := l.ctx.Write
+	w.Table = map[int]int64{l.linNr: linOffset}
+	for objNr, off := range l.offsets {
+		w.Table[objNr] = off
+	}
+}
+
+// inlineStreamLengths replaces indirect stream lengths by their values
+// since objects are written one by one without following references.
+func inlineStreamLengths(ctx *PDFContext) {
+	for _, entry := range ctx.Table {
+		sd, ok := entry.Object.(PDFStreamDict)
+		if ok && sd.StreamLength != nil && sd.IndirectRefEntry("Length") != nil {
+			sd.Update("Length", PDFInteger(*sd.StreamLength))
+		}
+	}
+}
+
+// writeLinearized writes a linearized PDF file.
+func writeLinearized(ctx *PDFContext) error {
+
+	log.Debug.Println("writeLinearized begin")
+
+	if ctx.Write.ReducedFeatureSet() {
+		return errors.New("linearization: not supported for split, trim and page extraction")
+	}
+
+	if ctx.lazy != nil {
+		if err := ctx.lazy.loadAll(); err != nil {
+			return err
+		}
+		ctx.lazy = nil
+	}
+
+	err := handleEncryption(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Ensure corresponding and accurate name tree object graphs.
+	err = ctx.BindNameTrees()
+	if err != nil {
+		return err
+	}
+
+	v := V17
+	if ctx.Version() == V20 {
+		v = V20
+	}
+
+	// Ensure there is no root version.
+	if ctx.RootVersion != nil {
+		ctx.RootDict.Delete("Version")
+	}
+
+	err = updateInfoDict(ctx)
+	if err != nil {
+		return err
+	}
+
+	inlineStreamLengths(ctx)
+
+	l := &linearizer{ctx: ctx, nodes: IntSet{}, assigned: IntSet{}, firstPage: IntSet{}, chunks: map[int][]byte{}, offsets: map[int]int64{}}
+
+	if err = l.arrange(); err != nil {
+		return err
+	}
+
+	l.renumber()
+
+	ctx.Write.WriteToObjectStream = false
+
+	for objNr, entry := range ctx.Table {
+		if objNr == 0 || objNr == l.linNr || objNr == l.hintNr || entry.Object == nil {
+			continue
+		}
+		if err = ctx.cancelled(); err != nil {
+			return err
+		}
+		if err = l.serialize(objNr); err != nil {
+			return err
+		}
+	}
+
+	// Sizes of parts 1 to 3 are independent of the values filled in later.
+	header, err := l.capture(0, func() error { return writeHeader(ctx.Write, v) })
+	if err != nil {
+		return err
+	}
+
+	linOffset := int64(len(header))
+
+	linDict, err := l.capture(linOffset, func() error {
+		return writePDFObject(ctx, l.linNr, 0, l.linearizationDict(0, 0, 0, 0, 0))
+	})
+	if err != nil {
+		return err
+	}
+
+	firstPageXRef := linOffset + int64(len(linDict))
+
+	l.setWriteOffsets(linOffset)
+	xRef, err := l.capture(firstPageXRef, func() error { return l.writeFirstPageXRefSection(0) })
+	if err != nil {
+		return err
+	}
+
+	part4 := firstPageXRef + int64(len(xRef))
+
+	// Compute the hint tables as if the hint stream was not present.
+	l.layout(part4)
+
+	sd, err := l.hintStream()
+	if err != nil {
+		return err
+	}
+
+	ctx.Table[l.hintNr].Object = *sd
+	if err = l.serialize(l.hintNr); err != nil {
+		return err
+	}
+
+	mainXRef := l.layout(part4)
+
+	hintOffset := l.offsets[l.hintNr]
+	hintLength := int64(len(l.chunks[l.hintNr]))
+	endOfFirstPage := l.offsets[l.part6[len(l.part6)-1]] + int64(len(l.chunks[l.part6[len(l.part6)-1]]))
+
+	l.setWriteOffsets(linOffset)
+
+	// Fill in the final values.
+	xRef, err = l.capture(firstPageXRef, func() error { return l.writeFirstPageXRefSection(mainXRef) })
+	if err != nil {
+		return err
+	}
+
+	mainXRefBytes, err := l.capture(mainXRef, func() error { return l.writeMainXRefSection(firstPageXRef) })
+	if err != nil {
+		return err
+	}
+
+	fileSize := mainXRef + int64(len(mainXRefBytes))
+
+	// The offset of the white-space character preceding the first entry of the main cross reference section.
+	t := mainXRef + int64(len("xref"+ctx.Write.Eol+fmt.Sprintf("0 %d", l.linNr)+ctx.Write.Eol)) - 1
+
+	linDict, err = l.capture(linOffset, func() error {
+		return writePDFObject(ctx, l.linNr, 0, l.linearizationDict(fileSize, hintOffset, hintLength, endOfFirstPage, t))
+	})
+	if err != nil {
+		return err
+	}
+
+	chunks := [][]byte{header, linDict, xRef}
+	for _, objNr := range l.fileOrder() {
+		chunks = append(chunks, l.chunks[objNr])
+	}
+	chunks = append(chunks, mainXRefBytes)
+
+	w := ctx.Write
+	w.Offset = 0
+
+	for _, b := range chunks {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		w.Offset += int64(n)
+	}
+
+	if w.Offset != fileSize {
+		return errors.Errorf("linearization: wrote %d bytes, expected %d", w.Offset, fileSize)
+	}
+
+	l.setWriteOffsets(linOffset)
+
+	log.Info.Printf("linearization: %d pages, %d objects in first page section\n", len(l.pages), len(l.part6))
+	log.Debug.Println("writeLinearized end")
+
+	return nil
+}
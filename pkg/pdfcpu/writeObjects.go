@@ -54,8 +54,12 @@ func writeTrailer(w *WriteContext) (int, error) {
 	return w.WriteString("%%EOF")
 }
 
+func objectHeader(w *WriteContext, objNumber, genNumber int) string {
+	return fmt.Sprintf("%d %d obj%s", objNumber, genNumber, w.Eol)
+}
+
 func writeObjectHeader(w *WriteContext, objNumber, genNumber int) (int, error) {
-	return w.WriteString(fmt.Sprintf("%d %d obj%s", objNumber, genNumber, w.Eol))
+	return w.WriteString(objectHeader(w, objNumber, genNumber))
 }
 
 func writeObjectTrailer(w *WriteContext) (int, error) {
@@ -290,7 +294,7 @@ func writePDFStringLiteralObject(ctx *PDFContext, objNumber, genNumber int, stri
 
 	sl := stringLiteral
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		s1, err := encryptString(ctx.AES4Strings, stringLiteral.Value(), objNumber, genNumber, ctx.EncKey)
 		if err != nil {
 			return err
@@ -315,7 +319,7 @@ func writePDFHexLiteralObject(ctx *PDFContext, objNumber, genNumber int, hexLite
 
 	hl := hexLiteral
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		s1, err := encryptString(ctx.AES4Strings, hexLiteral.Value(), objNumber, genNumber, ctx.EncKey)
 		if err != nil {
 			return err
@@ -366,7 +370,7 @@ func writePDFDictObject(ctx *PDFContext, objNumber, genNumber int, dict PDFDict)
 		return nil
 	}
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		_, err := encryptDeepObject(dict, objNumber, genNumber, ctx.EncKey, ctx.AES4Strings)
 		if err != nil {
 			return err
@@ -387,7 +391,7 @@ func writePDFArrayObject(ctx *PDFContext, objNumber, genNumber int, array PDFArr
 		return nil
 	}
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		_, err := encryptDeepObject(array, objNumber, genNumber, ctx.EncKey, ctx.AES4Strings)
 		if err != nil {
 			return err
@@ -461,15 +465,20 @@ func writePDFStreamDictObject(ctx *PDFContext, objNumber, genNumber int, streamD
 		}
 	}
 
-	var err error
+	// Crypt filters are meaningless without encryption.
+	if ctx.EncKey == nil {
+		streamDict.removeCryptFilter()
+	}
 
 	// Unless the "Identity" crypt filter is used we have to encrypt.
-	isXRefStreamDict := streamDict.Type() != nil && *streamDict.Type() == "XRef"
-	if ctx.EncKey != nil &&
-		!isXRefStreamDict &&
-		!(len(streamDict.FilterPipeline) == 1 && streamDict.FilterPipeline[0].Name == "Crypt") {
+	encrypted, aes, err := streamEncryption(ctx.XRefTable, &streamDict)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
 
-		streamDict.Raw, err = encryptStream(ctx.AES4Streams, streamDict.Raw, objNumber, genNumber, ctx.EncKey)
+		streamDict.Raw, err = encryptStream(aes, streamDict.Raw, objNumber, genNumber, ctx.EncKey)
 		if err != nil {
 			return err
 		}
@@ -579,7 +588,7 @@ func writeDeepPDFDict(ctx *PDFContext, d PDFDict, objNr, genNr int) error {
 
 func writeDeepPDFStreamDict(ctx *PDFContext, sd *PDFStreamDict, objNr, genNr int) error {
 
-	if ctx.EncKey != nil {
+	if stringsEncrypted(ctx.XRefTable) {
 		_, err := encryptDeepObject(*sd, objNr, genNr, ctx.EncKey, ctx.AES4Strings)
 		if err != nil {
 			return err
@@ -628,6 +637,10 @@ func writeIndirectObject(ctx *PDFContext, indRef PDFIndirectRef) (PDFObject, err
 		return nil, nil
 	}
 
+	if err := ctx.cancelled(); err != nil {
+		return nil, err
+	}
+
 	o, err := ctx.Dereference(indRef)
 	if err != nil {
 		return nil, errors.Wrapf(err, "writeIndirectObject: unable to dereference indirect object #%d", objNumber)
@@ -17,7 +17,9 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
 	"path"
@@ -68,9 +70,17 @@ func NewFreeHeadXRefTableEntry() *XRefTableEntry {
 // Enc wraps around all defined encryption attributes.
 type Enc struct {
 	O, U       []byte
+	OE, UE     []byte   // encrypted file encryption key (R>=5)
+	Perms      []byte   // encrypted permissions (R>=5)
+	PubSec     bool     // public-key security handler
+	Recipients [][]byte // enveloped seed and permissions for each group of recipients (PubSec)
 	L, P, R, V int
 	Emd        bool // encrypt meta data
 	ID         []byte
+
+	// Crypt filters (V>=4)
+	StmF, StrF, EFF string          // crypt filter names for streams, strings and embedded files
+	CF              map[string]bool // crypt filters by name, true for AES
 }
 
 // XRefTable represents a PDF cross reference table plus stats for a PDF file.
@@ -99,10 +109,11 @@ type XRefTable struct {
 	Creator  string
 	Producer string
 
-	// Linearization section (not yet supported)
+	// Linearization section
 	OffsetPrimaryHintTable  *int64
 	OffsetOverflowHintTable *int64
 	LinearizationObjs       IntSet
+	linearization           *linearizationParms // Recorded while reading, see validateLinearization.
 
 	// Offspec section
 	AdditionalStreams *PDFArray // array of PDFIndirectRef - trailer :e.g., Oasis "Open Doc"
@@ -113,23 +124,42 @@ type XRefTable struct {
 	Tagged bool // File is using tags. This is important for ???
 
 	// Validation
-	Valid          bool // true means successful validated against ISO 32000.
-	ValidationMode int  // see Configuration
+	Valid            bool        // true means successful validated against ISO 32000.
+	ValidationMode   int         // see Configuration
+	ValidationTarget *PDFVersion // see Configuration
 
 	Optimized bool
+
+	lazy *lazyLoader // Loads objects on first access, see Configuration.Lazy
+
+	fingerprints map[int]uint64 // Object states recorded by TrackChanges, see DirtyObjects.
+
+	context context.Context // Governs processing, see Configuration.Context
 }
 
 // NewXRefTable creates a new XRefTable.
-func newXRefTable(validationMode int) (xRefTable *XRefTable) {
+func newXRefTable(config *Configuration) (xRefTable *XRefTable) {
 	return &XRefTable{
 		Table:             map[int]*XRefTableEntry{},
 		Names:             map[string]*Node{},
 		LinearizationObjs: IntSet{},
 		Stats:             NewPDFStats(),
-		ValidationMode:    validationMode,
+		ValidationMode:    config.ValidationMode,
+		ValidationTarget:  config.ValidationTarget,
+		context:           config.Context,
 	}
 }
 
+// cancelled returns the error of the context governing processing once it is done.
+func (xRefTable *XRefTable) cancelled() error {
+
+	if xRefTable.context == nil {
+		return nil
+	}
+
+	return xRefTable.context.Err()
+}
+
 // Version returns the PDF version of the PDF writer that created this file.
 // Before V1.4 this is the header version.
 // Since V1.4 the catalog may contain a Version entry which takes precedence over the header version.
@@ -166,14 +196,49 @@ func (xRefTable *XRefTable) ParseRootVersion() (v *string, err error) {
 	return v, nil
 }
 
-// ValidateVersion validates against the xRefTable's version.
+// validationVersion returns the spec version validation is based on.
+// In strict mode this is the validation target if set.
+func (xRefTable *XRefTable) validationVersion() PDFVersion {
+
+	if xRefTable.ValidationMode == ValidationStrict && xRefTable.ValidationTarget != nil {
+		return *xRefTable.ValidationTarget
+	}
+
+	return xRefTable.Version()
+}
+
+// ValidateVersion validates an element introduced in sinceVersion against the xRefTable's version.
+// Strict mode rejects elements of later versions, relaxed mode accepts them.
 func (xRefTable *XRefTable) ValidateVersion(element string, sinceVersion PDFVersion) error {
 
-	if xRefTable.Version() < sinceVersion {
-		return errors.Errorf("%s: unsupported in version %s\n", element, xRefTable.VersionString())
+	v := xRefTable.validationVersion()
+	if v >= sinceVersion {
+		return nil
+	}
+
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		log.Info.Printf("%s: unsupported in version %s\n", element, VersionString(v))
+		return nil
 	}
 
-	return nil
+	return errors.Errorf("%s: unsupported in version %s\n", element, VersionString(v))
+}
+
+// ValidateDeprecated validates an element deprecated since deprecatedVersion.
+// Strict mode rejects deprecated elements, relaxed mode accepts them.
+func (xRefTable *XRefTable) ValidateDeprecated(element string, deprecatedVersion PDFVersion) error {
+
+	v := xRefTable.validationVersion()
+	if v < deprecatedVersion {
+		return nil
+	}
+
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		log.Info.Printf("%s: deprecated in version %s\n", element, VersionString(v))
+		return nil
+	}
+
+	return errors.Errorf("%s: deprecated in version %s\n", element, VersionString(v))
 }
 
 // IsLinearizationObject returns true if object #i is a a linearization object.
@@ -215,9 +280,30 @@ func (xRefTable *XRefTable) Find(objNumber int) (*XRefTableEntry, bool) {
 	return e, true
 }
 
+// ensureLoaded parses the object for objNumber from file unless already in memory.
+// This only applies to lazy reading, see Configuration.Lazy.
+// Lazy loading modifies the xRefTable and must not run concurrently.
+func (xRefTable *XRefTable) ensureLoaded(objNumber int) error {
+
+	if xRefTable.lazy == nil {
+		return nil
+	}
+
+	entry, found := xRefTable.Find(objNumber)
+	if !found {
+		return nil
+	}
+
+	return xRefTable.lazy.load(objNumber, entry)
+}
+
 // FindObject returns the object of the XRefTableEntry for a specific object number.
 func (xRefTable *XRefTable) FindObject(objNumber int) (PDFObject, error) {
 
+	if err := xRefTable.ensureLoaded(objNumber); err != nil {
+		return nil, err
+	}
+
 	entry, ok := xRefTable.Find(objNumber)
 	if !ok {
 		return nil, errors.Errorf("FindObject: obj#%d not registered in xRefTable", objNumber)
@@ -262,6 +348,10 @@ func (xRefTable *XRefTable) FindTableEntryLight(objNumber int) (*XRefTableEntry,
 // FindTableEntry returns the XRefTable entry for given object and generation numbers.
 func (xRefTable *XRefTable) FindTableEntry(objNumber int, generationNumber int) (*XRefTableEntry, bool) {
 	//fmt.Printf("FindTableEntry: obj#:%d gen:%d \n", objNumber, generationNumber)
+	if err := xRefTable.ensureLoaded(objNumber); err != nil {
+		log.Info.Printf("FindTableEntry: %v\n", err)
+		return nil, false
+	}
 	entry, found := xRefTable.Find(objNumber)
 	if found && entry == nil {
 		fmt.Printf("FindTableEntry(%d,%d) finds entry = nil!\n", objNumber, generationNumber)
@@ -515,7 +605,14 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 	// insert remaining free objects into verified linked list
 	// unless they are forever deleted with generation 65535.
 	// In that case they have to point to obj 0.
+	// Process them in order so the resulting list does not depend on map iteration.
+	var keys []int
 	for i := range m {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+
+	for _, i := range keys {
 
 		entry, found := xRefTable.FindTableEntryLight(i)
 		if !found {
@@ -542,6 +639,109 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 	return nil
 }
 
+// fingerprint returns a hash of the state of an xref table entry.
+func fingerprint(entry *XRefTableEntry) uint64 {
+
+	h := fnv.New64a()
+
+	if entry.Free {
+		var next int64
+		if entry.Offset != nil {
+			next = *entry.Offset
+		}
+		fmt.Fprintf(h, "f %d %d", next, *entry.Generation)
+		return h.Sum64()
+	}
+
+	fmt.Fprintf(h, "n %d ", *entry.Generation)
+
+	if entry.Object == nil {
+		h.Write([]byte("null"))
+		return h.Sum64()
+	}
+
+	h.Write([]byte(entry.Object.PDFString()))
+
+	if sd, ok := entry.Object.(PDFStreamDict); ok {
+		h.Write(sd.Raw)
+	}
+
+	return h.Sum64()
+}
+
+// recordFingerprint records the state of an object loaded after TrackChanges (lazy mode only).
+func (xRefTable *XRefTable) recordFingerprint(objNumber int, entry *XRefTableEntry) {
+
+	if fp, found := xRefTable.fingerprints[objNumber]; found && fp == 0 {
+		xRefTable.fingerprints[objNumber] = fingerprint(entry)
+	}
+}
+
+// TrackChanges records the state of all objects in memory.
+// Objects inserted, modified or deleted afterwards are reported by DirtyObjects.
+func (xRefTable *XRefTable) TrackChanges() {
+
+	xRefTable.fingerprints = map[int]uint64{}
+
+	for objNr, entry := range xRefTable.Table {
+
+		// 0 marks objects not loaded yet.
+		var fp uint64
+		if entry.Free || entry.Object != nil {
+			fp = fingerprint(entry)
+		}
+
+		xRefTable.fingerprints[objNr] = fp
+	}
+}
+
+// TracksChanges returns true if TrackChanges has been called.
+func (xRefTable *XRefTable) TracksChanges() bool {
+	return xRefTable.fingerprints != nil
+}
+
+// DirtyObjects returns the sorted numbers of all objects inserted, modified or deleted since TrackChanges.
+func (xRefTable *XRefTable) DirtyObjects() ([]int, error) {
+
+	if !xRefTable.TracksChanges() {
+		return nil, errors.New("DirtyObjects: changes are not being tracked")
+	}
+
+	var objNrs []int
+
+	for objNr, entry := range xRefTable.Table {
+
+		fp, found := xRefTable.fingerprints[objNr]
+		if !found {
+			objNrs = append(objNrs, objNr)
+			continue
+		}
+
+		if fp == 0 {
+			// Never loaded, so only a deletion or replacement may have happened.
+			if entry.Free || entry.Object != nil {
+				objNrs = append(objNrs, objNr)
+			}
+			continue
+		}
+
+		// Reload evicted stream content in lazy mode.
+		if err := xRefTable.ensureLoaded(objNr); err != nil {
+			return nil, err
+		}
+
+		if fingerprint(entry) != fp {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+
+	sort.Ints(objNrs)
+
+	log.Debug.Printf("DirtyObjects: %v\n", objNrs)
+
+	return objNrs, nil
+}
+
 func (xRefTable *XRefTable) deleteObject(obj PDFObject) error {
 
 	indRef, ok := obj.(PDFIndirectRef)
@@ -702,6 +902,10 @@ func (xRefTable *XRefTable) indRefToObject(indObjRef *PDFIndirectRef) (PDFObject
 
 	generationNumber := indObjRef.GenerationNumber.Value()
 
+	if err := xRefTable.ensureLoaded(objectNumber); err != nil {
+		return nil, err
+	}
+
 	entry, found := xRefTable.FindTableEntry(objectNumber, generationNumber)
 	if !found {
 		return nil, nil
@@ -1609,3 +1813,79 @@ func (xRefTable *XRefTable) PageDict(page int) (*PDFDict, *InheritedPageAttrs, e
 
 	return pageDict, inhPAttrs, nil
 }
+
+func (xRefTable *XRefTable) pageIndRef(root PDFIndirectRef, p *int, page int) (*PDFIndirectRef, error) {
+
+	dict, err := xRefTable.DereferenceDict(root)
+	if err != nil || dict == nil {
+		return nil, err
+	}
+
+	kids := dict.PDFArrayEntry("Kids")
+	if kids == nil {
+		return nil, nil
+	}
+
+	for _, obj := range *kids {
+
+		indRef, ok := obj.(PDFIndirectRef)
+		if !ok {
+			continue
+		}
+
+		pageNodeDict, err := xRefTable.DereferenceDict(indRef)
+		if err != nil {
+			return nil, err
+		}
+
+		if pageNodeDict == nil || pageNodeDict.Type() == nil {
+			continue
+		}
+
+		switch *pageNodeDict.Type() {
+
+		case "Pages":
+			pageCount := pageNodeDict.IntEntry("Count")
+			if pageCount != nil && *p+*pageCount < page {
+				// Skip sub pagetree.
+				*p += *pageCount
+				continue
+			}
+			ir, err := xRefTable.pageIndRef(indRef, p, page)
+			if err != nil || ir != nil {
+				return ir, err
+			}
+
+		case "Page":
+			*p++
+			if *p == page {
+				return &indRef, nil
+			}
+
+		}
+	}
+
+	return nil, nil
+}
+
+// PageDictIndRef returns the indirect reference of a specific page dict.
+func (xRefTable *XRefTable) PageDictIndRef(page int) (*PDFIndirectRef, error) {
+
+	root, err := xRefTable.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	pageCount := 0
+
+	indRef, err := xRefTable.pageIndRef(*root, &pageCount, page)
+	if err != nil {
+		return nil, err
+	}
+
+	if indRef == nil {
+		return nil, errors.Errorf("PageDictIndRef: page %d not found", page)
+	}
+
+	return indRef, nil
+}